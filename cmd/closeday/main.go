@@ -0,0 +1,50 @@
+// Command closeday closes the books of a business day: it writes every wallet's
+// closing balance and the debits and credits posted to each type of ledger account
+// over the day. Closing a day again overwrites what was written the first time with
+// the same figures. It exits with status 2 when the day could not be closed, which
+// includes while another instance is closing it
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/settlement"
+	"github.com/ageeknamedslickback/wallet-API/wallet/presentation"
+)
+
+func main() {
+	day := flag.String("day", "", "the day to close as YYYY-MM-DD, yesterday in EOD_TIMEZONE by default")
+	chunkSize := flag.Int("chunk-size", 0, "how many closing balances to write at a time, EOD_CHUNK_SIZE by default")
+	flag.Parse()
+
+	closer := presentation.Closer(
+		presentation.Connect(),
+		slog.New(slog.NewTextHandler(os.Stderr, nil)),
+	)
+	if *chunkSize > 0 {
+		closer.ChunkSize = *chunkSize
+	}
+	if *day == "" {
+		*day = settlement.Day(time.Now().In(closer.Location).AddDate(0, 0, -1), closer.Location)
+	}
+
+	dayClose, err := closer.CloseDay(context.Background(), *day)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error closing %s: %v\n", *day, err)
+		os.Exit(2)
+	}
+
+	fmt.Fprintf(
+		os.Stderr,
+		"%s closed in %s: %d wallets with a closing balance of %s\n",
+		dayClose.Day,
+		dayClose.Currency,
+		dayClose.Wallets,
+		dayClose.ClosingBalance,
+	)
+}
@@ -0,0 +1,79 @@
+// Command rebuildbalance replays a wallet's event stream to recompute its balance
+// at any point in time. The events are replayed from the first one and the result
+// is checked against the replay from the latest snapshot taken by then. It exits
+// with status 1 when the two disagree and 2 when the balance could not be rebuilt
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/database"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/audit"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/cache"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/eventstore"
+)
+
+func main() {
+	walletID := flag.Int("wallet", 0, "the ID of the wallet whose balance to rebuild")
+	at := flag.String("at", "", "the RFC 3339 time to rebuild the balance at, now by default")
+	flag.Parse()
+
+	if *walletID <= 0 {
+		fmt.Fprintln(os.Stderr, "a wallet ID has to be passed with -wallet")
+		os.Exit(2)
+	}
+	asOf := time.Now()
+	if *at != "" {
+		t, err := time.Parse(time.RFC3339, *at)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -at: %v\n", err)
+			os.Exit(2)
+		}
+		asOf = t
+	}
+
+	gormDb, err := database.ConnectToDatabase()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error connecting to the database: %v\n", err)
+		os.Exit(2)
+	}
+	// the replay reads the event streams only, the cache is never consulted
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	noCache := cache.NewLocalCache(
+		nil,
+		nil,
+		cache.LocalCacheOptions{MaxEntries: 1, TTL: time.Second},
+		logger,
+	)
+	// nothing is appended to the audit log by a replay, so the store is not keyed
+	store := database.NewEventStore(gormDb, noCache, audit.Key{}, eventstore.DefaultSnapshotEvery, logger)
+
+	ctx := context.Background()
+	replayed, err := store.BalanceAt(ctx, *walletID, asOf, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error replaying wallet %d's events: %v\n", *walletID, err)
+		os.Exit(2)
+	}
+	fromSnapshot, err := store.BalanceAt(ctx, *walletID, asOf, true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error replaying wallet %d's events from its snapshot: %v\n", *walletID, err)
+		os.Exit(2)
+	}
+
+	fmt.Printf(
+		"wallet %d's balance at %s is %s (version %d)\n",
+		*walletID, asOf.Format(time.RFC3339), replayed.Balance, replayed.Version,
+	)
+	if !replayed.Balance.Equal(fromSnapshot.Balance) || replayed.Version != fromSnapshot.Version {
+		fmt.Printf(
+			"the latest snapshot disagrees: %s (version %d)\n",
+			fromSnapshot.Balance, fromSnapshot.Version,
+		)
+		os.Exit(1)
+	}
+}
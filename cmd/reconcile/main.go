@@ -0,0 +1,69 @@
+// Command reconcile checks that every wallet's balance is the sum of its ledger
+// postings and that the cache agrees with the database, writing the discrepancies
+// found as JSON lines or CSV. It exits with status 1 when discrepancies are found
+// and 2 when the wallets could not be reconciled
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/reconcile"
+	"github.com/ageeknamedslickback/wallet-API/wallet/presentation"
+)
+
+func main() {
+	format := flag.String("format", reconcile.FormatJSON, "the report format, json or csv")
+	out := flag.String("out", "", "the file to write the report to, stdout by default")
+	chunkSize := flag.Int("chunk-size", 0, "how many wallets to reconcile at a time, RECONCILE_CHUNK_SIZE by default")
+	repairCache := flag.Bool("repair-cache", false, "evict the wallets whose cached balance is wrong from the cache")
+	flag.Parse()
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error creating the report: %v\n", err)
+			os.Exit(2)
+		}
+		defer f.Close()
+		w = f
+	}
+	report, err := reconcile.NewReport(*format, w)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	reconciler := presentation.Reconciler(
+		presentation.Connect(),
+		slog.New(slog.NewTextHandler(os.Stderr, nil)),
+	)
+	if *chunkSize > 0 {
+		reconciler.ChunkSize = *chunkSize
+	}
+	reconciler.RepairCache = reconciler.RepairCache || *repairCache
+
+	summary, err := reconciler.Reconcile(context.Background(), report)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reconciling after %d wallets: %v\n", summary.Wallets, err)
+		os.Exit(2)
+	}
+
+	fmt.Fprintf(
+		os.Stderr,
+		"%d wallets reconciled: %d ledger and %d cache discrepancies, %d cached balances repaired\n",
+		summary.Wallets,
+		summary.Discrepancies[reconcile.LedgerMismatch],
+		summary.Discrepancies[reconcile.CacheMismatch],
+		summary.Repaired,
+	)
+	if summary.Found() > 0 {
+		// os.Exit skips the deferred close, the report has been flushed already
+		os.Exit(1)
+	}
+}
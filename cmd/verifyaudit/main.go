@@ -0,0 +1,48 @@
+// Command verifyaudit walks the audit log's hash chain and reports the first
+// broken link. It exits with status 1 when the audit log has been tampered with
+// and 2 when it could not be verified. It must be run with the same
+// AUDIT_HMAC_KEY and AUDIT_HMAC_FROM as the API
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/database"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/audit"
+)
+
+func main() {
+	pageSize := flag.Int("page-size", audit.DefaultPageSize, "how many records to read at a time")
+	flag.Parse()
+
+	gormDb, err := database.ConnectToDatabase()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error connecting to the database: %v\n", err)
+		os.Exit(2)
+	}
+
+	// the key is the one the API seals the audit log with
+	key, err := audit.KeyFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading the audit log's key: %v\n", err)
+		os.Exit(2)
+	}
+	if len(key.Secret) == 0 {
+		fmt.Fprintln(os.Stderr, "warning: AUDIT_HMAC_KEY is not set, a rewritten audit log can not be told apart from an intact one")
+	}
+
+	broken, verified, err := audit.Verify(context.Background(), database.NewAuditLog(gormDb, key), *pageSize, key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error verifying the audit log after %d records: %v\n", verified, err)
+		os.Exit(2)
+	}
+	if broken != nil {
+		fmt.Printf("audit log is broken: %s (%d records verified before it)\n", broken, verified)
+		os.Exit(1)
+	}
+
+	fmt.Printf("audit log is intact: %d records verified\n", verified)
+}
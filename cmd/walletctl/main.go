@@ -0,0 +1,220 @@
+// Command walletctl performs the operators' actions on wallets: opening them, showing
+// their balance, listing their transactions, freezing and unfreezing them, adjusting
+// their balance by hand and seeding test data. Results are written to stdout as JSON
+// and failures to stderr as JSON, exiting with status 1, or 2 when it is misused.
+// Every change is recorded in the audit log under the operator running it. The
+// operator is self-declared, -operator or $USER, and is not verified: the audit log
+// can only tell which operator ran a command as far as access to the database's
+// credentials is limited to the operators themselves
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/audit"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/statement"
+	"github.com/ageeknamedslickback/wallet-API/wallet/presentation"
+	"github.com/shopspring/decimal"
+)
+
+const usage = `usage: walletctl [-operator name] <command> [flags]
+
+commands:
+  create        open a wallet, optionally putting money in it
+  balance       show a wallet's balance and whether it is frozen
+  transactions  list a wallet's transactions as a statement
+  freeze        stop the players from crediting or debiting a wallet
+  unfreeze      let the players credit and debit a wallet again
+  adjust        put money in or take it out of a wallet, with a reason
+  seed          open wallets as test data
+
+Run walletctl <command> -h for the flags of a command
+`
+
+func main() {
+	operator := flag.String("operator", os.Getenv("USER"), "who is running the command, recorded unverified in the audit log")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	commands := map[string]func(ctx context.Context, args []string) (interface{}, error){
+		"create":       create,
+		"balance":      balance,
+		"transactions": transactions,
+		"freeze":       freeze(true),
+		"unfreeze":     freeze(false),
+		"adjust":       adjust,
+		"seed":         seed,
+	}
+	command, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := audit.WithActor(context.Background(), audit.Actor{Subject: "walletctl:" + *operator})
+	result, err := command(ctx, flag.Args()[1:])
+	if err != nil {
+		fail(err)
+	}
+	if result != nil {
+		_ = json.NewEncoder(os.Stdout).Encode(result)
+	}
+}
+
+// fail writes an error as JSON, classified the way the APIs classify it, and exits
+func fail(err error) {
+	_ = json.NewEncoder(os.Stderr).Encode(map[string]string{
+		"code":   domain.ErrorCode(err),
+		"detail": domain.ErrorDetail(err),
+		"error":  err.Error(),
+	})
+	os.Exit(1)
+}
+
+func logger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, nil))
+}
+
+// parse parses a command's flags, exiting when they can not be parsed
+func parse(fs *flag.FlagSet, args []string) {
+	if err := fs.Parse(args); err != nil {
+		os.Exit(2)
+	}
+}
+
+// parseAmount parses a decimal flag, exiting when it is not a number
+func parseAmount(name string, value string) decimal.Decimal {
+	amount, err := decimal.NewFromString(value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -%s %q: must be a number\n", name, value)
+		os.Exit(2)
+	}
+	return amount
+}
+
+func create(ctx context.Context, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("create", flag.ExitOnError)
+	opening := fs.String("balance", "0", "the money to put in the wallet, posted as an adjustment")
+	reason := fs.String("reason", "", "why the wallet is opened, required with a balance")
+	parse(fs, args)
+
+	wallet, err := presentation.AdminUsecases(presentation.Connect(), logger()).
+		CreateWallet(ctx, parseAmount("balance", *opening), *reason)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{"wallet": wallet}, nil
+}
+
+func balance(ctx context.Context, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("balance", flag.ExitOnError)
+	walletID := fs.Int("wallet", 0, "the wallet's ID")
+	parse(fs, args)
+
+	wallet, err := presentation.AdminUsecases(presentation.Connect(), logger()).Wallet(ctx, *walletID)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{"wallet": wallet}, nil
+}
+
+// transactions writes the wallet's statement itself rather than returning a result
+func transactions(ctx context.Context, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("transactions", flag.ExitOnError)
+	walletID := fs.Int("wallet", 0, "the wallet's ID")
+	from := fs.String("from", "", "the RFC 3339 moment the transactions are listed from, inclusive")
+	to := fs.String("to", "", "the RFC 3339 moment the transactions are listed to, exclusive, now by default")
+	format := fs.String("format", statement.FormatJSON, "the statement format, json, csv or ofx")
+	parse(fs, args)
+
+	start, err := time.Parse(time.RFC3339Nano, *from)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -from %q: must be an RFC 3339 timestamp\n", *from)
+		os.Exit(2)
+	}
+	end := time.Now()
+	if *to != "" {
+		if end, err = time.Parse(time.RFC3339Nano, *to); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -to %q: must be an RFC 3339 timestamp\n", *to)
+			os.Exit(2)
+		}
+	}
+	w, err := statement.NewWriter(*format, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	uc := presentation.StatementUsecases(presentation.Connect(), logger())
+	return nil, uc.Statement(ctx, *walletID, start, end, w)
+}
+
+func freeze(frozen bool) func(ctx context.Context, args []string) (interface{}, error) {
+	return func(ctx context.Context, args []string) (interface{}, error) {
+		name, state := "unfreeze", "unfrozen"
+		if frozen {
+			name, state = "freeze", "frozen"
+		}
+		fs := flag.NewFlagSet(name, flag.ExitOnError)
+		walletID := fs.Int("wallet", 0, "the wallet's ID")
+		reason := fs.String("reason", "", "why the wallet is "+state)
+		parse(fs, args)
+
+		uc := presentation.AdminUsecases(presentation.Connect(), logger())
+		setFrozen := uc.UnfreezeWallet
+		if frozen {
+			setFrozen = uc.FreezeWallet
+		}
+		wallet, err := setFrozen(ctx, *walletID, *reason)
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]interface{}{"wallet": wallet}, nil
+	}
+}
+
+func adjust(ctx context.Context, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("adjust", flag.ExitOnError)
+	walletID := fs.Int("wallet", 0, "the wallet's ID")
+	amount := fs.String("amount", "", "the money to put in the wallet, negative to take it out")
+	reason := fs.String("reason", "", "why the balance is adjusted, required")
+	parse(fs, args)
+
+	adjustment, err := presentation.AdminUsecases(presentation.Connect(), logger()).
+		AdjustWallet(ctx, *walletID, parseAmount("amount", *amount), *reason)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{"adjustment": adjustment}, nil
+}
+
+func seed(ctx context.Context, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	count := fs.Int("count", 10, "how many wallets to open")
+	opening := fs.String("balance", "100", "the money to put in each wallet")
+	parse(fs, args)
+
+	wallets, err := presentation.AdminUsecases(presentation.Connect(), logger()).
+		SeedWallets(ctx, *count, parseAmount("balance", *opening))
+	if err != nil {
+		return nil, fmt.Errorf("%d wallets seeded: %w", len(wallets), err)
+	}
+
+	return map[string]interface{}{"wallets": wallets}, nil
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -15,7 +17,56 @@ import (
 )
 
 func main() {
-	router := presentation.Router()
+	logger := presentation.Logger()
+	slog.SetDefault(logger)
+	shutdownTracing := presentation.Tracing()
+
+	deps := presentation.Connect()
+	uc := presentation.Usecases(deps, logger)
+	checker := presentation.Readiness(deps)
+	router := presentation.NewRouter(
+		uc,
+		presentation.WebhookUsecases(deps),
+		presentation.SettlementUsecases(deps),
+		presentation.StatementUsecases(deps, logger),
+		checker,
+		logger,
+	)
+	grpcServer := presentation.GrpcServer(uc, logger)
+
+	// The outbox relay, the webhook dispatcher, the scheduled reconciliation and the
+	// closing of the books run until the server shuts down
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	if relay := presentation.OutboxRelay(deps, logger); relay != nil {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			relay.Run(workersCtx)
+		}()
+	}
+	dispatcher := presentation.WebhookDispatcher(deps, logger)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		dispatcher.Run(workersCtx)
+	}()
+	if interval := presentation.ReconcileInterval(); interval > 0 {
+		reconciler := presentation.Reconciler(deps, logger)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			reconciler.Run(workersCtx, interval)
+		}()
+	}
+	if interval, grace := presentation.CloseInterval(); interval > 0 {
+		closer := presentation.Closer(deps, logger)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			closer.Run(workersCtx, interval, grace)
+		}()
+	}
 
 	port := os.Getenv("PORT")
 	srv := &http.Server{
@@ -28,7 +79,19 @@ func main() {
 	go func() {
 		if err := srv.ListenAndServe(); err != nil &&
 			errors.Is(err, http.ErrServerClosed) {
-			log.Printf("listen: %s\n", err)
+			logger.Error("listen", slog.String("error", err.Error()))
+		}
+	}()
+
+	// The gRPC API is served on its own port alongside the JSON API
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", os.Getenv("GRPC_PORT")))
+	if err != nil {
+		logger.Error("failed to listen for gRPC", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	go func() {
+		if err := grpcServer.Serve(lis); err != nil {
+			logger.Error("grpc listen", slog.String("error", err.Error()))
 		}
 	}()
 
@@ -40,16 +103,58 @@ func main() {
 	// kill -9 is syscall.SIGKILL but can't be caught, so don't need to add it
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	log.Println("Shutting down server...")
+
+	// Fail readiness first and keep serving for the drain period so that
+	// load balancers stop routing new requests here before the server stops
+	checker.Drain()
+	drainPeriod := presentation.DrainPeriod()
+	logger.Info("draining server", slog.Duration("drain_period", drainPeriod))
+	time.Sleep(drainPeriod)
+
+	logger.Info("shutting down server")
 
 	// The context is used to inform the server it has 5 seconds to finish
 	// the request it is currently handling
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	// GracefulStop waits for in flight calls, including balance streams,
+	// so the gRPC server is stopped forcefully once the timeout is up
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown:", err)
+		grpcServer.Stop()
+		logger.Error("server forced to shutdown", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	select {
+	case <-grpcStopped:
+	case <-ctx.Done():
+		grpcServer.Stop()
+		logger.Warn("gRPC server forced to shutdown")
+	}
+
+	// an event or delivery in flight when the workers stop is sent again on restart
+	stopWorkers()
+	workersStopped := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(workersStopped)
+	}()
+	select {
+	case <-workersStopped:
+	case <-ctx.Done():
+		logger.Warn("background workers did not stop in time")
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("failed to flush spans", slog.String("error", err.Error()))
 	}
 
-	log.Println("Server exiting")
+	logger.Info("server exiting")
 }
@@ -1,12 +1,287 @@
 package domain
 
 import (
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/shopspring/decimal"
 )
 
 // Wallet represents a digital wallet that manages
-// debit and credit transaction for online casino game players
+// debit and credit transaction for online casino game players.
+// A frozen wallet can not be credited nor debited by the players
 type Wallet struct {
 	ID      int             `json:"id" gorm:"primarykey"`
 	Balance decimal.Decimal `json:"balance"`
+	Frozen  bool            `json:"frozen,omitempty" gorm:"not null;default:false"`
+	// CreatedAt is unknown for the wallets opened before it was recorded
+	CreatedAt *time.Time `json:"-" gorm:"index"`
+}
+
+// Batch is a processed batch of credits/debits. It is kept so that
+// retrying a batch with the same idempotency key does not apply it twice
+type Batch struct {
+	IdempotencyKey string    `json:"idempotency_key" gorm:"primarykey;size:191"`
+	RequestHash    string    `json:"request_hash" gorm:"size:64"`
+	Result         []byte    `json:"result"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// AuditRecord is an entry of the append-only audit log. Every record is chained
+// to the previous one by its hash so that altering or deleting one is detectable
+type AuditRecord struct {
+	Seq       uint64    `json:"seq" gorm:"primarykey;autoIncrement:false"`
+	Actor     string    `json:"actor" gorm:"size:191"`
+	IP        string    `json:"ip" gorm:"size:64"`
+	Action    string    `json:"action" gorm:"size:64"`
+	WalletID  int       `json:"wallet_id" gorm:"index"`
+	Details   []byte    `json:"details"`
+	CreatedAt time.Time `json:"created_at"`
+	PrevHash  string    `json:"prev_hash" gorm:"size:64"`
+	Hash      string    `json:"hash" gorm:"size:64"`
+}
+
+// AuditHead is the latest link of the audit log's hash chain. Its row is locked
+// while a record is appended so that records are chained one at a time
+type AuditHead struct {
+	ID   int    `gorm:"primarykey;autoIncrement:false"`
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash" gorm:"size:64"`
+}
+
+// OutboxEvent is a domain event waiting in the outbox to be published. It is
+// written in the same transaction as the change it describes. An event is leased
+// to the relay publishing it, or held back after failing, until ClaimedUntil
+type OutboxEvent struct {
+	ID           uint64     `json:"id" gorm:"primarykey"`
+	EventID      string     `json:"event_id" gorm:"size:32;uniqueIndex"`
+	Type         string     `json:"type" gorm:"size:64"`
+	WalletID     int        `json:"wallet_id" gorm:"index"`
+	Payload      []byte     `json:"payload"`
+	CreatedAt    time.Time  `json:"created_at"`
+	PublishedAt  *time.Time `json:"published_at" gorm:"index"`
+	ClaimedUntil *time.Time `json:"claimed_until,omitempty"`
+}
+
+// Types of the domain events published when a wallet changes
+const (
+	EventWalletCredited = "WalletCredited"
+	EventWalletDebited  = "WalletDebited"
+	EventWalletFrozen   = "WalletFrozen"
+	EventWalletUnfrozen = "WalletUnfrozen"
+)
+
+// EventTypes are all the domain event types, in the order they are documented
+var EventTypes = []string{EventWalletCredited, EventWalletDebited, EventWalletFrozen, EventWalletUnfrozen}
+
+// Admin actions recorded in the audit log alongside the money movements
+const (
+	ActionWalletCreated   = "admin.wallet_created"
+	ActionWalletFrozen    = "admin.wallet_frozen"
+	ActionWalletUnfrozen  = "admin.wallet_unfrozen"
+	ActionBalanceAdjusted = "admin.balance_adjusted"
+)
+
+// EventWalletOpened is the first event of a wallet's event stream, carrying the
+// balance the wallet had before its changes were event sourced
+const EventWalletOpened = "WalletOpened"
+
+// WalletEvent is an entry of a wallet's append-only event stream. A wallet's
+// balance is the sum of the amounts of its events, credits being negative
+type WalletEvent struct {
+	ID        uint64          `json:"id" gorm:"primarykey"`
+	WalletID  int             `json:"wallet_id" gorm:"uniqueIndex:idx_wallet_version"`
+	Version   uint64          `json:"version" gorm:"uniqueIndex:idx_wallet_version"`
+	Type      string          `json:"type" gorm:"size:64"`
+	Amount    decimal.Decimal `json:"amount"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// WalletSnapshot is a wallet's balance as of a version of its event stream, so
+// that reads only replay the events appended after it
+type WalletSnapshot struct {
+	WalletID  int             `json:"wallet_id" gorm:"primarykey;autoIncrement:false"`
+	Version   uint64          `json:"version" gorm:"primarykey;autoIncrement:false"`
+	Balance   decimal.Decimal `json:"balance"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// BalanceEntry is a wallet's balance from the moment it was changed until its next
+// change. Entries are indexed by wallet and time so a balance can be looked up as of any moment
+type BalanceEntry struct {
+	ID        uint64          `json:"id" gorm:"primarykey"`
+	WalletID  int             `json:"wallet_id" gorm:"index:idx_wallet_history,priority:1"`
+	Previous  decimal.Decimal `json:"previous"`
+	Balance   decimal.Decimal `json:"balance"`
+	CreatedAt time.Time       `json:"created_at" gorm:"index:idx_wallet_history,priority:2"`
+}
+
+// The ledger accounts money moves between besides the players' wallets
+const (
+	AccountHouse              = "house"
+	AccountProviderSettlement = "provider_settlement"
+	AccountBonusPool          = "bonus_pool"
+	// AccountAdjustments is where the operators' manual adjustments of balances come from and go to
+	AccountAdjustments = "adjustments"
+	// AccountOpeningBalances is the equity the balances wallets held before the ledger
+	// was introduced are posted against
+	AccountOpeningBalances = "opening_balances"
+)
+
+// Accounts are all the ledger accounts that are not a player's wallet
+var Accounts = []string{
+	AccountHouse,
+	AccountProviderSettlement,
+	AccountBonusPool,
+	AccountAdjustments,
+	AccountOpeningBalances,
+}
+
+// WalletAccountPrefix prefixes the ledger account of every wallet
+const WalletAccountPrefix = "wallet:"
+
+// WalletAccount is the ledger account of a player's wallet
+func WalletAccount(walletID int) string {
+	return WalletAccountPrefix + strconv.Itoa(walletID)
+}
+
+// IsAccount reports whether the account is a wallet's or one of the other ledger accounts
+func IsAccount(account string) bool {
+	if strings.HasPrefix(account, WalletAccountPrefix) {
+		walletID, err := strconv.Atoi(strings.TrimPrefix(account, WalletAccountPrefix))
+		return err == nil && walletID > 0
+	}
+	for _, a := range Accounts {
+		if a == account {
+			return true
+		}
+	}
+	return false
+}
+
+// AccountTypeWallet is the type of the players' wallets' ledger accounts. The
+// other ledger accounts are their own type
+const AccountTypeWallet = "wallet"
+
+// AccountType is the type of a ledger account, the wallet type for every player's wallet
+func AccountType(account string) string {
+	if strings.HasPrefix(account, WalletAccountPrefix) {
+		return AccountTypeWallet
+	}
+	return account
+}
+
+// Posting is one side of a ledger transaction. Positive amounts debit the account,
+// putting money in it, and negative amounts credit it, taking money out of it
+type Posting struct {
+	ID            uint64          `json:"id" gorm:"primarykey"`
+	TransactionID string          `json:"transaction_id" gorm:"size:32;index"`
+	Account       string          `json:"account" gorm:"size:64;index:idx_account_postings,priority:1"`
+	Amount        decimal.Decimal `json:"amount"`
+	CreatedAt     time.Time       `json:"created_at" gorm:"index:idx_account_postings,priority:2;index"`
+}
+
+// LedgerTransaction is a movement of money between ledger accounts. Money is only
+// ever moved, never made or lost, so the amounts of its postings sum to zero
+type LedgerTransaction struct {
+	ID       string
+	Postings []Posting
+}
+
+// Change is how much the transaction changes the account's balance by, the sum of
+// its postings on the account
+func (t *LedgerTransaction) Change(account string) decimal.Decimal {
+	change := decimal.Zero
+	for _, posting := range t.Postings {
+		if posting.Account == account {
+			change = change.Add(posting.Amount)
+		}
+	}
+	return change
+}
+
+// Migration is a one-time data migration that has been applied to the database
+type Migration struct {
+	Name      string    `json:"name" gorm:"primarykey;size:191"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// ClosingBalance is a wallet's balance at the close of a business day. Days are
+// written as YYYY-MM-DD in the time zone the books are closed in. The closing
+// balances of a day are those written by the close its DayClose points at
+type ClosingBalance struct {
+	Day      string          `json:"day" gorm:"primarykey;size:10"`
+	Currency string          `json:"currency" gorm:"primarykey;size:3"`
+	CloseID  string          `json:"-" gorm:"primarykey;size:32"`
+	WalletID int             `json:"wallet_id" gorm:"primarykey;autoIncrement:false"`
+	Balance  decimal.Decimal `json:"balance"`
+}
+
+// SettlementTotal is the money posted to a type of ledger account over a business day.
+// Debits put money in the accounts and credits take it out of them
+type SettlementTotal struct {
+	Day         string          `json:"day" gorm:"primarykey;size:10"`
+	Currency    string          `json:"currency" gorm:"primarykey;size:3"`
+	AccountType string          `json:"account_type" gorm:"primarykey;size:64"`
+	Debits      decimal.Decimal `json:"debits"`
+	Credits     decimal.Decimal `json:"credits"`
+	Postings    int64           `json:"postings"`
+}
+
+// DayClose is a closed business day. It is written once the day's closing
+// balances and settlement totals have all been written, and points at the
+// close that wrote them
+type DayClose struct {
+	Day            string          `json:"day" gorm:"primarykey;size:10"`
+	Currency       string          `json:"currency" gorm:"primarykey;size:3"`
+	CloseID        string          `json:"-" gorm:"size:32"`
+	Wallets        int             `json:"wallets"`
+	ClosingBalance decimal.Decimal `json:"closing_balance"`
+	ClosedAt       time.Time       `json:"closed_at"`
+}
+
+// WebhookSubscription is a partner's URL that is notified of the selected
+// event types. Deliveries are signed with the subscription's secret
+type WebhookSubscription struct {
+	ID         uint64    `json:"id" gorm:"primarykey"`
+	URL        string    `json:"url" gorm:"size:2048"`
+	EventTypes string    `json:"-" gorm:"size:255"`
+	Secret     string    `json:"-" gorm:"size:255"`
+	CreatedBy  string    `json:"created_by" gorm:"size:191"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Subscribes reports whether the subscription is notified of the event type
+func (s WebhookSubscription) Subscribes(eventType string) bool {
+	for _, subscribed := range strings.Split(s.EventTypes, ",") {
+		if subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Statuses of a webhook delivery
+const (
+	DeliveryPending      = "pending"
+	DeliveryDelivered    = "delivered"
+	DeliveryDeadLettered = "dead_lettered"
+)
+
+// WebhookDelivery is an event being delivered to a webhook subscription
+type WebhookDelivery struct {
+	ID             uint64     `json:"id" gorm:"primarykey"`
+	SubscriptionID uint64     `json:"subscription_id" gorm:"uniqueIndex:idx_delivery_event"`
+	EventID        string     `json:"event_id" gorm:"size:32;uniqueIndex:idx_delivery_event"`
+	EventType      string     `json:"event_type" gorm:"size:64"`
+	Payload        []byte     `json:"-"`
+	Status         string     `json:"status" gorm:"size:16;index:idx_delivery_due"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"index:idx_delivery_due"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty" gorm:"size:1024"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
 }
@@ -0,0 +1,93 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of failures a client can tell apart. Errors are matched
+// against them with errors.Is however deeply they have been wrapped
+var (
+	ErrNotFound          = errors.New("not found")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrFrozen            = errors.New("wallet is frozen")
+	ErrConflict          = errors.New("conflict")
+	ErrValidation        = errors.New("validation failed")
+	ErrUnavailable       = errors.New("service unavailable")
+)
+
+// Error is a classified failure. Its detail is safe to be shown to clients
+// while the underlying cause is kept for logs only
+type Error struct {
+	Kind   error
+	Detail string
+	Err    error
+}
+
+// NewError classifies a failure as one of the error kinds
+func NewError(kind error, detail string, cause error) *Error {
+	return &Error{
+		Kind:   kind,
+		Detail: detail,
+		Err:    cause,
+	}
+}
+
+// Error is a string representation of an error interface
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Detail, e.Err)
+	}
+	return e.Detail
+}
+
+// Is reports whether the error is of the target kind
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
+
+// Unwrap returns the underlying cause
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Stable machine readable error codes
+const (
+	CodeNotFound          = "not_found"
+	CodeInsufficientFunds = "insufficient_funds"
+	CodeFrozen            = "wallet_frozen"
+	CodeConflict          = "conflict"
+	CodeValidation        = "validation_failed"
+	CodeUnavailable       = "service_unavailable"
+	CodeInternal          = "internal_error"
+)
+
+// ErrorCode returns the stable machine readable code of an error's kind
+func ErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return CodeNotFound
+	case errors.Is(err, ErrInsufficientFunds):
+		return CodeInsufficientFunds
+	case errors.Is(err, ErrFrozen):
+		return CodeFrozen
+	case errors.Is(err, ErrConflict):
+		return CodeConflict
+	case errors.Is(err, ErrValidation):
+		return CodeValidation
+	case errors.Is(err, ErrUnavailable):
+		return CodeUnavailable
+	default:
+		return CodeInternal
+	}
+}
+
+// ErrorDetail returns the client safe detail of an error. Unclassified
+// errors may leak internals so they get a generic detail instead
+func ErrorDetail(err error) string {
+	var domainErr *Error
+	if errors.As(err, &domainErr) {
+		return domainErr.Detail
+	}
+	return "an unexpected error occurred"
+}
@@ -2,21 +2,466 @@ package dto
 
 import (
 	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
 	"github.com/shopspring/decimal"
 )
 
+// MaxBulkWallets is the maximum number of wallets that can be looked up at once
+const MaxBulkWallets = 1000
+
+// MaxBatchOperations is the maximum number of credits/debits that can be applied in one batch
+const MaxBatchOperations = 10000
+
+// OperationType is the kind of balance change applied by a batch operation
+type OperationType string
+
+// Supported batch operation types
+const (
+	CreditOperation OperationType = "credit"
+	DebitOperation  OperationType = "debit"
+)
+
+// BatchMode selects how a batch is applied
+type BatchMode string
+
+// Supported batch modes
+const (
+	// AtomicBatch applies every operation or none of them
+	AtomicBatch BatchMode = "atomic"
+	// BestEffortBatch applies every operation that can be applied
+	BestEffortBatch BatchMode = "best_effort"
+)
+
+// AmountLimits bounds the amount of a single credit/debit. A zero limit is not enforced
+type AmountLimits struct {
+	Min decimal.Decimal
+	Max decimal.Decimal
+}
+
+// Rules are the configurable validation rules of credits/debits. Amounts must
+// always be greater than zero, the zero value enforces nothing more than that
+type Rules struct {
+	Credit AmountLimits
+	Debit  AmountLimits
+	// DecimalPlaces is the precision supported by the currency, 0 is not enforced
+	DecimalPlaces int32
+}
+
+func (r Rules) limits(op OperationType) AmountLimits {
+	if op == CreditOperation {
+		return r.Credit
+	}
+	return r.Debit
+}
+
+// FieldError is a validation failure of a single request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// FieldErrors are all the validation failures of a request
+type FieldErrors []FieldError
+
+// Error is a string representation of an error interface
+func (f FieldErrors) Error() string {
+	msgs := make([]string, len(f))
+	for i, fieldErr := range f {
+		msgs[i] = fieldErr.Field + " " + fieldErr.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (f *FieldErrors) add(field string, format string, args ...interface{}) {
+	*f = append(*f, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// err returns a validation error carrying the field errors, if there are any
+func (f FieldErrors) err() error {
+	if len(f) == 0 {
+		return nil
+	}
+	return domain.NewError(domain.ErrValidation, f.Error(), f)
+}
+
+// ValidWalletID validates that a wallet ID is a positive number
+func ValidWalletID(walletID int) error {
+	var errs FieldErrors
+	checkWalletID(&errs, "wallet_id", walletID)
+	return errs.err()
+}
+
+func checkWalletID(errs *FieldErrors, field string, walletID int) {
+	if walletID <= 0 {
+		errs.add(field, "must be a positive whole number")
+	}
+}
+
 // AmountInput is the credit/debit amount input data transfer object
 type AmountInput struct {
-	Amount decimal.Decimal `json:"amount"`
+	Amount decimal.NullDecimal `json:"amount"`
+}
+
+// Valid validates the credit/debit amount against the rules of the operation
+func (a *AmountInput) Valid(rules Rules, op OperationType) error {
+	var errs FieldErrors
+	a.check(&errs, "amount", rules, op)
+	return errs.err()
 }
 
-// Valid validates the debit/credit amount is not a negative number
-func (a *AmountInput) Valid() error {
-	if a.Amount.IsNegative() {
-		return fmt.Errorf("amount can not be a negative number")
+func (a *AmountInput) check(errs *FieldErrors, field string, rules Rules, op OperationType) {
+	if !a.Amount.Valid {
+		errs.add(field, "is required")
+		return
 	}
-	return nil
+
+	amount := a.Amount.Decimal
+	if !amount.IsPositive() {
+		errs.add(field, "must be greater than 0")
+		return
+	}
+	if rules.DecimalPlaces > 0 && !amount.Truncate(rules.DecimalPlaces).Equal(amount) {
+		errs.add(field, "must have at most %d decimal places", rules.DecimalPlaces)
+	}
+
+	limits := rules.limits(op)
+	if limits.Min.IsPositive() && amount.LessThan(limits.Min) {
+		errs.add(field, "must be at least %s for a %s", limits.Min, op)
+	}
+	if limits.Max.IsPositive() && amount.GreaterThan(limits.Max) {
+		errs.add(field, "must be at most %s for a %s", limits.Max, op)
+	}
+}
+
+// BulkBalanceInput is the bulk balance lookup input data transfer object
+type BulkBalanceInput struct {
+	WalletIDs []int `json:"wallet_ids"`
+}
+
+// Valid validates that at least one and at most MaxBulkWallets valid wallets are looked up
+func (b *BulkBalanceInput) Valid() error {
+	var errs FieldErrors
+	switch {
+	case len(b.WalletIDs) == 0:
+		errs.add("wallet_ids", "must have at least one wallet ID")
+	case len(b.WalletIDs) > MaxBulkWallets:
+		errs.add("wallet_ids", "must have at most %d wallet IDs", MaxBulkWallets)
+	default:
+		for i, walletID := range b.WalletIDs {
+			checkWalletID(&errs, fmt.Sprintf("wallet_ids[%d]", i), walletID)
+		}
+	}
+	return errs.err()
+}
+
+// WalletBalanceResult is the outcome of looking up a single wallet in a bulk lookup
+type WalletBalanceResult struct {
+	WalletID int            `json:"wallet_id"`
+	Found    bool           `json:"found"`
+	Wallet   *domain.Wallet `json:"wallet,omitempty"`
+}
+
+// BatchOperation is a single credit/debit of a batch
+type BatchOperation struct {
+	AmountInput
+	WalletID int           `json:"wallet_id"`
+	Type     OperationType `json:"type"`
+}
+
+func (o *BatchOperation) check(errs *FieldErrors, field string, rules Rules) {
+	checkWalletID(errs, field+".wallet_id", o.WalletID)
+	if o.Type != CreditOperation && o.Type != DebitOperation {
+		errs.add(field+".type", "must be either %s or %s", CreditOperation, DebitOperation)
+		return
+	}
+	o.AmountInput.check(errs, field+".amount", rules, o.Type)
+}
+
+// BatchInput is the batch credit/debit input data transfer object
+type BatchInput struct {
+	IdempotencyKey string           `json:"idempotency_key"`
+	Mode           BatchMode        `json:"mode"`
+	Operations     []BatchOperation `json:"operations"`
+}
+
+// Valid validates the batch and every one of its operations
+func (b *BatchInput) Valid(rules Rules) error {
+	var errs FieldErrors
+	if b.IdempotencyKey == "" {
+		errs.add("idempotency_key", "is required")
+	}
+	if b.Mode != AtomicBatch && b.Mode != BestEffortBatch {
+		errs.add("mode", "must be either %s or %s", AtomicBatch, BestEffortBatch)
+	}
+
+	switch {
+	case len(b.Operations) == 0:
+		errs.add("operations", "must have at least one operation")
+	case len(b.Operations) > MaxBatchOperations:
+		errs.add("operations", "must have at most %d operations", MaxBatchOperations)
+	default:
+		for i := range b.Operations {
+			b.Operations[i].check(&errs, fmt.Sprintf("operations[%d]", i), rules)
+		}
+	}
+	return errs.err()
+}
+
+// BatchOperationResult is the outcome of a single operation of a batch
+type BatchOperationResult struct {
+	Index     int            `json:"index"`
+	WalletID  int            `json:"wallet_id"`
+	Type      OperationType  `json:"type"`
+	Succeeded bool           `json:"succeeded"`
+	Wallet    *domain.Wallet `json:"wallet,omitempty"`
+	Code      string         `json:"code,omitempty"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// BatchResult is the outcome of a batch. Applied is false when an atomic
+// batch was rejected, in which case no operation has been applied
+type BatchResult struct {
+	IdempotencyKey string                 `json:"idempotency_key"`
+	Mode           BatchMode              `json:"mode"`
+	Applied        bool                   `json:"applied"`
+	Replayed       bool                   `json:"replayed"`
+	Results        []BatchOperationResult `json:"results"`
+}
+
+// WebhookSubscriptionInput is the webhook subscription input data transfer object.
+// A secret is generated when none is given
+type WebhookSubscriptionInput struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Secret     string   `json:"secret"`
+}
+
+// Valid validates that the webhook is an absolute https URL, that does not point at
+// this network, subscribed to known event types and that a given secret is long
+// enough to sign with. Host names are checked again when a delivery is dialed
+func (w *WebhookSubscriptionInput) Valid() error {
+	var errs FieldErrors
+	u, err := url.Parse(w.URL)
+	switch {
+	case err != nil || u.Scheme != "https" || u.Hostname() == "":
+		errs.add("url", "must be an absolute https URL")
+	case !PublicHost(u.Hostname()):
+		errs.add("url", "must not point at a loopback, private or link local address")
+	}
+
+	if len(w.EventTypes) == 0 {
+		errs.add("event_types", "must have at least one event type")
+	}
+	for i, eventType := range w.EventTypes {
+		if !knownEventType(eventType) {
+			errs.add(fmt.Sprintf("event_types[%d]", i), "must be one of %s", strings.Join(domain.EventTypes, ", "))
+		}
+	}
+
+	if w.Secret != "" && len(w.Secret) < MinWebhookSecretLength {
+		errs.add("secret", "must be at least %d characters long", MinWebhookSecretLength)
+	}
+	return errs.err()
+}
+
+// PublicHost reports whether a host name or IP address may be reached from the
+// internet. Host names other than localhost are resolved, and checked, when dialed
+func PublicHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip == nil || PublicIP(ip)
+}
+
+// PublicIP reports whether an IP address may be reached from the internet, that is
+// that it is not a loopback, private, link local or otherwise reserved address
+func PublicIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !reservedIP(ip)
+}
+
+// reservedNetworks are the non routable networks net.IP has no predicate for
+var reservedNetworks = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("192.0.0.0/24"),
+	mustParseCIDR("198.18.0.0/15"),
+	mustParseCIDR("240.0.0.0/4"),
+	mustParseCIDR("64:ff9b::/96"),
+}
+
+func reservedIP(ip net.IP) bool {
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+func knownEventType(eventType string) bool {
+	for _, known := range domain.EventTypes {
+		if eventType == known {
+			return true
+		}
+	}
+	return false
+}
+
+// MinWebhookSecretLength is the minimum length of a webhook signing secret
+const MinWebhookSecretLength = 16
+
+// WebhookSubscription is a webhook subscription as it is shown to its owner.
+// The secret is only shown when the subscription is created
+type WebhookSubscription struct {
+	ID         uint64    `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"secret,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// NewWebhookSubscription shows a webhook subscription, without its secret
+func NewWebhookSubscription(sub domain.WebhookSubscription) WebhookSubscription {
+	return WebhookSubscription{
+		ID:         sub.ID,
+		URL:        sub.URL,
+		EventTypes: strings.Split(sub.EventTypes, ","),
+		CreatedAt:  sub.CreatedAt,
+	}
+}
+
+// DayLayout is how business days are written
+const DayLayout = "2006-01-02"
+
+// ValidDay validates that a business day is a date written as YYYY-MM-DD
+func ValidDay(day string) error {
+	var errs FieldErrors
+	if _, err := time.Parse(DayLayout, day); err != nil {
+		errs.add("day", "must be a date formatted as YYYY-MM-DD")
+	}
+	return errs.err()
+}
+
+// SettlementReport is a closed business day with the debits and credits posted
+// to each type of ledger account over the day
+type SettlementReport struct {
+	domain.DayClose
+	Totals []domain.SettlementTotal `json:"totals"`
+}
+
+// ValidStatementPeriod validates that a statement starts before it ends and does not end in the future
+func ValidStatementPeriod(from time.Time, to time.Time) error {
+	var errs FieldErrors
+	if !from.Before(to) {
+		errs.add("from", "must be before to")
+	}
+	if to.After(time.Now()) {
+		errs.add("to", "can not be in the future")
+	}
+	return errs.err()
+}
+
+// Statement is a wallet's account statement from, inclusive, to, exclusive. The
+// closing balance is the opening balance with every entry of the statement applied
+type Statement struct {
+	WalletID int              `json:"wallet_id"`
+	Currency string           `json:"currency"`
+	From     time.Time        `json:"from"`
+	To       time.Time        `json:"to"`
+	Opening  decimal.Decimal  `json:"opening_balance"`
+	Closing  *decimal.Decimal `json:"closing_balance,omitempty"`
+}
+
+// StatementEntry is a ledger posting to a wallet with the balance it left the wallet with.
+// Credits take money out of the wallet and debits put money in it
+type StatementEntry struct {
+	ID            uint64          `json:"id"`
+	TransactionID string          `json:"transaction_id"`
+	Type          OperationType   `json:"type"`
+	Amount        decimal.Decimal `json:"amount"`
+	Balance       decimal.Decimal `json:"balance"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// MaxReasonLength is the longest reason an operator can give for an admin action
+const MaxReasonLength = 255
+
+// MaxSeedWallets is how many wallets can be seeded at once
+const MaxSeedWallets = 10000
+
+// ValidReason validates the reason an operator gave for an admin action
+func ValidReason(reason string, required bool) error {
+	var errs FieldErrors
+	checkReason(&errs, reason, required)
+	return errs.err()
+}
+
+func checkReason(errs *FieldErrors, reason string, required bool) {
+	switch {
+	case required && strings.TrimSpace(reason) == "":
+		errs.add("reason", "is required")
+	case len(reason) > MaxReasonLength:
+		errs.add("reason", "must be at most %d characters", MaxReasonLength)
+	}
+}
+
+// ValidAdjustment validates that a manual adjustment changes a wallet's balance and says why
+func ValidAdjustment(walletID int, amount decimal.Decimal, reason string) error {
+	var errs FieldErrors
+	checkWalletID(&errs, "wallet_id", walletID)
+	if amount.IsZero() {
+		errs.add("amount", "can not be zero")
+	}
+	checkReason(&errs, reason, true)
+	return errs.err()
+}
+
+// ValidOpening validates the balance a wallet is opened with and why it is opened.
+// The reason is required when the wallet is opened with money in it
+func ValidOpening(balance decimal.Decimal, reason string) error {
+	var errs FieldErrors
+	if balance.IsNegative() {
+		errs.add("balance", "can not be negative")
+	}
+	checkReason(&errs, reason, !balance.IsZero())
+	return errs.err()
+}
+
+// ValidSeed validates how many wallets are seeded and the balance each one is given
+func ValidSeed(count int, balance decimal.Decimal) error {
+	var errs FieldErrors
+	if count <= 0 || count > MaxSeedWallets {
+		errs.add("count", "must be between 1 and %d", MaxSeedWallets)
+	}
+	if balance.IsNegative() {
+		errs.add("balance", "can not be negative")
+	}
+	return errs.err()
+}
+
+// Adjustment is an operator's manual change of a wallet's balance, posted against the
+// adjustments ledger account. Positive amounts put money in the wallet and negative ones take it out
+type Adjustment struct {
+	TransactionID string          `json:"transaction_id"`
+	WalletID      int             `json:"wallet_id"`
+	Amount        decimal.Decimal `json:"amount"`
+	Reason        string          `json:"reason"`
+	Wallet        *domain.Wallet  `json:"wallet"`
 }
 
 // AccessToken represents Auth0 oauth2 access token
@@ -26,6 +471,16 @@ type AccessToken struct {
 	ExpiresIn   int    `json:"expires_in"`
 }
 
+// Problem is an RFC 7807 problem details error response
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail"`
+	Code     string `json:"code"`
+	Instance string `json:"instance,omitempty"`
+}
+
 // WrappedError is a custom context wrapped error
 type WrappedError struct {
 	Context string `json:"context"`
@@ -37,6 +492,11 @@ func (w *WrappedError) Error() string {
 	return fmt.Sprintf("%s: %v", w.Context, w.Err)
 }
 
+// Unwrap returns the wrapped error so that errors.Is and errors.As see through the context
+func (w *WrappedError) Unwrap() error {
+	return w.Err
+}
+
 // Wrap wraps an error with it's context
 func Wrap(err error, info string) *WrappedError {
 	return &WrappedError{
@@ -0,0 +1,149 @@
+package dto_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/shopspring/decimal"
+)
+
+var rules = dto.Rules{
+	Credit:        dto.AmountLimits{Min: decimal.NewFromInt(1), Max: decimal.NewFromInt(100)},
+	DecimalPlaces: 2,
+}
+
+func amount(value string) dto.AmountInput {
+	return dto.AmountInput{Amount: decimal.NewNullDecimal(decimal.RequireFromString(value))}
+}
+
+func TestAmountInput_Valid(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     dto.AmountInput
+		op        dto.OperationType
+		wantField string
+	}{
+		{
+			name:  "happy case",
+			input: amount("10.45"),
+			op:    dto.CreditOperation,
+		},
+		{
+			name:  "happy case - debits are not bounded",
+			input: amount("1000000"),
+			op:    dto.DebitOperation,
+		},
+		{
+			name:      "sad case - missing",
+			input:     dto.AmountInput{},
+			op:        dto.CreditOperation,
+			wantField: "amount",
+		},
+		{
+			name:      "sad case - zero",
+			input:     amount("0"),
+			op:        dto.DebitOperation,
+			wantField: "amount",
+		},
+		{
+			name:      "sad case - negative",
+			input:     amount("-1"),
+			op:        dto.DebitOperation,
+			wantField: "amount",
+		},
+		{
+			name:      "sad case - too precise",
+			input:     amount("1.001"),
+			op:        dto.DebitOperation,
+			wantField: "amount",
+		},
+		{
+			name:      "sad case - below the minimum",
+			input:     amount("0.99"),
+			op:        dto.CreditOperation,
+			wantField: "amount",
+		},
+		{
+			name:      "sad case - above the maximum",
+			input:     amount("100.01"),
+			op:        dto.CreditOperation,
+			wantField: "amount",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.input.Valid(rules, tt.op)
+			if (err != nil) != (tt.wantField != "") {
+				t.Fatalf("AmountInput.Valid() error = %v, wantField %q", err, tt.wantField)
+			}
+			if err == nil {
+				return
+			}
+
+			if !errors.Is(err, domain.ErrValidation) {
+				t.Fatalf("expected a validation error but got %v", err)
+			}
+			var fieldErrs dto.FieldErrors
+			if !errors.As(err, &fieldErrs) || fieldErrs[0].Field != tt.wantField {
+				t.Fatalf("expected %s to be invalid but got %v", tt.wantField, err)
+			}
+		})
+	}
+}
+
+func TestBatchInput_Valid(t *testing.T) {
+	input := dto.BatchInput{
+		Mode: dto.AtomicBatch,
+		Operations: []dto.BatchOperation{
+			{WalletID: 1, Type: dto.CreditOperation, AmountInput: amount("10")},
+			{WalletID: -1, Type: dto.DebitOperation, AmountInput: amount("10")},
+			{WalletID: 2, Type: dto.CreditOperation, AmountInput: amount("500")},
+		},
+	}
+
+	err := input.Valid(rules)
+	var fieldErrs dto.FieldErrors
+	if !errors.As(err, &fieldErrs) {
+		t.Fatalf("expected field errors but got %v", err)
+	}
+
+	want := []string{"idempotency_key", "operations[1].wallet_id", "operations[2].amount"}
+	if len(fieldErrs) != len(want) {
+		t.Fatalf("expected %v to be invalid but got %v", want, fieldErrs)
+	}
+	for i, field := range want {
+		if fieldErrs[i].Field != field {
+			t.Fatalf("expected %s to be invalid but got %v", field, fieldErrs)
+		}
+	}
+}
+
+func TestPublicHost(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+		want bool
+	}{
+		{name: "happy case - host name", host: "partner.example.com", want: true},
+		{name: "happy case - public IPv4", host: "93.184.216.34", want: true},
+		{name: "happy case - public IPv6", host: "2606:2800:220:1::", want: true},
+		{name: "sad case - localhost", host: "LocalHost."},
+		{name: "sad case - loopback", host: "127.0.0.2"},
+		{name: "sad case - unspecified", host: "0.0.0.0"},
+		{name: "sad case - private", host: "10.1.2.3"},
+		{name: "sad case - link local", host: "169.254.169.254"},
+		{name: "sad case - shared address space", host: "100.64.0.1"},
+		{name: "sad case - IPv6 loopback", host: "::1"},
+		{name: "sad case - IPv6 unique local", host: "fd00::1"},
+		{name: "sad case - IPv4 mapped loopback", host: "::ffff:127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dto.PublicHost(tt.host); got != tt.want {
+				t.Fatalf("PublicHost(%q) = %v, want %v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
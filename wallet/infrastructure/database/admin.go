@@ -0,0 +1,205 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/audit"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/events"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errWalletFrozen = domain.NewError(domain.ErrFrozen, "the wallet is frozen", nil)
+
+// CreateWallet opens a wallet with a zero balance within the transaction and records who
+// opened it in the audit log. An event store wallet is opened with an empty event stream
+func (tx *walletTx) CreateWallet(
+	ctx context.Context,
+	reason string,
+) (*domain.Wallet, error) {
+	wallet := &domain.Wallet{Balance: decimal.Zero}
+	if err := tx.db.WithContext(ctx).Create(wallet).Error; err != nil {
+		return nil, dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to create wallet record with err %v", err)),
+			"CreateWallet",
+		)
+	}
+	if err := appendAudit(ctx, tx.db, tx.auditKey, audit.ActionWalletCreated, wallet.ID, reasonDetails(reason)); err != nil {
+		return nil, dto.Wrap(err, "CreateWallet")
+	}
+
+	return wallet, nil
+}
+
+// SetFrozen freezes or unfreezes a wallet, recording the reason in the audit log and
+// the WalletFrozen or WalletUnfrozen event in the outbox in the same transaction.
+// Nothing is recorded when the wallet already is in that state
+func (db *WalletDb) SetFrozen(
+	ctx context.Context,
+	walletID int,
+	frozen bool,
+	reason string,
+) (*domain.Wallet, error) {
+	var wallet domain.Wallet
+	err := db.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&wallet, walletID).
+			Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return domain.NewError(domain.ErrNotFound, "wallet not found", err)
+			}
+			return databaseUnavailable(fmt.Errorf("failed to lock wallet record with err %v", err))
+		}
+
+		return setFrozen(ctx, tx, db.AuditKey, &wallet, frozen, reason)
+	})
+	if err != nil {
+		return nil, dto.Wrap(err, "SetFrozen")
+	}
+
+	cacheChanged(ctx, db.Cache, db.Logger, &wallet)
+
+	return &wallet, nil
+}
+
+// SetFrozen freezes or unfreezes a wallet, recording the reason in the audit log and
+// the WalletFrozen or WalletUnfrozen event in the outbox in the same transaction.
+// Nothing is recorded when the wallet already is in that state
+func (s *EventStore) SetFrozen(
+	ctx context.Context,
+	walletID int,
+	frozen bool,
+	reason string,
+) (*domain.Wallet, error) {
+	var wallet *domain.Wallet
+	err := s.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		streams, err := loadStreams(ctx, tx, []int{walletID}, true)
+		if err != nil {
+			return err
+		}
+		stream, ok := streams[walletID]
+		if !ok {
+			return domain.NewError(domain.ErrNotFound, "wallet not found", nil)
+		}
+
+		wallet = stream.Wallet()
+		return setFrozen(ctx, tx, s.AuditKey, wallet, frozen, reason)
+	})
+	if err != nil {
+		return nil, dto.Wrap(err, "SetFrozen")
+	}
+
+	cacheChanged(ctx, s.Cache, s.Logger, wallet)
+
+	return wallet, nil
+}
+
+// setFrozen changes a locked wallet's state within the transaction
+func setFrozen(
+	ctx context.Context,
+	tx *gorm.DB,
+	auditKey audit.Key,
+	wallet *domain.Wallet,
+	frozen bool,
+	reason string,
+) error {
+	if wallet.Frozen == frozen {
+		return nil
+	}
+
+	if err := tx.WithContext(ctx).Model(&domain.Wallet{}).
+		Where("id = ?", wallet.ID).
+		Update("frozen", frozen).
+		Error; err != nil {
+		return databaseUnavailable(fmt.Errorf("failed to update wallet record with err %v", err))
+	}
+	wallet.Frozen = frozen
+
+	action := audit.ActionWalletUnfrozen
+	if frozen {
+		action = audit.ActionWalletFrozen
+	}
+	if err := appendAudit(ctx, tx, auditKey, action, wallet.ID, reasonDetails(reason)); err != nil {
+		return err
+	}
+
+	event, err := events.FreezeChanged(wallet)
+	if err != nil {
+		return err
+	}
+	if err := tx.WithContext(ctx).Create(event).Error; err != nil {
+		return databaseUnavailable(fmt.Errorf("failed to write outbox event with err %v", err))
+	}
+
+	return nil
+}
+
+// AdjustBalance changes a wallet's balance by an operator's adjustment within the
+// transaction, recording the adjustment and its reason in the audit log
+func (tx *walletTx) AdjustBalance(
+	ctx context.Context,
+	wallet *domain.Wallet,
+	txn *domain.LedgerTransaction,
+	reason string,
+) (*domain.Wallet, error) {
+	adjusted, err := tx.UpdateBalance(ctx, wallet, txn)
+	if err != nil {
+		return nil, dto.Wrap(err, "AdjustBalance")
+	}
+	if err := auditAdjustment(ctx, tx.db, tx.auditKey, adjusted.ID, txn, reason); err != nil {
+		return nil, dto.Wrap(err, "AdjustBalance")
+	}
+
+	return adjusted, nil
+}
+
+// AdjustBalance changes a wallet's balance by an operator's adjustment within the
+// transaction, recording the adjustment and its reason in the audit log
+func (tx *eventTx) AdjustBalance(
+	ctx context.Context,
+	wallet *domain.Wallet,
+	txn *domain.LedgerTransaction,
+	reason string,
+) (*domain.Wallet, error) {
+	adjusted, err := tx.UpdateBalance(ctx, wallet, txn)
+	if err != nil {
+		return nil, dto.Wrap(err, "AdjustBalance")
+	}
+	if err := auditAdjustment(ctx, tx.db, tx.auditKey, adjusted.ID, txn, reason); err != nil {
+		return nil, dto.Wrap(err, "AdjustBalance")
+	}
+
+	return adjusted, nil
+}
+
+// auditAdjustment appends an adjustment of a wallet's balance to the audit log
+func auditAdjustment(
+	ctx context.Context,
+	tx *gorm.DB,
+	auditKey audit.Key,
+	walletID int,
+	txn *domain.LedgerTransaction,
+	reason string,
+) error {
+	details, err := json.Marshal(map[string]string{
+		"transaction_id": txn.ID,
+		"amount":         txn.Change(domain.WalletAccount(walletID)).String(),
+		"reason":         reason,
+	})
+	if err != nil {
+		return err
+	}
+	return appendAudit(ctx, tx, auditKey, audit.ActionBalanceAdjusted, walletID, details)
+}
+
+// reasonDetails are the details of an admin action given with a reason only
+func reasonDetails(reason string) []byte {
+	bs, _ := json.Marshal(map[string]string{"reason": reason})
+	return bs
+}
@@ -0,0 +1,168 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/audit"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// auditHeadID is the ID of the single row holding the head of the hash chain
+const auditHeadID = 1
+
+var errAuditNotKeyed = domain.NewError(
+	domain.ErrUnavailable,
+	"the audit log is unavailable",
+	errors.New("the audit log has not been configured with a key"),
+)
+
+// AuditLog is the append-only audit log of money movements and admin actions.
+// Money movements are appended by the wallet database layer as they are made
+type AuditLog struct {
+	Db  *gorm.DB
+	Key audit.Key
+}
+
+// NewAuditLog initializes the audit log stored in the given database, sealing
+// the records it appends with the key
+func NewAuditLog(gorm *gorm.DB, key audit.Key) *AuditLog {
+	l := &AuditLog{
+		Db:  gorm,
+		Key: key,
+	}
+	l.checkPreconditions()
+	return l
+}
+
+func (db *AuditLog) checkPreconditions() {
+	if db.Db == nil {
+		log.Panicf("error initializing audit log, ORM has not been initialized")
+	}
+}
+
+// AuditRecords reads the audit log in sequence order, starting after the given record
+func (db *AuditLog) AuditRecords(
+	ctx context.Context,
+	afterSeq uint64,
+	limit int,
+) ([]domain.AuditRecord, error) {
+	var records []domain.AuditRecord
+	if err := db.Db.WithContext(ctx).Where("seq > ?", afterSeq).
+		Order("seq").
+		Limit(limit).
+		Find(&records).
+		Error; err != nil {
+		return nil, dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to get audit records with err %v", err)),
+			"AuditRecords",
+		)
+	}
+
+	return records, nil
+}
+
+// AuditHead reads the latest link of the audit log's hash chain.
+// No head is returned when nothing has been audited yet
+func (db *AuditLog) AuditHead(ctx context.Context) (*domain.AuditHead, error) {
+	var heads []domain.AuditHead
+	if err := db.Db.WithContext(ctx).Where("id = ?", auditHeadID).
+		Limit(1).
+		Find(&heads).
+		Error; err != nil {
+		return nil, dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to get audit head with err %v", err)),
+			"AuditHead",
+		)
+	}
+	if len(heads) == 0 {
+		return nil, nil
+	}
+
+	return &heads[0], nil
+}
+
+// auditBalanceChange appends a wallet's balance change to the audit log
+// within the transaction that changed it
+func auditBalanceChange(
+	ctx context.Context,
+	tx *gorm.DB,
+	key audit.Key,
+	walletID int,
+	previous decimal.Decimal,
+	balance decimal.Decimal,
+) error {
+	action, details := audit.BalanceChange(previous, balance)
+	return appendAudit(ctx, tx, key, action, walletID, details)
+}
+
+// appendAudit chains a record, sealed with the key, to the head of the audit log.
+// The head's row is locked until the transaction ends, so records are appended one
+// at a time and a record is only kept if the change it describes is committed. A
+// record the key does not cover is refused rather than appended unkeyed
+func appendAudit(
+	ctx context.Context,
+	tx *gorm.DB,
+	key audit.Key,
+	action string,
+	walletID int,
+	details []byte,
+) error {
+	head := domain.AuditHead{ID: auditHeadID}
+	if err := tx.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&head).
+		Error; err != nil {
+		return dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to create audit head with err %v", err)),
+			"appendAudit",
+		)
+	}
+	if err := tx.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&head, auditHeadID).
+		Error; err != nil {
+		return dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to lock audit head with err %v", err)),
+			"appendAudit",
+		)
+	}
+
+	actor := audit.ActorFrom(ctx)
+	record := &domain.AuditRecord{
+		Seq:       head.Seq + 1,
+		Actor:     actor.Subject,
+		IP:        actor.IP,
+		Action:    action,
+		WalletID:  walletID,
+		Details:   details,
+		CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+	if !key.Keyed(record.Seq) {
+		return dto.Wrap(errAuditNotKeyed, "appendAudit")
+	}
+	audit.Seal(record, head.Hash, key)
+
+	if err := tx.WithContext(ctx).Create(record).Error; err != nil {
+		return dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to append audit record with err %v", err)),
+			"appendAudit",
+		)
+	}
+	if err := tx.WithContext(ctx).Model(&domain.AuditHead{}).
+		Where("id = ?", auditHeadID).
+		Updates(map[string]interface{}{"seq": record.Seq, "hash": record.Hash}).
+		Error; err != nil {
+		return dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to move audit head with err %v", err)),
+			"appendAudit",
+		)
+	}
+
+	return nil
+}
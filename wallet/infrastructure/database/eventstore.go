@@ -0,0 +1,536 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/audit"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/cache"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/eventstore"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errInsufficientFunds = domain.NewError(
+	domain.ErrInsufficientFunds,
+	"a wallet balance cannot go below 0",
+	nil,
+)
+
+// EventStore is the wallet database layer that derives balances from each
+// wallet's append-only event stream instead of a mutable balance column. The
+// wallets table only keeps which wallets exist and the balance they were opened
+// with, and a snapshot is taken every SnapshotEvery events to keep reads short
+type EventStore struct {
+	Db            *gorm.DB
+	Cache         cache.WalletCache
+	AuditKey      audit.Key
+	SnapshotEvery uint64
+	Logger        *slog.Logger
+}
+
+// NewEventStore initializes a new event sourced wallet database instance.
+// Changes are audited with the key
+func NewEventStore(
+	gorm *gorm.DB,
+	c cache.WalletCache,
+	auditKey audit.Key,
+	snapshotEvery uint64,
+	logger *slog.Logger,
+) *EventStore {
+	s := &EventStore{
+		Db:            gorm,
+		Cache:         c,
+		AuditKey:      auditKey,
+		SnapshotEvery: snapshotEvery,
+		Logger:        logger,
+	}
+	s.checkPreconditions()
+	return s
+}
+
+func (s *EventStore) checkPreconditions() {
+	if s.Db == nil {
+		log.Panicf("error initializing event store, ORM has not been initialized")
+	}
+	if s.Cache == nil {
+		log.Panicf("error initializing event store, Cache service has not been initialized")
+	}
+	if s.SnapshotEvery == 0 {
+		log.Panicf("error initializing event store, snapshot frequency has not been configured")
+	}
+	if s.Logger == nil {
+		log.Panicf("error initializing event store, logger has not been initialized")
+	}
+}
+
+// GetBalance replays a wallet's events since its latest snapshot, unless its balance is cached
+func (s *EventStore) GetBalance(
+	ctx context.Context,
+	walletID int,
+) (*domain.Wallet, error) {
+	wallets, err := s.GetBalances(ctx, []int{walletID})
+	if err != nil {
+		return nil, dto.Wrap(err, "GetBalance")
+	}
+
+	wallet, ok := wallets[walletID]
+	if !ok {
+		return nil, dto.Wrap(
+			domain.NewError(domain.ErrNotFound, "wallet not found", nil),
+			"GetBalance",
+		)
+	}
+	return wallet, nil
+}
+
+// GetBalances reads the cache first and replays the streams of all the misses
+// together. Wallets that do not exist are left out of the result
+func (s *EventStore) GetBalances(
+	ctx context.Context,
+	walletIDs []int,
+) (map[int]*domain.Wallet, error) {
+	wallets, err := s.Cache.GetCachedBalances(ctx, walletIDs)
+	if err != nil {
+		return nil, dto.Wrap(err, "GetBalances")
+	}
+
+	var misses []int
+	for _, walletID := range walletIDs {
+		if _, ok := wallets[walletID]; !ok {
+			misses = append(misses, walletID)
+		}
+	}
+	if len(misses) == 0 {
+		return wallets, nil
+	}
+
+	streams, err := loadStreams(ctx, s.Db, misses, false)
+	if err != nil {
+		return nil, dto.Wrap(err, "GetBalances")
+	}
+
+	for walletID, stream := range streams {
+		wallet := stream.Wallet()
+		wallets[walletID] = wallet
+
+		// a failure to warm the cache should not fail the read itself
+		if err := s.Cache.FillBalance(ctx, wallet); err != nil {
+			s.Logger.WarnContext(
+				ctx,
+				"failed to cache wallet balance",
+				slog.Int("wallet_id", walletID),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+
+	return wallets, nil
+}
+
+// UpdateBalance appends the ledger transaction's change to the wallet's balance to its
+// stream unless the wallet is frozen. The change is applied to the balance the stream is
+// at once it is locked, and the ledger transaction is posted and the change recorded in
+// the audit log and the outbox in the same transaction
+func (s *EventStore) UpdateBalance(
+	ctx context.Context,
+	wallet *domain.Wallet,
+	txn *domain.LedgerTransaction,
+) (*domain.Wallet, error) {
+	if wallet == nil {
+		return nil, fmt.Errorf("no wallet has been passed")
+	}
+
+	var updated *domain.Wallet
+	err := s.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		streams, err := loadStreams(ctx, tx, []int{wallet.ID}, true)
+		if err != nil {
+			return err
+		}
+		stream, ok := streams[wallet.ID]
+		if !ok {
+			return domain.NewError(domain.ErrNotFound, "wallet not found", nil)
+		}
+		if stream.Frozen {
+			return errWalletFrozen
+		}
+
+		updated, err = s.appendChange(ctx, tx, stream, txn)
+		return err
+	})
+	if err != nil {
+		return nil, dto.Wrap(err, "UpdateBalance")
+	}
+
+	cacheChanged(ctx, s.Cache, s.Logger, updated)
+
+	return updated, nil
+}
+
+// appendChange appends the ledger transaction's change to a locked stream, taking a
+// snapshot when one is due, and posts the transaction
+func (s *EventStore) appendChange(
+	ctx context.Context,
+	tx *gorm.DB,
+	stream *eventstore.Stream,
+	txn *domain.LedgerTransaction,
+) (*domain.Wallet, error) {
+	if txn == nil {
+		return nil, fmt.Errorf("no ledger transaction has been passed")
+	}
+
+	change := txn.Change(domain.WalletAccount(stream.WalletID))
+	previous, from := stream.Balance, stream.Version
+	next := previous.Add(change)
+	if change.IsNegative() && next.IsNegative() {
+		return nil, errInsufficientFunds
+	}
+
+	now := time.Now().UTC()
+	appended := eventstore.Append(stream, next, now)
+	if err := tx.WithContext(ctx).Create(&appended).Error; err != nil {
+		return nil, databaseUnavailable(fmt.Errorf("failed to append wallet events with err %v", err))
+	}
+
+	if eventstore.SnapshotDue(from, stream.Version, s.SnapshotEvery) {
+		snapshot := eventstore.Snapshot(*stream, now)
+		if err := tx.WithContext(ctx).Create(&snapshot).Error; err != nil {
+			return nil, databaseUnavailable(fmt.Errorf("failed to snapshot wallet with err %v", err))
+		}
+	}
+
+	if err := postTransaction(ctx, tx, txn); err != nil {
+		return nil, err
+	}
+	if err := recordBalanceChange(ctx, tx, s.AuditKey, stream.WalletID, previous, next); err != nil {
+		return nil, err
+	}
+
+	return stream.Wallet(), nil
+}
+
+// GetBatch retrieves a processed batch by its idempotency key.
+// No batch is returned when the key has not been seen before
+func (s *EventStore) GetBatch(
+	ctx context.Context,
+	idempotencyKey string,
+) (*domain.Batch, error) {
+	return getBatch(ctx, s.Db, idempotencyKey)
+}
+
+// Transact runs fn in a database transaction. The transaction is committed when
+// fn succeeds and the balances it updated are then written to the cache
+func (s *EventStore) Transact(
+	ctx context.Context,
+	fn func(tx repository.Tx) error,
+) error {
+	tx := &eventTx{
+		walletTx: &walletTx{auditKey: s.AuditKey, updated: map[int]*domain.Wallet{}},
+		store:    s,
+		streams:  map[int]*eventstore.Stream{},
+	}
+	err := s.Db.WithContext(ctx).Transaction(func(gormTx *gorm.DB) error {
+		tx.db = gormTx
+		return fn(tx)
+	})
+	if err != nil {
+		return dto.Wrap(err, "Transact")
+	}
+
+	for _, wallet := range tx.updated {
+		cacheChanged(ctx, s.Cache, s.Logger, wallet)
+	}
+
+	return nil
+}
+
+// BalanceAt replays a wallet's events up to the given time. With fromSnapshots
+// the replay starts from the latest snapshot taken by then, otherwise from the
+// wallet's first event
+func (s *EventStore) BalanceAt(
+	ctx context.Context,
+	walletID int,
+	at time.Time,
+	fromSnapshots bool,
+) (*eventstore.Stream, error) {
+	db := s.Db.WithContext(ctx)
+
+	var wallet domain.Wallet
+	if err := db.Where("id = ?", walletID).Limit(1).Find(&wallet).Error; err != nil {
+		return nil, dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to get wallet record with err %v", err)),
+			"BalanceAt",
+		)
+	}
+	if wallet.ID == 0 {
+		return nil, dto.Wrap(
+			domain.NewError(domain.ErrNotFound, "wallet not found", nil),
+			"BalanceAt",
+		)
+	}
+
+	var snapshot *domain.WalletSnapshot
+	if fromSnapshots {
+		var snapshots []domain.WalletSnapshot
+		if err := db.Where("wallet_id = ? AND created_at <= ?", walletID, at).
+			Order("version DESC").
+			Limit(1).
+			Find(&snapshots).
+			Error; err != nil {
+			return nil, dto.Wrap(
+				databaseUnavailable(fmt.Errorf("failed to get wallet snapshot with err %v", err)),
+				"BalanceAt",
+			)
+		}
+		if len(snapshots) == 1 {
+			snapshot = &snapshots[0]
+		}
+	}
+
+	var after uint64
+	if snapshot != nil {
+		after = snapshot.Version
+	}
+	var events []domain.WalletEvent
+	if err := db.Where("wallet_id = ? AND version > ? AND created_at <= ?", walletID, after, at).
+		Order("version").
+		Find(&events).
+		Error; err != nil {
+		return nil, dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to get wallet events with err %v", err)),
+			"BalanceAt",
+		)
+	}
+
+	stream, err := eventstore.Replay(walletID, wallet.Balance, snapshot, events)
+	if err != nil {
+		return nil, dto.Wrap(err, "BalanceAt")
+	}
+	return &stream, nil
+}
+
+// ScanBalances replays the streams of the wallets after the given wallet ID, in ID
+// order, since their latest snapshots without going through the cache
+func (s *EventStore) ScanBalances(
+	ctx context.Context,
+	afterID int,
+	limit int,
+) ([]domain.Wallet, error) {
+	db := s.Db.WithContext(ctx)
+
+	var walletIDs []int
+	if err := db.Model(&domain.Wallet{}).
+		Where("id > ?", afterID).
+		Order("id").
+		Limit(limit).
+		Pluck("id", &walletIDs).
+		Error; err != nil {
+		return nil, dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to scan wallet records with err %v", err)),
+			"ScanBalances",
+		)
+	}
+	if len(walletIDs) == 0 {
+		return nil, nil
+	}
+
+	streams, err := loadStreams(ctx, db, walletIDs, false)
+	if err != nil {
+		return nil, dto.Wrap(err, "ScanBalances")
+	}
+
+	wallets := make([]domain.Wallet, 0, len(walletIDs))
+	for _, walletID := range walletIDs {
+		if stream, ok := streams[walletID]; ok {
+			wallets = append(wallets, *stream.Wallet())
+		}
+	}
+
+	return wallets, nil
+}
+
+// GetBalanceAsOf retrieves the balance a wallet had at the given moment by replaying
+// its events from the latest snapshot taken by then
+func (s *EventStore) GetBalanceAsOf(
+	ctx context.Context,
+	walletID int,
+	asOf time.Time,
+) (*domain.Wallet, error) {
+	stream, err := s.BalanceAt(ctx, walletID, asOf, true)
+	if err != nil {
+		return nil, dto.Wrap(err, "GetBalanceAsOf")
+	}
+	return stream.Wallet(), nil
+}
+
+// ScanBalancesAsOf replays the streams of the wallets after the given wallet ID, in
+// ID order, up to the given moment from the latest snapshots taken by then, leaving
+// out the wallets opened after it
+func (s *EventStore) ScanBalancesAsOf(
+	ctx context.Context,
+	afterID int,
+	limit int,
+	asOf time.Time,
+) ([]domain.Wallet, error) {
+	var walletIDs []int
+	if err := s.Db.WithContext(ctx).Model(&domain.Wallet{}).
+		Where("id > ? AND (created_at IS NULL OR created_at <= ?)", afterID, asOf).
+		Order("id").
+		Limit(limit).
+		Pluck("id", &walletIDs).
+		Error; err != nil {
+		return nil, dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to scan wallet records with err %v", err)),
+			"ScanBalancesAsOf",
+		)
+	}
+
+	wallets := make([]domain.Wallet, 0, len(walletIDs))
+	for _, walletID := range walletIDs {
+		stream, err := s.BalanceAt(ctx, walletID, asOf, true)
+		if errors.Is(err, domain.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, dto.Wrap(err, "ScanBalancesAsOf")
+		}
+		wallets = append(wallets, *stream.Wallet())
+	}
+
+	return wallets, nil
+}
+
+// loadStreams replays the streams of the wallets since their latest snapshots.
+// With lock the wallets are row locked, in ID order, until the transaction ends
+// so that their streams are appended to one transaction at a time. Wallets that
+// do not exist are left out of the result
+func loadStreams(
+	ctx context.Context,
+	db *gorm.DB,
+	walletIDs []int,
+	lock bool,
+) (map[int]*eventstore.Stream, error) {
+	query := func() *gorm.DB {
+		q := db.WithContext(ctx)
+		if lock {
+			// locking reads see the latest committed events rather than a read view
+			q = q.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		return q
+	}
+
+	var wallets []domain.Wallet
+	if err := query().Where("id IN ?", walletIDs).Order("id").Find(&wallets).Error; err != nil {
+		return nil, databaseUnavailable(fmt.Errorf("failed to get wallet records with err %v", err))
+	}
+	if len(wallets) == 0 {
+		return map[int]*eventstore.Stream{}, nil
+	}
+
+	latest := db.WithContext(ctx).Model(&domain.WalletSnapshot{}).
+		Select("wallet_id, MAX(version)").
+		Where("wallet_id IN ?", walletIDs).
+		Group("wallet_id")
+	var snapshots []domain.WalletSnapshot
+	if err := query().Where("(wallet_id, version) IN (?)", latest).Find(&snapshots).Error; err != nil {
+		return nil, databaseUnavailable(fmt.Errorf("failed to get wallet snapshots with err %v", err))
+	}
+	bySnapshot := map[int]*domain.WalletSnapshot{}
+	for i := range snapshots {
+		bySnapshot[snapshots[i].WalletID] = &snapshots[i]
+	}
+
+	var events []domain.WalletEvent
+	if err := query().
+		Where("wallet_id IN ?", walletIDs).
+		Where("version > COALESCE((SELECT MAX(s.version) FROM wallet_snapshots s WHERE s.wallet_id = wallet_events.wallet_id), 0)").
+		Order("wallet_id, version").
+		Find(&events).
+		Error; err != nil {
+		return nil, databaseUnavailable(fmt.Errorf("failed to get wallet events with err %v", err))
+	}
+	byWallet := map[int][]domain.WalletEvent{}
+	for _, event := range events {
+		byWallet[event.WalletID] = append(byWallet[event.WalletID], event)
+	}
+
+	streams := make(map[int]*eventstore.Stream, len(wallets))
+	for _, wallet := range wallets {
+		stream, err := eventstore.Replay(wallet.ID, wallet.Balance, bySnapshot[wallet.ID], byWallet[wallet.ID])
+		if err != nil {
+			return nil, err
+		}
+		stream.Frozen = wallet.Frozen
+		streams[wallet.ID] = &stream
+	}
+
+	return streams, nil
+}
+
+// eventTx is the event store bound to a single transaction. Batches are claimed
+// and saved like they are by the wallet database layer
+type eventTx struct {
+	*walletTx
+	store   *EventStore
+	streams map[int]*eventstore.Stream
+}
+
+// LockWallets row locks the wallets until the transaction ends and replays their streams.
+// Wallets that do not exist are left out of the result
+func (tx *eventTx) LockWallets(
+	ctx context.Context,
+	walletIDs []int,
+) (map[int]*domain.Wallet, error) {
+	streams, err := loadStreams(ctx, tx.db, walletIDs, true)
+	if err != nil {
+		return nil, dto.Wrap(err, "LockWallets")
+	}
+
+	wallets := make(map[int]*domain.Wallet, len(streams))
+	for walletID, stream := range streams {
+		tx.streams[walletID] = stream
+		wallets[walletID] = stream.Wallet()
+	}
+
+	return wallets, nil
+}
+
+// UpdateBalance appends the ledger transaction's change to a locked wallet's stream within
+// the transaction, posting the transaction and recording it in the audit log and the outbox
+func (tx *eventTx) UpdateBalance(
+	ctx context.Context,
+	wallet *domain.Wallet,
+	txn *domain.LedgerTransaction,
+) (*domain.Wallet, error) {
+	if wallet == nil {
+		return nil, fmt.Errorf("no wallet has been passed")
+	}
+
+	stream, ok := tx.streams[wallet.ID]
+	if !ok {
+		if _, err := tx.LockWallets(ctx, []int{wallet.ID}); err != nil {
+			return nil, dto.Wrap(err, "UpdateBalance")
+		}
+		if stream, ok = tx.streams[wallet.ID]; !ok {
+			return nil, dto.Wrap(
+				domain.NewError(domain.ErrNotFound, "wallet not found", nil),
+				"UpdateBalance",
+			)
+		}
+	}
+
+	updated, err := tx.store.appendChange(ctx, tx.db, stream, txn)
+	if err != nil {
+		return nil, dto.Wrap(err, "UpdateBalance")
+	}
+	tx.updated[wallet.ID] = updated
+
+	return updated, nil
+}
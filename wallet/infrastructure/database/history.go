@@ -0,0 +1,208 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// GetBalanceAsOf retrieves the balance a wallet had at the given moment from its balance
+// history. Each lookup is a single seek on the (wallet_id, created_at) index, however long
+// the history is. A wallet that had not been changed by then has the balance its first
+// change started from, or its current balance when it has never been changed
+func (db *WalletDb) GetBalanceAsOf(
+	ctx context.Context,
+	walletID int,
+	asOf time.Time,
+) (*domain.Wallet, error) {
+	tx := db.Db.WithContext(ctx)
+
+	var entries []domain.BalanceEntry
+	if err := tx.Where("wallet_id = ? AND created_at <= ?", walletID, asOf).
+		Order("created_at DESC, id DESC").
+		Limit(1).
+		Find(&entries).
+		Error; err != nil {
+		return nil, dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to get balance history with err %v", err)),
+			"GetBalanceAsOf",
+		)
+	}
+	if len(entries) == 1 {
+		return &domain.Wallet{ID: walletID, Balance: entries[0].Balance}, nil
+	}
+
+	if err := tx.Where("wallet_id = ? AND created_at > ?", walletID, asOf).
+		Order("created_at, id").
+		Limit(1).
+		Find(&entries).
+		Error; err != nil {
+		return nil, dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to get balance history with err %v", err)),
+			"GetBalanceAsOf",
+		)
+	}
+	if len(entries) == 1 {
+		return &domain.Wallet{ID: walletID, Balance: entries[0].Previous}, nil
+	}
+
+	var wallets []domain.Wallet
+	if err := tx.Where("id = ?", walletID).Limit(1).Find(&wallets).Error; err != nil {
+		return nil, dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to get wallet record with err %v", err)),
+			"GetBalanceAsOf",
+		)
+	}
+	if len(wallets) == 0 {
+		return nil, dto.Wrap(
+			domain.NewError(domain.ErrNotFound, "wallet not found", nil),
+			"GetBalanceAsOf",
+		)
+	}
+
+	return &wallets[0], nil
+}
+
+// ScanBalancesAsOf reads the balances the wallets after the given wallet ID, in ID order,
+// had at the given moment, leaving out the wallets opened after it. The balance history
+// of the whole chunk is looked up together, a wallet's latest entry by then being the
+// one GetBalanceAsOf reads: the latest by creation time, then ID, since backdated
+// entries such as the opening balances are appended after the ones they precede
+func (db *WalletDb) ScanBalancesAsOf(
+	ctx context.Context,
+	afterID int,
+	limit int,
+	asOf time.Time,
+) ([]domain.Wallet, error) {
+	var wallets []domain.Wallet
+	// wallets opened before their opening was recorded have been open all along
+	if err := db.Db.WithContext(ctx).
+		Where("id > ? AND (created_at IS NULL OR created_at <= ?)", afterID, asOf).
+		Order("id").
+		Limit(limit).
+		Find(&wallets).
+		Error; err != nil {
+		return nil, dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to scan wallet records with err %v", err)),
+			"ScanBalancesAsOf",
+		)
+	}
+	if len(wallets) == 0 {
+		return nil, nil
+	}
+
+	walletIDs := make([]int, len(wallets))
+	for i, wallet := range wallets {
+		walletIDs[i] = wallet.ID
+	}
+	balances, err := db.historyEntries(ctx, true, "created_at <= ?", walletIDs, asOf)
+	if err != nil {
+		return nil, dto.Wrap(err, "ScanBalancesAsOf")
+	}
+	var unchanged []int
+	for _, walletID := range walletIDs {
+		if _, ok := balances[walletID]; !ok {
+			unchanged = append(unchanged, walletID)
+		}
+	}
+
+	// a wallet only changed afterwards had the balance its first change started from
+	if len(unchanged) > 0 {
+		later, err := db.historyEntries(ctx, false, "created_at > ?", unchanged, asOf)
+		if err != nil {
+			return nil, dto.Wrap(err, "ScanBalancesAsOf")
+		}
+		for walletID, entry := range later {
+			entry.Balance = entry.Previous
+			balances[walletID] = entry
+		}
+	}
+
+	for i := range wallets {
+		if entry, ok := balances[wallets[i].ID]; ok {
+			wallets[i].Balance = entry.Balance
+		}
+	}
+	return wallets, nil
+}
+
+// historyEntries picks one balance history entry of each of the wallets among their
+// entries that match the condition: the latest by creation time then ID, or the earliest
+func (db *WalletDb) historyEntries(
+	ctx context.Context,
+	latest bool,
+	condition string,
+	walletIDs []int,
+	at time.Time,
+) (map[int]domain.BalanceEntry, error) {
+	tx := db.Db.WithContext(ctx)
+
+	pick := "MIN(created_at)"
+	if latest {
+		pick = "MAX(created_at)"
+	}
+	var moments []struct {
+		WalletID  int
+		CreatedAt time.Time
+	}
+	if err := tx.Model(&domain.BalanceEntry{}).
+		Select("wallet_id, "+pick+" AS created_at").
+		Where("wallet_id IN ?", walletIDs).
+		Where(condition, at).
+		Group("wallet_id").
+		Scan(&moments).
+		Error; err != nil {
+		return nil, databaseUnavailable(fmt.Errorf("failed to get balance history with err %v", err))
+	}
+
+	entries := make(map[int]domain.BalanceEntry, len(moments))
+	if len(moments) == 0 {
+		return entries, nil
+	}
+	pairs := make([][]interface{}, len(moments))
+	for i, moment := range moments {
+		pairs[i] = []interface{}{moment.WalletID, moment.CreatedAt}
+	}
+	var found []domain.BalanceEntry
+	if err := tx.Where("(wallet_id, created_at) IN ?", pairs).Find(&found).Error; err != nil {
+		return nil, databaseUnavailable(fmt.Errorf("failed to get balance history with err %v", err))
+	}
+
+	// entries created at the same moment are told apart by their IDs
+	for _, entry := range found {
+		picked, ok := entries[entry.WalletID]
+		if !ok || (latest && entry.ID > picked.ID) || (!latest && entry.ID < picked.ID) {
+			entries[entry.WalletID] = entry
+		}
+	}
+	return entries, nil
+}
+
+// recordBalanceEntry appends a wallet's new balance to its balance history
+// within the transaction that changed it
+func recordBalanceEntry(
+	ctx context.Context,
+	tx *gorm.DB,
+	walletID int,
+	previous decimal.Decimal,
+	balance decimal.Decimal,
+) error {
+	entry := domain.BalanceEntry{
+		WalletID: walletID,
+		Previous: previous,
+		Balance:  balance,
+	}
+	if err := tx.WithContext(ctx).Create(&entry).Error; err != nil {
+		return dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to write balance history with err %v", err)),
+			"recordBalanceEntry",
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Ledger reads the balances of ledger accounts from their postings
+type Ledger struct {
+	Db *gorm.DB
+}
+
+// NewLedger initializes the ledger stored in the given database
+func NewLedger(gorm *gorm.DB) *Ledger {
+	l := &Ledger{
+		Db: gorm,
+	}
+	l.checkPreconditions()
+	return l
+}
+
+func (l *Ledger) checkPreconditions() {
+	if l.Db == nil {
+		log.Panicf("error initializing ledger, ORM has not been initialized")
+	}
+}
+
+// LedgerBalances sums the postings of the wallets' ledger accounts. Wallets
+// without any posting are left out of the result
+func (l *Ledger) LedgerBalances(
+	ctx context.Context,
+	walletIDs []int,
+) (map[int]decimal.Decimal, error) {
+	accounts := make([]string, len(walletIDs))
+	walletByAccount := make(map[string]int, len(walletIDs))
+	for i, walletID := range walletIDs {
+		accounts[i] = domain.WalletAccount(walletID)
+		walletByAccount[accounts[i]] = walletID
+	}
+
+	var sums []struct {
+		Account string
+		Balance decimal.Decimal
+	}
+	if err := l.Db.WithContext(ctx).Model(&domain.Posting{}).
+		Select("account, SUM(amount) AS balance").
+		Where("account IN ?", accounts).
+		Group("account").
+		Scan(&sums).
+		Error; err != nil {
+		return nil, dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to sum ledger postings with err %v", err)),
+			"LedgerBalances",
+		)
+	}
+
+	balances := make(map[int]decimal.Decimal, len(sums))
+	for _, sum := range sums {
+		balances[walletByAccount[sum.Account]] = sum.Balance
+	}
+
+	return balances, nil
+}
+
+// ListPostings retrieves an account's postings made between from, inclusive, and to,
+// exclusive, in the order they were made. Pages are read after the given posting along
+// the (account, created_at) index, so that every page is as quick to read as the first
+func (l *Ledger) ListPostings(
+	ctx context.Context,
+	account string,
+	from time.Time,
+	to time.Time,
+	after *domain.Posting,
+	limit int,
+) ([]domain.Posting, error) {
+	query := l.Db.WithContext(ctx).
+		Where("account = ? AND created_at >= ? AND created_at < ?", account, from, to)
+	if after != nil {
+		query = query.Where(
+			"(created_at > ? OR (created_at = ? AND id > ?))",
+			after.CreatedAt,
+			after.CreatedAt,
+			after.ID,
+		)
+	}
+
+	var postings []domain.Posting
+	if err := query.Order("created_at, id").Limit(limit).Find(&postings).Error; err != nil {
+		return nil, dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to list ledger postings with err %v", err)),
+			"ListPostings",
+		)
+	}
+
+	return postings, nil
+}
+
+// PostingTotals sums the debits and credits posted between from, inclusive, and to,
+// exclusive, by account type. Types without any posting are left out of the result
+func (l *Ledger) PostingTotals(
+	ctx context.Context,
+	from time.Time,
+	to time.Time,
+) ([]domain.SettlementTotal, error) {
+	var totals []domain.SettlementTotal
+	if err := l.Db.WithContext(ctx).Model(&domain.Posting{}).
+		Select(
+			"CASE WHEN account LIKE ? THEN ? ELSE account END AS account_type, "+
+				"SUM(CASE WHEN amount > 0 THEN amount ELSE 0 END) AS debits, "+
+				"SUM(CASE WHEN amount < 0 THEN -amount ELSE 0 END) AS credits, "+
+				"COUNT(*) AS postings",
+			domain.WalletAccountPrefix+"%",
+			domain.AccountTypeWallet,
+		).
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Group("account_type").
+		Order("account_type").
+		Scan(&totals).
+		Error; err != nil {
+		return nil, dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to sum ledger postings with err %v", err)),
+			"PostingTotals",
+		)
+	}
+
+	return totals, nil
+}
+
+// postTransaction writes the postings of a ledger transaction within the
+// database transaction that changes the balances it moves money between
+func postTransaction(
+	ctx context.Context,
+	tx *gorm.DB,
+	txn *domain.LedgerTransaction,
+) error {
+	if txn == nil || len(txn.Postings) == 0 {
+		return fmt.Errorf("no ledger transaction has been passed")
+	}
+
+	if err := tx.WithContext(ctx).Create(&txn.Postings).Error; err != nil {
+		return dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to post ledger transaction with err %v", err)),
+			"postTransaction",
+		)
+	}
+
+	return nil
+}
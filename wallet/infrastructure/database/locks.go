@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// withLock runs fn on a connection holding the named MySQL lock, waiting up to wait for
+// it, and releases the lock once fn returns. The lock is shared by every instance using
+// the database and is released on its own if the connection is lost. It reports false,
+// without running fn, when the lock is still held elsewhere after waiting
+func withLock(
+	ctx context.Context,
+	db *gorm.DB,
+	name string,
+	wait time.Duration,
+	fn func(conn *gorm.DB) error,
+) (bool, error) {
+	acquired := false
+	err := db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		var got sql.NullInt64
+		if err := conn.Raw("SELECT GET_LOCK(?, ?)", name, int(wait.Seconds())).Scan(&got).Error; err != nil {
+			return databaseUnavailable(fmt.Errorf("failed to get lock %s with err %v", name, err))
+		}
+		if !got.Valid || got.Int64 != 1 {
+			return nil
+		}
+		acquired = true
+		// the lock is released even when the context fn ran with is done
+		defer conn.WithContext(context.Background()).Exec("DO RELEASE_LOCK(?)", name)
+
+		return fn(conn)
+	})
+
+	return acquired, err
+}
+
+// JobLock makes sure a periodic job runs on a single instance at a time
+type JobLock struct {
+	Db   *gorm.DB
+	Name string
+}
+
+// NewJobLock initializes the lock of the named job, shared by every instance using the database
+func NewJobLock(gorm *gorm.DB, name string) *JobLock {
+	l := &JobLock{
+		Db:   gorm,
+		Name: name,
+	}
+	l.checkPreconditions()
+	return l
+}
+
+func (l *JobLock) checkPreconditions() {
+	if l.Db == nil {
+		log.Panicf("job lock has not initialized a database")
+	}
+	if l.Name == "" {
+		log.Panicf("job lock has not been named")
+	}
+}
+
+// Do runs fn unless another instance is running the job, without waiting for it,
+// and reports whether fn ran
+func (l *JobLock) Do(
+	ctx context.Context,
+	fn func(ctx context.Context) error,
+) (bool, error) {
+	return withLock(ctx, l.Db, l.Name, 0, func(conn *gorm.DB) error {
+		return fn(ctx)
+	})
+}
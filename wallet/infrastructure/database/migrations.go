@@ -0,0 +1,243 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// migrationChunk is how many wallets a data migration changes per transaction
+const migrationChunk = 500
+
+// openingBalancesMigration posts the balances wallets held before the ledger was introduced
+const openingBalancesMigration = "opening_balances"
+
+// closingBalanceClosesMigration keys closing balances by the close that wrote them
+const closingBalanceClosesMigration = "closing_balance_closes"
+
+// migrateData applies the data migrations that have not been applied yet
+func migrateData(db *gorm.DB) error {
+	if err := runOnce(db, openingBalancesMigration, postOpeningBalances); err != nil {
+		return err
+	}
+	return runOnce(db, closingBalanceClosesMigration, keyClosingBalancesByClose)
+}
+
+// keyClosingBalancesByClose adds the close that wrote them to the primary key of
+// closing balances written before they were staged, which the schema migration
+// leaves as it was. Days closed before then, and their closing balances, have no
+// close ID and keep pointing at each other
+func keyClosingBalancesByClose(db *gorm.DB) error {
+	var keyed int64
+	if err := db.Raw(
+		"SELECT COUNT(*) FROM information_schema.key_column_usage " +
+			"WHERE table_schema = DATABASE() AND table_name = 'closing_balances' " +
+			"AND constraint_name = 'PRIMARY' AND column_name = 'close_id'",
+	).Scan(&keyed).Error; err != nil {
+		return databaseUnavailable(fmt.Errorf("failed to read the closing balances' primary key with err %v", err))
+	}
+	if keyed > 0 {
+		return nil
+	}
+
+	if err := db.Exec(
+		"ALTER TABLE closing_balances DROP PRIMARY KEY, ADD PRIMARY KEY (day, currency, close_id, wallet_id)",
+	).Error; err != nil {
+		return databaseUnavailable(fmt.Errorf("failed to key closing balances by close with err %v", err))
+	}
+	return nil
+}
+
+// runOnce applies a data migration unless it has been applied already. A migration is
+// only recorded once it has completed, so it has to be safe to apply again when it
+// failed half way or another instance applied it at the same time
+func runOnce(db *gorm.DB, name string, migrate func(db *gorm.DB) error) error {
+	var applied int64
+	if err := db.Model(&domain.Migration{}).Where("name = ?", name).Count(&applied).Error; err != nil {
+		return dto.Wrap(fmt.Errorf("failed to read migration %s with err %v", name, err), "runOnce")
+	}
+	if applied > 0 {
+		return nil
+	}
+
+	if err := migrate(db); err != nil {
+		return dto.Wrap(fmt.Errorf("failed to apply migration %s with err %v", name, err), "runOnce")
+	}
+
+	migration := domain.Migration{Name: name, AppliedAt: time.Now().UTC()}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&migration).Error; err != nil {
+		return dto.Wrap(fmt.Errorf("failed to record migration %s with err %v", name, err), "runOnce")
+	}
+
+	return nil
+}
+
+// postOpeningBalances posts, against the opening balances account, the part of every
+// wallet's balance its ledger postings do not account for: the money it held before the
+// ledger was introduced. The opening is dated just before the wallet's first posting or
+// balance history entry, and appended to its balance history, so that statements and
+// closing balances add up from it. Wallets are locked a chunk at a time while their
+// opening is worked out, so applying it again posts nothing more
+func postOpeningBalances(db *gorm.DB) error {
+	ctx := context.Background()
+
+	afterID := 0
+	for {
+		var walletIDs []int
+		if err := db.WithContext(ctx).Model(&domain.Wallet{}).
+			Where("id > ?", afterID).
+			Order("id").
+			Limit(migrationChunk).
+			Pluck("id", &walletIDs).
+			Error; err != nil {
+			return databaseUnavailable(fmt.Errorf("failed to scan wallet records with err %v", err))
+		}
+		if len(walletIDs) == 0 {
+			return nil
+		}
+		afterID = walletIDs[len(walletIDs)-1]
+
+		if err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return postOpeningChunk(ctx, tx, walletIDs)
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+func postOpeningChunk(ctx context.Context, tx *gorm.DB, walletIDs []int) error {
+	var wallets []domain.Wallet
+	if err := tx.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", walletIDs).
+		Order("id").
+		Find(&wallets).
+		Error; err != nil {
+		return databaseUnavailable(fmt.Errorf("failed to lock wallet records with err %v", err))
+	}
+
+	// an event sourced wallet's balance is its opening balance and the changes in its stream
+	var changes []struct {
+		WalletID int
+		Amount   decimal.Decimal
+	}
+	if err := tx.WithContext(ctx).Model(&domain.WalletEvent{}).
+		Select("wallet_id, SUM(amount) AS amount").
+		Where("wallet_id IN ? AND type <> ?", walletIDs, domain.EventWalletOpened).
+		Group("wallet_id").
+		Scan(&changes).
+		Error; err != nil {
+		return databaseUnavailable(fmt.Errorf("failed to sum wallet events with err %v", err))
+	}
+	changed := make(map[int]decimal.Decimal, len(changes))
+	for _, change := range changes {
+		changed[change.WalletID] = change.Amount
+	}
+
+	posted, err := NewLedger(tx).LedgerBalances(ctx, walletIDs)
+	if err != nil {
+		return err
+	}
+	firsts, err := firstChanges(ctx, tx, walletIDs)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, wallet := range wallets {
+		opening := wallet.Balance.Add(changed[wallet.ID]).Sub(posted[wallet.ID])
+		if opening.IsZero() {
+			continue
+		}
+
+		at := now
+		if first, ok := firsts[wallet.ID]; ok {
+			// dates are kept to the millisecond
+			at = first.Add(-time.Millisecond)
+		}
+		id, err := openingTransactionID()
+		if err != nil {
+			return err
+		}
+		postings := []domain.Posting{
+			{TransactionID: id, Account: domain.WalletAccount(wallet.ID), Amount: opening, CreatedAt: at},
+			{TransactionID: id, Account: domain.AccountOpeningBalances, Amount: opening.Neg(), CreatedAt: at},
+		}
+		if err := tx.WithContext(ctx).Create(&postings).Error; err != nil {
+			return databaseUnavailable(fmt.Errorf("failed to post opening balance with err %v", err))
+		}
+		entry := domain.BalanceEntry{WalletID: wallet.ID, Previous: decimal.Zero, Balance: opening, CreatedAt: at}
+		if err := tx.WithContext(ctx).Create(&entry).Error; err != nil {
+			return databaseUnavailable(fmt.Errorf("failed to write balance history with err %v", err))
+		}
+	}
+
+	return nil
+}
+
+// firstChanges finds when each of the wallets was first posted to or had its balance
+// history written. Wallets that have never been changed are left out of the result
+func firstChanges(ctx context.Context, tx *gorm.DB, walletIDs []int) (map[int]time.Time, error) {
+	accounts := make([]string, len(walletIDs))
+	walletByAccount := make(map[string]int, len(walletIDs))
+	for i, walletID := range walletIDs {
+		accounts[i] = domain.WalletAccount(walletID)
+		walletByAccount[accounts[i]] = walletID
+	}
+
+	var postings []struct {
+		Account string
+		First   time.Time
+	}
+	if err := tx.WithContext(ctx).Model(&domain.Posting{}).
+		Select("account, MIN(created_at) AS first").
+		Where("account IN ?", accounts).
+		Group("account").
+		Scan(&postings).
+		Error; err != nil {
+		return nil, databaseUnavailable(fmt.Errorf("failed to read ledger postings with err %v", err))
+	}
+	var entries []struct {
+		WalletID int
+		First    time.Time
+	}
+	if err := tx.WithContext(ctx).Model(&domain.BalanceEntry{}).
+		Select("wallet_id, MIN(created_at) AS first").
+		Where("wallet_id IN ?", walletIDs).
+		Group("wallet_id").
+		Scan(&entries).
+		Error; err != nil {
+		return nil, databaseUnavailable(fmt.Errorf("failed to read balance history with err %v", err))
+	}
+
+	firsts := make(map[int]time.Time, len(postings)+len(entries))
+	earliest := func(walletID int, at time.Time) {
+		if first, ok := firsts[walletID]; !ok || at.Before(first) {
+			firsts[walletID] = at
+		}
+	}
+	for _, posting := range postings {
+		earliest(walletByAccount[posting.Account], posting.First)
+	}
+	for _, entry := range entries {
+		earliest(entry.WalletID, entry.First)
+	}
+
+	return firsts, nil
+}
+
+// openingTransactionID identifies the ledger transaction of a wallet's opening balance
+func openingTransactionID() (string, error) {
+	bs := make([]byte, 16)
+	if _, err := rand.Read(bs); err != nil {
+		return "", fmt.Errorf("failed to generate a ledger transaction ID with err %v", err)
+	}
+	return hex.EncodeToString(bs), nil
+}
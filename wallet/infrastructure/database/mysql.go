@@ -2,31 +2,47 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
+	"time"
 
 	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
 	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/audit"
 	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/cache"
-	"github.com/shopspring/decimal"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/metrics"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/tracing"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository"
+	"golang.org/x/sync/singleflight"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // WalletDb sets up wallet's API server database layer
 // with all the necessary dependencies
 type WalletDb struct {
-	Db    *gorm.DB
-	Cache cache.WalletCache
+	Db       *gorm.DB
+	Cache    cache.WalletCache
+	AuditKey audit.Key
+	Logger   *slog.Logger
+
+	// misses coalesces concurrent cache misses on the same wallet
+	// so that only one of them falls through to the database
+	misses singleflight.Group
 }
 
 // NewWalletDb initializes a new wallet server database instance
-// that meets all the preconsitions checks
-func NewWalletDb(gorm *gorm.DB, c cache.WalletCache) *WalletDb {
+// that meets all the preconsitions checks. Changes are audited with the key
+func NewWalletDb(gorm *gorm.DB, c cache.WalletCache, auditKey audit.Key, logger *slog.Logger) *WalletDb {
 	db := WalletDb{
-		Db:    gorm,
-		Cache: c,
+		Db:       gorm,
+		Cache:    c,
+		AuditKey: auditKey,
+		Logger:   logger,
 	}
 	db.checkPreconditions()
 
@@ -42,6 +58,9 @@ func (db *WalletDb) checkPreconditions() {
 			"error initializing database, Cache service has not been initialized",
 		)
 	}
+	if db.Logger == nil {
+		log.Panicf("error initializing database, logger has not been initialized")
+	}
 }
 
 // ConnectToDatabase opens a connection to the database
@@ -61,6 +80,12 @@ func ConnectToDatabase() (*gorm.DB, error) {
 			"ConnectToDatabase",
 		)
 	}
+	if err := db.Use(metrics.GormPlugin{}); err != nil {
+		return nil, dto.Wrap(err, "ConnectToDatabase")
+	}
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		return nil, dto.Wrap(err, "ConnectToDatabase")
+	}
 
 	if err := autoMigrate(db); err != nil {
 		return nil, dto.Wrap(err, "ConnectToDatabase")
@@ -69,9 +94,28 @@ func ConnectToDatabase() (*gorm.DB, error) {
 	return db, nil
 }
 
+// databaseUnavailable classifies a failed query as the database being unavailable
+func databaseUnavailable(err error) error {
+	return domain.NewError(domain.ErrUnavailable, "the database is unavailable", err)
+}
+
 func autoMigrate(db *gorm.DB) error {
 	tables := []interface{}{
 		&domain.Wallet{},
+		&domain.Batch{},
+		&domain.AuditRecord{},
+		&domain.AuditHead{},
+		&domain.OutboxEvent{},
+		&domain.WebhookSubscription{},
+		&domain.WebhookDelivery{},
+		&domain.WalletEvent{},
+		&domain.WalletSnapshot{},
+		&domain.BalanceEntry{},
+		&domain.Posting{},
+		&domain.ClosingBalance{},
+		&domain.SettlementTotal{},
+		&domain.DayClose{},
+		&domain.Migration{},
 	}
 	for _, table := range tables {
 		if err := db.AutoMigrate(table); err != nil {
@@ -82,13 +126,103 @@ func autoMigrate(db *gorm.DB) error {
 		}
 	}
 
+	if err := migrateData(db); err != nil {
+		return dto.Wrap(err, "autoMigrate")
+	}
+
 	return nil
 }
 
-// GetBalance retrieves a wallet balance for the supplied wallet ID
+// GetBalance retrieves a wallet balance for the supplied wallet ID.
+// Concurrent lookups of the same wallet share a single cache/database round trip
 func (db *WalletDb) GetBalance(
 	ctx context.Context,
 	walletID int,
+) (*domain.Wallet, error) {
+	results := db.misses.DoChan(fmt.Sprint(walletID), func() (interface{}, error) {
+		// the shared lookup must not be cancelled by whichever caller started it
+		// going away, but it is still bound by that caller's deadline
+		lookupCtx, cancel := detach(ctx)
+		defer cancel()
+
+		return db.getBalance(lookupCtx, walletID)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, dto.Wrap(ctx.Err(), "GetBalance")
+
+	case res := <-results:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+
+		// every caller gets its own copy since the wallet is shared between them
+		wallet := *res.Val.(*domain.Wallet)
+		return &wallet, nil
+	}
+}
+
+// detach returns a context that keeps its parent's values and deadline
+// but is not cancelled when its parent is
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached := detachedContext{parent: ctx}
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(detached, deadline)
+	}
+	return context.WithCancel(detached)
+}
+
+type detachedContext struct {
+	parent context.Context
+}
+
+func (d detachedContext) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (d detachedContext) Done() <-chan struct{}             { return nil }
+func (d detachedContext) Err() error                        { return nil }
+func (d detachedContext) Value(key interface{}) interface{} { return d.parent.Value(key) }
+
+// cacheTimeout bounds caching the balances changed by a committed transaction
+const cacheTimeout = 2 * time.Second
+
+// cacheChanged caches the balances of wallets changed by a committed transaction. It
+// runs on a context of its own, since the change stands whether or not its caller is
+// still waiting, and a failure is logged rather than returned for the same reason. A
+// wallet that can not be cached is evicted instead, so that the balance cached before
+// the change is not served, and one that can not be evicted either is skipped by the
+// in-memory tier's reads until it is
+func cacheChanged(ctx context.Context, c cache.WalletCache, logger *slog.Logger, wallets ...*domain.Wallet) {
+	cacheCtx, cancel := context.WithTimeout(detachedContext{parent: ctx}, cacheTimeout)
+	defer cancel()
+
+	for _, wallet := range wallets {
+		_, err := c.CacheBalance(cacheCtx, wallet)
+		if err == nil {
+			continue
+		}
+
+		if evictErr := c.EvictBalance(cacheCtx, wallet.ID); evictErr != nil {
+			logger.ErrorContext(
+				ctx,
+				"failed to cache or evict changed wallet balance",
+				slog.Int("wallet_id", wallet.ID),
+				slog.String("error", err.Error()),
+				slog.String("evict_error", evictErr.Error()),
+			)
+			continue
+		}
+		logger.WarnContext(
+			ctx,
+			"failed to cache changed wallet balance, evicted it instead",
+			slog.Int("wallet_id", wallet.ID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+func (db *WalletDb) getBalance(
+	ctx context.Context,
+	walletID int,
 ) (*domain.Wallet, error) {
 	cachedBalance, err := db.Cache.GetCachedBalance(ctx, walletID)
 	if err != nil {
@@ -100,39 +234,351 @@ func (db *WalletDb) GetBalance(
 	}
 
 	var wallet domain.Wallet
-	if err := db.Db.First(&wallet, walletID).Error; err != nil {
+	if err := db.Db.WithContext(ctx).First(&wallet, walletID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, dto.Wrap(
+				domain.NewError(domain.ErrNotFound, "wallet not found", err),
+				"GetBalance",
+			)
+		}
 		return nil, dto.Wrap(
-			fmt.Errorf("failed to get wallet record with err %v", err),
+			databaseUnavailable(fmt.Errorf("failed to get wallet record with err %v", err)),
 			"GetBalance",
 		)
 	}
 
+	// a failure to warm the cache should not fail the read itself
+	if err := db.Cache.FillBalance(ctx, &wallet); err != nil {
+		db.Logger.WarnContext(
+			ctx,
+			"failed to cache wallet balance",
+			slog.Int("wallet_id", wallet.ID),
+			slog.String("error", err.Error()),
+		)
+	}
+
 	return &wallet, nil
 }
 
-// UpdateBalance updates (credits/debits) a wallet's balance
+// GetBalances retrieves the balances of many wallets, reading the cache first and
+// fetching all the misses with a single query. Wallets that do not exist are left
+// out of the result
+func (db *WalletDb) GetBalances(
+	ctx context.Context,
+	walletIDs []int,
+) (map[int]*domain.Wallet, error) {
+	wallets, err := db.Cache.GetCachedBalances(ctx, walletIDs)
+	if err != nil {
+		return nil, dto.Wrap(err, "GetBalances")
+	}
+
+	var misses []int
+	for _, walletID := range walletIDs {
+		if _, ok := wallets[walletID]; !ok {
+			misses = append(misses, walletID)
+		}
+	}
+	if len(misses) == 0 {
+		return wallets, nil
+	}
+
+	var records []domain.Wallet
+	if err := db.Db.WithContext(ctx).Where("id IN ?", misses).Find(&records).Error; err != nil {
+		return nil, dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to get wallet records with err %v", err)),
+			"GetBalances",
+		)
+	}
+
+	for i := range records {
+		wallet := &records[i]
+		wallets[wallet.ID] = wallet
+
+		// a failure to warm the cache should not fail the read itself
+		if err := db.Cache.FillBalance(ctx, wallet); err != nil {
+			db.Logger.WarnContext(
+				ctx,
+				"failed to cache wallet balance",
+				slog.Int("wallet_id", wallet.ID),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+
+	return wallets, nil
+}
+
+// ScanBalances reads the balances of the wallets after the given wallet ID, in ID
+// order, straight from the database
+func (db *WalletDb) ScanBalances(
+	ctx context.Context,
+	afterID int,
+	limit int,
+) ([]domain.Wallet, error) {
+	var wallets []domain.Wallet
+	if err := db.Db.WithContext(ctx).Where("id > ?", afterID).
+		Order("id").
+		Limit(limit).
+		Find(&wallets).
+		Error; err != nil {
+		return nil, dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to scan wallet records with err %v", err)),
+			"ScanBalances",
+		)
+	}
+
+	return wallets, nil
+}
+
+// UpdateBalance changes (credits/debits) a wallet's balance by the ledger transaction's
+// postings on it unless it is frozen. The change is applied to the balance read under
+// the wallet's row lock, not the one passed in which may have been cached, and it is
+// posted, appended to the balance history and the audit log and its event written to
+// the outbox in the same transaction
 func (db *WalletDb) UpdateBalance(
 	ctx context.Context,
 	wallet *domain.Wallet,
-	balance decimal.Decimal,
+	txn *domain.LedgerTransaction,
 ) (*domain.Wallet, error) {
 	if wallet == nil {
 		return nil, fmt.Errorf("no wallet has been passed")
 	}
 
-	if err := db.Db.Model(&wallet).
-		Where("id = ?", wallet.ID).
-		Updates(domain.Wallet{Balance: balance}).
+	var updated *domain.Wallet
+	err := db.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		previous, err := lockWallet(ctx, tx, wallet.ID)
+		if err != nil {
+			return err
+		}
+		if previous.Frozen {
+			return errWalletFrozen
+		}
+
+		updated, err = changeBalance(ctx, tx, db.AuditKey, previous, txn)
+		return err
+	})
+	if err != nil {
+		return nil, dto.Wrap(err, "UpdateBalance")
+	}
+
+	cacheChanged(ctx, db.Cache, db.Logger, updated)
+
+	return updated, nil
+}
+
+// lockWallet reads and row locks a wallet until the transaction ends
+func lockWallet(
+	ctx context.Context,
+	tx *gorm.DB,
+	walletID int,
+) (*domain.Wallet, error) {
+	var wallet domain.Wallet
+	if err := tx.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&wallet, walletID).
+		Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, domain.NewError(domain.ErrNotFound, "wallet not found", err)
+		}
+		return nil, databaseUnavailable(fmt.Errorf("failed to lock wallet record with err %v", err))
+	}
+
+	return &wallet, nil
+}
+
+// changeBalance changes a locked wallet's balance by the ledger transaction's postings
+// on it, posting the transaction and recording the change in the balance history, the
+// audit log and the outbox. Money can not be taken out of a wallet below zero
+func changeBalance(
+	ctx context.Context,
+	tx *gorm.DB,
+	auditKey audit.Key,
+	previous *domain.Wallet,
+	txn *domain.LedgerTransaction,
+) (*domain.Wallet, error) {
+	if txn == nil {
+		return nil, fmt.Errorf("no ledger transaction has been passed")
+	}
+
+	change := txn.Change(domain.WalletAccount(previous.ID))
+	balance := previous.Balance.Add(change)
+	if change.IsNegative() && balance.IsNegative() {
+		return nil, errInsufficientFunds
+	}
+
+	if err := tx.WithContext(ctx).Model(&domain.Wallet{}).
+		Where("id = ?", previous.ID).
+		Update("balance", balance).
 		Error; err != nil {
+		return nil, databaseUnavailable(fmt.Errorf("failed to update wallet balance with err %v", err))
+	}
+
+	if err := postTransaction(ctx, tx, txn); err != nil {
+		return nil, err
+	}
+	if err := recordBalanceEntry(ctx, tx, previous.ID, previous.Balance, balance); err != nil {
+		return nil, err
+	}
+	if err := recordBalanceChange(ctx, tx, auditKey, previous.ID, previous.Balance, balance); err != nil {
+		return nil, err
+	}
+
+	return &domain.Wallet{ID: previous.ID, Balance: balance, Frozen: previous.Frozen}, nil
+}
+
+// GetBatch retrieves a processed batch by its idempotency key.
+// No batch is returned when the key has not been seen before
+func (db *WalletDb) GetBatch(
+	ctx context.Context,
+	idempotencyKey string,
+) (*domain.Batch, error) {
+	return getBatch(ctx, db.Db, idempotencyKey)
+}
+
+func getBatch(
+	ctx context.Context,
+	db *gorm.DB,
+	idempotencyKey string,
+) (*domain.Batch, error) {
+	var batch domain.Batch
+	err := db.WithContext(ctx).Where("idempotency_key = ?", idempotencyKey).
+		Limit(1).
+		Find(&batch).
+		Error
+	if err != nil {
 		return nil, dto.Wrap(
-			fmt.Errorf("failed to update wallet balance with err %v", err),
-			"UpdateBalance",
+			databaseUnavailable(fmt.Errorf("failed to get batch record with err %v", err)),
+			"GetBatch",
 		)
 	}
+	if batch.IdempotencyKey == "" {
+		return nil, nil
+	}
+
+	return &batch, nil
+}
+
+// Transact runs fn in a database transaction. The transaction is committed when
+// fn succeeds and the balances it updated are then written to the cache
+func (db *WalletDb) Transact(
+	ctx context.Context,
+	fn func(tx repository.Tx) error,
+) error {
+	tx := &walletTx{auditKey: db.AuditKey, updated: map[int]*domain.Wallet{}}
+	err := db.Db.WithContext(ctx).Transaction(func(gormTx *gorm.DB) error {
+		tx.db = gormTx
+		return fn(tx)
+	})
+	if err != nil {
+		return dto.Wrap(err, "Transact")
+	}
+
+	for _, wallet := range tx.updated {
+		cacheChanged(ctx, db.Cache, db.Logger, wallet)
+	}
 
-	if _, err := db.Cache.CacheBalance(ctx, wallet); err != nil {
+	return nil
+}
+
+// walletTx is the database layer bound to a single transaction
+type walletTx struct {
+	db       *gorm.DB
+	auditKey audit.Key
+	updated  map[int]*domain.Wallet
+}
+
+// ClaimBatch records a batch before it is applied. It reports false when another
+// transaction has already claimed the same idempotency key; a concurrent claim
+// blocks until the transaction holding it has finished
+func (tx *walletTx) ClaimBatch(
+	ctx context.Context,
+	batch *domain.Batch,
+) (bool, error) {
+	if batch == nil {
+		return false, fmt.Errorf("no batch has been passed")
+	}
+
+	result := tx.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(batch)
+	if result.Error != nil {
+		return false, dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to claim batch with err %v", result.Error)),
+			"ClaimBatch",
+		)
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+// SaveBatch stores the outcome of a claimed batch
+func (tx *walletTx) SaveBatch(
+	ctx context.Context,
+	batch *domain.Batch,
+) error {
+	if batch == nil {
+		return fmt.Errorf("no batch has been passed")
+	}
+
+	if err := tx.db.WithContext(ctx).Model(&domain.Batch{}).
+		Where("idempotency_key = ?", batch.IdempotencyKey).
+		Update("result", batch.Result).
+		Error; err != nil {
+		return dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to save batch with err %v", err)),
+			"SaveBatch",
+		)
+	}
+
+	return nil
+}
+
+// LockWallets reads and row locks the wallets until the transaction ends.
+// Rows are locked in ID order so that concurrent transactions can not deadlock.
+// Wallets that do not exist are left out of the result
+func (tx *walletTx) LockWallets(
+	ctx context.Context,
+	walletIDs []int,
+) (map[int]*domain.Wallet, error) {
+	var records []domain.Wallet
+	if err := tx.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", walletIDs).
+		Order("id").
+		Find(&records).
+		Error; err != nil {
+		return nil, dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to lock wallet records with err %v", err)),
+			"LockWallets",
+		)
+	}
+
+	wallets := map[int]*domain.Wallet{}
+	for i := range records {
+		wallets[records[i].ID] = &records[i]
+	}
+
+	return wallets, nil
+}
+
+// UpdateBalance changes (credits/debits) a wallet's balance by the ledger transaction's
+// postings on it within the transaction, posting the transaction and recording the change
+// in the balance history, the audit log and the outbox. The wallet's row is locked, if
+// it has not been already, and its balance read again before it is changed
+func (tx *walletTx) UpdateBalance(
+	ctx context.Context,
+	wallet *domain.Wallet,
+	txn *domain.LedgerTransaction,
+) (*domain.Wallet, error) {
+	if wallet == nil {
+		return nil, fmt.Errorf("no wallet has been passed")
+	}
+
+	previous, err := lockWallet(ctx, tx.db, wallet.ID)
+	if err != nil {
+		return nil, dto.Wrap(err, "UpdateBalance")
+	}
+	updated, err := changeBalance(ctx, tx.db, tx.auditKey, previous, txn)
+	if err != nil {
 		return nil, dto.Wrap(err, "UpdateBalance")
 	}
+	tx.updated[wallet.ID] = updated
 
-	return wallet, nil
+	return updated, nil
 }
@@ -2,21 +2,35 @@ package database_test
 
 import (
 	"context"
+	"errors"
+	"io"
 	"log"
+	"log/slog"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
 	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/database"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/audit"
 	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/cache"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/events"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository"
 	"github.com/brianvoe/gofakeit/v6"
-	"github.com/go-redis/redis"
+	"github.com/go-redis/redis/v8"
 	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
 )
 
 var ctx = context.Background()
 
+// testAuditKey seals the audit records appended by the tests
+var testAuditKey = audit.Key{Secret: []byte("a test audit key of at least 32 characters"), From: 1}
+
 func initTestDatabase() *database.WalletDb {
 	gormDb, err := database.ConnectToDatabase()
 	if err != nil {
@@ -35,7 +49,7 @@ func initTestDatabase() *database.WalletDb {
 
 	c := cache.NewCacheService(rdb)
 
-	return database.NewWalletDb(gormDb, c)
+	return database.NewWalletDb(gormDb, c, testAuditKey, slog.New(slog.NewTextHandler(io.Discard, nil)))
 }
 
 func TestWalletDb_GetBalance(t *testing.T) {
@@ -100,6 +114,71 @@ func TestWalletDb_GetBalance(t *testing.T) {
 	}
 }
 
+func TestWalletDb_GetBalance_ConcurrentMisses(t *testing.T) {
+	db := initTestDatabase()
+	if err := db.Cache.(*cache.ServiceCache).EvictBalance(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	var reads int32
+	if err := db.Db.Callback().Query().After("gorm:query").Register("test:count_wallet_reads", func(tx *gorm.DB) {
+		if tx.Statement.Table == "wallets" {
+			atomic.AddInt32(&reads, 1)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			wallet, err := db.GetBalance(ctx, 1)
+			if err != nil {
+				errs <- err
+				return
+			}
+			// callers must not share the same wallet
+			wallet.Balance = decimal.Zero
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("WalletDb.GetBalance() error = %v", err)
+	}
+	// the concurrent misses share a single read, and the later callers read what it cached
+	if got := atomic.LoadInt32(&reads); got != 1 {
+		t.Fatalf("expected the wallet to be read from the database once but it was read %d times", got)
+	}
+
+	wallet, err := db.GetBalance(ctx, 1)
+	if err != nil {
+		t.Fatalf("WalletDb.GetBalance() error = %v", err)
+	}
+	if wallet.Balance.String() != decimal.NewFromInt(100).String() {
+		t.Fatalf("expected wallet balance to be 100 but got %s", wallet.Balance)
+	}
+}
+
+// transfer is the ledger transaction of a wallet's balance change settled against the house
+func transfer(walletID int, change decimal.Decimal) *domain.LedgerTransaction {
+	id := strings.ReplaceAll(gofakeit.UUID(), "-", "")
+	return &domain.LedgerTransaction{
+		ID: id,
+		Postings: []domain.Posting{
+			{TransactionID: id, Account: domain.WalletAccount(walletID), Amount: change},
+			{TransactionID: id, Account: domain.AccountHouse, Amount: change.Neg()},
+		},
+	}
+}
+
 func TestWalletDb_UpdateBalance(t *testing.T) {
 	db := initTestDatabase()
 
@@ -112,9 +191,9 @@ func TestWalletDb_UpdateBalance(t *testing.T) {
 	newBalance := decimal.NewFromFloat(50.32)
 
 	type args struct {
-		ctx     context.Context
-		wallet  *domain.Wallet
-		balance decimal.Decimal
+		ctx    context.Context
+		wallet *domain.Wallet
+		txn    *domain.LedgerTransaction
 	}
 	tests := []struct {
 		name    string
@@ -124,9 +203,9 @@ func TestWalletDb_UpdateBalance(t *testing.T) {
 		{
 			name: "happy case",
 			args: args{
-				ctx:     ctx,
-				wallet:  wallet,
-				balance: newBalance,
+				ctx:    ctx,
+				wallet: wallet,
+				txn:    transfer(walletID, newBalance.Sub(wallet.Balance)),
 			},
 			wantErr: false,
 		},
@@ -144,7 +223,7 @@ func TestWalletDb_UpdateBalance(t *testing.T) {
 			wallet, err := db.UpdateBalance(
 				tt.args.ctx,
 				tt.args.wallet,
-				tt.args.balance,
+				tt.args.txn,
 			)
 			if (err != nil) != tt.wantErr {
 				t.Errorf(
@@ -176,6 +255,192 @@ func TestWalletDb_UpdateBalance(t *testing.T) {
 	}
 }
 
+// downCache is a cache whose writes fail
+type downCache struct {
+	cache.WalletCache
+}
+
+func (downCache) CacheBalance(ctx context.Context, wallet *domain.Wallet) (*domain.Wallet, error) {
+	return nil, errors.New("redis is down")
+}
+
+func TestWalletDb_UpdateBalance_CacheDown(t *testing.T) {
+	db := initTestDatabase()
+	down := database.NewWalletDb(db.Db, downCache{WalletCache: db.Cache}, db.AuditKey, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	wallet, err := db.GetBalance(ctx, 2) // existing wallet
+	if err != nil {
+		t.Fatalf("expected to get wallet with id 2: %v", err)
+	}
+
+	// the change is committed, so failing to cache it must not fail it
+	updated, err := down.UpdateBalance(ctx, wallet, transfer(2, decimal.NewFromInt(1)))
+	if err != nil {
+		t.Fatalf("expected a committed change to succeed but got %v", err)
+	}
+	if err := down.Transact(ctx, func(tx repository.Tx) error {
+		_, err := tx.UpdateBalance(ctx, updated, transfer(2, decimal.NewFromInt(-1)))
+		return err
+	}); err != nil {
+		t.Fatalf("expected a committed transaction to succeed but got %v", err)
+	}
+
+	// the balance cached before the changes is evicted rather than served
+	cached, err := db.Cache.GetCachedBalance(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached != nil {
+		t.Fatalf("expected the changed wallet to be evicted but %s is cached", cached.Balance)
+	}
+}
+
+func TestWalletDb_UpdateBalance_StaleReads(t *testing.T) {
+	db := initTestDatabase()
+
+	opened := &domain.Wallet{ID: gofakeit.Number(1000000, 2000000000), Balance: decimal.NewFromInt(100)}
+	if err := db.Db.Create(opened).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// concurrent credits of the same stale read are both applied
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(stale domain.Wallet) {
+			defer wg.Done()
+			if _, err := db.UpdateBalance(ctx, &stale, transfer(opened.ID, decimal.NewFromInt(-10))); err != nil {
+				t.Error(err)
+			}
+		}(*opened)
+	}
+	wg.Wait()
+
+	if _, err := db.UpdateBalance(ctx, opened, transfer(opened.ID, decimal.NewFromInt(-90))); !errors.Is(err, domain.ErrInsufficientFunds) {
+		t.Fatalf("expected a credit of a stale read not to overdraw the wallet but got %v", err)
+	}
+
+	balances, err := database.NewLedger(db.Db).LedgerBalances(ctx, []int{opened.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record domain.Wallet
+	if err := db.Db.First(&record, opened.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !record.Balance.Equal(decimal.NewFromInt(80)) || !balances[opened.ID].Equal(decimal.NewFromInt(-20)) {
+		t.Fatalf("expected a balance of 80 and postings of -20 but got %s and %s", record.Balance, balances[opened.ID])
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	db := initTestDatabase()
+	auditLog := database.NewAuditLog(db.Db, db.AuditKey)
+
+	head, err := auditLog.AuditHead(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wallet, err := db.GetBalance(ctx, 2) // existing wallet
+	if err != nil {
+		t.Fatalf("expected to get wallet with id 2: %v", err)
+	}
+	actor := audit.Actor{Subject: "auth0|auditor", IP: "10.0.0.1"}
+	if _, err := db.UpdateBalance(audit.WithActor(ctx, actor), wallet, transfer(2, decimal.NewFromInt(1))); err != nil {
+		t.Fatal(err)
+	}
+
+	var afterSeq uint64
+	if head != nil {
+		afterSeq = head.Seq
+	}
+	records, err := auditLog.AuditRecords(ctx, afterSeq, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected the balance change to be audited but got %d records", len(records))
+	}
+	if records[0].Actor != actor.Subject || records[0].IP != actor.IP || records[0].Action != audit.ActionDebited {
+		t.Fatalf("expected the debit to be attributed to %+v but got %+v", actor, records[0])
+	}
+
+	broken, _, err := audit.Verify(ctx, auditLog, audit.DefaultPageSize, db.AuditKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if broken != nil {
+		t.Fatalf("expected an intact audit log but got %s", broken)
+	}
+}
+
+func TestAuditLog_Unkeyed(t *testing.T) {
+	db := initTestDatabase()
+	unkeyed := database.NewWalletDb(db.Db, db.Cache, audit.Key{}, db.Logger)
+
+	wallet, err := db.GetBalance(ctx, 2) // existing wallet
+	if err != nil {
+		t.Fatalf("expected to get wallet with id 2: %v", err)
+	}
+	if _, err := unkeyed.UpdateBalance(ctx, wallet, transfer(2, decimal.NewFromInt(1))); !errors.Is(err, domain.ErrUnavailable) {
+		t.Fatalf("expected a change that can not be audited to be refused but got %v", err)
+	}
+
+	unchanged, err := db.GetBalance(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !unchanged.Balance.Equal(wallet.Balance) {
+		t.Fatalf("expected the balance to stay %s but got %s", wallet.Balance, unchanged.Balance)
+	}
+}
+
+func TestOutbox_ClaimEvents(t *testing.T) {
+	db := initTestDatabase()
+	outbox := database.NewOutbox(db.Db)
+	relay := events.NewRelay(outbox, events.NewMemorySink(), time.Second, 1000, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// publish whatever earlier tests have left in the outbox
+	for {
+		published, err := relay.RelayOnce(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if published == 0 {
+			break
+		}
+	}
+
+	wallet, err := db.GetBalance(ctx, 2) // existing wallet
+	if err != nil {
+		t.Fatalf("expected to get wallet with id 2: %v", err)
+	}
+	if _, err := db.UpdateBalance(ctx, wallet, transfer(2, decimal.NewFromInt(1))); err != nil {
+		t.Fatal(err)
+	}
+
+	claimed, err := outbox.ClaimEvents(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 1 || claimed[0].WalletID != 2 || claimed[0].Type != events.WalletDebited {
+		t.Fatalf("expected the debit to be waiting in the outbox but got %+v", claimed)
+	}
+
+	leased, err := outbox.ClaimEvents(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leased) != 0 {
+		t.Fatalf("expected the leased debit not to be claimed again but got %+v", leased)
+	}
+
+	if err := outbox.MarkPublished(ctx, []uint64{claimed[0].ID}); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestConnectToDatabase(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -219,3 +484,362 @@ func TestConnectToDatabase(t *testing.T) {
 		})
 	}
 }
+
+func TestEventStore(t *testing.T) {
+	db := initTestDatabase()
+	store := database.NewEventStore(db.Db, db.Cache, db.AuditKey, 2, db.Logger)
+
+	opened := &domain.Wallet{ID: gofakeit.Number(1000000, 2000000000), Balance: decimal.NewFromInt(100)}
+	if err := db.Db.Create(opened).Error; err != nil {
+		t.Fatal(err)
+	}
+	beforeChanges := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	wallet, err := store.GetBalance(ctx, opened.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wallet, err = store.UpdateBalance(ctx, wallet, transfer(opened.ID, decimal.NewFromInt(50))); err != nil {
+		t.Fatal(err)
+	}
+	if wallet, err = store.UpdateBalance(ctx, wallet, transfer(opened.ID, decimal.NewFromInt(-30))); err != nil {
+		t.Fatal(err)
+	}
+
+	// concurrent debits of the same stale read are both kept
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(stale domain.Wallet) {
+			defer wg.Done()
+			if _, err := store.UpdateBalance(ctx, &stale, transfer(opened.ID, decimal.NewFromInt(10))); err != nil {
+				t.Error(err)
+			}
+		}(*wallet)
+	}
+	wg.Wait()
+
+	if _, err := store.UpdateBalance(ctx, wallet, transfer(opened.ID, decimal.NewFromInt(-200))); err == nil {
+		t.Fatalf("expected a credit of a stale read not to overdraw the wallet")
+	}
+
+	for _, fromSnapshots := range []bool{true, false} {
+		stream, err := store.BalanceAt(ctx, opened.ID, time.Now(), fromSnapshots)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !stream.Balance.Equal(decimal.NewFromInt(140)) || stream.Version != 5 {
+			t.Fatalf("expected 140 at version 5 but got %s at version %d", stream.Balance, stream.Version)
+		}
+	}
+	stream, err := store.BalanceAt(ctx, opened.ID, beforeChanges, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stream.Balance.Equal(decimal.NewFromInt(100)) {
+		t.Fatalf("expected the opening balance before any change but got %s", stream.Balance)
+	}
+
+	var record domain.Wallet
+	if err := db.Db.First(&record, opened.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !record.Balance.Equal(opened.Balance) {
+		t.Fatalf("expected the wallet's balance column to be left alone but got %s", record.Balance)
+	}
+}
+
+func TestWalletDb_GetBalanceAsOf(t *testing.T) {
+	db := initTestDatabase()
+
+	wallet := &domain.Wallet{ID: gofakeit.Number(1000000, 2000000000), Balance: decimal.NewFromInt(100)}
+	if err := db.Db.Create(wallet).Error; err != nil {
+		t.Fatal(err)
+	}
+	beforeChanges := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	wallet, err := db.UpdateBalance(ctx, wallet, transfer(wallet.ID, decimal.NewFromInt(50)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	betweenChanges := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	if _, err := db.UpdateBalance(ctx, wallet, transfer(wallet.ID, decimal.NewFromInt(-30))); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		walletID    int
+		asOf        time.Time
+		wantBalance string
+		wantErr     bool
+	}{
+		{
+			name:        "happy case - before the first change",
+			walletID:    wallet.ID,
+			asOf:        beforeChanges,
+			wantBalance: "100",
+		},
+		{
+			name:        "happy case - between changes",
+			walletID:    wallet.ID,
+			asOf:        betweenChanges,
+			wantBalance: "150",
+		},
+		{
+			name:        "happy case - after the last change",
+			walletID:    wallet.ID,
+			asOf:        time.Now(),
+			wantBalance: "120",
+		},
+		{
+			name:     "sad case - wallet does not exist",
+			walletID: -1,
+			asOf:     time.Now(),
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.GetBalanceAsOf(ctx, tt.walletID, tt.asOf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WalletDb.GetBalanceAsOf() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.Balance.String() != tt.wantBalance {
+				t.Fatalf("expected a balance of %s but got %s", tt.wantBalance, got.Balance)
+			}
+		})
+	}
+}
+
+func TestWalletDb_ScanBalancesAsOf(t *testing.T) {
+	db := initTestDatabase()
+
+	// wallet IDs are picked in a range of their own so that no other wallet sits between them
+	id := gofakeit.Number(2000000001, 2100000000)
+	changed := &domain.Wallet{ID: id, Balance: decimal.NewFromInt(100)}
+	unchanged := &domain.Wallet{ID: id + 1, Balance: decimal.NewFromInt(7)}
+	if err := db.Db.Create([]*domain.Wallet{changed, unchanged}).Error; err != nil {
+		t.Fatal(err)
+	}
+	beforeChanges := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	changed, err := db.UpdateBalance(ctx, changed, transfer(changed.ID, decimal.NewFromInt(50)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	betweenChanges := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	if _, err := db.UpdateBalance(ctx, changed, transfer(changed.ID, decimal.NewFromInt(-30))); err != nil {
+		t.Fatal(err)
+	}
+	// a backdated entry, like an opening balance, is appended after the entries it precedes
+	opening := &domain.BalanceEntry{
+		WalletID:  changed.ID,
+		Previous:  decimal.Zero,
+		Balance:   decimal.NewFromInt(100),
+		CreatedAt: beforeChanges.Add(-time.Hour),
+	}
+	if err := db.Db.Create(opening).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		asOf         time.Time
+		wantBalances []string
+	}{
+		{
+			name:         "happy case - before the first change",
+			asOf:         beforeChanges,
+			wantBalances: []string{"100", "7"},
+		},
+		{
+			name:         "happy case - between changes",
+			asOf:         betweenChanges,
+			wantBalances: []string{"150", "7"},
+		},
+		{
+			name:         "happy case - after the last change",
+			asOf:         time.Now(),
+			wantBalances: []string{"120", "7"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.ScanBalancesAsOf(ctx, id-1, 2, tt.asOf)
+			if err != nil {
+				t.Fatalf("WalletDb.ScanBalancesAsOf() error = %v", err)
+			}
+			if len(got) != len(tt.wantBalances) {
+				t.Fatalf("expected %d wallets but got %d", len(tt.wantBalances), len(got))
+			}
+			for i, want := range tt.wantBalances {
+				if got[i].ID != id+i || got[i].Balance.String() != want {
+					t.Fatalf("expected wallet %d to have a balance of %s but got %+v", id+i, want, got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLedger_ListPostings(t *testing.T) {
+	db := initTestDatabase()
+	ledger := database.NewLedger(db.Db)
+
+	wallet := &domain.Wallet{ID: gofakeit.Number(1000000, 2000000000), Balance: decimal.NewFromInt(100)}
+	if err := db.Db.Create(wallet).Error; err != nil {
+		t.Fatal(err)
+	}
+	from := time.Now().Add(-time.Second)
+	for _, amount := range []int64{50, -30, 10} {
+		var err error
+		wallet, err = db.UpdateBalance(ctx, wallet, transfer(wallet.ID, decimal.NewFromInt(amount)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	to := time.Now().Add(time.Second)
+
+	tests := []struct {
+		name        string
+		limit       int
+		wantAmounts []string
+	}{
+		{
+			name:        "happy case - one page",
+			limit:       10,
+			wantAmounts: []string{"50", "-30", "10"},
+		},
+		{
+			name:        "happy case - pages smaller than the postings",
+			limit:       2,
+			wantAmounts: []string{"50", "-30", "10"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			var after *domain.Posting
+			for {
+				postings, err := ledger.ListPostings(ctx, domain.WalletAccount(wallet.ID), from, to, after, tt.limit)
+				if err != nil {
+					t.Fatalf("Ledger.ListPostings() error = %v", err)
+				}
+				if len(postings) == 0 {
+					break
+				}
+				for _, posting := range postings {
+					got = append(got, posting.Amount.String())
+				}
+				after = &postings[len(postings)-1]
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantAmounts, ",") {
+				t.Fatalf("expected the postings %v but got %v", tt.wantAmounts, got)
+			}
+		})
+	}
+}
+
+func TestWalletDb_SetFrozen(t *testing.T) {
+	db := initTestDatabase()
+
+	var wallet *domain.Wallet
+	if err := db.Transact(ctx, func(tx repository.Tx) error {
+		var err error
+		wallet, err = tx.CreateWallet(ctx, "integration test")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		walletID   int
+		frozen     bool
+		wantUpdate error
+		wantErr    bool
+	}{
+		{
+			name:       "happy case - frozen wallet can not be updated",
+			walletID:   wallet.ID,
+			frozen:     true,
+			wantUpdate: domain.ErrFrozen,
+		},
+		{
+			name:     "happy case - unfrozen wallet can be updated",
+			walletID: wallet.ID,
+		},
+		{
+			name:     "sad case - wallet does not exist",
+			walletID: -1,
+			frozen:   true,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.SetFrozen(ctx, tt.walletID, tt.frozen, "integration test")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WalletDb.SetFrozen() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Frozen != tt.frozen {
+				t.Fatalf("expected the wallet's frozen to be %v", tt.frozen)
+			}
+
+			_, err = db.UpdateBalance(ctx, got, transfer(got.ID, decimal.NewFromInt(10)))
+			if !errors.Is(err, tt.wantUpdate) || (err != nil) != (tt.wantUpdate != nil) {
+				t.Fatalf("WalletDb.UpdateBalance() error = %v, wantErr %v", err, tt.wantUpdate)
+			}
+		})
+	}
+}
+
+func TestConnectToDatabase_OpeningBalances(t *testing.T) {
+	db := initTestDatabase()
+
+	// a wallet that held money before the ledger was introduced
+	legacy := &domain.Wallet{ID: gofakeit.Number(1000000, 2000000000), Balance: decimal.NewFromInt(100)}
+	if err := db.Db.Create(legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Db.Where("name = ?", "opening_balances").Delete(&domain.Migration{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// migrating again posts nothing more
+	for i := 0; i < 2; i++ {
+		if _, err := database.ConnectToDatabase(); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Db.Where("name = ?", "opening_balances").Delete(&domain.Migration{}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	balances, err := database.NewLedger(db.Db).LedgerBalances(ctx, []int{legacy.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !balances[legacy.ID].Equal(legacy.Balance) {
+		t.Fatalf("expected the opening balance of 100 to be posted but got %s", balances[legacy.ID])
+	}
+	got, err := db.GetBalanceAsOf(ctx, legacy.ID, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Balance.IsZero() {
+		t.Fatalf("expected no balance before the opening but got %s", got.Balance)
+	}
+}
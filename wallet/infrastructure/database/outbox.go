@@ -0,0 +1,173 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/audit"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/events"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Outbox holds the domain events waiting to be published by the relay
+type Outbox struct {
+	Db *gorm.DB
+}
+
+// NewOutbox initializes the outbox stored in the given database
+func NewOutbox(gorm *gorm.DB) *Outbox {
+	o := &Outbox{
+		Db: gorm,
+	}
+	o.checkPreconditions()
+	return o
+}
+
+func (o *Outbox) checkPreconditions() {
+	if o.Db == nil {
+		log.Panicf("error initializing outbox, ORM has not been initialized")
+	}
+}
+
+// outboxClaimLock serializes the relays' claims so that a wallet's events are never
+// leased to two relays at once
+const outboxClaimLock = "wallet_outbox_claim"
+
+// outboxClaimWait is how long a relay waits for another relay's claim to finish
+const outboxClaimWait = 10 * time.Second
+
+// ClaimEvents leases the oldest unpublished events, in the order they were written,
+// to the calling relay for the lease duration. Events leased to another relay, or
+// held back after failing to be published, are skipped along with the later events
+// of their wallets, so that the other wallets' events still go out. The claim is a
+// short transaction of its own and the events are published outside of it
+func (o *Outbox) ClaimEvents(
+	ctx context.Context,
+	limit int,
+	lease time.Duration,
+) ([]domain.OutboxEvent, error) {
+	var claimed []domain.OutboxEvent
+	_, err := withLock(ctx, o.Db, outboxClaimLock, outboxClaimWait, func(conn *gorm.DB) error {
+		return conn.Transaction(func(tx *gorm.DB) error {
+			now := time.Now()
+			if err := tx.Where("published_at IS NULL").
+				Where("claimed_until IS NULL OR claimed_until <= ?", now).
+				Where(
+					"NOT EXISTS (SELECT 1 FROM outbox_events earlier "+
+						"WHERE earlier.wallet_id = outbox_events.wallet_id AND earlier.id < outbox_events.id "+
+						"AND earlier.published_at IS NULL AND earlier.claimed_until > ?)",
+					now,
+				).
+				Order("id").
+				Limit(limit).
+				Find(&claimed).
+				Error; err != nil {
+				return databaseUnavailable(fmt.Errorf("failed to claim outbox events with err %v", err))
+			}
+			if len(claimed) == 0 {
+				return nil
+			}
+
+			if err := tx.Model(&domain.OutboxEvent{}).
+				Where("id IN ?", eventIDs(claimed)).
+				Update("claimed_until", now.Add(lease)).
+				Error; err != nil {
+				return databaseUnavailable(fmt.Errorf("failed to lease outbox events with err %v", err))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, dto.Wrap(err, "ClaimEvents")
+	}
+
+	return claimed, nil
+}
+
+// MarkPublished marks leased events as published
+func (o *Outbox) MarkPublished(
+	ctx context.Context,
+	ids []uint64,
+) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if err := o.Db.WithContext(ctx).Model(&domain.OutboxEvent{}).
+		Where("id IN ?", ids).
+		Updates(map[string]interface{}{"published_at": time.Now(), "claimed_until": nil}).
+		Error; err != nil {
+		return dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to mark outbox events as published with err %v", err)),
+			"MarkPublished",
+		)
+	}
+
+	return nil
+}
+
+// ReleaseEvents ends the lease of events that were not published so that they can be
+// claimed again from the given time. Until then the later events of their wallets are
+// held back too
+func (o *Outbox) ReleaseEvents(
+	ctx context.Context,
+	ids []uint64,
+	until time.Time,
+) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if err := o.Db.WithContext(ctx).Model(&domain.OutboxEvent{}).
+		Where("id IN ? AND published_at IS NULL", ids).
+		Update("claimed_until", until).
+		Error; err != nil {
+		return dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to release outbox events with err %v", err)),
+			"ReleaseEvents",
+		)
+	}
+
+	return nil
+}
+
+func eventIDs(events []domain.OutboxEvent) []uint64 {
+	ids := make([]uint64, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+	return ids
+}
+
+// recordBalanceChange appends a wallet's balance change to the audit log and
+// writes its event to the outbox within the transaction that changed it
+func recordBalanceChange(
+	ctx context.Context,
+	tx *gorm.DB,
+	key audit.Key,
+	walletID int,
+	previous decimal.Decimal,
+	balance decimal.Decimal,
+) error {
+	if err := auditBalanceChange(ctx, tx, key, walletID, previous, balance); err != nil {
+		return err
+	}
+
+	event, err := events.BalanceChanged(walletID, previous, balance)
+	if err != nil {
+		return dto.Wrap(err, "recordBalanceChange")
+	}
+	if err := tx.WithContext(ctx).Create(event).Error; err != nil {
+		return dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to write outbox event with err %v", err)),
+			"recordBalanceChange",
+		)
+	}
+
+	return nil
+}
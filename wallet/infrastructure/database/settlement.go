@@ -0,0 +1,194 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SettlementStore holds the closed business days, their wallets' closing
+// balances and their settlement totals
+type SettlementStore struct {
+	Db *gorm.DB
+}
+
+// NewSettlementStore initializes the settlement store kept in the given database
+func NewSettlementStore(gorm *gorm.DB) *SettlementStore {
+	s := &SettlementStore{
+		Db: gorm,
+	}
+	s.checkPreconditions()
+	return s
+}
+
+func (s *SettlementStore) checkPreconditions() {
+	if s.Db == nil {
+		log.Panicf("error initializing settlement store, ORM has not been initialized")
+	}
+}
+
+// staleChunk is how many stale closing balances are deleted at a time
+const staleChunk = 5000
+
+// SaveClosingBalances stages wallets' closing balances under the close writing them.
+// They are not read until the close's day close is saved
+func (s *SettlementStore) SaveClosingBalances(
+	ctx context.Context,
+	balances []domain.ClosingBalance,
+) error {
+	if len(balances) == 0 {
+		return nil
+	}
+
+	if err := s.Db.WithContext(ctx).
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&balances).
+		Error; err != nil {
+		return dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to save closing balances with err %v", err)),
+			"SaveClosingBalances",
+		)
+	}
+	return nil
+}
+
+// SaveDayClose replaces a day's settlement totals and marks it closed by the close
+// that staged its closing balances, in one transaction, so that the day's totals and
+// closing balances are all replaced at once
+func (s *SettlementStore) SaveDayClose(
+	ctx context.Context,
+	dayClose *domain.DayClose,
+	totals []domain.SettlementTotal,
+) error {
+	if dayClose == nil {
+		return fmt.Errorf("no day close has been passed")
+	}
+
+	err := s.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("day = ? AND currency = ?", dayClose.Day, dayClose.Currency).
+			Delete(&domain.SettlementTotal{}).
+			Error; err != nil {
+			return err
+		}
+		if len(totals) > 0 {
+			if err := tx.Create(&totals).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(dayClose).Error
+	})
+	if err != nil {
+		return dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to save day close with err %v", err)),
+			"SaveDayClose",
+		)
+	}
+	return nil
+}
+
+// DeleteClosingBalances deletes a day's closing balances written by closes other than
+// the given one: those replaced by closing the day again and those staged by closes
+// that did not complete
+func (s *SettlementStore) DeleteClosingBalances(
+	ctx context.Context,
+	day string,
+	currency string,
+	keepCloseID string,
+) error {
+	for {
+		result := s.Db.WithContext(ctx).
+			Where("day = ? AND currency = ? AND close_id <> ?", day, currency, keepCloseID).
+			Limit(staleChunk).
+			Delete(&domain.ClosingBalance{})
+		if result.Error != nil {
+			return dto.Wrap(
+				databaseUnavailable(fmt.Errorf("failed to delete stale closing balances with err %v", result.Error)),
+				"DeleteClosingBalances",
+			)
+		}
+		if result.RowsAffected < staleChunk {
+			return nil
+		}
+	}
+}
+
+// GetDayClose retrieves a closed day, which is not found until it has been closed
+func (s *SettlementStore) GetDayClose(
+	ctx context.Context,
+	day string,
+	currency string,
+) (*domain.DayClose, error) {
+	var dayClose domain.DayClose
+	if err := s.Db.WithContext(ctx).
+		Where("day = ? AND currency = ?", day, currency).
+		First(&dayClose).
+		Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, dto.Wrap(
+				domain.NewError(domain.ErrNotFound, "the day has not been closed", err),
+				"GetDayClose",
+			)
+		}
+		return nil, dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to get day close with err %v", err)),
+			"GetDayClose",
+		)
+	}
+	return &dayClose, nil
+}
+
+// ListSettlementTotals retrieves a day's settlement totals by account type
+func (s *SettlementStore) ListSettlementTotals(
+	ctx context.Context,
+	day string,
+	currency string,
+) ([]domain.SettlementTotal, error) {
+	var totals []domain.SettlementTotal
+	if err := s.Db.WithContext(ctx).
+		Where("day = ? AND currency = ?", day, currency).
+		Order("account_type").
+		Find(&totals).
+		Error; err != nil {
+		return nil, dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to list settlement totals with err %v", err)),
+			"ListSettlementTotals",
+		)
+	}
+	return totals, nil
+}
+
+// ListClosingBalances retrieves a day's closing balances of the wallets after the
+// given wallet ID, in wallet ID order. Only the balances of the close that marked the
+// day closed are read
+func (s *SettlementStore) ListClosingBalances(
+	ctx context.Context,
+	day string,
+	currency string,
+	afterWalletID int,
+	limit int,
+) ([]domain.ClosingBalance, error) {
+	closed := s.Db.Model(&domain.DayClose{}).
+		Select("close_id").
+		Where("day = ? AND currency = ?", day, currency)
+
+	var balances []domain.ClosingBalance
+	if err := s.Db.WithContext(ctx).
+		Where("day = ? AND currency = ? AND wallet_id > ?", day, currency, afterWalletID).
+		Where("close_id = (?)", closed).
+		Order("wallet_id").
+		Limit(limit).
+		Find(&balances).
+		Error; err != nil {
+		return nil, dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to list closing balances with err %v", err)),
+			"ListClosingBalances",
+		)
+	}
+	return balances, nil
+}
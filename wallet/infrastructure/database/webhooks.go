@@ -0,0 +1,272 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// WebhookStore holds the webhook subscriptions and their deliveries
+type WebhookStore struct {
+	Db *gorm.DB
+}
+
+// NewWebhookStore initializes the webhook store kept in the given database
+func NewWebhookStore(gorm *gorm.DB) *WebhookStore {
+	s := &WebhookStore{
+		Db: gorm,
+	}
+	s.checkPreconditions()
+	return s
+}
+
+func (s *WebhookStore) checkPreconditions() {
+	if s.Db == nil {
+		log.Panicf("error initializing webhook store, ORM has not been initialized")
+	}
+}
+
+// CreateSubscription stores a new webhook subscription
+func (s *WebhookStore) CreateSubscription(
+	ctx context.Context,
+	sub *domain.WebhookSubscription,
+) error {
+	if sub == nil {
+		return fmt.Errorf("no webhook subscription has been passed")
+	}
+
+	if err := s.Db.WithContext(ctx).Create(sub).Error; err != nil {
+		return dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to create webhook subscription with err %v", err)),
+			"CreateSubscription",
+		)
+	}
+	return nil
+}
+
+// GetSubscription retrieves a webhook subscription by its ID
+func (s *WebhookStore) GetSubscription(
+	ctx context.Context,
+	id uint64,
+) (*domain.WebhookSubscription, error) {
+	var sub domain.WebhookSubscription
+	if err := s.Db.WithContext(ctx).First(&sub, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, dto.Wrap(
+				domain.NewError(domain.ErrNotFound, "webhook subscription not found", err),
+				"GetSubscription",
+			)
+		}
+		return nil, dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to get webhook subscription with err %v", err)),
+			"GetSubscription",
+		)
+	}
+	return &sub, nil
+}
+
+// ListSubscriptions retrieves the webhook subscriptions created by an owner
+func (s *WebhookStore) ListSubscriptions(
+	ctx context.Context,
+	owner string,
+) ([]domain.WebhookSubscription, error) {
+	var subs []domain.WebhookSubscription
+	if err := s.Db.WithContext(ctx).Where("created_by = ?", owner).
+		Order("id").
+		Find(&subs).
+		Error; err != nil {
+		return nil, dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to list webhook subscriptions with err %v", err)),
+			"ListSubscriptions",
+		)
+	}
+	return subs, nil
+}
+
+// DeleteSubscription removes a webhook subscription along with its deliveries
+func (s *WebhookStore) DeleteSubscription(
+	ctx context.Context,
+	id uint64,
+) error {
+	err := s.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("subscription_id = ?", id).Delete(&domain.WebhookDelivery{}).Error; err != nil {
+			return databaseUnavailable(fmt.Errorf("failed to delete webhook deliveries with err %v", err))
+		}
+		if err := tx.Delete(&domain.WebhookSubscription{}, id).Error; err != nil {
+			return databaseUnavailable(fmt.Errorf("failed to delete webhook subscription with err %v", err))
+		}
+		return nil
+	})
+	if err != nil {
+		return dto.Wrap(err, "DeleteSubscription")
+	}
+	return nil
+}
+
+// ListDeliveries retrieves the latest deliveries to a webhook subscription, newest first
+func (s *WebhookStore) ListDeliveries(
+	ctx context.Context,
+	subscriptionID uint64,
+	limit int,
+) ([]domain.WebhookDelivery, error) {
+	var deliveries []domain.WebhookDelivery
+	if err := s.Db.WithContext(ctx).Where("subscription_id = ?", subscriptionID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&deliveries).
+		Error; err != nil {
+		return nil, dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to list webhook deliveries with err %v", err)),
+			"ListDeliveries",
+		)
+	}
+	return deliveries, nil
+}
+
+// EnqueueDeliveries schedules the delivery of an event to every subscription to
+// its type. An event that is published again is not delivered twice
+func (s *WebhookStore) EnqueueDeliveries(
+	ctx context.Context,
+	event domain.OutboxEvent,
+) error {
+	var subs []domain.WebhookSubscription
+	if err := s.Db.WithContext(ctx).Find(&subs).Error; err != nil {
+		return dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to list webhook subscriptions with err %v", err)),
+			"EnqueueDeliveries",
+		)
+	}
+
+	now := time.Now()
+	deliveries := []domain.WebhookDelivery{}
+	for _, sub := range subs {
+		if !sub.Subscribes(event.Type) {
+			continue
+		}
+		deliveries = append(deliveries, domain.WebhookDelivery{
+			SubscriptionID: sub.ID,
+			EventID:        event.EventID,
+			EventType:      event.Type,
+			Payload:        event.Payload,
+			Status:         domain.DeliveryPending,
+			NextAttemptAt:  now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	if err := s.Db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&deliveries).
+		Error; err != nil {
+		return dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to enqueue webhook deliveries with err %v", err)),
+			"EnqueueDeliveries",
+		)
+	}
+	return nil
+}
+
+// ClaimDeliveries leases the pending deliveries that are due, along with their
+// subscriptions, by pushing their next attempt back by the lease. Claiming is a
+// short transaction of its own, the deliveries are attempted outside of it and
+// skipped by the other instances until the lease is over, so a delivery is only
+// attempted once at a time. Deliveries whose subscription is gone are left out
+func (s *WebhookStore) ClaimDeliveries(
+	ctx context.Context,
+	limit int,
+	lease time.Duration,
+) ([]domain.WebhookDelivery, []domain.WebhookSubscription, error) {
+	var (
+		due  []domain.WebhookDelivery
+		subs []domain.WebhookSubscription
+	)
+	err := s.Db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", domain.DeliveryPending, now).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&due).
+			Error; err != nil {
+			return databaseUnavailable(fmt.Errorf("failed to claim webhook deliveries with err %v", err))
+		}
+		if len(due) == 0 {
+			return nil
+		}
+
+		ids := make([]uint64, len(due))
+		subIDs := make([]uint64, len(due))
+		for i, delivery := range due {
+			ids[i] = delivery.ID
+			subIDs[i] = delivery.SubscriptionID
+		}
+		if err := tx.Where("id IN ?", subIDs).Find(&subs).Error; err != nil {
+			return databaseUnavailable(fmt.Errorf("failed to get webhook subscriptions with err %v", err))
+		}
+
+		until := now.Add(lease)
+		if err := tx.Model(&domain.WebhookDelivery{}).
+			Where("id IN ?", ids).
+			Update("next_attempt_at", until).
+			Error; err != nil {
+			return databaseUnavailable(fmt.Errorf("failed to lease webhook deliveries with err %v", err))
+		}
+		for i := range due {
+			due[i].NextAttemptAt = until
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, dto.Wrap(err, "ClaimDeliveries")
+	}
+
+	byID := map[uint64]bool{}
+	for _, sub := range subs {
+		byID[sub.ID] = true
+	}
+	claimed := due[:0]
+	for _, delivery := range due {
+		if byID[delivery.SubscriptionID] {
+			claimed = append(claimed, delivery)
+		}
+	}
+
+	return claimed, subs, nil
+}
+
+// SaveDelivery records the outcome of a delivery attempt. Nothing is saved for a
+// delivery that is no longer pending, or was deleted along with its subscription
+func (s *WebhookStore) SaveDelivery(
+	ctx context.Context,
+	delivery *domain.WebhookDelivery,
+) error {
+	if delivery == nil {
+		return fmt.Errorf("no webhook delivery has been passed")
+	}
+
+	if err := s.Db.WithContext(ctx).Model(&domain.WebhookDelivery{}).
+		Where("id = ? AND status = ?", delivery.ID, domain.DeliveryPending).
+		Updates(map[string]interface{}{
+			"status":           delivery.Status,
+			"attempts":         delivery.Attempts,
+			"next_attempt_at":  delivery.NextAttemptAt,
+			"last_status_code": delivery.LastStatusCode,
+			"last_error":       delivery.LastError,
+			"delivered_at":     delivery.DeliveredAt,
+		}).
+		Error; err != nil {
+		return dto.Wrap(
+			databaseUnavailable(fmt.Errorf("failed to save webhook delivery with err %v", err)),
+			"SaveDelivery",
+		)
+	}
+	return nil
+}
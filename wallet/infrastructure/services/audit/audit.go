@@ -0,0 +1,235 @@
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/shopspring/decimal"
+)
+
+// Actions recorded in the audit log. Admin actions are recorded under their own
+// "admin." prefixed actions alongside the money movements
+const (
+	ActionCredited = "wallet.credited"
+	ActionDebited  = "wallet.debited"
+
+	ActionWalletCreated   = domain.ActionWalletCreated
+	ActionWalletFrozen    = domain.ActionWalletFrozen
+	ActionWalletUnfrozen  = domain.ActionWalletUnfrozen
+	ActionBalanceAdjusted = domain.ActionBalanceAdjusted
+)
+
+// DefaultPageSize is how many records Verify reads at a time unless told otherwise
+const DefaultPageSize = 1000
+
+// Anonymous is the actor of actions performed without a verified identity
+const Anonymous = "anonymous"
+
+// Actor is who performed an audited action and from where
+type Actor struct {
+	// Subject is the access token's subject or API key the caller authenticated with
+	Subject string
+	IP      string
+}
+
+type actorKey struct{}
+
+// WithActor returns a context carrying who is performing the request
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns who is performing the request, anonymous when unknown
+func ActorFrom(ctx context.Context) Actor {
+	actor, _ := ctx.Value(actorKey{}).(Actor)
+	if actor.Subject == "" {
+		actor.Subject = Anonymous
+	}
+	return actor
+}
+
+// minSecretLength is the shortest secret the audit log may be keyed with
+const minSecretLength = 32
+
+// Key is the secret the audit log's hashes are keyed with. It is kept out of
+// the database so that someone able to write to the database can not rewrite
+// the log and recompute a chain that still verifies
+type Key struct {
+	Secret []byte
+	// From is the first record sealed with the secret. Records before it were
+	// written before the log was keyed and are hashed without the secret
+	From uint64
+}
+
+// KeyFromEnv reads the audit log's key from AUDIT_HMAC_KEY and the first record
+// sealed with it from AUDIT_HMAC_FROM. Without a key records are hashed unkeyed
+func KeyFromEnv() (Key, error) {
+	key := Key{Secret: []byte(os.Getenv("AUDIT_HMAC_KEY")), From: 1}
+	if len(key.Secret) == 0 {
+		return Key{}, nil
+	}
+	if len(key.Secret) < minSecretLength {
+		return Key{}, fmt.Errorf("AUDIT_HMAC_KEY must be at least %d characters", minSecretLength)
+	}
+
+	if from := os.Getenv("AUDIT_HMAC_FROM"); from != "" {
+		seq, err := strconv.ParseUint(from, 10, 64)
+		if err != nil || seq == 0 {
+			return Key{}, fmt.Errorf("invalid AUDIT_HMAC_FROM %q", from)
+		}
+		key.From = seq
+	}
+	return key, nil
+}
+
+// Keyed reports whether a record is hashed with the secret
+func (k Key) Keyed(seq uint64) bool {
+	return len(k.Secret) > 0 && seq >= k.From
+}
+
+// Seal chains a record to the record before it. The hash covers every field of
+// the record and the previous record's hash, so changing either breaks the chain
+func Seal(record *domain.AuditRecord, prevHash string, key Key) {
+	record.PrevHash = prevHash
+	record.Hash = Hash(*record, key)
+}
+
+// Hash fingerprints a record, keyed with the audit log's secret once the log
+// is keyed. Timestamps are hashed in UTC at millisecond precision which is what
+// the database keeps
+func Hash(record domain.AuditRecord, key Key) string {
+	bs, _ := json.Marshal(struct {
+		Seq       uint64 `json:"seq"`
+		PrevHash  string `json:"prev_hash"`
+		Actor     string `json:"actor"`
+		IP        string `json:"ip"`
+		Action    string `json:"action"`
+		WalletID  int    `json:"wallet_id"`
+		Details   string `json:"details"`
+		CreatedAt string `json:"created_at"`
+	}{
+		Seq:       record.Seq,
+		PrevHash:  record.PrevHash,
+		Actor:     record.Actor,
+		IP:        record.IP,
+		Action:    record.Action,
+		WalletID:  record.WalletID,
+		Details:   string(record.Details),
+		CreatedAt: record.CreatedAt.UTC().Truncate(time.Millisecond).Format(time.RFC3339Nano),
+	})
+
+	if key.Keyed(record.Seq) {
+		mac := hmac.New(sha256.New, key.Secret)
+		mac.Write(bs)
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	sum := sha256.Sum256(bs)
+	return hex.EncodeToString(sum[:])
+}
+
+// Log is the audit log as stored, read in sequence order
+type Log interface {
+	AuditRecords(
+		ctx context.Context,
+		afterSeq uint64,
+		limit int,
+	) ([]domain.AuditRecord, error)
+	AuditHead(ctx context.Context) (*domain.AuditHead, error)
+}
+
+// BrokenLink is the first record at which the audit log's hash chain breaks
+type BrokenLink struct {
+	Seq    uint64
+	Reason string
+}
+
+// String is a human readable description of the broken link
+func (b BrokenLink) String() string {
+	return fmt.Sprintf("record %d %s", b.Seq, b.Reason)
+}
+
+// Verify walks the audit log's hash chain from the first record and returns the
+// first broken link, if any, along with how many records were verified. Records
+// sealed with a key only verify against the same key
+func Verify(ctx context.Context, log Log, pageSize int, key Key) (*BrokenLink, uint64, error) {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+
+	var (
+		prevHash string
+		lastSeq  uint64
+	)
+	for {
+		records, err := log.AuditRecords(ctx, lastSeq, pageSize)
+		if err != nil {
+			return nil, lastSeq, dto.Wrap(err, "Verify")
+		}
+
+		for _, record := range records {
+			switch {
+			case record.Seq != lastSeq+1:
+				return &BrokenLink{Seq: lastSeq + 1, Reason: "has been deleted"}, lastSeq, nil
+			case record.PrevHash != prevHash:
+				return &BrokenLink{Seq: record.Seq, Reason: "does not link to the record before it"}, lastSeq, nil
+			case !hmac.Equal([]byte(Hash(record, key)), []byte(record.Hash)):
+				return &BrokenLink{Seq: record.Seq, Reason: "has been modified"}, lastSeq, nil
+			}
+
+			prevHash = record.Hash
+			lastSeq = record.Seq
+		}
+
+		if len(records) < pageSize {
+			break
+		}
+	}
+
+	// the head catches the latest records being deleted, which leaves no gap
+	head, err := log.AuditHead(ctx)
+	if err != nil {
+		return nil, lastSeq, dto.Wrap(err, "Verify")
+	}
+	switch {
+	case head == nil && lastSeq > 0, head != nil && head.Seq < lastSeq:
+		return &BrokenLink{Seq: headSeq(head) + 1, Reason: "was not appended through the audit log"}, lastSeq, nil
+	case head != nil && head.Seq > lastSeq:
+		return &BrokenLink{Seq: lastSeq + 1, Reason: "has been deleted"}, lastSeq, nil
+	case head != nil && head.Hash != prevHash:
+		return &BrokenLink{Seq: lastSeq, Reason: "does not match the head of the audit log"}, lastSeq, nil
+	}
+
+	return nil, lastSeq, nil
+}
+
+func headSeq(head *domain.AuditHead) uint64 {
+	if head == nil {
+		return 0
+	}
+	return head.Seq
+}
+
+// BalanceChange describes a wallet's balance going from previous to balance.
+// Credits take money out of a wallet and debits put money in
+func BalanceChange(previous, balance decimal.Decimal) (string, []byte) {
+	action := ActionDebited
+	if balance.LessThan(previous) {
+		action = ActionCredited
+	}
+
+	bs, _ := json.Marshal(map[string]string{
+		"previous_balance": previous.String(),
+		"balance":          balance.String(),
+		"amount":           balance.Sub(previous).Abs().String(),
+	})
+	return action, bs
+}
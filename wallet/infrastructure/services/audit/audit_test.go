@@ -0,0 +1,218 @@
+package audit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/audit"
+	"github.com/shopspring/decimal"
+)
+
+// memoryLog is an audit log held in memory
+type memoryLog struct {
+	records []domain.AuditRecord
+	head    *domain.AuditHead
+}
+
+func (m *memoryLog) AuditRecords(ctx context.Context, afterSeq uint64, limit int) ([]domain.AuditRecord, error) {
+	var page []domain.AuditRecord
+	for _, record := range m.records {
+		if record.Seq > afterSeq && len(page) < limit {
+			page = append(page, record)
+		}
+	}
+	return page, nil
+}
+
+func (m *memoryLog) AuditHead(ctx context.Context) (*domain.AuditHead, error) {
+	return m.head, nil
+}
+
+// testKey is the secret the test audit logs are sealed with
+var testKey = audit.Key{Secret: []byte("0123456789abcdef0123456789abcdef"), From: 1}
+
+// chain appends n sealed balance changes the way the database layer does
+func chain(n int, key audit.Key) *memoryLog {
+	m := &memoryLog{}
+	prevHash := ""
+	for i := 1; i <= n; i++ {
+		action, details := audit.BalanceChange(decimal.NewFromInt(int64(i)), decimal.NewFromInt(int64(i+1)))
+		record := domain.AuditRecord{
+			Seq:       uint64(i),
+			Actor:     "auth0|user",
+			IP:        "10.0.0.1",
+			Action:    action,
+			WalletID:  1,
+			Details:   details,
+			CreatedAt: time.Now(),
+		}
+		audit.Seal(&record, prevHash, key)
+		prevHash = record.Hash
+		m.records = append(m.records, record)
+	}
+	if n > 0 {
+		m.head = &domain.AuditHead{ID: 1, Seq: uint64(n), Hash: prevHash}
+	}
+	return m
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name       string
+		tamper     func(m *memoryLog)
+		wantBroken uint64
+	}{
+		{
+			name:   "happy case - intact",
+			tamper: func(m *memoryLog) {},
+		},
+		{
+			name: "sad case - modified amount",
+			tamper: func(m *memoryLog) {
+				m.records[4].Details = []byte(`{"amount":"1000"}`)
+			},
+			wantBroken: 5,
+		},
+		{
+			name: "sad case - modified and rehashed",
+			tamper: func(m *memoryLog) {
+				m.records[4].Actor = "someone else"
+				m.records[4].Hash = audit.Hash(m.records[4], testKey)
+			},
+			wantBroken: 6,
+		},
+		{
+			name: "sad case - rewritten without the key",
+			tamper: func(m *memoryLog) {
+				m.records[4].Actor = "someone else"
+				prevHash := m.records[3].Hash
+				for i := 4; i < len(m.records); i++ {
+					audit.Seal(&m.records[i], prevHash, audit.Key{})
+					prevHash = m.records[i].Hash
+				}
+				m.head.Hash = prevHash
+			},
+			wantBroken: 5,
+		},
+		{
+			name: "sad case - deleted record",
+			tamper: func(m *memoryLog) {
+				m.records = append(m.records[:2], m.records[3:]...)
+			},
+			wantBroken: 3,
+		},
+		{
+			name: "sad case - deleted latest records",
+			tamper: func(m *memoryLog) {
+				m.records = m.records[:8]
+			},
+			wantBroken: 9,
+		},
+		{
+			name: "sad case - record appended around the log",
+			tamper: func(m *memoryLog) {
+				record := domain.AuditRecord{Seq: 11, Action: audit.ActionDebited, WalletID: 1}
+				audit.Seal(&record, m.records[9].Hash, testKey)
+				m.records = append(m.records, record)
+			},
+			wantBroken: 11,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := chain(10, testKey)
+			tt.tamper(m)
+
+			// a small page size walks the chain across pages
+			broken, _, err := audit.Verify(context.Background(), m, 3, testKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantBroken == 0 {
+				if broken != nil {
+					t.Fatalf("expected an intact audit log but got %s", broken)
+				}
+				return
+			}
+			if broken == nil || broken.Seq != tt.wantBroken {
+				t.Fatalf("expected record %d to be reported but got %v", tt.wantBroken, broken)
+			}
+		})
+	}
+}
+
+func TestVerify_KeyedFrom(t *testing.T) {
+	// records written before the log was keyed are hashed without the secret
+	key := audit.Key{Secret: testKey.Secret, From: 6}
+	m := chain(5, audit.Key{})
+	for i := 6; i <= 10; i++ {
+		record := domain.AuditRecord{Seq: uint64(i), Action: audit.ActionDebited, WalletID: 1}
+		audit.Seal(&record, m.records[len(m.records)-1].Hash, key)
+		m.records = append(m.records, record)
+	}
+	m.head = &domain.AuditHead{ID: 1, Seq: 10, Hash: m.records[9].Hash}
+
+	broken, verified, err := audit.Verify(context.Background(), m, audit.DefaultPageSize, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if broken != nil || verified != 10 {
+		t.Fatalf("expected 10 records to verify but got %d and %v", verified, broken)
+	}
+
+	broken, _, err = audit.Verify(context.Background(), m, audit.DefaultPageSize, audit.Key{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if broken == nil || broken.Seq != 6 {
+		t.Fatalf("expected the first keyed record to be reported without the key but got %v", broken)
+	}
+}
+
+func TestKeyFromEnv(t *testing.T) {
+	t.Setenv("AUDIT_HMAC_KEY", "")
+	if key, err := audit.KeyFromEnv(); err != nil || key.Keyed(1) {
+		t.Fatalf("expected an unkeyed audit log but got %+v, %v", key, err)
+	}
+
+	t.Setenv("AUDIT_HMAC_KEY", "too short")
+	if _, err := audit.KeyFromEnv(); err == nil {
+		t.Fatal("expected a short key to be refused")
+	}
+
+	t.Setenv("AUDIT_HMAC_KEY", string(testKey.Secret))
+	t.Setenv("AUDIT_HMAC_FROM", "42")
+	key, err := audit.KeyFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Keyed(41) || !key.Keyed(42) {
+		t.Fatalf("expected records from 42 on to be keyed but got %+v", key)
+	}
+}
+
+func TestActorFrom(t *testing.T) {
+	if actor := audit.ActorFrom(context.Background()); actor.Subject != audit.Anonymous {
+		t.Fatalf("expected an anonymous actor but got %+v", actor)
+	}
+
+	want := audit.Actor{Subject: "auth0|user", IP: "10.0.0.1"}
+	if actor := audit.ActorFrom(audit.WithActor(context.Background(), want)); actor != want {
+		t.Fatalf("expected actor %+v but got %+v", want, actor)
+	}
+}
+
+func TestBalanceChange(t *testing.T) {
+	action, _ := audit.BalanceChange(decimal.NewFromInt(200), decimal.NewFromInt(150))
+	if action != audit.ActionCredited {
+		t.Fatalf("expected money taken out to be a credit but got %s", action)
+	}
+
+	action, _ = audit.BalanceChange(decimal.NewFromInt(150), decimal.NewFromInt(200))
+	if action != audit.ActionDebited {
+		t.Fatalf("expected money put in to be a debit but got %s", action)
+	}
+}
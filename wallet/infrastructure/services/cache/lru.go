@@ -0,0 +1,408 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"log/slog"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/metrics"
+)
+
+// InvalidationChannel is the pub/sub channel on which cached balance
+// invalidations are broadcast across API server instances
+const InvalidationChannel = "wallet:balance:invalidate"
+
+// evictionSource marks the invalidations of wallets evicted from the shared
+// cache, which every instance acts on
+const evictionSource = "evicted"
+
+// Invalidator represents a contract for broadcasting and receiving cached
+// balance invalidations across API server instances
+type Invalidator interface {
+	PublishInvalidation(
+		ctx context.Context,
+		message string,
+	) error
+	SubscribeInvalidations(
+		ctx context.Context,
+		handler func(message string),
+	) error
+}
+
+// LocalCacheOptions configures the in-process cache tier
+type LocalCacheOptions struct {
+	// MaxEntries is the maximum number of wallets held in memory,
+	// the least recently used wallet is evicted once it is exceeded
+	MaxEntries int
+	// TTL is how long a wallet is held in memory before it is considered stale
+	TTL time.Duration
+	// EarlyRefreshBeta enables probabilistic early refresh when greater than zero.
+	// Reads of a wallet that is about to expire are treated as misses with a
+	// probability that grows as expiry approaches, so hot wallets are refreshed
+	// by a single request instead of all of them missing at once. 1 is a sane default
+	EarlyRefreshBeta float64
+}
+
+type localEntry struct {
+	wallet    domain.Wallet
+	expiresAt time.Time
+	// delta is how long it took to fetch the wallet from the next tier
+	delta time.Duration
+}
+
+// LocalCache is an in-process LRU/TTL cache tier that decorates
+// another WalletCache (usually the Redis ServiceCache)
+type LocalCache struct {
+	Next        WalletCache
+	Invalidator Invalidator
+	Logger      *slog.Logger
+
+	opts       LocalCacheOptions
+	instanceID string
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[int]*list.Element
+	// stale are the wallets that could not be evicted from the next tier, whose
+	// balance there may be older than the one in the database
+	stale map[int]bool
+}
+
+// NewLocalCache initializes an in-process cache tier in front of the next tier.
+// Both the next tier and the invalidator are optional so that the local tier
+// can be used on its own
+func NewLocalCache(
+	next WalletCache,
+	invalidator Invalidator,
+	opts LocalCacheOptions,
+	logger *slog.Logger,
+) *LocalCache {
+	c := &LocalCache{
+		Next:        next,
+		Invalidator: invalidator,
+		Logger:      logger,
+		opts:        opts,
+		instanceID:  newInstanceID(),
+		order:       list.New(),
+		entries:     map[int]*list.Element{},
+		stale:       map[int]bool{},
+	}
+	c.checkPreconditions()
+	return c
+}
+
+func (c *LocalCache) checkPreconditions() {
+	if c.opts.MaxEntries <= 0 {
+		log.Panicf("local cache has not been configured with a size limit")
+	}
+	if c.opts.TTL <= 0 {
+		log.Panicf("local cache has not been configured with a TTL")
+	}
+	if c.opts.EarlyRefreshBeta < 0 {
+		log.Panicf("local cache early refresh beta can not be a negative number")
+	}
+	if c.Logger == nil {
+		log.Panicf("local cache has not been initialized with a logger")
+	}
+}
+
+func newInstanceID() string {
+	bs := make([]byte, 8)
+	if _, err := cryptorand.Read(bs); err != nil {
+		log.Panicf("failed to generate local cache instance ID: %v", err)
+	}
+	return hex.EncodeToString(bs)
+}
+
+// CacheBalance caches a wallet in memory and in the next tier, then notifies
+// the other instances to drop their stale in-memory copy
+func (c *LocalCache) CacheBalance(
+	ctx context.Context,
+	wallet *domain.Wallet,
+) (*domain.Wallet, error) {
+	if wallet == nil {
+		return nil, dto.Wrap(fmt.Errorf("no wallet has been passed"), "CacheBalance")
+	}
+
+	if c.Next != nil {
+		if _, err := c.Next.CacheBalance(ctx, wallet); err != nil {
+			c.Evict(wallet.ID)
+			return nil, dto.Wrap(err, "CacheBalance")
+		}
+	}
+	c.set(wallet, 0)
+	c.setStale(wallet.ID, false)
+
+	if c.Invalidator != nil {
+		message := fmt.Sprintf("%s:%d", c.instanceID, wallet.ID)
+		if err := c.Invalidator.PublishInvalidation(ctx, message); err != nil {
+			return nil, dto.Wrap(err, "CacheBalance")
+		}
+	}
+
+	return wallet, nil
+}
+
+// FillBalance caches a wallet read from the database in the next tier unless it is
+// cached there already. It is only held in memory once it is read back from the next
+// tier, which holds whichever balance was cached first; without a next tier it is
+// held in memory unless it is already
+func (c *LocalCache) FillBalance(
+	ctx context.Context,
+	wallet *domain.Wallet,
+) error {
+	if wallet == nil {
+		return dto.Wrap(fmt.Errorf("no wallet has been passed"), "FillBalance")
+	}
+
+	if c.Next != nil {
+		if err := c.Next.FillBalance(ctx, wallet); err != nil {
+			return dto.Wrap(err, "FillBalance")
+		}
+		return nil
+	}
+	if c.get(wallet.ID) == nil {
+		c.set(wallet, 0)
+	}
+
+	return nil
+}
+
+// GetCachedBalance retrieves a wallet from memory, falling back to the next tier.
+// A wallet that could not be evicted from the next tier is not read from it
+func (c *LocalCache) GetCachedBalance(
+	ctx context.Context,
+	walletID int,
+) (*domain.Wallet, error) {
+	if c.isStale(ctx, walletID) {
+		return nil, nil
+	}
+	if wallet := c.get(walletID); wallet != nil {
+		metrics.ObserveCacheLookups(metrics.LocalTier, 1, 0)
+		return wallet, nil
+	}
+	metrics.ObserveCacheLookups(metrics.LocalTier, 0, 1)
+
+	if c.Next == nil {
+		return nil, nil
+	}
+
+	start := time.Now()
+	wallet, err := c.Next.GetCachedBalance(ctx, walletID)
+	if err != nil {
+		return nil, dto.Wrap(err, "GetCachedBalance")
+	}
+	if wallet != nil {
+		c.set(wallet, time.Since(start))
+	}
+
+	return wallet, nil
+}
+
+// GetCachedBalances retrieves many wallets from memory, falling back to the next
+// tier for the ones that are not held in memory. Wallets that could not be evicted
+// from the next tier are left out
+func (c *LocalCache) GetCachedBalances(
+	ctx context.Context,
+	walletIDs []int,
+) (map[int]*domain.Wallet, error) {
+	wallets := map[int]*domain.Wallet{}
+	var misses []int
+	for _, walletID := range walletIDs {
+		if c.isStale(ctx, walletID) {
+			continue
+		}
+		if wallet := c.get(walletID); wallet != nil {
+			wallets[walletID] = wallet
+			continue
+		}
+		misses = append(misses, walletID)
+	}
+	metrics.ObserveCacheLookups(metrics.LocalTier, len(wallets), len(misses))
+
+	if c.Next == nil || len(misses) == 0 {
+		return wallets, nil
+	}
+
+	start := time.Now()
+	cached, err := c.Next.GetCachedBalances(ctx, misses)
+	if err != nil {
+		return nil, dto.Wrap(err, "GetCachedBalances")
+	}
+	delta := time.Since(start)
+	for walletID, wallet := range cached {
+		c.set(wallet, delta)
+		wallets[walletID] = wallet
+	}
+
+	return wallets, nil
+}
+
+// EvictBalance drops a wallet from memory and evicts it from the next tier. A wallet
+// the next tier fails to evict is not read from it until it has been evicted or
+// cached again, the eviction being retried when the wallet is next read
+func (c *LocalCache) EvictBalance(
+	ctx context.Context,
+	walletID int,
+) error {
+	c.Evict(walletID)
+	if c.Next == nil {
+		return nil
+	}
+
+	if err := c.Next.EvictBalance(ctx, walletID); err != nil {
+		c.setStale(walletID, true)
+		return dto.Wrap(err, "EvictBalance")
+	}
+	c.setStale(walletID, false)
+
+	return nil
+}
+
+// isStale reports whether a wallet's balance in the next tier may be stale, retrying
+// its eviction first
+func (c *LocalCache) isStale(ctx context.Context, walletID int) bool {
+	c.mu.Lock()
+	stale := c.stale[walletID]
+	c.mu.Unlock()
+	if !stale {
+		return false
+	}
+
+	return c.EvictBalance(ctx, walletID) != nil
+}
+
+func (c *LocalCache) setStale(walletID int, stale bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if stale {
+		c.stale[walletID] = true
+		return
+	}
+	delete(c.stale, walletID)
+}
+
+// Evict drops a wallet from memory
+func (c *LocalCache) Evict(walletID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[walletID]; ok {
+		c.order.Remove(el)
+		delete(c.entries, walletID)
+	}
+}
+
+// Len returns the number of wallets held in memory
+func (c *LocalCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// ListenForInvalidations evicts wallets that other instances have updated.
+// It blocks until the context is cancelled or the subscription fails or ends,
+// after which it is expected to be called again. Wallets updated in between are
+// served from the cache for at most its TTL
+func (c *LocalCache) ListenForInvalidations(ctx context.Context) error {
+	if c.Invalidator == nil {
+		return nil
+	}
+
+	return c.Invalidator.SubscribeInvalidations(ctx, c.handleInvalidation)
+}
+
+func (c *LocalCache) handleInvalidation(message string) {
+	parts := strings.SplitN(message, ":", 2)
+	if len(parts) != 2 {
+		c.Logger.Warn("ignoring malformed cache invalidation", slog.String("message", message))
+		return
+	}
+	if parts[0] == c.instanceID {
+		return
+	}
+
+	walletID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		c.Logger.Warn("ignoring malformed cache invalidation", slog.String("message", message))
+		return
+	}
+	c.Evict(walletID)
+}
+
+func (c *LocalCache) get(walletID int) *domain.Wallet {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[walletID]
+	if !ok {
+		return nil
+	}
+
+	entry := el.Value.(*localEntry)
+	now := time.Now()
+	if now.After(entry.expiresAt) {
+		c.order.Remove(el)
+		delete(c.entries, walletID)
+		return nil
+	}
+	c.order.MoveToFront(el)
+
+	if c.refreshEarly(now, entry) {
+		return nil
+	}
+
+	wallet := entry.wallet
+	return &wallet
+}
+
+// refreshEarly implements the XFetch algorithm: an entry is refreshed ahead of
+// its expiry with probability exp(-remaining / (delta * beta))
+func (c *LocalCache) refreshEarly(now time.Time, entry *localEntry) bool {
+	if c.opts.EarlyRefreshBeta == 0 || entry.delta == 0 {
+		return false
+	}
+
+	gap := float64(entry.delta) * c.opts.EarlyRefreshBeta * -math.Log(1-rand.Float64())
+	return now.Add(time.Duration(gap)).After(entry.expiresAt)
+}
+
+func (c *LocalCache) set(wallet *domain.Wallet, delta time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &localEntry{
+		wallet:    *wallet,
+		expiresAt: time.Now().Add(c.opts.TTL),
+		delta:     delta,
+	}
+	if el, ok := c.entries[wallet.ID]; ok {
+		if delta == 0 {
+			entry.delta = el.Value.(*localEntry).delta
+		}
+		el.Value = entry
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[wallet.ID] = c.order.PushFront(entry)
+	for c.order.Len() > c.opts.MaxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*localEntry).wallet.ID)
+	}
+}
@@ -0,0 +1,333 @@
+package cache_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/cache"
+	"github.com/shopspring/decimal"
+)
+
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+type fakeTier struct {
+	wallets map[int]*domain.Wallet
+	gets    int
+	err     error
+}
+
+func (f *fakeTier) CacheBalance(ctx context.Context, wallet *domain.Wallet) (*domain.Wallet, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.wallets[wallet.ID] = wallet
+	return wallet, nil
+}
+
+func (f *fakeTier) FillBalance(ctx context.Context, wallet *domain.Wallet) error {
+	if f.err != nil {
+		return f.err
+	}
+	if _, ok := f.wallets[wallet.ID]; !ok {
+		f.wallets[wallet.ID] = wallet
+	}
+	return nil
+}
+
+func (f *fakeTier) GetCachedBalance(ctx context.Context, walletID int) (*domain.Wallet, error) {
+	f.gets++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.wallets[walletID], nil
+}
+
+func (f *fakeTier) GetCachedBalances(ctx context.Context, walletIDs []int) (map[int]*domain.Wallet, error) {
+	f.gets++
+	if f.err != nil {
+		return nil, f.err
+	}
+	wallets := map[int]*domain.Wallet{}
+	for _, walletID := range walletIDs {
+		if wallet, ok := f.wallets[walletID]; ok {
+			wallets[walletID] = wallet
+		}
+	}
+	return wallets, nil
+}
+
+func (f *fakeTier) EvictBalance(ctx context.Context, walletID int) error {
+	if f.err != nil {
+		return f.err
+	}
+	delete(f.wallets, walletID)
+	return nil
+}
+
+type fakeInvalidator struct {
+	published []string
+}
+
+func (f *fakeInvalidator) PublishInvalidation(ctx context.Context, message string) error {
+	f.published = append(f.published, message)
+	return nil
+}
+
+func (f *fakeInvalidator) SubscribeInvalidations(ctx context.Context, handler func(message string)) error {
+	for _, message := range f.published {
+		handler(message)
+	}
+	return nil
+}
+
+func TestLocalCache_GetCachedBalance(t *testing.T) {
+	wallet := &domain.Wallet{ID: 1, Balance: decimal.NewFromFloat(10.45)}
+
+	tests := []struct {
+		name     string
+		next     *fakeTier
+		walletID int
+		wantNil  bool
+		wantGets int
+		wantErr  bool
+	}{
+		{
+			name:     "happy case - served from next tier",
+			next:     &fakeTier{wallets: map[int]*domain.Wallet{1: wallet}},
+			walletID: 1,
+			wantGets: 1,
+		},
+		{
+			name:     "happy case - miss in both tiers",
+			next:     &fakeTier{wallets: map[int]*domain.Wallet{}},
+			walletID: 1,
+			wantNil:  true,
+			wantGets: 2,
+		},
+		{
+			name:     "sad case - next tier fails",
+			next:     &fakeTier{err: fmt.Errorf("redis is down")},
+			walletID: 1,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cache.NewLocalCache(tt.next, nil, cache.LocalCacheOptions{
+				MaxEntries: 10,
+				TTL:        time.Minute,
+			}, logger)
+
+			got, err := c.GetCachedBalance(ctx, tt.walletID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LocalCache.GetCachedBalance() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (got == nil) != tt.wantNil {
+				t.Fatalf("expected nil wallet to be %v but got %v", tt.wantNil, got)
+			}
+
+			// the second read should be served from memory when the first one hit
+			if _, err := c.GetCachedBalance(ctx, tt.walletID); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.next.gets != tt.wantGets {
+				t.Fatalf("expected %d reads from next tier but got %d", tt.wantGets, tt.next.gets)
+			}
+		})
+	}
+}
+
+func TestLocalCache_Limits(t *testing.T) {
+	c := cache.NewLocalCache(nil, nil, cache.LocalCacheOptions{
+		MaxEntries: 2,
+		TTL:        50 * time.Millisecond,
+	}, logger)
+
+	for id := 1; id <= 3; id++ {
+		if _, err := c.CacheBalance(ctx, &domain.Wallet{ID: id}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if c.Len() != 2 {
+		t.Fatalf("expected 2 wallets in memory but got %d", c.Len())
+	}
+
+	if got, _ := c.GetCachedBalance(ctx, 1); got != nil {
+		t.Fatalf("expected least recently used wallet to be evicted")
+	}
+	if got, _ := c.GetCachedBalance(ctx, 3); got == nil {
+		t.Fatalf("expected most recently used wallet to be cached")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if got, _ := c.GetCachedBalance(ctx, 3); got != nil {
+		t.Fatalf("expected expired wallet not to be returned")
+	}
+}
+
+func TestLocalCache_Invalidation(t *testing.T) {
+	invalidator := &fakeInvalidator{}
+	next := &fakeTier{wallets: map[int]*domain.Wallet{}}
+	opts := cache.LocalCacheOptions{MaxEntries: 10, TTL: time.Minute}
+
+	writer := cache.NewLocalCache(next, invalidator, opts, logger)
+	reader := cache.NewLocalCache(next, invalidator, opts, logger)
+
+	if _, err := reader.CacheBalance(ctx, &domain.Wallet{ID: 7, Balance: decimal.NewFromInt(1)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	invalidator.published = nil
+
+	if _, err := writer.CacheBalance(ctx, &domain.Wallet{ID: 7, Balance: decimal.NewFromInt(2)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(invalidator.published) != 1 {
+		t.Fatalf("expected an invalidation to be published")
+	}
+
+	if err := reader.ListenForInvalidations(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := writer.ListenForInvalidations(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if reader.Len() != 0 {
+		t.Fatalf("expected the reader's stale copy to be evicted")
+	}
+	if writer.Len() != 1 {
+		t.Fatalf("expected the writer to ignore its own invalidation")
+	}
+
+	got, err := reader.GetCachedBalance(ctx, 7)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.Balance.Equal(decimal.NewFromInt(2)) {
+		t.Fatalf("expected the reader to see the new balance but got %s", got.Balance)
+	}
+}
+
+func TestLocalCache_EvictBalance(t *testing.T) {
+	stale := &domain.Wallet{ID: 3, Balance: decimal.NewFromInt(10)}
+	next := &fakeTier{wallets: map[int]*domain.Wallet{3: stale}}
+	c := cache.NewLocalCache(next, nil, cache.LocalCacheOptions{MaxEntries: 10, TTL: time.Minute}, logger)
+	if _, err := c.GetCachedBalance(ctx, 3); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the next tier can neither cache the changed balance nor evict the stale one
+	next.err = fmt.Errorf("redis is down")
+	if _, err := c.CacheBalance(ctx, &domain.Wallet{ID: 3, Balance: decimal.NewFromInt(20)}); err == nil {
+		t.Fatalf("expected caching to fail")
+	}
+	if err := c.EvictBalance(ctx, 3); err == nil {
+		t.Fatalf("expected the eviction to fail")
+	}
+
+	// the eviction is retried by the next read, which skips the next tier while it fails
+	gets := next.gets
+	got, err := c.GetCachedBalance(ctx, 3)
+	if err != nil || got != nil || next.gets != gets {
+		t.Fatalf("expected the stale wallet not to be read from the next tier but got %v, %v", got, err)
+	}
+
+	next.err = nil
+	got, err = c.GetCachedBalance(ctx, 3)
+	if err != nil || got != nil {
+		t.Fatalf("expected the stale wallet to be evicted but got %v, %v", got, err)
+	}
+	if _, ok := next.wallets[3]; ok {
+		t.Fatalf("expected the stale wallet to be evicted from the next tier")
+	}
+}
+
+type slowTier struct {
+	fakeTier
+	delay time.Duration
+}
+
+func (s *slowTier) GetCachedBalance(ctx context.Context, walletID int) (*domain.Wallet, error) {
+	time.Sleep(s.delay)
+	return s.fakeTier.GetCachedBalance(ctx, walletID)
+}
+
+func TestLocalCache_EarlyRefresh(t *testing.T) {
+	tests := []struct {
+		name        string
+		beta        float64
+		wantRefresh bool
+	}{
+		{
+			name:        "happy case - refreshes ahead of expiry",
+			beta:        1000,
+			wantRefresh: true,
+		},
+		{
+			name:        "happy case - disabled",
+			beta:        0,
+			wantRefresh: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &slowTier{
+				fakeTier: fakeTier{wallets: map[int]*domain.Wallet{1: {ID: 1}}},
+				delay:    time.Millisecond,
+			}
+			c := cache.NewLocalCache(next, nil, cache.LocalCacheOptions{
+				MaxEntries:       10,
+				TTL:              100 * time.Millisecond,
+				EarlyRefreshBeta: tt.beta,
+			}, logger)
+
+			for i := 0; i < 20; i++ {
+				if _, err := c.GetCachedBalance(ctx, 1); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			refreshed := next.gets > 1
+			if refreshed != tt.wantRefresh {
+				t.Fatalf("expected early refresh to be %v but got %d reads from next tier", tt.wantRefresh, next.gets)
+			}
+		})
+	}
+}
+
+func TestLocalCache_FillBalance(t *testing.T) {
+	next := &fakeTier{wallets: map[int]*domain.Wallet{}}
+	c := cache.NewLocalCache(next, nil, cache.LocalCacheOptions{MaxEntries: 10, TTL: time.Minute}, logger)
+
+	// a change is cached before a read that started earlier fills its stale balance
+	if _, err := c.CacheBalance(ctx, &domain.Wallet{ID: 7, Balance: decimal.NewFromInt(2)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.FillBalance(ctx, &domain.Wallet{ID: 7, Balance: decimal.NewFromInt(1)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.Evict(7)
+
+	got, err := c.GetCachedBalance(ctx, 7)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got == nil || !got.Balance.Equal(decimal.NewFromInt(2)) {
+		t.Fatalf("expected the changed balance to stay cached but got %v", got)
+	}
+
+	if err := c.FillBalance(ctx, &domain.Wallet{ID: 8, Balance: decimal.NewFromInt(3)}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := c.GetCachedBalance(ctx, 8); got == nil || !got.Balance.Equal(decimal.NewFromInt(3)) {
+		t.Fatalf("expected a wallet that was not cached to be filled but got %v", got)
+	}
+}
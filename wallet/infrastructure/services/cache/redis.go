@@ -5,10 +5,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
 	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
-	"github.com/go-redis/redis"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/metrics"
+	"github.com/go-redis/redis/v8"
 )
 
 // WalletCache represents a contract that should be adhered to by the cache service
@@ -17,22 +22,144 @@ type WalletCache interface {
 		ctx context.Context,
 		wallet *domain.Wallet,
 	) (*domain.Wallet, error)
+	// FillBalance caches a wallet read from the database unless it is cached already,
+	// so that a balance read before a change is never cached over the changed one
+	FillBalance(
+		ctx context.Context,
+		wallet *domain.Wallet,
+	) error
 	GetCachedBalance(
 		ctx context.Context,
 		walletID int,
 	) (*domain.Wallet, error)
+	GetCachedBalances(
+		ctx context.Context,
+		walletIDs []int,
+	) (map[int]*domain.Wallet, error)
+	// EvictBalance removes a wallet from the cache so that its balance is next read
+	// from the database
+	EvictBalance(
+		ctx context.Context,
+		walletID int,
+	) error
+}
+
+// RedisClient is the subset of the redis client API that the cache service relies on.
+// It is satisfied by single node, sentinel (failover) and cluster clients
+type RedisClient interface {
+	Ping(ctx context.Context) *redis.StatusCmd
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Pipeline() redis.Pipeliner
+	Set(
+		ctx context.Context,
+		key string,
+		value interface{},
+		expiration time.Duration,
+	) *redis.StatusCmd
+	SetNX(
+		ctx context.Context,
+		key string,
+		value interface{},
+		expiration time.Duration,
+	) *redis.BoolCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+	Publish(
+		ctx context.Context,
+		channel string,
+		message interface{},
+	) *redis.IntCmd
+	Subscribe(ctx context.Context, channels ...string) *redis.PubSub
+}
+
+// Redis deployment modes supported by ConnectToRedis
+const (
+	RedisModeSingle   = "single"
+	RedisModeSentinel = "sentinel"
+	RedisModeCluster  = "cluster"
+)
+
+// ConnectToRedis opens a connection to redis. The deployment is selected with
+// REDIS_MODE (single, sentinel or cluster) and REDIS_ADDR holds a comma separated
+// list of node (or sentinel) addresses
+func ConnectToRedis(ctx context.Context) (RedisClient, error) {
+	addrs := strings.Split(os.Getenv("REDIS_ADDR"), ",")
+	password := os.Getenv("REDIS_PASSWORD")
+
+	db := 0
+	if os.Getenv("REDIS_DB") != "" {
+		var err error
+		db, err = strconv.Atoi(os.Getenv("REDIS_DB"))
+		if err != nil {
+			return nil, dto.Wrap(
+				fmt.Errorf("invalid REDIS_DB with err %v", err),
+				"ConnectToRedis",
+			)
+		}
+	}
+
+	var client RedisClient
+	switch mode := os.Getenv("REDIS_MODE"); mode {
+	case "", RedisModeSingle:
+		client = redis.NewClient(&redis.Options{
+			Addr:     addrs[0],
+			Password: password,
+			DB:       db,
+		})
+
+	case RedisModeSentinel:
+		client = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       os.Getenv("REDIS_MASTER_NAME"),
+			SentinelAddrs:    addrs,
+			SentinelPassword: os.Getenv("REDIS_SENTINEL_PASSWORD"),
+			Password:         password,
+			DB:               db,
+		})
+
+	case RedisModeCluster:
+		client = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:    addrs,
+			Password: password,
+		})
+
+	default:
+		return nil, dto.Wrap(
+			fmt.Errorf("unsupported redis mode %q", mode),
+			"ConnectToRedis",
+		)
+	}
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, dto.Wrap(
+			fmt.Errorf("failed to connect to redis with err %v", err),
+			"ConnectToRedis",
+		)
+	}
+
+	return client, nil
+}
+
+// cacheUnavailable classifies a failed redis call as the cache being unavailable
+func cacheUnavailable(err error) error {
+	return domain.NewError(domain.ErrUnavailable, "the cache is unavailable", err)
 }
 
+// DefaultTTL is how long a balance is cached unless told otherwise
+const DefaultTTL = time.Hour
+
 // ServiceCache sets up wallet's API server cache layer
 // with all the necessary dependencies
 type ServiceCache struct {
-	Rdb *redis.Client
+	Rdb RedisClient
+	// TTL bounds how long a balance is cached, and so how long a wrongly cached
+	// balance can be read
+	TTL time.Duration
 }
 
 // NewCacheService initalizes a new cache service
-func NewCacheService(client *redis.Client) *ServiceCache {
+func NewCacheService(client RedisClient) *ServiceCache {
 	c := &ServiceCache{
 		Rdb: client,
+		TTL: DefaultTTL,
 	}
 	c.checkPreconditions()
 	return c
@@ -42,6 +169,9 @@ func (c *ServiceCache) checkPreconditions() {
 	if c.Rdb == nil {
 		log.Panicf("cache service has not initalized redis client")
 	}
+	if c.TTL <= 0 {
+		log.Panicf("cache service has not been configured with a TTL")
+	}
 }
 
 // CacheBalance caches a wallet to easily retrieve its balance
@@ -60,9 +190,12 @@ func (c *ServiceCache) CacheBalance(
 			"CacheBalance",
 		)
 	}
-	if err := c.Rdb.Set(fmt.Sprint(wallet.ID), bs, 0).Err(); err != nil {
+	start := time.Now()
+	err = c.Rdb.Set(ctx, fmt.Sprint(wallet.ID), bs, c.TTL).Err()
+	metrics.ObserveRedisCall("set", time.Since(start), err)
+	if err != nil {
 		return nil, dto.Wrap(
-			fmt.Errorf("failed to cache wallet balance with err %v", err),
+			cacheUnavailable(fmt.Errorf("failed to cache wallet balance with err %v", err)),
 			"CacheBalance",
 		)
 	}
@@ -70,18 +203,54 @@ func (c *ServiceCache) CacheBalance(
 	return wallet, nil
 }
 
+// FillBalance caches a wallet read from the database unless it is cached already. A
+// change caches the wallet's new balance once it is committed, so the balance cached
+// first is never older than the one being filled
+func (c *ServiceCache) FillBalance(
+	ctx context.Context,
+	wallet *domain.Wallet,
+) error {
+	if wallet == nil {
+		return dto.Wrap(fmt.Errorf("no wallet has been passed"), "FillBalance")
+	}
+
+	bs, err := json.Marshal(wallet)
+	if err != nil {
+		return dto.Wrap(
+			fmt.Errorf("failed to marshal wallet balance with err %v", err),
+			"FillBalance",
+		)
+	}
+	start := time.Now()
+	err = c.Rdb.SetNX(ctx, fmt.Sprint(wallet.ID), bs, c.TTL).Err()
+	metrics.ObserveRedisCall("setnx", time.Since(start), err)
+	if err != nil {
+		return dto.Wrap(
+			cacheUnavailable(fmt.Errorf("failed to cache wallet balance with err %v", err)),
+			"FillBalance",
+		)
+	}
+
+	return nil
+}
+
 // GetCachedBalance retrieves wallet balance from the cache
 func (c *ServiceCache) GetCachedBalance(
 	ctx context.Context,
 	walletID int,
 ) (*domain.Wallet, error) {
 	var wallet domain.Wallet
-	result, err := c.Rdb.Get(fmt.Sprint(walletID)).Result()
+	start := time.Now()
+	result, err := c.Rdb.Get(ctx, fmt.Sprint(walletID)).Result()
 	switch err {
 	case redis.Nil:
+		metrics.ObserveRedisCall("get", time.Since(start), nil)
+		metrics.ObserveCacheLookups(metrics.RedisTier, 0, 1)
 		return nil, nil
 
 	case nil:
+		metrics.ObserveRedisCall("get", time.Since(start), nil)
+		metrics.ObserveCacheLookups(metrics.RedisTier, 1, 0)
 		if err := json.Unmarshal([]byte(result), &wallet); err != nil {
 			return nil, dto.Wrap(
 				fmt.Errorf(
@@ -94,9 +263,212 @@ func (c *ServiceCache) GetCachedBalance(
 		return &wallet, nil
 
 	default:
+		metrics.ObserveRedisCall("get", time.Since(start), err)
 		return nil, dto.Wrap(
-			fmt.Errorf("failed to get cached balance with err %v", err),
+			cacheUnavailable(fmt.Errorf("failed to get cached balance with err %v", err)),
 			"GetCachedBalance",
 		)
 	}
 }
+
+// EvictBalance removes a wallet from the cache and tells every instance to evict it
+// from memory, so that its balance is next read from the database
+func (c *ServiceCache) EvictBalance(
+	ctx context.Context,
+	walletID int,
+) error {
+	start := time.Now()
+	err := c.Rdb.Del(ctx, fmt.Sprint(walletID)).Err()
+	metrics.ObserveRedisCall("del", time.Since(start), err)
+	if err != nil {
+		return dto.Wrap(
+			cacheUnavailable(fmt.Errorf("failed to evict cached balance with err %v", err)),
+			"EvictBalance",
+		)
+	}
+
+	if err := c.PublishInvalidation(ctx, fmt.Sprintf("%s:%d", evictionSource, walletID)); err != nil {
+		return dto.Wrap(err, "EvictBalance")
+	}
+
+	return nil
+}
+
+// GetCachedBalances retrieves the balances of many wallets from the cache in a
+// single round trip, or one per node in cluster mode where the wallets' keys hash
+// to different slots. Wallets that are not cached are left out of the result
+func (c *ServiceCache) GetCachedBalances(
+	ctx context.Context,
+	walletIDs []int,
+) (map[int]*domain.Wallet, error) {
+	wallets := map[int]*domain.Wallet{}
+	if len(walletIDs) == 0 {
+		return wallets, nil
+	}
+
+	// a pipeline of GETs rather than an MGET, which is refused across cluster slots
+	pipe := c.Rdb.Pipeline()
+	gets := make([]*redis.StringCmd, len(walletIDs))
+	for i, walletID := range walletIDs {
+		gets[i] = pipe.Get(ctx, fmt.Sprint(walletID))
+	}
+
+	start := time.Now()
+	_, err := pipe.Exec(ctx)
+	if err == redis.Nil {
+		err = nil
+	}
+	metrics.ObserveRedisCall("pipeline_get", time.Since(start), err)
+	if err != nil {
+		return nil, dto.Wrap(
+			cacheUnavailable(fmt.Errorf("failed to get cached balances with err %v", err)),
+			"GetCachedBalances",
+		)
+	}
+
+	for i, get := range gets {
+		str, err := get.Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, dto.Wrap(
+				cacheUnavailable(fmt.Errorf("failed to get cached balances with err %v", err)),
+				"GetCachedBalances",
+			)
+		}
+
+		var wallet domain.Wallet
+		if err := json.Unmarshal([]byte(str), &wallet); err != nil {
+			return nil, dto.Wrap(
+				fmt.Errorf(
+					"failed to unmarshal cached balance with err %v",
+					err,
+				),
+				"GetCachedBalances",
+			)
+		}
+		wallets[walletIDs[i]] = &wallet
+	}
+	metrics.ObserveCacheLookups(metrics.RedisTier, len(wallets), len(walletIDs)-len(wallets))
+
+	return wallets, nil
+}
+
+// PublishInvalidation broadcasts a cached balance invalidation to the other instances
+func (c *ServiceCache) PublishInvalidation(
+	ctx context.Context,
+	message string,
+) error {
+	start := time.Now()
+	err := c.Rdb.Publish(ctx, InvalidationChannel, message).Err()
+	metrics.ObserveRedisCall("publish", time.Since(start), err)
+	if err != nil {
+		return dto.Wrap(
+			cacheUnavailable(fmt.Errorf("failed to publish cache invalidation with err %v", err)),
+			"PublishInvalidation",
+		)
+	}
+
+	return nil
+}
+
+// SubscribeInvalidations passes every cached balance invalidation to the handler
+// until the context is cancelled
+func (c *ServiceCache) SubscribeInvalidations(
+	ctx context.Context,
+	handler func(message string),
+) error {
+	pubsub := c.Rdb.Subscribe(ctx, InvalidationChannel)
+	defer pubsub.Close()
+
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return dto.Wrap(
+			fmt.Errorf("failed to subscribe to cache invalidations with err %v", err),
+			"SubscribeInvalidations",
+		)
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			handler(msg.Payload)
+		}
+	}
+}
+
+// BalanceChannel is the pub/sub channel on which balance updates are broadcast
+// to the balance watchers of every API server instance
+const BalanceChannel = "wallet:balance:updates"
+
+// PublishBalance broadcasts a wallet's new balance to every instance
+func (c *ServiceCache) PublishBalance(
+	ctx context.Context,
+	wallet *domain.Wallet,
+) error {
+	if wallet == nil {
+		return dto.Wrap(fmt.Errorf("no wallet has been passed"), "PublishBalance")
+	}
+
+	bs, err := json.Marshal(wallet)
+	if err != nil {
+		return dto.Wrap(
+			fmt.Errorf("failed to marshal wallet balance with err %v", err),
+			"PublishBalance",
+		)
+	}
+	start := time.Now()
+	err = c.Rdb.Publish(ctx, BalanceChannel, bs).Err()
+	metrics.ObserveRedisCall("publish", time.Since(start), err)
+	if err != nil {
+		return dto.Wrap(
+			cacheUnavailable(fmt.Errorf("failed to publish balance update with err %v", err)),
+			"PublishBalance",
+		)
+	}
+
+	return nil
+}
+
+// SubscribeBalances passes every broadcast balance update to the handler until
+// the context is cancelled. Malformed updates are skipped
+func (c *ServiceCache) SubscribeBalances(
+	ctx context.Context,
+	handler func(wallet *domain.Wallet),
+) error {
+	pubsub := c.Rdb.Subscribe(ctx, BalanceChannel)
+	defer pubsub.Close()
+
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return dto.Wrap(
+			fmt.Errorf("failed to subscribe to balance updates with err %v", err),
+			"SubscribeBalances",
+		)
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+
+			var wallet domain.Wallet
+			if err := json.Unmarshal([]byte(msg.Payload), &wallet); err != nil {
+				continue
+			}
+			handler(&wallet)
+		}
+	}
+}
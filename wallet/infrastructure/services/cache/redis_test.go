@@ -9,7 +9,7 @@ import (
 
 	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
 	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/cache"
-	"github.com/go-redis/redis"
+	"github.com/go-redis/redis/v8"
 	"github.com/shopspring/decimal"
 )
 
@@ -28,6 +28,59 @@ func initalizeRedisService() *cache.ServiceCache {
 
 	return cache.NewCacheService(rdb)
 }
+
+// single node, sentinel and cluster clients must all be usable by the cache service
+var (
+	_ cache.RedisClient = (*redis.Client)(nil)
+	_ cache.RedisClient = (*redis.ClusterClient)(nil)
+)
+
+func TestConnectToRedis(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	defer os.Setenv("REDIS_ADDR", addr)
+	defer os.Unsetenv("REDIS_MODE")
+
+	tests := []struct {
+		name    string
+		mode    string
+		addr    string
+		wantErr bool
+	}{
+		{
+			name:    "happy case",
+			mode:    cache.RedisModeSingle,
+			addr:    addr,
+			wantErr: false,
+		},
+		{
+			name:    "sad case - unsupported mode",
+			mode:    "replicated",
+			addr:    addr,
+			wantErr: true,
+		},
+		{
+			name:    "sad case - unreachable cluster",
+			mode:    cache.RedisModeCluster,
+			addr:    "127.0.0.1:1,127.0.0.1:2",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv("REDIS_MODE", tt.mode)
+			os.Setenv("REDIS_ADDR", tt.addr)
+
+			client, err := cache.ConnectToRedis(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ConnectToRedis() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && client == nil {
+				t.Fatalf("expected a redis client")
+			}
+		})
+	}
+}
+
 func TestServiceCache_CacheBalance(t *testing.T) {
 	type args struct {
 		ctx    context.Context
@@ -130,3 +183,23 @@ func TestServiceCache_GetCachedBalance(t *testing.T) {
 		})
 	}
 }
+
+func TestServiceCache_GetCachedBalances(t *testing.T) {
+	c := initalizeRedisService()
+	for _, walletID := range []int{11, 12} {
+		if _, err := c.CacheBalance(ctx, &domain.Wallet{ID: walletID, Balance: decimal.NewFromInt(int64(walletID))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.EvictBalance(ctx, 13); err != nil {
+		t.Fatal(err)
+	}
+
+	wallets, err := c.GetCachedBalances(ctx, []int{11, 12, 13})
+	if err != nil {
+		t.Fatalf("ServiceCache.GetCachedBalances() error = %v", err)
+	}
+	if len(wallets) != 2 || !wallets[11].Balance.Equal(decimal.NewFromInt(11)) || !wallets[12].Balance.Equal(decimal.NewFromInt(12)) {
+		t.Fatalf("expected wallets 11 and 12 to be cached and 13 to be left out but got %v", wallets)
+	}
+}
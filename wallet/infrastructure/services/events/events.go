@@ -0,0 +1,108 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/shopspring/decimal"
+)
+
+// Types of the domain events published to downstream systems
+const (
+	WalletCredited = domain.EventWalletCredited
+	WalletDebited  = domain.EventWalletDebited
+	WalletFrozen   = domain.EventWalletFrozen
+	WalletUnfrozen = domain.EventWalletUnfrozen
+)
+
+// Event is the payload of a domain event as it is published. Delivery is at least
+// once so consumers should skip events whose ID they have already handled
+type Event struct {
+	ID              string          `json:"id"`
+	Type            string          `json:"type"`
+	WalletID        int             `json:"wallet_id"`
+	Amount          decimal.Decimal `json:"amount"`
+	PreviousBalance decimal.Decimal `json:"previous_balance"`
+	Balance         decimal.Decimal `json:"balance"`
+	OccurredAt      time.Time       `json:"occurred_at"`
+}
+
+// BalanceChanged is the outbox event of a wallet's balance going from previous
+// to balance. Credits take money out of a wallet and debits put money in
+func BalanceChanged(walletID int, previous, balance decimal.Decimal) (*domain.OutboxEvent, error) {
+	eventID, err := newEventID()
+	if err != nil {
+		return nil, err
+	}
+
+	event := Event{
+		ID:              eventID,
+		Type:            WalletDebited,
+		WalletID:        walletID,
+		Amount:          balance.Sub(previous).Abs(),
+		PreviousBalance: previous,
+		Balance:         balance,
+		OccurredAt:      time.Now().UTC(),
+	}
+	if balance.LessThan(previous) {
+		event.Type = WalletCredited
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event with err %v", err)
+	}
+
+	return &domain.OutboxEvent{
+		EventID:  event.ID,
+		Type:     event.Type,
+		WalletID: walletID,
+		Payload:  payload,
+	}, nil
+}
+
+// FreezeChanged is the outbox event of a wallet being frozen or unfrozen. Its balance
+// is left as it was, so the amount is zero
+func FreezeChanged(wallet *domain.Wallet) (*domain.OutboxEvent, error) {
+	eventID, err := newEventID()
+	if err != nil {
+		return nil, err
+	}
+
+	event := Event{
+		ID:              eventID,
+		Type:            WalletUnfrozen,
+		WalletID:        wallet.ID,
+		Amount:          decimal.Zero,
+		PreviousBalance: wallet.Balance,
+		Balance:         wallet.Balance,
+		OccurredAt:      time.Now().UTC(),
+	}
+	if wallet.Frozen {
+		event.Type = WalletFrozen
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event with err %v", err)
+	}
+
+	return &domain.OutboxEvent{
+		EventID:  event.ID,
+		Type:     event.Type,
+		WalletID: wallet.ID,
+		Payload:  payload,
+	}, nil
+}
+
+func newEventID() (string, error) {
+	bs := make([]byte, 16)
+	if _, err := rand.Read(bs); err != nil {
+		return "", fmt.Errorf("failed to generate an event ID with err %v", err)
+	}
+	return hex.EncodeToString(bs), nil
+}
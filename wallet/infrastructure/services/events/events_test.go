@@ -0,0 +1,345 @@
+package events_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/events"
+	"github.com/shopspring/decimal"
+)
+
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// memoryOutbox is an outbox held in memory
+type memoryOutbox struct {
+	mu     sync.Mutex
+	events []domain.OutboxEvent
+}
+
+func (o *memoryOutbox) write(t *testing.T, walletID int, previous, balance int64) {
+	event, err := events.BalanceChanged(walletID, decimal.NewFromInt(previous), decimal.NewFromInt(balance))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	event.ID = uint64(len(o.events) + 1)
+	o.events = append(o.events, *event)
+}
+
+func (o *memoryOutbox) ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]domain.OutboxEvent, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	leased := func(event domain.OutboxEvent) bool {
+		return event.ClaimedUntil != nil && event.ClaimedUntil.After(now)
+	}
+	held := map[int]bool{}
+	var claimed []domain.OutboxEvent
+	for i, event := range o.events {
+		if event.PublishedAt != nil {
+			continue
+		}
+		if leased(event) {
+			held[event.WalletID] = true
+			continue
+		}
+		if held[event.WalletID] || len(claimed) == limit {
+			continue
+		}
+		until := now.Add(lease)
+		o.events[i].ClaimedUntil = &until
+		claimed = append(claimed, o.events[i])
+	}
+	return claimed, nil
+}
+
+func (o *memoryOutbox) MarkPublished(ctx context.Context, ids []uint64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	for _, id := range ids {
+		o.events[id-1].PublishedAt = &now
+	}
+	return nil
+}
+
+func (o *memoryOutbox) ReleaseEvents(ctx context.Context, ids []uint64, until time.Time) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, id := range ids {
+		o.events[id-1].ClaimedUntil = &until
+	}
+	return nil
+}
+
+// flakySink fails to publish the events of the given wallets
+type flakySink struct {
+	*events.MemorySink
+	failing map[int]bool
+}
+
+func (s *flakySink) Publish(ctx context.Context, event domain.OutboxEvent) error {
+	if s.failing[event.WalletID] {
+		return fmt.Errorf("sink is unavailable")
+	}
+	return s.MemorySink.Publish(ctx, event)
+}
+
+func TestBalanceChanged(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous int64
+		balance  int64
+		wantType string
+	}{
+		{
+			name:     "money taken out is a credit",
+			previous: 200,
+			balance:  150,
+			wantType: events.WalletCredited,
+		},
+		{
+			name:     "money put in is a debit",
+			previous: 150,
+			balance:  200,
+			wantType: events.WalletDebited,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := events.BalanceChanged(1, decimal.NewFromInt(tt.previous), decimal.NewFromInt(tt.balance))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if event.Type != tt.wantType {
+				t.Fatalf("expected a %s event but got %s", tt.wantType, event.Type)
+			}
+
+			var payload events.Event
+			if err := json.Unmarshal(event.Payload, &payload); err != nil {
+				t.Fatal(err)
+			}
+			if payload.ID != event.EventID || !payload.Amount.Equal(decimal.NewFromInt(50)) {
+				t.Fatalf("unexpected payload %s", event.Payload)
+			}
+		})
+	}
+}
+
+func TestFreezeChanged(t *testing.T) {
+	tests := []struct {
+		name     string
+		frozen   bool
+		wantType string
+	}{
+		{
+			name:     "frozen wallet",
+			frozen:   true,
+			wantType: events.WalletFrozen,
+		},
+		{
+			name:     "unfrozen wallet",
+			wantType: events.WalletUnfrozen,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := events.FreezeChanged(&domain.Wallet{ID: 1, Balance: decimal.NewFromInt(200), Frozen: tt.frozen})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if event.Type != tt.wantType {
+				t.Fatalf("expected a %s event but got %s", tt.wantType, event.Type)
+			}
+
+			var payload events.Event
+			if err := json.Unmarshal(event.Payload, &payload); err != nil {
+				t.Fatal(err)
+			}
+			if !payload.Amount.IsZero() || !payload.Balance.Equal(decimal.NewFromInt(200)) {
+				t.Fatalf("unexpected payload %s", event.Payload)
+			}
+		})
+	}
+}
+
+func TestRelay_RelayOnce(t *testing.T) {
+	outbox := &memoryOutbox{}
+	outbox.write(t, 1, 200, 150)
+	outbox.write(t, 2, 100, 110)
+	outbox.write(t, 1, 150, 100)
+	outbox.write(t, 2, 110, 120)
+
+	sink := &flakySink{MemorySink: events.NewMemorySink(), failing: map[int]bool{2: true}}
+	relay := events.NewRelay(outbox, sink, time.Second, 10, logger)
+	relay.RetryAfter = 0
+
+	published, err := relay.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if published != 2 {
+		t.Fatalf("expected only wallet 1's events to be published but got %d", published)
+	}
+
+	// wallet 2's events are held back and go out in order once the sink recovers
+	sink.failing = map[int]bool{}
+	if _, err := relay.RelayOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, event := range sink.Events() {
+		got = append(got, fmt.Sprintf("%d:%d", event.WalletID, event.ID))
+	}
+	want := []string{"1:1", "1:3", "2:2", "2:4"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected the events to be published as %v but got %v", want, got)
+	}
+
+	published, err = relay.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if published != 0 {
+		t.Fatalf("expected published events not to be published again but got %d", published)
+	}
+}
+
+func TestRelay_RelayOnce_HeldBackWallet(t *testing.T) {
+	outbox := &memoryOutbox{}
+	for i := 0; i < 3; i++ {
+		outbox.write(t, 2, int64(i*10), int64(i*10+10))
+	}
+	outbox.write(t, 1, 200, 150)
+
+	sink := &flakySink{MemorySink: events.NewMemorySink(), failing: map[int]bool{2: true}}
+	relay := events.NewRelay(outbox, sink, time.Second, 2, logger)
+	relay.RetryAfter = time.Hour
+
+	// the first batch is all wallet 2's, which is then held back
+	for i := 0; i < 2; i++ {
+		if _, err := relay.RelayOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := sink.Events()
+	if len(got) != 1 || got[0].WalletID != 1 {
+		t.Fatalf("expected wallet 1's event to go out past the held back wallet but got %+v", got)
+	}
+}
+
+func TestRelay_Run(t *testing.T) {
+	outbox := &memoryOutbox{}
+	for i := 0; i < 5; i++ {
+		outbox.write(t, i+1, 0, 10)
+	}
+
+	sink := events.NewMemorySink()
+	relay := events.NewRelay(outbox, sink, 10*time.Millisecond, 2, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(stopped)
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for len(sink.Events()) < 5 {
+		select {
+		case <-deadline:
+			t.Fatalf("expected every event to be published but got %d", len(sink.Events()))
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+
+	cancel()
+	<-stopped
+}
+
+func TestWebhookSink_Publish(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{
+			name:   "happy case",
+			status: http.StatusNoContent,
+		},
+		{
+			name:    "sad case - webhook failure",
+			status:  http.StatusInternalServerError,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := events.BalanceChanged(1, decimal.NewFromInt(200), decimal.NewFromInt(150))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var received http.Header
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = r.Header
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			err = events.NewWebhookSink(srv.URL, srv.Client()).Publish(context.Background(), *event)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v but got %v", tt.wantErr, err)
+			}
+			if received.Get("X-Event-ID") != event.EventID || received.Get("X-Event-Type") != events.WalletCredited {
+				t.Fatalf("expected the event to be identified in the headers but got %v", received)
+			}
+		})
+	}
+}
+
+func TestFileSink_Publish(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	sink, err := events.NewFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	for _, balance := range []int64{150, 100} {
+		event, err := events.BalanceChanged(1, decimal.NewFromInt(200), decimal.NewFromInt(balance))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Publish(context.Background(), *event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(bs)), "\n"); len(lines) != 2 {
+		t.Fatalf("expected an event per line but got %q", bs)
+	}
+}
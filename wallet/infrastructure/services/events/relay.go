@@ -0,0 +1,187 @@
+package events
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+)
+
+// DefaultLease is how long a relay holds the events it claimed while it publishes them
+// unless told otherwise
+const DefaultLease = time.Minute
+
+// Outbox represents a contract for reading the events waiting to be published
+type Outbox interface {
+	// ClaimEvents leases the oldest unpublished events, in the order they were
+	// written, to the relay for the lease duration so that no other relay publishes
+	// them at the same time. Events of a wallet whose earlier event is leased, or
+	// held back, are left out
+	ClaimEvents(
+		ctx context.Context,
+		limit int,
+		lease time.Duration,
+	) ([]domain.OutboxEvent, error)
+	// MarkPublished marks the leased events as published
+	MarkPublished(
+		ctx context.Context,
+		ids []uint64,
+	) error
+	// ReleaseEvents ends the lease of events that were not published so that they
+	// can be claimed again from the given time
+	ReleaseEvents(
+		ctx context.Context,
+		ids []uint64,
+		until time.Time,
+	) error
+}
+
+// Relay publishes the events written to the outbox to a sink. An event is
+// published at least once: it is published again if the relay stops before it
+// has been marked as published. A wallet's events are published in the order
+// they were written, so a wallet whose event could not be published is held
+// back for RetryAfter while the other wallets' events go out
+type Relay struct {
+	Outbox    Outbox
+	Sink      Sink
+	Interval  time.Duration
+	BatchSize int
+	// Lease bounds how long a batch is published for, its events are claimed
+	// by another relay once it is over
+	Lease time.Duration
+	// RetryAfter is how long a wallet whose event could not be published is
+	// held back, the polling interval by default
+	RetryAfter time.Duration
+	Logger     *slog.Logger
+}
+
+// NewRelay initializes a relay that polls the outbox every interval
+func NewRelay(
+	outbox Outbox,
+	sink Sink,
+	interval time.Duration,
+	batchSize int,
+	logger *slog.Logger,
+) *Relay {
+	r := &Relay{
+		Outbox:     outbox,
+		Sink:       sink,
+		Interval:   interval,
+		BatchSize:  batchSize,
+		Lease:      DefaultLease,
+		RetryAfter: interval,
+		Logger:     logger,
+	}
+	r.checkPreconditions()
+	return r
+}
+
+func (r *Relay) checkPreconditions() {
+	if r.Outbox == nil {
+		log.Panicf("relay has not been initialized with an outbox")
+	}
+	if r.Sink == nil {
+		log.Panicf("relay has not been initialized with a sink")
+	}
+	if r.Interval <= 0 {
+		log.Panicf("relay has not been configured with a polling interval")
+	}
+	if r.BatchSize <= 0 {
+		log.Panicf("relay has not been configured with a batch size")
+	}
+	if r.Lease <= 0 {
+		log.Panicf("relay has not been configured with a lease")
+	}
+	if r.Logger == nil {
+		log.Panicf("relay has not been initialized with a logger")
+	}
+}
+
+// Run relays the outbox until the context is done
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		published, err := r.RelayOnce(ctx)
+		if err != nil {
+			r.Logger.ErrorContext(ctx, "failed to relay outbox events", slog.String("error", err.Error()))
+		}
+
+		// a full batch means more events are waiting
+		if err == nil && published == r.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayOnce publishes a batch of events and returns how many were published. The
+// batch is published within its lease, and the events that were not published are
+// released for the next batch, the failed ones once they have been held back
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	claimed, err := r.Outbox.ClaimEvents(ctx, r.BatchSize, r.Lease)
+	if err != nil {
+		return 0, dto.Wrap(err, "RelayOnce")
+	}
+	if len(claimed) == 0 {
+		return 0, nil
+	}
+
+	leaseCtx, cancel := context.WithTimeout(ctx, r.Lease)
+	published, failed, skipped := r.publish(leaseCtx, claimed)
+	cancel()
+
+	if err := r.Outbox.MarkPublished(ctx, published); err != nil {
+		return 0, dto.Wrap(err, "RelayOnce")
+	}
+	now := time.Now()
+	if err := r.Outbox.ReleaseEvents(ctx, failed, now.Add(r.RetryAfter)); err != nil {
+		return len(published), dto.Wrap(err, "RelayOnce")
+	}
+	if err := r.Outbox.ReleaseEvents(ctx, skipped, now); err != nil {
+		return len(published), dto.Wrap(err, "RelayOnce")
+	}
+
+	return len(published), nil
+}
+
+// publish publishes the events in order, holding back the later events of a wallet
+// whose event could not be published, until the lease is over. It returns the events
+// that were published, the ones that failed and the ones that were not tried
+func (r *Relay) publish(
+	ctx context.Context,
+	events []domain.OutboxEvent,
+) (published []uint64, failed []uint64, skipped []uint64) {
+	held := map[int]bool{}
+	for _, event := range events {
+		if held[event.WalletID] || ctx.Err() != nil {
+			skipped = append(skipped, event.ID)
+			continue
+		}
+
+		if err := r.Sink.Publish(ctx, event); err != nil {
+			held[event.WalletID] = true
+			failed = append(failed, event.ID)
+			r.Logger.WarnContext(
+				ctx,
+				"failed to publish event",
+				slog.String("event_id", event.EventID),
+				slog.Int("wallet_id", event.WalletID),
+				slog.String("error", err.Error()),
+			)
+			continue
+		}
+		published = append(published, event.ID)
+	}
+
+	return published, failed, skipped
+}
@@ -0,0 +1,130 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+)
+
+// Sink represents a contract for publishing events to downstream systems e.g.
+// a webhook, a Kafka topic or a NATS subject. An event is only marked as
+// published once Publish returns without an error
+type Sink interface {
+	Publish(ctx context.Context, event domain.OutboxEvent) error
+}
+
+// MemorySink keeps the published events in memory
+type MemorySink struct {
+	mu     sync.Mutex
+	events []domain.OutboxEvent
+}
+
+// NewMemorySink initializes an empty in-memory sink
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+// Publish keeps the event in memory
+func (s *MemorySink) Publish(ctx context.Context, event domain.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, event)
+	return nil
+}
+
+// Events returns the events published so far, in the order they were published
+func (s *MemorySink) Events() []domain.OutboxEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]domain.OutboxEvent(nil), s.events...)
+}
+
+// FileSink appends every event to a file as a line of JSON
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink initializes a sink that appends events to the file at the given path
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, dto.Wrap(err, "NewFileSink")
+	}
+	return &FileSink{file: file}, nil
+}
+
+// Publish appends the event to the file
+func (s *FileSink) Publish(ctx context.Context, event domain.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(append(event.Payload, '\n')); err != nil {
+		return dto.Wrap(err, "FileSink.Publish")
+	}
+	return nil
+}
+
+// Close closes the file
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// WebhookSink POSTs every event to a URL
+type WebhookSink struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhookSink initializes a sink that POSTs events to the given URL
+func NewWebhookSink(url string, client *http.Client) *WebhookSink {
+	s := &WebhookSink{
+		URL:    url,
+		Client: client,
+	}
+	s.checkPreconditions()
+	return s
+}
+
+func (s *WebhookSink) checkPreconditions() {
+	if s.URL == "" {
+		log.Panicf("webhook sink has not been configured with a URL")
+	}
+	if s.Client == nil {
+		log.Panicf("webhook sink has not been initialized with an HTTP client")
+	}
+}
+
+// Publish POSTs the event, which is published once the webhook answers with a 2xx
+func (s *WebhookSink) Publish(ctx context.Context, event domain.OutboxEvent) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(event.Payload))
+	if err != nil {
+		return dto.Wrap(err, "WebhookSink.Publish")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", event.EventID)
+	req.Header.Set("X-Event-Type", event.Type)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return dto.Wrap(err, "WebhookSink.Publish")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return dto.Wrap(
+			fmt.Errorf("webhook answered with status %d", resp.StatusCode),
+			"WebhookSink.Publish",
+		)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package eventstore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/shopspring/decimal"
+)
+
+// DefaultSnapshotEvery is how many events are appended to a wallet's stream
+// between two snapshots unless told otherwise
+const DefaultSnapshotEvery = 100
+
+// Stream is a wallet's balance as of a version of its event stream. Version 0
+// is a wallet whose stream has not been started, its balance is its opening balance
+type Stream struct {
+	WalletID int
+	Version  uint64
+	Balance  decimal.Decimal
+	// Frozen is kept with the wallet rather than in its stream
+	Frozen bool
+}
+
+// Wallet is the wallet whose balance the stream is at
+func (s Stream) Wallet() *domain.Wallet {
+	return &domain.Wallet{ID: s.WalletID, Balance: s.Balance, Frozen: s.Frozen}
+}
+
+// Replay folds the events appended after the snapshot, in version order, into
+// the wallet's stream. Without a snapshot the events are replayed from the first
+// one, and a wallet without any events keeps its opening balance
+func Replay(
+	walletID int,
+	opening decimal.Decimal,
+	snapshot *domain.WalletSnapshot,
+	events []domain.WalletEvent,
+) (Stream, error) {
+	stream := Stream{WalletID: walletID, Balance: opening}
+	if snapshot != nil {
+		stream.Version = snapshot.Version
+		stream.Balance = snapshot.Balance
+	} else if len(events) > 0 {
+		stream.Balance = decimal.Zero
+	}
+
+	for _, event := range events {
+		if event.Version != stream.Version+1 {
+			return stream, fmt.Errorf(
+				"wallet %d's event stream jumps from version %d to %d",
+				walletID, stream.Version, event.Version,
+			)
+		}
+		stream.Version = event.Version
+		stream.Balance = stream.Balance.Add(event.Amount)
+	}
+
+	return stream, nil
+}
+
+// Append moves the stream to the new balance and returns the events to append
+// for it. A stream that has not been started is opened with its opening balance
+// first. Credits take money out of a wallet and debits put money in
+func Append(stream *Stream, balance decimal.Decimal, at time.Time) []domain.WalletEvent {
+	var appended []domain.WalletEvent
+	if stream.Version == 0 {
+		stream.Version++
+		appended = append(appended, domain.WalletEvent{
+			WalletID:  stream.WalletID,
+			Version:   stream.Version,
+			Type:      domain.EventWalletOpened,
+			Amount:    stream.Balance,
+			CreatedAt: at,
+		})
+	}
+
+	eventType := domain.EventWalletDebited
+	if balance.LessThan(stream.Balance) {
+		eventType = domain.EventWalletCredited
+	}
+	stream.Version++
+	appended = append(appended, domain.WalletEvent{
+		WalletID:  stream.WalletID,
+		Version:   stream.Version,
+		Type:      eventType,
+		Amount:    balance.Sub(stream.Balance),
+		CreatedAt: at,
+	})
+	stream.Balance = balance
+
+	return appended
+}
+
+// SnapshotDue reports whether a snapshot should be taken after the stream moved
+// from one version to another, which is every time it passes a multiple of every
+func SnapshotDue(from uint64, to uint64, every uint64) bool {
+	if every == 0 {
+		return false
+	}
+	return to/every > from/every
+}
+
+// Snapshot is the snapshot of the stream at its current version
+func Snapshot(stream Stream, at time.Time) domain.WalletSnapshot {
+	return domain.WalletSnapshot{
+		WalletID:  stream.WalletID,
+		Version:   stream.Version,
+		Balance:   stream.Balance,
+		CreatedAt: at,
+	}
+}
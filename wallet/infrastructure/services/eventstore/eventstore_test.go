@@ -0,0 +1,151 @@
+package eventstore_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/eventstore"
+	"github.com/shopspring/decimal"
+)
+
+func TestReplay(t *testing.T) {
+	now := time.Now()
+
+	// a wallet opened with 100, debited 50 then credited 30
+	stream := eventstore.Stream{WalletID: 1, Balance: decimal.NewFromInt(100)}
+	events := eventstore.Append(&stream, decimal.NewFromInt(150), now)
+	events = append(events, eventstore.Append(&stream, decimal.NewFromInt(120), now)...)
+
+	tests := []struct {
+		name        string
+		snapshot    *domain.WalletSnapshot
+		events      []domain.WalletEvent
+		wantBalance string
+		wantVersion uint64
+		wantErr     bool
+	}{
+		{
+			name:        "happy case - not started",
+			wantBalance: "100",
+		},
+		{
+			name:        "happy case - from the first event",
+			events:      events,
+			wantBalance: "120",
+			wantVersion: 3,
+		},
+		{
+			name:        "happy case - from a snapshot",
+			snapshot:    &domain.WalletSnapshot{WalletID: 1, Version: 2, Balance: decimal.NewFromInt(150)},
+			events:      events[2:],
+			wantBalance: "120",
+			wantVersion: 3,
+		},
+		{
+			name:        "happy case - snapshot of the latest version",
+			snapshot:    &domain.WalletSnapshot{WalletID: 1, Version: 3, Balance: decimal.NewFromInt(120)},
+			wantBalance: "120",
+			wantVersion: 3,
+		},
+		{
+			name:    "sad case - missing event",
+			events:  []domain.WalletEvent{events[0], events[2]},
+			wantErr: true,
+		},
+		{
+			name:     "sad case - events the snapshot already covers",
+			snapshot: &domain.WalletSnapshot{WalletID: 1, Version: 2, Balance: decimal.NewFromInt(150)},
+			events:   events,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := eventstore.Replay(1, decimal.NewFromInt(100), tt.snapshot, tt.events)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Replay() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Balance.String() != tt.wantBalance || got.Version != tt.wantVersion {
+				t.Fatalf(
+					"expected balance %s at version %d but got %s at version %d",
+					tt.wantBalance, tt.wantVersion, got.Balance, got.Version,
+				)
+			}
+		})
+	}
+}
+
+func TestAppend(t *testing.T) {
+	now := time.Now()
+	stream := eventstore.Stream{WalletID: 1, Balance: decimal.NewFromInt(100)}
+
+	opened := eventstore.Append(&stream, decimal.NewFromInt(150), now)
+	if len(opened) != 2 || opened[0].Type != domain.EventWalletOpened || !opened[0].Amount.Equal(decimal.NewFromInt(100)) {
+		t.Fatalf("expected the stream to be opened with its opening balance but got %+v", opened)
+	}
+	if opened[1].Type != domain.EventWalletDebited || !opened[1].Amount.Equal(decimal.NewFromInt(50)) || opened[1].Version != 2 {
+		t.Fatalf("expected a debit of 50 at version 2 but got %+v", opened[1])
+	}
+
+	credited := eventstore.Append(&stream, decimal.NewFromInt(120), now)
+	if len(credited) != 1 || credited[0].Type != domain.EventWalletCredited || !credited[0].Amount.Equal(decimal.NewFromInt(-30)) {
+		t.Fatalf("expected a credit of 30 but got %+v", credited)
+	}
+	if stream.Version != 3 || !stream.Balance.Equal(decimal.NewFromInt(120)) {
+		t.Fatalf("expected the stream to be at 120 at version 3 but got %+v", stream)
+	}
+}
+
+func TestSnapshotDue(t *testing.T) {
+	tests := []struct {
+		name  string
+		from  uint64
+		to    uint64
+		every uint64
+		want  bool
+	}{
+		{
+			name:  "reaches a multiple",
+			from:  99,
+			to:    100,
+			every: 100,
+			want:  true,
+		},
+		{
+			name:  "passes a multiple",
+			from:  0,
+			to:    2,
+			every: 1,
+			want:  true,
+		},
+		{
+			name:  "opening passes a multiple",
+			from:  99,
+			to:    101,
+			every: 100,
+			want:  true,
+		},
+		{
+			name:  "between multiples",
+			from:  100,
+			to:    101,
+			every: 100,
+		},
+		{
+			name: "snapshots disabled",
+			from: 99,
+			to:   100,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := eventstore.SnapshotDue(tt.from, tt.to, tt.every); got != tt.want {
+				t.Errorf("SnapshotDue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
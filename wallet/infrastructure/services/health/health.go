@@ -0,0 +1,211 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/cache"
+	"gorm.io/gorm"
+)
+
+// Statuses reported for the service and each of its dependencies
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+	StatusDraining    = "draining"
+)
+
+// Check reports whether a dependency is reachable
+type Check func(ctx context.Context) error
+
+// DependencyStatus is the outcome of a single dependency check
+type DependencyStatus struct {
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+	// Err is logged but never exposed since it may name internal hosts
+	Err error `json:"-"`
+}
+
+// Report is the readiness of the service and of each of its dependencies
+type Report struct {
+	Status       string                      `json:"status"`
+	Dependencies map[string]DependencyStatus `json:"dependencies"`
+}
+
+// Ready reports whether the service can take traffic
+func (r Report) Ready() bool {
+	return r.Status == StatusOK
+}
+
+// Checker runs the dependency checks behind the readiness probe
+type Checker struct {
+	Checks  map[string]Check
+	Timeout time.Duration
+
+	draining  atomic.Bool
+	drained   chan struct{}
+	drainOnce sync.Once
+}
+
+// NewChecker initializes a readiness checker that bounds each check with the given timeout
+func NewChecker(checks map[string]Check, timeout time.Duration) *Checker {
+	c := &Checker{
+		Checks:  checks,
+		Timeout: timeout,
+		drained: make(chan struct{}),
+	}
+	c.checkPreconditions()
+	return c
+}
+
+func (c *Checker) checkPreconditions() {
+	if c.Timeout <= 0 {
+		log.Panicf("health checker has not been configured with a timeout")
+	}
+	for name, check := range c.Checks {
+		if check == nil {
+			log.Panicf("health check %s has not been initialized", name)
+		}
+	}
+}
+
+// Drain marks the service as shutting down so that readiness fails and
+// load balancers stop routing traffic to it before the server stops
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+	c.drainOnce.Do(func() { close(c.drained) })
+}
+
+// Drained is closed once the service starts shutting down, so that long lived
+// requests can end before the server stops
+func (c *Checker) Drained() <-chan struct{} {
+	return c.drained
+}
+
+// Draining reports whether the service is shutting down
+func (c *Checker) Draining() bool {
+	return c.draining.Load()
+}
+
+// Check runs every dependency check concurrently
+func (c *Checker) Check(ctx context.Context) Report {
+	report := Report{
+		Status:       StatusOK,
+		Dependencies: make(map[string]DependencyStatus, len(c.Checks)),
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for name, check := range c.Checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+
+			status := c.run(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Dependencies[name] = status
+			if status.Err != nil {
+				report.Status = StatusUnavailable
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	if c.Draining() {
+		report.Status = StatusDraining
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) DependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+
+	status := DependencyStatus{
+		Status:  StatusOK,
+		Latency: time.Since(start).Round(time.Millisecond).String(),
+		Err:     err,
+	}
+	if err != nil {
+		status.Status = StatusUnavailable
+	}
+	return status
+}
+
+// Database checks that MySQL answers a ping
+func Database(db *gorm.DB) Check {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return dto.Wrap(err, "health.Database")
+		}
+		if err := sqlDB.PingContext(ctx); err != nil {
+			return dto.Wrap(err, "health.Database")
+		}
+		return nil
+	}
+}
+
+// Redis checks that Redis answers a ping
+func Redis(client cache.RedisClient) Check {
+	return func(ctx context.Context) error {
+		if err := client.Ping(ctx).Err(); err != nil {
+			return dto.Wrap(err, "health.Redis")
+		}
+		return nil
+	}
+}
+
+// JWKS checks that the JSON Web Key Set used to validate access tokens can be fetched.
+// A successful fetch is trusted for ttl, the time the token validator caches the keys
+// for, so that readiness probes do not fetch the keys from the issuer every time
+func JWKS(client *http.Client, issuerURL string, ttl time.Duration) Check {
+	jwksURL := issuerURL + ".well-known/jwks.json"
+
+	var (
+		mu      sync.Mutex
+		fetched time.Time
+	)
+	return func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if !fetched.IsZero() && time.Since(fetched) < ttl {
+			return nil
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURL, nil)
+		if err != nil {
+			return dto.Wrap(err, "health.JWKS")
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return dto.Wrap(err, "health.JWKS")
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return dto.Wrap(
+				fmt.Errorf("fetching the JWKS returned status %d", resp.StatusCode),
+				"health.JWKS",
+			)
+		}
+		fetched = time.Now()
+		return nil
+	}
+}
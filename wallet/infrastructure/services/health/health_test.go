@@ -0,0 +1,133 @@
+package health_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/health"
+)
+
+func ok(ctx context.Context) error {
+	return nil
+}
+
+func down(ctx context.Context) error {
+	return fmt.Errorf("dial tcp 10.0.0.1:3306: connection refused")
+}
+
+func hangs(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestChecker_Check(t *testing.T) {
+	tests := []struct {
+		name       string
+		checks     map[string]health.Check
+		drain      bool
+		wantStatus string
+		wantDeps   map[string]string
+	}{
+		{
+			name:       "happy case - every dependency is up",
+			checks:     map[string]health.Check{"mysql": ok, "redis": ok},
+			wantStatus: health.StatusOK,
+			wantDeps:   map[string]string{"mysql": health.StatusOK, "redis": health.StatusOK},
+		},
+		{
+			name:       "sad case - a dependency is down",
+			checks:     map[string]health.Check{"mysql": down, "redis": ok},
+			wantStatus: health.StatusUnavailable,
+			wantDeps:   map[string]string{"mysql": health.StatusUnavailable, "redis": health.StatusOK},
+		},
+		{
+			name:       "sad case - a dependency times out",
+			checks:     map[string]health.Check{"mysql": ok, "jwks": hangs},
+			wantStatus: health.StatusUnavailable,
+			wantDeps:   map[string]string{"mysql": health.StatusOK, "jwks": health.StatusUnavailable},
+		},
+		{
+			name:       "sad case - draining",
+			checks:     map[string]health.Check{"mysql": ok},
+			drain:      true,
+			wantStatus: health.StatusDraining,
+			wantDeps:   map[string]string{"mysql": health.StatusOK},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := health.NewChecker(tt.checks, 20*time.Millisecond)
+			if tt.drain {
+				checker.Drain()
+			}
+
+			start := time.Now()
+			report := checker.Check(context.Background())
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Fatalf("expected the checks to be bounded by the timeout but took %v", elapsed)
+			}
+
+			if report.Status != tt.wantStatus {
+				t.Fatalf("expected status %s but got %s", tt.wantStatus, report.Status)
+			}
+			if report.Ready() != (tt.wantStatus == health.StatusOK) {
+				t.Fatalf("expected ready to be %v", tt.wantStatus == health.StatusOK)
+			}
+			for name, want := range tt.wantDeps {
+				if got := report.Dependencies[name].Status; got != want {
+					t.Fatalf("expected %s to be %s but got %s", name, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		wantErr     bool
+		wantFetches int
+	}{
+		{
+			name:        "happy case - fetched once within the TTL",
+			status:      http.StatusOK,
+			wantFetches: 1,
+		},
+		{
+			name:        "sad case - JWKS unavailable is fetched again",
+			status:      http.StatusBadGateway,
+			wantErr:     true,
+			wantFetches: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fetches atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/.well-known/jwks.json" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				fetches.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			check := health.JWKS(srv.Client(), srv.URL+"/", time.Minute)
+			for i := 0; i < 3; i++ {
+				if err := check(context.Background()); (err != nil) != tt.wantErr {
+					t.Fatalf("expected error %v but got %v", tt.wantErr, err)
+				}
+			}
+			if got := int(fetches.Load()); got != tt.wantFetches {
+				t.Fatalf("expected the JWKS to be fetched %d times but got %d", tt.wantFetches, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/logging"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNew(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	spanCtx := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID})
+
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		attrs []slog.Attr
+		want  map[string]interface{}
+	}{
+		{
+			name: "happy case - correlated with the request",
+			ctx:  logging.WithRequestID(context.Background(), "req-1"),
+			want: map[string]interface{}{"request_id": "req-1"},
+		},
+		{
+			name: "happy case - correlated with the trace",
+			ctx:  trace.ContextWithSpanContext(context.Background(), spanCtx),
+			want: map[string]interface{}{
+				"trace_id": traceID.String(),
+				"span_id":  spanID.String(),
+			},
+		},
+		{
+			name: "happy case - credentials are redacted",
+			ctx:  context.Background(),
+			attrs: []slog.Attr{
+				slog.Group("headers",
+					slog.String("Authorization", "Bearer s3cr3t"),
+					slog.String("Accept", "application/json"),
+				),
+				slog.String("client_secret", "s3cr3t"),
+			},
+			want: map[string]interface{}{
+				"headers": map[string]interface{}{
+					"Authorization": logging.Redacted,
+					"Accept":        "application/json",
+				},
+				"client_secret": logging.Redacted,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := logging.New(&buf, slog.LevelInfo)
+			logger.LogAttrs(tt.ctx, slog.LevelInfo, "request served", tt.attrs...)
+
+			if bytes.Contains(buf.Bytes(), []byte("s3cr3t")) {
+				t.Fatalf("expected credentials to be redacted but got %s", buf.String())
+			}
+
+			var got map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatalf("expected a JSON record but got %s", buf.String())
+			}
+			for key, want := range tt.want {
+				gotJSON, _ := json.Marshal(got[key])
+				wantJSON, _ := json.Marshal(want)
+				if !bytes.Equal(gotJSON, wantJSON) {
+					t.Fatalf("expected %s to be %s but got %s", key, wantJSON, gotJSON)
+				}
+			}
+		})
+	}
+}
+
+func TestNew_Level(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(&buf, slog.LevelWarn)
+	logger.Info("ignored", slog.Int("status", http.StatusOK))
+
+	if buf.Len() != 0 {
+		t.Fatalf("expected records below the level to be dropped but got %s", buf.String())
+	}
+}
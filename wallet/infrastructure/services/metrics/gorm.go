@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const startedAt = "metrics:started_at"
+
+// GormPlugin records the latency of every MySQL call made through gorm
+type GormPlugin struct{}
+
+// Name is the name the plugin is registered under
+func (GormPlugin) Name() string {
+	return "metrics"
+}
+
+// Initialize registers callbacks around each of gorm's operations
+func (GormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	hooks := []struct {
+		operation string
+		before    func(name string, fn func(*gorm.DB)) error
+		after     func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	}
+
+	for _, hook := range hooks {
+		operation := hook.operation
+		if err := hook.before("metrics:before_"+operation, startTimer); err != nil {
+			return err
+		}
+		if err := hook.after("metrics:after_"+operation, func(db *gorm.DB) {
+			observeDbCall(operation, db)
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func startTimer(db *gorm.DB) {
+	db.InstanceSet(startedAt, time.Now())
+}
+
+func observeDbCall(operation string, db *gorm.DB) {
+	value, ok := db.InstanceGet(startedAt)
+	if !ok {
+		return
+	}
+	start, ok := value.(time.Time)
+	if !ok {
+		return
+	}
+
+	err := db.Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// a lookup of a wallet that does not exist is not a failed call
+		err = nil
+	}
+	ObserveDbCall(operation, time.Since(start), err)
+}
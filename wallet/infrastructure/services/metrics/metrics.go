@@ -0,0 +1,158 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/shopspring/decimal"
+)
+
+const namespace = "wallet"
+
+// Cache tiers whose hits and misses are counted
+const (
+	LocalTier = "local"
+	RedisTier = "redis"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latencies by route, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	movements = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "balance_changes_total",
+		Help:      "Credits and debits applied to wallets.",
+	}, []string{"operation"})
+
+	movedAmounts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "balance_change_amount_total",
+		Help:      "Sum of the amounts credited and debited by currency.",
+	}, []string{"operation", "currency"})
+
+	insufficientFunds = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "insufficient_funds_total",
+		Help:      "Credits rejected because the balance would go below 0.",
+	}, []string{"operation"})
+
+	dbDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_call_duration_seconds",
+		Help:      "MySQL call latencies by operation and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "outcome"})
+
+	redisDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "redis_call_duration_seconds",
+		Help:      "Redis call latencies by command and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"command", "outcome"})
+
+	cacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Cached balance lookups by tier and result, the hit ratio is hits over all lookups.",
+	}, []string{"tier", "result"})
+
+	balanceStreams = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "balance_streams_open",
+		Help:      "Balance streams currently open on this instance.",
+	})
+	discrepancies = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "reconciliation_discrepancies",
+		Help:      "Wallets found out of line by the latest reconciliation, by kind of discrepancy.",
+	}, []string{"kind"})
+
+	resubscriptions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pubsub_resubscriptions_total",
+		Help:      "Pub/sub subscriptions that failed or ended and were resubscribed, by subscription.",
+	}, []string{"subscription"})
+)
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveRequest records a served HTTP request
+func ObserveRequest(route string, method string, status int, took time.Duration) {
+	code := strconv.Itoa(status)
+	httpRequests.WithLabelValues(route, method, code).Inc()
+	httpDuration.WithLabelValues(route, method, code).Observe(took.Seconds())
+}
+
+// ObserveBalanceChange records a credit/debit that has been applied
+func ObserveBalanceChange(operation string, currency string, amount decimal.Decimal) {
+	movements.WithLabelValues(operation).Inc()
+	value, _ := amount.Float64()
+	movedAmounts.WithLabelValues(operation, currency).Add(value)
+}
+
+// ObserveInsufficientFunds records a credit/debit rejected for insufficient funds
+func ObserveInsufficientFunds(operation string) {
+	insufficientFunds.WithLabelValues(operation).Inc()
+}
+
+// ObserveDbCall records the latency of a MySQL call
+func ObserveDbCall(operation string, took time.Duration, err error) {
+	dbDuration.WithLabelValues(operation, outcome(err)).Observe(took.Seconds())
+}
+
+// ObserveRedisCall records the latency of a Redis call
+func ObserveRedisCall(command string, took time.Duration, err error) {
+	redisDuration.WithLabelValues(command, outcome(err)).Observe(took.Seconds())
+}
+
+// ObserveCacheLookups records how many of the looked up wallets a cache tier held
+func ObserveCacheLookups(tier string, hits int, misses int) {
+	if hits > 0 {
+		cacheLookups.WithLabelValues(tier, "hit").Add(float64(hits))
+	}
+	if misses > 0 {
+		cacheLookups.WithLabelValues(tier, "miss").Add(float64(misses))
+	}
+}
+
+// ObserveBalanceStreams records how many balance streams are open
+func ObserveBalanceStreams(open int) {
+	balanceStreams.Set(float64(open))
+}
+
+// ObserveDiscrepancies records how many wallets of each kind of discrepancy a reconciliation found
+func ObserveDiscrepancies(byKind map[string]int) {
+	for kind, count := range byKind {
+		discrepancies.WithLabelValues(kind).Set(float64(count))
+	}
+}
+
+// ObserveResubscription records a pub/sub subscription that failed or ended and is resubscribed
+func ObserveResubscription(subscription string) {
+	resubscriptions.WithLabelValues(subscription).Inc()
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
+	"github.com/shopspring/decimal"
+)
+
+// InstrumentedUsecases decorates the usecases, counting the credits/debits
+// they apply and the ones they reject for insufficient funds
+type InstrumentedUsecases struct {
+	usecases.WalletBusinessLogic
+
+	// Currency is the ISO 4217 code of the wallets' balances
+	Currency string
+}
+
+// NewInstrumentedUsecases initializes usecases that record metrics on top of the given ones
+func NewInstrumentedUsecases(
+	next usecases.WalletBusinessLogic,
+	currency string,
+) *InstrumentedUsecases {
+	u := &InstrumentedUsecases{
+		WalletBusinessLogic: next,
+		Currency:            currency,
+	}
+	u.checkPreconditions()
+	return u
+}
+
+func (u *InstrumentedUsecases) checkPreconditions() {
+	if u.WalletBusinessLogic == nil {
+		log.Panicf("instrumented usecases have not been initialized with the usecases")
+	}
+	if u.Currency == "" {
+		log.Panicf("instrumented usecases have not been initialized with a currency")
+	}
+}
+
+// CreditWallet credits a wallet and records the outcome
+func (u *InstrumentedUsecases) CreditWallet(
+	ctx context.Context,
+	walletID int,
+	creditAmount decimal.Decimal,
+) (*domain.Wallet, error) {
+	wallet, err := u.WalletBusinessLogic.CreditWallet(ctx, walletID, creditAmount)
+	u.observe(dto.CreditOperation, creditAmount, err)
+	return wallet, err
+}
+
+// DebitWallet debits a wallet and records the outcome
+func (u *InstrumentedUsecases) DebitWallet(
+	ctx context.Context,
+	walletID int,
+	debitAmount decimal.Decimal,
+) (*domain.Wallet, error) {
+	wallet, err := u.WalletBusinessLogic.DebitWallet(ctx, walletID, debitAmount)
+	u.observe(dto.DebitOperation, debitAmount, err)
+	return wallet, err
+}
+
+// ApplyBatch applies a batch and records the outcome of each of its operations.
+// Replayed batches are not recorded again
+func (u *InstrumentedUsecases) ApplyBatch(
+	ctx context.Context,
+	input dto.BatchInput,
+) (*dto.BatchResult, error) {
+	result, err := u.WalletBusinessLogic.ApplyBatch(ctx, input)
+	if err != nil || result.Replayed {
+		return result, err
+	}
+
+	for _, opResult := range result.Results {
+		if opResult.Code == domain.CodeInsufficientFunds {
+			ObserveInsufficientFunds(string(opResult.Type))
+			continue
+		}
+		if result.Applied && opResult.Succeeded {
+			ObserveBalanceChange(string(opResult.Type), u.Currency, input.Operations[opResult.Index].Amount.Decimal)
+		}
+	}
+
+	return result, nil
+}
+
+func (u *InstrumentedUsecases) observe(op dto.OperationType, amount decimal.Decimal, err error) {
+	switch {
+	case err == nil:
+		ObserveBalanceChange(string(op), u.Currency, amount)
+	case errors.Is(err, domain.ErrInsufficientFunds):
+		ObserveInsufficientFunds(string(op))
+	}
+}
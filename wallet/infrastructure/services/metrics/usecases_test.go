@@ -0,0 +1,74 @@
+package metrics_test
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/metrics"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository/mocks"
+	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
+	"github.com/shopspring/decimal"
+)
+
+func scrape(t *testing.T) string {
+	srv := httptest.NewServer(metrics.Handler())
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	bs, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bs)
+}
+
+func TestInstrumentedUsecases(t *testing.T) {
+	ctx := context.Background()
+	uc := metrics.NewInstrumentedUsecases(
+		usecases.NewWalletUsecases(mocks.NewMockRepo(), mocks.NewMockRepo(), mocks.NewMockRepo()),
+		"KES",
+	)
+
+	if _, err := uc.DebitWallet(ctx, 1, decimal.NewFromFloat(10.5)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := uc.CreditWallet(ctx, 1, decimal.NewFromFloat(2.5)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := uc.CreditWallet(ctx, 1, decimal.NewFromFloat(1000000)); err == nil {
+		t.Fatalf("expected the credit to be rejected")
+	}
+	result, err := uc.ApplyBatch(ctx, dto.BatchInput{
+		IdempotencyKey: "metrics",
+		Mode:           dto.BestEffortBatch,
+		Operations: []dto.BatchOperation{
+			{WalletID: 1, Type: dto.DebitOperation, AmountInput: dto.AmountInput{Amount: decimal.NewNullDecimal(decimal.NewFromInt(4))}},
+			{WalletID: 1, Type: dto.CreditOperation, AmountInput: dto.AmountInput{Amount: decimal.NewNullDecimal(decimal.NewFromInt(1000))}},
+		},
+	})
+	if err != nil || !result.Applied {
+		t.Fatalf("unexpected batch outcome %+v, %v", result, err)
+	}
+
+	got := scrape(t)
+	for _, want := range []string{
+		`wallet_balance_changes_total{operation="debit"} 2`,
+		`wallet_balance_changes_total{operation="credit"} 1`,
+		`wallet_balance_change_amount_total{currency="KES",operation="debit"} 14.5`,
+		`wallet_balance_change_amount_total{currency="KES",operation="credit"} 2.5`,
+		`wallet_insufficient_funds_total{operation="credit"} 2`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q to be exposed", want)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package reconcile
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/metrics"
+	"github.com/shopspring/decimal"
+)
+
+// DefaultChunkSize is how many wallets are reconciled at a time unless told otherwise
+const DefaultChunkSize = 500
+
+// Kinds of discrepancies a wallet can have
+const (
+	// LedgerMismatch is a wallet whose balance is not the sum of its ledger postings
+	LedgerMismatch = "ledger_mismatch"
+	// CacheMismatch is a wallet whose cached balance is not its balance in the database
+	CacheMismatch = "cache_mismatch"
+)
+
+// Kinds are all the kinds of discrepancies, in the order they are checked
+var Kinds = []string{LedgerMismatch, CacheMismatch}
+
+// Balances represents a contract for reading wallets' balances straight from the database
+type Balances interface {
+	ScanBalances(
+		ctx context.Context,
+		afterID int,
+		limit int,
+	) ([]domain.Wallet, error)
+}
+
+// Ledger represents a contract for summing wallets' ledger postings
+type Ledger interface {
+	LedgerBalances(
+		ctx context.Context,
+		walletIDs []int,
+	) (map[int]decimal.Decimal, error)
+}
+
+// Cache represents a contract for reading and evicting cached balances
+type Cache interface {
+	GetCachedBalances(
+		ctx context.Context,
+		walletIDs []int,
+	) (map[int]*domain.Wallet, error)
+	EvictBalance(
+		ctx context.Context,
+		walletID int,
+	) error
+}
+
+// Lock represents a contract for running a job on a single instance at a time
+type Lock interface {
+	Do(
+		ctx context.Context,
+		fn func(ctx context.Context) error,
+	) (bool, error)
+}
+
+// Discrepancy is a wallet whose balance in the database, its ledger and the cache do not agree.
+// A wallet that is not cached has no cached balance
+type Discrepancy struct {
+	WalletID int              `json:"wallet_id"`
+	Kind     string           `json:"kind"`
+	Balance  decimal.Decimal  `json:"balance"`
+	Ledger   decimal.Decimal  `json:"ledger"`
+	Cached   *decimal.Decimal `json:"cached"`
+	Repaired bool             `json:"repaired"`
+}
+
+// Summary is the outcome of a reconciliation
+type Summary struct {
+	Wallets       int            `json:"wallets"`
+	Discrepancies map[string]int `json:"discrepancies"`
+	Repaired      int            `json:"repaired"`
+}
+
+// Found is how many discrepancies were found, of any kind
+func (s Summary) Found() int {
+	found := 0
+	for _, count := range s.Discrepancies {
+		found += count
+	}
+	return found
+}
+
+// Reconciler checks that every wallet's balance is the sum of its ledger postings
+// and that the cache agrees with the database. With RepairCache the wallets whose
+// cached balance is wrong are evicted from the cache, so their balance is next read
+// from the database
+type Reconciler struct {
+	Balances    Balances
+	Ledger      Ledger
+	Cache       Cache
+	ChunkSize   int
+	RepairCache bool
+	// Lock is optional, without it every instance running the reconciler reconciles
+	Lock   Lock
+	Logger *slog.Logger
+}
+
+// NewReconciler initializes a reconciler that scans chunkSize wallets at a time
+func NewReconciler(
+	balances Balances,
+	ledger Ledger,
+	cache Cache,
+	chunkSize int,
+	logger *slog.Logger,
+) *Reconciler {
+	r := &Reconciler{
+		Balances:  balances,
+		Ledger:    ledger,
+		Cache:     cache,
+		ChunkSize: chunkSize,
+		Logger:    logger,
+	}
+	r.checkPreconditions()
+	return r
+}
+
+func (r *Reconciler) checkPreconditions() {
+	if r.Balances == nil {
+		log.Panicf("reconciler has not been initialized with the balances")
+	}
+	if r.Ledger == nil {
+		log.Panicf("reconciler has not been initialized with the ledger")
+	}
+	if r.Cache == nil {
+		log.Panicf("reconciler has not been initialized with the cache")
+	}
+	if r.ChunkSize <= 0 {
+		log.Panicf("reconciler has not been configured with a chunk size")
+	}
+	if r.Logger == nil {
+		log.Panicf("reconciler has not been initialized with a logger")
+	}
+}
+
+// Reconcile scans every wallet, a chunk at a time, and writes the discrepancies
+// found to the report. A discrepancy is checked again before it is reported, so
+// that a wallet changed while its chunk was being read is not reported
+func (r *Reconciler) Reconcile(ctx context.Context, report Report) (Summary, error) {
+	summary := Summary{Discrepancies: map[string]int{}}
+	for _, kind := range Kinds {
+		summary.Discrepancies[kind] = 0
+	}
+
+	afterID := 0
+	for {
+		wallets, err := r.Balances.ScanBalances(ctx, afterID, r.ChunkSize)
+		if err != nil {
+			return summary, dto.Wrap(err, "Reconcile")
+		}
+		if len(wallets) == 0 {
+			break
+		}
+		summary.Wallets += len(wallets)
+		afterID = wallets[len(wallets)-1].ID
+
+		suspects, err := r.check(ctx, wallets)
+		if err != nil {
+			return summary, dto.Wrap(err, "Reconcile")
+		}
+		for _, suspect := range suspects {
+			discrepancies, err := r.recheck(ctx, suspect)
+			if err != nil {
+				return summary, dto.Wrap(err, "Reconcile")
+			}
+			for _, discrepancy := range discrepancies {
+				summary.Discrepancies[discrepancy.Kind]++
+				if discrepancy.Repaired {
+					summary.Repaired++
+				}
+				if err := report.Write(discrepancy); err != nil {
+					return summary, dto.Wrap(err, "Reconcile")
+				}
+			}
+		}
+
+		if len(wallets) < r.ChunkSize {
+			break
+		}
+	}
+
+	if err := report.Flush(); err != nil {
+		return summary, dto.Wrap(err, "Reconcile")
+	}
+	return summary, nil
+}
+
+// check compares a chunk of wallets with their ledger and cached balances and
+// returns the ones that do not agree
+func (r *Reconciler) check(ctx context.Context, wallets []domain.Wallet) ([]domain.Wallet, error) {
+	walletIDs := make([]int, len(wallets))
+	for i, wallet := range wallets {
+		walletIDs[i] = wallet.ID
+	}
+
+	ledger, err := r.Ledger.LedgerBalances(ctx, walletIDs)
+	if err != nil {
+		return nil, err
+	}
+	cached, err := r.Cache.GetCachedBalances(ctx, walletIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var suspects []domain.Wallet
+	for _, wallet := range wallets {
+		if len(compare(wallet, ledger[wallet.ID], cached[wallet.ID])) > 0 {
+			suspects = append(suspects, wallet)
+		}
+	}
+	return suspects, nil
+}
+
+// recheck reads a suspect wallet again and returns its discrepancies, evicting
+// it from the cache when its cached balance is wrong and the cache is repaired
+func (r *Reconciler) recheck(ctx context.Context, suspect domain.Wallet) ([]Discrepancy, error) {
+	wallets, err := r.Balances.ScanBalances(ctx, suspect.ID-1, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(wallets) == 0 || wallets[0].ID != suspect.ID {
+		// the wallet is gone, there is nothing left to reconcile
+		return nil, nil
+	}
+	wallet := wallets[0]
+
+	ledger, err := r.Ledger.LedgerBalances(ctx, []int{wallet.ID})
+	if err != nil {
+		return nil, err
+	}
+	cached, err := r.Cache.GetCachedBalances(ctx, []int{wallet.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	discrepancies := compare(wallet, ledger[wallet.ID], cached[wallet.ID])
+	for i := range discrepancies {
+		if discrepancies[i].Kind != CacheMismatch || !r.RepairCache {
+			continue
+		}
+		if err := r.Cache.EvictBalance(ctx, wallet.ID); err != nil {
+			return nil, err
+		}
+		discrepancies[i].Repaired = true
+	}
+	return discrepancies, nil
+}
+
+// compare lists how a wallet's balance disagrees with its ledger and cached balances
+func compare(wallet domain.Wallet, ledger decimal.Decimal, cached *domain.Wallet) []Discrepancy {
+	discrepancy := Discrepancy{
+		WalletID: wallet.ID,
+		Balance:  wallet.Balance,
+		Ledger:   ledger,
+	}
+	if cached != nil {
+		discrepancy.Cached = &cached.Balance
+	}
+
+	var discrepancies []Discrepancy
+	if !wallet.Balance.Equal(ledger) {
+		d := discrepancy
+		d.Kind = LedgerMismatch
+		discrepancies = append(discrepancies, d)
+	}
+	if cached != nil && !wallet.Balance.Equal(cached.Balance) {
+		d := discrepancy
+		d.Kind = CacheMismatch
+		discrepancies = append(discrepancies, d)
+	}
+	return discrepancies
+}
+
+// Run reconciles every interval until the context is done, logging the
+// discrepancies found and recording how many there were of each kind. With a
+// lock an interval is skipped while another instance is reconciling
+func (r *Reconciler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var summary Summary
+		reconcile := func(ctx context.Context) (err error) {
+			summary, err = r.Reconcile(ctx, NewLogReport(ctx, r.Logger))
+			return err
+		}
+
+		ran := true
+		var err error
+		if r.Lock != nil {
+			ran, err = r.Lock.Do(ctx, reconcile)
+		} else {
+			err = reconcile(ctx)
+		}
+		switch {
+		case !ran && err == nil:
+			r.Logger.DebugContext(ctx, "skipped reconciling wallets, another instance is reconciling them")
+		case err != nil:
+			r.Logger.ErrorContext(ctx, "failed to reconcile wallets", slog.String("error", err.Error()))
+		default:
+			metrics.ObserveDiscrepancies(summary.Discrepancies)
+			r.Logger.InfoContext(
+				ctx,
+				"reconciled wallets",
+				slog.Int("wallets", summary.Wallets),
+				slog.Int("discrepancies", summary.Found()),
+				slog.Int("repaired", summary.Repaired),
+			)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package reconcile_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/reconcile"
+	"github.com/shopspring/decimal"
+)
+
+var ctx = context.Background()
+
+// memoryStore holds wallets' balances, ledger sums and cached balances in memory.
+// onScan is called before every scan, so a test can change a wallet mid-reconciliation
+type memoryStore struct {
+	balances map[int]decimal.Decimal
+	ledger   map[int]decimal.Decimal
+	cached   map[int]decimal.Decimal
+	scans    int
+	onScan   func(scans int)
+}
+
+func (m *memoryStore) ScanBalances(ctx context.Context, afterID int, limit int) ([]domain.Wallet, error) {
+	m.scans++
+	if m.onScan != nil {
+		m.onScan(m.scans)
+	}
+
+	var ids []int
+	for id := range m.balances {
+		if id > afterID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	wallets := make([]domain.Wallet, len(ids))
+	for i, id := range ids {
+		wallets[i] = domain.Wallet{ID: id, Balance: m.balances[id]}
+	}
+	return wallets, nil
+}
+
+func (m *memoryStore) LedgerBalances(ctx context.Context, walletIDs []int) (map[int]decimal.Decimal, error) {
+	sums := map[int]decimal.Decimal{}
+	for _, id := range walletIDs {
+		if sum, ok := m.ledger[id]; ok {
+			sums[id] = sum
+		}
+	}
+	return sums, nil
+}
+
+func (m *memoryStore) GetCachedBalances(ctx context.Context, walletIDs []int) (map[int]*domain.Wallet, error) {
+	wallets := map[int]*domain.Wallet{}
+	for _, id := range walletIDs {
+		if balance, ok := m.cached[id]; ok {
+			wallets[id] = &domain.Wallet{ID: id, Balance: balance}
+		}
+	}
+	return wallets, nil
+}
+
+func (m *memoryStore) EvictBalance(ctx context.Context, walletID int) error {
+	delete(m.cached, walletID)
+	return nil
+}
+
+// memoryReport keeps the discrepancies written to it
+type memoryReport struct {
+	discrepancies []reconcile.Discrepancy
+}
+
+func (r *memoryReport) Write(discrepancy reconcile.Discrepancy) error {
+	r.discrepancies = append(r.discrepancies, discrepancy)
+	return nil
+}
+
+func (r *memoryReport) Flush() error { return nil }
+
+func d(value int64) decimal.Decimal {
+	return decimal.NewFromInt(value)
+}
+
+func TestReconciler_Reconcile(t *testing.T) {
+	tests := []struct {
+		name         string
+		store        *memoryStore
+		repair       bool
+		wantWallets  int
+		wantFound    map[string][]int
+		wantRepaired int
+		wantCached   map[int]bool
+	}{
+		{
+			name: "happy case - everything agrees",
+			store: &memoryStore{
+				balances: map[int]decimal.Decimal{1: d(100), 2: d(0), 3: d(50)},
+				ledger:   map[int]decimal.Decimal{1: d(100), 3: d(50)},
+				cached:   map[int]decimal.Decimal{1: d(100)},
+			},
+			wantWallets: 3,
+			wantFound:   map[string][]int{},
+		},
+		{
+			name: "sad case - ledger and cache out of line",
+			store: &memoryStore{
+				balances: map[int]decimal.Decimal{1: d(100), 2: d(20), 3: d(50), 4: d(10), 5: d(5)},
+				ledger:   map[int]decimal.Decimal{1: d(100), 2: d(25), 3: d(50), 4: d(10), 5: d(5)},
+				cached:   map[int]decimal.Decimal{3: d(40), 5: d(5)},
+			},
+			wantWallets: 5,
+			wantFound: map[string][]int{
+				reconcile.LedgerMismatch: {2},
+				reconcile.CacheMismatch:  {3},
+			},
+			wantCached: map[int]bool{3: true, 5: true},
+		},
+		{
+			name: "happy case - cache repaired",
+			store: &memoryStore{
+				balances: map[int]decimal.Decimal{1: d(100), 2: d(20), 3: d(50)},
+				ledger:   map[int]decimal.Decimal{1: d(100), 2: d(20), 3: d(50)},
+				cached:   map[int]decimal.Decimal{2: d(20), 3: d(40)},
+			},
+			repair:       true,
+			wantWallets:  3,
+			wantFound:    map[string][]int{reconcile.CacheMismatch: {3}},
+			wantRepaired: 1,
+			wantCached:   map[int]bool{2: true},
+		},
+		{
+			name: "happy case - wallet changed mid-reconciliation",
+			store: &memoryStore{
+				balances: map[int]decimal.Decimal{1: d(100)},
+				ledger:   map[int]decimal.Decimal{1: d(90)},
+				cached:   map[int]decimal.Decimal{1: d(90)},
+			},
+			wantWallets: 1,
+			wantFound:   map[string][]int{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "happy case - wallet changed mid-reconciliation" {
+				// the wallet's balance is read before a change is committed and
+				// its ledger and cached balance after it
+				tt.store.onScan = func(scans int) {
+					if scans == 2 {
+						tt.store.balances[1] = d(90)
+					}
+				}
+			}
+
+			r := reconcile.NewReconciler(tt.store, tt.store, tt.store, 2, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			r.RepairCache = tt.repair
+			report := &memoryReport{}
+
+			summary, err := r.Reconcile(ctx, report)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if summary.Wallets != tt.wantWallets {
+				t.Fatalf("expected %d wallets to be reconciled but got %d", tt.wantWallets, summary.Wallets)
+			}
+			found := map[string][]int{}
+			for _, discrepancy := range report.discrepancies {
+				found[discrepancy.Kind] = append(found[discrepancy.Kind], discrepancy.WalletID)
+			}
+			for _, kind := range reconcile.Kinds {
+				if len(found[kind]) != len(tt.wantFound[kind]) || summary.Discrepancies[kind] != len(tt.wantFound[kind]) {
+					t.Fatalf("expected %s for %v but got %v (%+v)", kind, tt.wantFound[kind], found[kind], summary)
+				}
+				for i, walletID := range tt.wantFound[kind] {
+					if found[kind][i] != walletID {
+						t.Fatalf("expected %s for %v but got %v", kind, tt.wantFound[kind], found[kind])
+					}
+				}
+			}
+			if summary.Repaired != tt.wantRepaired {
+				t.Fatalf("expected %d cached balances to be repaired but got %d", tt.wantRepaired, summary.Repaired)
+			}
+			if tt.wantCached != nil {
+				for walletID := range tt.store.cached {
+					if !tt.wantCached[walletID] {
+						t.Fatalf("expected wallet %d to have been evicted from the cache", walletID)
+					}
+				}
+				if len(tt.store.cached) != len(tt.wantCached) {
+					t.Fatalf("expected %d wallets to be cached but got %d", len(tt.wantCached), len(tt.store.cached))
+				}
+			}
+		})
+	}
+}
+
+func TestNewReport(t *testing.T) {
+	cached := d(40)
+	discrepancies := []reconcile.Discrepancy{
+		{WalletID: 2, Kind: reconcile.LedgerMismatch, Balance: d(20), Ledger: d(25)},
+		{WalletID: 3, Kind: reconcile.CacheMismatch, Balance: d(50), Ledger: d(50), Cached: &cached, Repaired: true},
+	}
+
+	tests := []struct {
+		name          string
+		format        string
+		discrepancies []reconcile.Discrepancy
+		want          string
+		wantErr       bool
+	}{
+		{
+			name:          "happy case - json",
+			format:        reconcile.FormatJSON,
+			discrepancies: discrepancies,
+			want: `{"wallet_id":2,"kind":"ledger_mismatch","balance":"20","ledger":"25","cached":null,"repaired":false}
+{"wallet_id":3,"kind":"cache_mismatch","balance":"50","ledger":"50","cached":"40","repaired":true}
+`,
+		},
+		{
+			name:          "happy case - csv",
+			format:        reconcile.FormatCSV,
+			discrepancies: discrepancies,
+			want: `wallet_id,kind,balance,ledger,cached,repaired
+2,ledger_mismatch,20,25,,false
+3,cache_mismatch,50,50,40,true
+`,
+		},
+		{
+			name:   "happy case - csv without discrepancies",
+			format: reconcile.FormatCSV,
+			want:   "wallet_id,kind,balance,ledger,cached,repaired\n",
+		},
+		{
+			name:    "sad case - unsupported format",
+			format:  "xml",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			report, err := reconcile.NewReport(tt.format, &buf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewReport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			for _, discrepancy := range tt.discrepancies {
+				if err := report.Write(discrepancy); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := report.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Fatalf("expected the report\n%s\nbut got\n%s", tt.want, strings.TrimSpace(got))
+			}
+		})
+	}
+}
+
+// heldLock is a lock held by another instance
+type heldLock struct {
+	tries int
+}
+
+func (l *heldLock) Do(ctx context.Context, fn func(ctx context.Context) error) (bool, error) {
+	l.tries++
+	return false, nil
+}
+
+func TestReconciler_Run_LockHeldElsewhere(t *testing.T) {
+	store := &memoryStore{balances: map[int]decimal.Decimal{1: decimal.NewFromInt(10)}}
+	r := reconcile.NewReconciler(store, store, store, 10, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	lock := &heldLock{}
+	r.Lock = lock
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	r.Run(ctx, time.Hour)
+
+	if lock.tries != 1 || store.scans != 0 {
+		t.Fatalf("expected the reconciliation to be skipped but got %d tries and %d scans", lock.tries, store.scans)
+	}
+}
@@ -0,0 +1,128 @@
+package reconcile
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+)
+
+// Report formats supported by NewReport
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// Report represents a contract for writing out the discrepancies a reconciliation finds
+type Report interface {
+	Write(discrepancy Discrepancy) error
+	Flush() error
+}
+
+// NewReport writes discrepancies to w as JSON lines or as CSV with a header row
+func NewReport(format string, w io.Writer) (Report, error) {
+	switch format {
+	case FormatJSON:
+		return &jsonReport{encoder: json.NewEncoder(w)}, nil
+	case FormatCSV:
+		return &csvReport{writer: csv.NewWriter(w)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported report format %q", format)
+	}
+}
+
+type jsonReport struct {
+	encoder *json.Encoder
+}
+
+func (r *jsonReport) Write(discrepancy Discrepancy) error {
+	if err := r.encoder.Encode(discrepancy); err != nil {
+		return fmt.Errorf("failed to write discrepancy with err %v", err)
+	}
+	return nil
+}
+
+func (r *jsonReport) Flush() error {
+	return nil
+}
+
+var csvHeader = []string{"wallet_id", "kind", "balance", "ledger", "cached", "repaired"}
+
+type csvReport struct {
+	writer      *csv.Writer
+	wroteHeader bool
+}
+
+func (r *csvReport) Write(discrepancy Discrepancy) error {
+	if !r.wroteHeader {
+		if err := r.writer.Write(csvHeader); err != nil {
+			return fmt.Errorf("failed to write report header with err %v", err)
+		}
+		r.wroteHeader = true
+	}
+
+	cached := ""
+	if discrepancy.Cached != nil {
+		cached = discrepancy.Cached.String()
+	}
+	if err := r.writer.Write([]string{
+		strconv.Itoa(discrepancy.WalletID),
+		discrepancy.Kind,
+		discrepancy.Balance.String(),
+		discrepancy.Ledger.String(),
+		cached,
+		strconv.FormatBool(discrepancy.Repaired),
+	}); err != nil {
+		return fmt.Errorf("failed to write discrepancy with err %v", err)
+	}
+	return nil
+}
+
+// Flush writes out the header when no discrepancy was found, so that an empty
+// report is still a valid CSV file
+func (r *csvReport) Flush() error {
+	if !r.wroteHeader {
+		if err := r.writer.Write(csvHeader); err != nil {
+			return fmt.Errorf("failed to write report header with err %v", err)
+		}
+		r.wroteHeader = true
+	}
+
+	r.writer.Flush()
+	if err := r.writer.Error(); err != nil {
+		return fmt.Errorf("failed to flush report with err %v", err)
+	}
+	return nil
+}
+
+// NewLogReport logs every discrepancy as a warning
+func NewLogReport(ctx context.Context, logger *slog.Logger) Report {
+	return &logReport{ctx: ctx, logger: logger}
+}
+
+type logReport struct {
+	ctx    context.Context
+	logger *slog.Logger
+}
+
+func (r *logReport) Write(discrepancy Discrepancy) error {
+	attrs := []slog.Attr{
+		slog.Int("wallet_id", discrepancy.WalletID),
+		slog.String("kind", discrepancy.Kind),
+		slog.String("balance", discrepancy.Balance.String()),
+		slog.String("ledger", discrepancy.Ledger.String()),
+		slog.Bool("repaired", discrepancy.Repaired),
+	}
+	if discrepancy.Cached != nil {
+		attrs = append(attrs, slog.String("cached", discrepancy.Cached.String()))
+	}
+	r.logger.LogAttrs(r.ctx, slog.LevelWarn, "wallet out of line", attrs...)
+	return nil
+}
+
+func (r *logReport) Flush() error {
+	return nil
+}
@@ -0,0 +1,324 @@
+package settlement
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/shopspring/decimal"
+)
+
+// DefaultChunkSize is how many wallets' closing balances are written at a time unless told otherwise
+const DefaultChunkSize = 500
+
+var errClosing = domain.NewError(domain.ErrConflict, "the day is being closed by another instance", nil)
+
+// Balances represents a contract for reading the balances wallets had at a moment
+type Balances interface {
+	ScanBalancesAsOf(
+		ctx context.Context,
+		afterID int,
+		limit int,
+		asOf time.Time,
+	) ([]domain.Wallet, error)
+}
+
+// Ledger represents a contract for summing the postings made over a period
+type Ledger interface {
+	PostingTotals(
+		ctx context.Context,
+		from time.Time,
+		to time.Time,
+	) ([]domain.SettlementTotal, error)
+}
+
+// Store represents a contract for writing closed days
+type Store interface {
+	SaveClosingBalances(
+		ctx context.Context,
+		balances []domain.ClosingBalance,
+	) error
+	SaveDayClose(
+		ctx context.Context,
+		dayClose *domain.DayClose,
+		totals []domain.SettlementTotal,
+	) error
+	DeleteClosingBalances(
+		ctx context.Context,
+		day string,
+		currency string,
+		keepCloseID string,
+	) error
+	GetDayClose(
+		ctx context.Context,
+		day string,
+		currency string,
+	) (*domain.DayClose, error)
+}
+
+// Lock represents a contract for running a job on a single instance at a time
+type Lock interface {
+	Do(
+		ctx context.Context,
+		fn func(ctx context.Context) error,
+	) (bool, error)
+}
+
+// Day is the business day a moment falls on in the location
+func Day(t time.Time, location *time.Location) string {
+	return t.In(location).Format(dto.DayLayout)
+}
+
+// Bounds is when a business day starts, inclusive, and ends, exclusive, in the location
+func Bounds(day string, location *time.Location) (time.Time, time.Time, error) {
+	if err := dto.ValidDay(day); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	start, err := time.ParseInLocation(dto.DayLayout, day, location)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return start, start.AddDate(0, 0, 1), nil
+}
+
+// Closer closes the books of business days: it writes the closing balance of every
+// wallet opened by the end of the day and the debits and credits posted to each type of
+// ledger account over the day. Closing a day again writes the same closing balances and
+// totals, replacing the ones written before all at once, so a day that failed to close
+// or was closed too early can be closed again
+type Closer struct {
+	Balances  Balances
+	Ledger    Ledger
+	Store     Store
+	Currency  string
+	Location  *time.Location
+	ChunkSize int
+	// Lock is optional, without it every instance running the closer closes the days
+	Lock   Lock
+	Logger *slog.Logger
+}
+
+// NewCloser initializes a closer of the business days in the location, writing
+// chunkSize closing balances at a time
+func NewCloser(
+	balances Balances,
+	ledger Ledger,
+	store Store,
+	currency string,
+	location *time.Location,
+	chunkSize int,
+	logger *slog.Logger,
+) *Closer {
+	c := &Closer{
+		Balances:  balances,
+		Ledger:    ledger,
+		Store:     store,
+		Currency:  currency,
+		Location:  location,
+		ChunkSize: chunkSize,
+		Logger:    logger,
+	}
+	c.checkPreconditions()
+	return c
+}
+
+func (c *Closer) checkPreconditions() {
+	if c.Balances == nil {
+		log.Panicf("closer has not been initialized with the balances")
+	}
+	if c.Ledger == nil {
+		log.Panicf("closer has not been initialized with the ledger")
+	}
+	if c.Store == nil {
+		log.Panicf("closer has not been initialized with the store")
+	}
+	if c.Currency == "" {
+		log.Panicf("closer has not been configured with a currency")
+	}
+	if c.Location == nil {
+		log.Panicf("closer has not been configured with a time zone")
+	}
+	if c.ChunkSize <= 0 {
+		log.Panicf("closer has not been configured with a chunk size")
+	}
+	if c.Logger == nil {
+		log.Panicf("closer has not been initialized with a logger")
+	}
+}
+
+// CloseDay closes the books of a business day that is over. Wallets' closing balances
+// are their balances as of the last moment of the day and the totals are summed from
+// the postings made during the day. The closing balances are staged under the close,
+// and the day is only marked closed by it once all of them have been written. The
+// closing balances of earlier closes of the day are then deleted. With a lock a day
+// is only closed by one instance at a time, the others fail with a conflict
+func (c *Closer) CloseDay(ctx context.Context, day string) (*domain.DayClose, error) {
+	if c.Lock == nil {
+		return c.closeDay(ctx, day)
+	}
+
+	var dayClose *domain.DayClose
+	var closeErr error
+	ran, err := c.Lock.Do(ctx, func(ctx context.Context) error {
+		dayClose, closeErr = c.closeDay(ctx, day)
+		return closeErr
+	})
+	if closeErr != nil {
+		return nil, closeErr
+	}
+	if err != nil {
+		return nil, dto.Wrap(err, "CloseDay")
+	}
+	if !ran {
+		return nil, dto.Wrap(errClosing, "CloseDay")
+	}
+	return dayClose, nil
+}
+
+// closeDay closes the books of a business day, the caller holds the lock if there is one
+func (c *Closer) closeDay(ctx context.Context, day string) (*domain.DayClose, error) {
+	start, end, err := Bounds(day, c.Location)
+	if err != nil {
+		return nil, dto.Wrap(err, "CloseDay")
+	}
+	if time.Now().Before(end) {
+		errs := dto.FieldErrors{{Field: "day", Message: "must be over before it is closed"}}
+		return nil, dto.Wrap(domain.NewError(domain.ErrValidation, errs.Error(), errs), "CloseDay")
+	}
+
+	closeID, err := newCloseID()
+	if err != nil {
+		return nil, dto.Wrap(err, "CloseDay")
+	}
+	dayClose := &domain.DayClose{
+		Day:            day,
+		Currency:       c.Currency,
+		CloseID:        closeID,
+		ClosingBalance: decimal.Zero,
+	}
+	asOf := end.Add(-time.Nanosecond)
+	afterID := 0
+	for {
+		wallets, err := c.Balances.ScanBalancesAsOf(ctx, afterID, c.ChunkSize, asOf)
+		if err != nil {
+			return nil, dto.Wrap(err, "CloseDay")
+		}
+		if len(wallets) == 0 {
+			break
+		}
+		afterID = wallets[len(wallets)-1].ID
+
+		balances := make([]domain.ClosingBalance, len(wallets))
+		for i, wallet := range wallets {
+			balances[i] = domain.ClosingBalance{
+				Day:      day,
+				Currency: c.Currency,
+				CloseID:  closeID,
+				WalletID: wallet.ID,
+				Balance:  wallet.Balance,
+			}
+			dayClose.ClosingBalance = dayClose.ClosingBalance.Add(wallet.Balance)
+		}
+		if err := c.Store.SaveClosingBalances(ctx, balances); err != nil {
+			return nil, dto.Wrap(err, "CloseDay")
+		}
+		dayClose.Wallets += len(wallets)
+
+		if len(wallets) < c.ChunkSize {
+			break
+		}
+	}
+
+	totals, err := c.Ledger.PostingTotals(ctx, start, end)
+	if err != nil {
+		return nil, dto.Wrap(err, "CloseDay")
+	}
+	for i := range totals {
+		totals[i].Day = day
+		totals[i].Currency = c.Currency
+	}
+
+	dayClose.ClosedAt = time.Now()
+	if err := c.Store.SaveDayClose(ctx, dayClose, totals); err != nil {
+		return nil, dto.Wrap(err, "CloseDay")
+	}
+
+	// the replaced closing balances are no longer read, they are deleted by the next close otherwise
+	if err := c.Store.DeleteClosingBalances(ctx, day, c.Currency, closeID); err != nil {
+		c.Logger.WarnContext(ctx, "failed to delete replaced closing balances", slog.String("day", day), slog.String("error", err.Error()))
+	}
+	return dayClose, nil
+}
+
+// Run closes the latest business day once it has been over for the grace period, so
+// that the changes in flight at midnight have been committed, checking every interval
+// until the context is done. A day that has been closed is not closed again, and with
+// a lock it is only checked and closed by one instance at a time
+func (c *Closer) Run(ctx context.Context, interval time.Duration, grace time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		start, _, _ := Bounds(Day(time.Now().Add(-grace), c.Location), c.Location)
+		day := Day(start.AddDate(0, 0, -1), c.Location)
+
+		if c.Lock == nil {
+			c.closeIfOpen(ctx, day)
+		} else {
+			ran, err := c.Lock.Do(ctx, func(ctx context.Context) error {
+				c.closeIfOpen(ctx, day)
+				return nil
+			})
+			switch {
+			case err != nil:
+				c.Logger.ErrorContext(ctx, "failed to lock day close", slog.String("day", day), slog.String("error", err.Error()))
+			case !ran:
+				c.Logger.DebugContext(ctx, "skipped closing day, another instance is closing it", slog.String("day", day))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// closeIfOpen closes the day unless it has been closed already
+func (c *Closer) closeIfOpen(ctx context.Context, day string) {
+	_, err := c.Store.GetDayClose(ctx, day, c.Currency)
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		dayClose, err := c.closeDay(ctx, day)
+		if err != nil {
+			c.Logger.ErrorContext(ctx, "failed to close day", slog.String("day", day), slog.String("error", err.Error()))
+			return
+		}
+		c.Logger.InfoContext(
+			ctx,
+			"closed day",
+			slog.String("day", day),
+			slog.Int("wallets", dayClose.Wallets),
+			slog.String("closing_balance", dayClose.ClosingBalance.String()),
+		)
+	case err != nil:
+		c.Logger.ErrorContext(ctx, "failed to check day close", slog.String("day", day), slog.String("error", err.Error()))
+	}
+}
+
+// newCloseID identifies a close of a day
+func newCloseID() (string, error) {
+	bs := make([]byte, 16)
+	if _, err := rand.Read(bs); err != nil {
+		return "", fmt.Errorf("failed to generate a close ID with err %v", err)
+	}
+	return hex.EncodeToString(bs), nil
+}
@@ -0,0 +1,388 @@
+package settlement_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/settlement"
+	"github.com/shopspring/decimal"
+)
+
+var ctx = context.Background()
+
+// balanceChange is a wallet's balance changing at a moment
+type balanceChange struct {
+	walletID int
+	at       time.Time
+	balance  decimal.Decimal
+}
+
+// memoryBooks holds wallets' balance changes, ledger totals and closed days in memory
+type memoryBooks struct {
+	changes   []balanceChange
+	opened    map[int]time.Time
+	totals    []domain.SettlementTotal
+	staged    map[string]map[int]domain.ClosingBalance
+	closes    map[string]domain.DayClose
+	dayTotal  map[string][]domain.SettlementTotal
+	totalsAt  [2]time.Time
+	failClose bool
+}
+
+func newMemoryBooks(changes []balanceChange, totals []domain.SettlementTotal) *memoryBooks {
+	return &memoryBooks{
+		changes:  changes,
+		opened:   map[int]time.Time{},
+		totals:   totals,
+		staged:   map[string]map[int]domain.ClosingBalance{},
+		closes:   map[string]domain.DayClose{},
+		dayTotal: map[string][]domain.SettlementTotal{},
+	}
+}
+
+// closing is the closing balances of the close that marked the day closed
+func (m *memoryBooks) closing(day string) map[int]domain.ClosingBalance {
+	return m.staged[m.closes[day].CloseID]
+}
+
+func (m *memoryBooks) ScanBalancesAsOf(ctx context.Context, afterID int, limit int, asOf time.Time) ([]domain.Wallet, error) {
+	balances := map[int]decimal.Decimal{}
+	for _, change := range m.changes {
+		if _, ok := balances[change.walletID]; !ok {
+			balances[change.walletID] = decimal.Zero
+		}
+		if !change.at.After(asOf) {
+			balances[change.walletID] = change.balance
+		}
+	}
+
+	var ids []int
+	for id := range balances {
+		if opened, ok := m.opened[id]; ok && opened.After(asOf) {
+			continue
+		}
+		if id > afterID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	wallets := make([]domain.Wallet, len(ids))
+	for i, id := range ids {
+		wallets[i] = domain.Wallet{ID: id, Balance: balances[id]}
+	}
+	return wallets, nil
+}
+
+func (m *memoryBooks) PostingTotals(ctx context.Context, from time.Time, to time.Time) ([]domain.SettlementTotal, error) {
+	m.totalsAt = [2]time.Time{from, to}
+	return append([]domain.SettlementTotal(nil), m.totals...), nil
+}
+
+func (m *memoryBooks) SaveClosingBalances(ctx context.Context, balances []domain.ClosingBalance) error {
+	for _, balance := range balances {
+		if m.staged[balance.CloseID] == nil {
+			m.staged[balance.CloseID] = map[int]domain.ClosingBalance{}
+		}
+		m.staged[balance.CloseID][balance.WalletID] = balance
+	}
+	return nil
+}
+
+func (m *memoryBooks) SaveDayClose(ctx context.Context, dayClose *domain.DayClose, totals []domain.SettlementTotal) error {
+	if m.failClose {
+		return errors.New("connection lost")
+	}
+	m.closes[dayClose.Day] = *dayClose
+	m.dayTotal[dayClose.Day] = totals
+	return nil
+}
+
+func (m *memoryBooks) DeleteClosingBalances(ctx context.Context, day string, currency string, keepCloseID string) error {
+	for closeID, balances := range m.staged {
+		if closeID == keepCloseID {
+			continue
+		}
+		for walletID, balance := range balances {
+			if balance.Day == day && balance.Currency == currency {
+				delete(balances, walletID)
+			}
+		}
+		if len(balances) == 0 {
+			delete(m.staged, closeID)
+		}
+	}
+	return nil
+}
+
+func (m *memoryBooks) GetDayClose(ctx context.Context, day string, currency string) (*domain.DayClose, error) {
+	dayClose, ok := m.closes[day]
+	if !ok {
+		return nil, domain.NewError(domain.ErrNotFound, "the day has not been closed", nil)
+	}
+	return &dayClose, nil
+}
+
+func d(value int64) decimal.Decimal {
+	return decimal.NewFromInt(value)
+}
+
+func TestCloser_CloseDay(t *testing.T) {
+	nairobi, err := time.LoadLocation("Africa/Nairobi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2022-03-01 in Nairobi is from 2022-02-28 21:00 to 2022-03-01 21:00 UTC
+	at := func(value string) time.Time {
+		moment, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return moment
+	}
+	changes := []balanceChange{
+		{walletID: 1, at: at("2022-02-28T20:00:00Z"), balance: d(100)},
+		{walletID: 1, at: at("2022-03-01T10:00:00Z"), balance: d(70)},
+		{walletID: 1, at: at("2022-03-01T21:00:00Z"), balance: d(5)},
+		{walletID: 2, at: at("2022-03-01T20:59:59Z"), balance: d(30)},
+		{walletID: 3, at: at("2022-03-02T08:00:00Z"), balance: d(40)},
+		{walletID: 4, at: at("2022-03-02T09:00:00Z"), balance: d(60)},
+	}
+	// wallet 4 is opened after the day, wallet 3 before its first change
+	opened := map[int]time.Time{3: at("2022-03-01T12:00:00Z"), 4: at("2022-03-02T09:00:00Z")}
+	totals := []domain.SettlementTotal{
+		{AccountType: domain.AccountHouse, Debits: d(30), Credits: d(30), Postings: 2},
+		{AccountType: domain.AccountTypeWallet, Debits: d(30), Credits: d(30), Postings: 2},
+	}
+
+	tests := []struct {
+		name        string
+		day         string
+		wantClosing map[int]int64
+		wantErr     bool
+	}{
+		{
+			name:        "happy case - closing balances as of midnight in the time zone",
+			day:         "2022-03-01",
+			wantClosing: map[int]int64{1: 70, 2: 30, 3: 0},
+		},
+		{
+			name:    "sad case - invalid day",
+			day:     "01/03/2022",
+			wantErr: true,
+		},
+		{
+			name:    "sad case - day not over",
+			day:     settlement.Day(time.Now(), nairobi),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			books := newMemoryBooks(changes, totals)
+			books.opened = opened
+			c := settlement.NewCloser(books, books, books, "KES", nairobi, 2, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+			dayClose, err := c.CloseDay(ctx, tt.day)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CloseDay() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, domain.ErrValidation) {
+					t.Fatalf("expected a validation error but got %v", err)
+				}
+				if len(books.closes) != 0 {
+					t.Fatalf("expected the day not to be closed")
+				}
+				return
+			}
+
+			// closing the day again, once a later close failed half way, writes the same figures
+			first := books.closes[tt.day]
+			books.failClose = true
+			if _, err := c.CloseDay(ctx, tt.day); err == nil {
+				t.Fatalf("expected the close to fail")
+			}
+			if books.closes[tt.day] != first {
+				t.Fatalf("expected a failed close to leave the day as it was closed")
+			}
+			books.failClose = false
+			if _, err := c.CloseDay(ctx, tt.day); err != nil {
+				t.Fatal(err)
+			}
+			if len(books.staged) != 1 {
+				t.Fatalf("expected the replaced closing balances to be deleted but %d closes are left", len(books.staged))
+			}
+
+			closings := books.closing(tt.day)
+			if len(closings) != len(tt.wantClosing) {
+				t.Fatalf("expected %d closing balances but got %d", len(tt.wantClosing), len(closings))
+			}
+			sum := decimal.Zero
+			for walletID, want := range tt.wantClosing {
+				closing := closings[walletID]
+				if !closing.Balance.Equal(d(want)) || closing.Day != tt.day || closing.Currency != "KES" {
+					t.Fatalf("expected wallet %d to close %s at %d KES but got %+v", walletID, tt.day, want, closing)
+				}
+				sum = sum.Add(d(want))
+			}
+
+			saved := books.closes[tt.day]
+			if saved.Wallets != len(tt.wantClosing) || !saved.ClosingBalance.Equal(sum) || saved.Wallets != dayClose.Wallets {
+				t.Fatalf("expected %d wallets closing at %s but got %+v", len(tt.wantClosing), sum, saved)
+			}
+			if !books.totalsAt[0].Equal(at("2022-02-28T21:00:00Z")) || !books.totalsAt[1].Equal(at("2022-03-01T21:00:00Z")) {
+				t.Fatalf("expected the postings of the day in Nairobi to be summed but got %v", books.totalsAt)
+			}
+			if len(books.dayTotal[tt.day]) != len(totals) {
+				t.Fatalf("expected %d settlement totals but got %d", len(totals), len(books.dayTotal[tt.day]))
+			}
+			for _, total := range books.dayTotal[tt.day] {
+				if total.Day != tt.day || total.Currency != "KES" {
+					t.Fatalf("expected the totals of %s in KES but got %+v", tt.day, total)
+				}
+			}
+		})
+	}
+}
+
+func TestBounds(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		day       string
+		wantHours float64
+		wantErr   bool
+	}{
+		{
+			name:      "happy case - a day",
+			day:       "2022-03-01",
+			wantHours: 24,
+		},
+		{
+			name:      "happy case - clocks go forward",
+			day:       "2022-03-27",
+			wantHours: 23,
+		},
+		{
+			name:    "sad case - not a date",
+			day:     "2022-02-30",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, err := settlement.Bounds(tt.day, london)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Bounds() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if settlement.Day(start, london) != tt.day {
+				t.Fatalf("expected %s to start on the day but it starts at %s", tt.day, start)
+			}
+			if hours := end.Sub(start).Hours(); hours != tt.wantHours {
+				t.Fatalf("expected %s to last %v hours but it lasts %v", tt.day, tt.wantHours, hours)
+			}
+		})
+	}
+}
+
+// heldLock is a lock held by another instance
+type heldLock struct {
+	tries int
+}
+
+func (l *heldLock) Do(ctx context.Context, fn func(ctx context.Context) error) (bool, error) {
+	l.tries++
+	return false, nil
+}
+
+func TestCloser_Run_LockHeldElsewhere(t *testing.T) {
+	books := newMemoryBooks(nil, nil)
+	closer := settlement.NewCloser(books, books, books, "KES", time.UTC, 10, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	lock := &heldLock{}
+	closer.Lock = lock
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	closer.Run(ctx, time.Hour, 0)
+
+	if lock.tries != 1 || len(books.closes) != 0 {
+		t.Fatalf("expected the day close to be skipped but got %d tries and %d closes", lock.tries, len(books.closes))
+	}
+}
+
+// mutexLock is a lock shared by the instances of a single process
+type mutexLock struct {
+	mu sync.Mutex
+}
+
+func (l *mutexLock) Do(ctx context.Context, fn func(ctx context.Context) error) (bool, error) {
+	if !l.mu.TryLock() {
+		return false, nil
+	}
+	defer l.mu.Unlock()
+	return true, fn(ctx)
+}
+
+// blockedBalances holds the balances back until they are released
+type blockedBalances struct {
+	settlement.Balances
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (b *blockedBalances) ScanBalancesAsOf(ctx context.Context, afterID int, limit int, asOf time.Time) ([]domain.Wallet, error) {
+	b.once.Do(func() { close(b.started) })
+	<-b.release
+	return b.Balances.ScanBalancesAsOf(ctx, afterID, limit, asOf)
+}
+
+func TestCloser_CloseDay_Concurrently(t *testing.T) {
+	day := "2022-03-01"
+	at := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	books := newMemoryBooks([]balanceChange{
+		{walletID: 1, at: at, balance: d(70)},
+		{walletID: 2, at: at, balance: d(30)},
+		{walletID: 3, at: at, balance: d(40)},
+	}, nil)
+	balances := &blockedBalances{Balances: books, started: make(chan struct{}), release: make(chan struct{})}
+	closer := settlement.NewCloser(balances, books, books, "KES", time.UTC, 2, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	closer.Lock = &mutexLock{}
+
+	first := make(chan error)
+	go func() {
+		_, err := closer.CloseDay(ctx, day)
+		first <- err
+	}()
+	<-balances.started
+
+	if _, err := closer.CloseDay(ctx, day); !errors.Is(err, domain.ErrConflict) {
+		t.Fatalf("expected the day to be closed by one instance at a time but got %v", err)
+	}
+	close(balances.release)
+	if err := <-first; err != nil {
+		t.Fatalf("CloseDay() error = %v", err)
+	}
+
+	if closing := books.closing(day); len(closing) != 3 {
+		t.Fatalf("expected the closing balances of 3 wallets to be kept but got %d", len(closing))
+	}
+}
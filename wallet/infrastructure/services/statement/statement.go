@@ -0,0 +1,208 @@
+package statement
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
+)
+
+// Statement formats supported by NewWriter
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatOFX  = "ofx"
+)
+
+// Formats are all the statement formats
+var Formats = []string{FormatJSON, FormatCSV, FormatOFX}
+
+// ContentType is the media type of a statement format
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatOFX:
+		return "application/x-ofx"
+	default:
+		return "application/json; charset=utf-8"
+	}
+}
+
+// NewWriter writes statements to w as a JSON document, as CSV with the opening and
+// closing balances as the first and last rows or as an OFX 2 bank statement
+func NewWriter(format string, w io.Writer) (usecases.StatementWriter, error) {
+	switch format {
+	case FormatJSON:
+		return &jsonWriter{w: bufio.NewWriter(w)}, nil
+	case FormatCSV:
+		return &csvWriter{writer: csv.NewWriter(w)}, nil
+	case FormatOFX:
+		return &ofxWriter{w: bufio.NewWriter(w)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported statement format %q", format)
+	}
+}
+
+// jsonWriter writes {"statement": {...}, "entries": [...], "closing_balance": "..."}
+// without holding the entries in memory
+type jsonWriter struct {
+	w       *bufio.Writer
+	entries int
+}
+
+func (j *jsonWriter) Open(statement dto.Statement) error {
+	header, err := json.Marshal(statement)
+	if err != nil {
+		return fmt.Errorf("failed to write statement with err %v", err)
+	}
+	fmt.Fprintf(j.w, `{"statement":%s,"entries":[`, header)
+	return nil
+}
+
+func (j *jsonWriter) Write(entries []dto.StatementEntry) error {
+	for _, entry := range entries {
+		bs, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to write statement entry with err %v", err)
+		}
+		if j.entries > 0 {
+			_ = j.w.WriteByte(',')
+		}
+		_, _ = j.w.Write(bs)
+		j.entries++
+	}
+	if err := j.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write statement entries with err %v", err)
+	}
+	return nil
+}
+
+func (j *jsonWriter) Close(statement dto.Statement) error {
+	closing, err := json.Marshal(statement.Closing)
+	if err != nil {
+		return fmt.Errorf("failed to write statement with err %v", err)
+	}
+	fmt.Fprintf(j.w, `],"closing_balance":%s}`+"\n", closing)
+	if err := j.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write statement with err %v", err)
+	}
+	return nil
+}
+
+var csvHeader = []string{"created_at", "id", "transaction_id", "type", "amount", "balance"}
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func (c *csvWriter) Open(statement dto.Statement) error {
+	_ = c.writer.Write(csvHeader)
+	_ = c.writer.Write([]string{
+		statement.From.Format(time.RFC3339Nano), "", "", "opening_balance", "", statement.Opening.String(),
+	})
+	return c.flush()
+}
+
+func (c *csvWriter) Write(entries []dto.StatementEntry) error {
+	for _, entry := range entries {
+		_ = c.writer.Write([]string{
+			entry.CreatedAt.Format(time.RFC3339Nano),
+			strconv.FormatUint(entry.ID, 10),
+			entry.TransactionID,
+			string(entry.Type),
+			entry.Amount.String(),
+			entry.Balance.String(),
+		})
+	}
+	return c.flush()
+}
+
+func (c *csvWriter) Close(statement dto.Statement) error {
+	_ = c.writer.Write([]string{
+		statement.To.Format(time.RFC3339Nano), "", "", "closing_balance", "", statement.Closing.String(),
+	})
+	return c.flush()
+}
+
+func (c *csvWriter) flush() error {
+	c.writer.Flush()
+	if err := c.writer.Error(); err != nil {
+		return fmt.Errorf("failed to write statement with err %v", err)
+	}
+	return nil
+}
+
+// ofxWriter writes an OFX 2 bank statement. OFX transaction types are seen from the
+// account holder's side, so money put in the wallet is a CREDIT and money taken out a DEBIT
+type ofxWriter struct {
+	w *bufio.Writer
+}
+
+// ofxDate writes a moment the way OFX does, in UTC
+func ofxDate(t time.Time) string {
+	return t.UTC().Format("20060102150405.000") + "[0:GMT]"
+}
+
+func (o *ofxWriter) Open(statement dto.Statement) error {
+	fmt.Fprint(o.w, `<?xml version="1.0" encoding="UTF-8" standalone="no"?>`+"\n")
+	fmt.Fprint(o.w, `<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>`+"\n")
+	fmt.Fprint(o.w, "<OFX>\n")
+	fmt.Fprint(o.w, "<SIGNONMSGSRSV1><SONRS>")
+	fmt.Fprint(o.w, "<STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>")
+	fmt.Fprintf(o.w, "<DTSERVER>%s</DTSERVER><LANGUAGE>ENG</LANGUAGE>", ofxDate(time.Now()))
+	fmt.Fprint(o.w, "</SONRS></SIGNONMSGSRSV1>\n")
+	fmt.Fprint(o.w, "<BANKMSGSRSV1><STMTTRNRS><TRNUID>0</TRNUID>")
+	fmt.Fprint(o.w, "<STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>\n")
+	fmt.Fprintf(o.w, "<STMTRS><CURDEF>%s</CURDEF>", escape(statement.Currency))
+	fmt.Fprintf(o.w, "<BANKACCTFROM><BANKID>wallet</BANKID><ACCTID>%d</ACCTID><ACCTTYPE>CHECKING</ACCTTYPE></BANKACCTFROM>\n", statement.WalletID)
+	fmt.Fprintf(o.w, "<BANKTRANLIST><DTSTART>%s</DTSTART><DTEND>%s</DTEND>\n", ofxDate(statement.From), ofxDate(statement.To))
+	return o.flush()
+}
+
+func (o *ofxWriter) Write(entries []dto.StatementEntry) error {
+	for _, entry := range entries {
+		trnType := "CREDIT"
+		if entry.Amount.IsNegative() {
+			trnType = "DEBIT"
+		}
+		fmt.Fprintf(
+			o.w,
+			"<STMTTRN><TRNTYPE>%s</TRNTYPE><DTPOSTED>%s</DTPOSTED><TRNAMT>%s</TRNAMT><FITID>%d</FITID><MEMO>%s</MEMO></STMTTRN>\n",
+			trnType,
+			ofxDate(entry.CreatedAt),
+			entry.Amount.String(),
+			entry.ID,
+			escape(entry.TransactionID),
+		)
+	}
+	return o.flush()
+}
+
+func (o *ofxWriter) Close(statement dto.Statement) error {
+	fmt.Fprint(o.w, "</BANKTRANLIST>\n")
+	fmt.Fprintf(o.w, "<LEDGERBAL><BALAMT>%s</BALAMT><DTASOF>%s</DTASOF></LEDGERBAL>\n", statement.Closing.String(), ofxDate(statement.To))
+	fmt.Fprint(o.w, "</STMTRS></STMTTRNRS></BANKMSGSRSV1>\n</OFX>\n")
+	return o.flush()
+}
+
+func (o *ofxWriter) flush() error {
+	if err := o.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write statement with err %v", err)
+	}
+	return nil
+}
+
+func escape(value string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(value))
+	return b.String()
+}
@@ -0,0 +1,147 @@
+package statement_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/statement"
+	"github.com/shopspring/decimal"
+)
+
+func d(value int64) decimal.Decimal {
+	return decimal.NewFromInt(value)
+}
+
+func TestNewWriter(t *testing.T) {
+	from := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+	closing := d(120)
+	st := dto.Statement{WalletID: 1, Currency: "EUR", From: from, To: to, Opening: d(100)}
+	chunks := [][]dto.StatementEntry{
+		{
+			{ID: 7, TransactionID: "txn7", Type: dto.DebitOperation, Amount: d(50), Balance: d(150), CreatedAt: from.Add(time.Hour)},
+		},
+		{
+			{ID: 9, TransactionID: "txn9", Type: dto.CreditOperation, Amount: d(-30), Balance: d(120), CreatedAt: from.Add(2 * time.Hour)},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		format   string
+		chunks   [][]dto.StatementEntry
+		closing  decimal.Decimal
+		want     string
+		wantText []string
+		wantErr  bool
+	}{
+		{
+			name:    "happy case - json",
+			format:  statement.FormatJSON,
+			chunks:  chunks,
+			closing: closing,
+			want: `{"statement":{"wallet_id":1,"currency":"EUR","from":"2022-03-01T00:00:00Z","to":"2022-03-02T00:00:00Z","opening_balance":"100"},"entries":[` +
+				`{"id":7,"transaction_id":"txn7","type":"debit","amount":"50","balance":"150","created_at":"2022-03-01T01:00:00Z"},` +
+				`{"id":9,"transaction_id":"txn9","type":"credit","amount":"-30","balance":"120","created_at":"2022-03-01T02:00:00Z"}` +
+				`],"closing_balance":"120"}` + "\n",
+		},
+		{
+			name:    "happy case - json without entries",
+			format:  statement.FormatJSON,
+			closing: d(100),
+			want: `{"statement":{"wallet_id":1,"currency":"EUR","from":"2022-03-01T00:00:00Z","to":"2022-03-02T00:00:00Z","opening_balance":"100"},"entries":[` +
+				`],"closing_balance":"100"}` + "\n",
+		},
+		{
+			name:    "happy case - csv",
+			format:  statement.FormatCSV,
+			chunks:  chunks,
+			closing: closing,
+			want: `created_at,id,transaction_id,type,amount,balance
+2022-03-01T00:00:00Z,,,opening_balance,,100
+2022-03-01T01:00:00Z,7,txn7,debit,50,150
+2022-03-01T02:00:00Z,9,txn9,credit,-30,120
+2022-03-02T00:00:00Z,,,closing_balance,,120
+`,
+		},
+		{
+			name:    "happy case - ofx",
+			format:  statement.FormatOFX,
+			chunks:  chunks,
+			closing: closing,
+			wantText: []string{
+				"<CURDEF>EUR</CURDEF>",
+				"<ACCTID>1</ACCTID>",
+				"<DTSTART>20220301000000.000[0:GMT]</DTSTART><DTEND>20220302000000.000[0:GMT]</DTEND>",
+				"<STMTTRN><TRNTYPE>CREDIT</TRNTYPE><DTPOSTED>20220301010000.000[0:GMT]</DTPOSTED><TRNAMT>50</TRNAMT><FITID>7</FITID>",
+				"<STMTTRN><TRNTYPE>DEBIT</TRNTYPE><DTPOSTED>20220301020000.000[0:GMT]</DTPOSTED><TRNAMT>-30</TRNAMT><FITID>9</FITID>",
+				"<LEDGERBAL><BALAMT>120</BALAMT>",
+			},
+		},
+		{
+			name:    "sad case - unsupported format",
+			format:  "qif",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := statement.NewWriter(tt.format, &buf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewWriter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if err := w.Open(st); err != nil {
+				t.Fatal(err)
+			}
+			for _, chunk := range tt.chunks {
+				if err := w.Write(chunk); err != nil {
+					t.Fatal(err)
+				}
+			}
+			closed := st
+			closed.Closing = &tt.closing
+			if err := w.Close(closed); err != nil {
+				t.Fatal(err)
+			}
+
+			got := buf.String()
+			if tt.want != "" && got != tt.want {
+				t.Fatalf("expected the statement\n%s\nbut got\n%s", tt.want, got)
+			}
+			for _, text := range tt.wantText {
+				if !strings.Contains(got, text) {
+					t.Fatalf("expected the statement to contain %s but got\n%s", text, got)
+				}
+			}
+
+			switch tt.format {
+			case statement.FormatJSON:
+				if !json.Valid(buf.Bytes()) {
+					t.Fatalf("expected a valid JSON document but got %s", got)
+				}
+			case statement.FormatOFX:
+				dec := xml.NewDecoder(&buf)
+				for {
+					if _, err := dec.Token(); err != nil {
+						if !errors.Is(err, io.EOF) {
+							t.Fatalf("expected a well-formed OFX document but got %v", err)
+						}
+						break
+					}
+				}
+			}
+		})
+	}
+}
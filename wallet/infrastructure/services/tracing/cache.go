@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"context"
+	"log"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/cache"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+)
+
+// TracedCache decorates a cache tier, starting a span for every call to it
+type TracedCache struct {
+	Next cache.WalletCache
+}
+
+// NewTracedCache initializes a cache tier that traces the calls to the given Redis tier
+func NewTracedCache(next cache.WalletCache) *TracedCache {
+	c := &TracedCache{
+		Next: next,
+	}
+	c.checkPreconditions()
+	return c
+}
+
+func (c *TracedCache) checkPreconditions() {
+	if c.Next == nil {
+		log.Panicf("traced cache has not been initialized with a cache tier")
+	}
+}
+
+// CacheBalance caches a wallet in the next tier
+func (c *TracedCache) CacheBalance(
+	ctx context.Context,
+	wallet *domain.Wallet,
+) (*domain.Wallet, error) {
+	ctx, span := Start(ctx, "redis.CacheBalance", semconv.DBSystemRedis)
+	if wallet != nil {
+		span.SetAttributes(attribute.Int("wallet.id", wallet.ID))
+	}
+
+	cached, err := c.Next.CacheBalance(ctx, wallet)
+	End(span, err)
+	return cached, err
+}
+
+// FillBalance caches a wallet in the next tier unless it is cached already
+func (c *TracedCache) FillBalance(
+	ctx context.Context,
+	wallet *domain.Wallet,
+) error {
+	ctx, span := Start(ctx, "redis.FillBalance", semconv.DBSystemRedis)
+	if wallet != nil {
+		span.SetAttributes(attribute.Int("wallet.id", wallet.ID))
+	}
+
+	err := c.Next.FillBalance(ctx, wallet)
+	End(span, err)
+	return err
+}
+
+// GetCachedBalance retrieves a wallet from the next tier
+func (c *TracedCache) GetCachedBalance(
+	ctx context.Context,
+	walletID int,
+) (*domain.Wallet, error) {
+	ctx, span := Start(ctx, "redis.GetCachedBalance", semconv.DBSystemRedis, attribute.Int("wallet.id", walletID))
+
+	wallet, err := c.Next.GetCachedBalance(ctx, walletID)
+	span.SetAttributes(attribute.Bool("cache.hit", wallet != nil))
+	End(span, err)
+	return wallet, err
+}
+
+// EvictBalance removes a wallet from the next tier
+func (c *TracedCache) EvictBalance(
+	ctx context.Context,
+	walletID int,
+) error {
+	ctx, span := Start(ctx, "redis.EvictBalance", semconv.DBSystemRedis, attribute.Int("wallet.id", walletID))
+
+	err := c.Next.EvictBalance(ctx, walletID)
+	End(span, err)
+	return err
+}
+
+// GetCachedBalances retrieves many wallets from the next tier
+func (c *TracedCache) GetCachedBalances(
+	ctx context.Context,
+	walletIDs []int,
+) (map[int]*domain.Wallet, error) {
+	ctx, span := Start(ctx, "redis.GetCachedBalances", semconv.DBSystemRedis, attribute.Int("wallet.count", len(walletIDs)))
+
+	wallets, err := c.Next.GetCachedBalances(ctx, walletIDs)
+	span.SetAttributes(attribute.Int("cache.hits", len(wallets)))
+	End(span, err)
+	return wallets, err
+}
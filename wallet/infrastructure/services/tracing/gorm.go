@@ -0,0 +1,83 @@
+package tracing
+
+import (
+	"errors"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const spanKey = "tracing:span"
+
+// GormPlugin starts a span for every MySQL call made through gorm
+type GormPlugin struct{}
+
+// Name is the name the plugin is registered under
+func (GormPlugin) Name() string {
+	return "tracing"
+}
+
+// Initialize registers callbacks around each of gorm's operations
+func (GormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	hooks := []struct {
+		operation string
+		before    func(name string, fn func(*gorm.DB)) error
+		after     func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	}
+
+	for _, hook := range hooks {
+		operation := hook.operation
+		if err := hook.before("tracing:before_"+operation, func(db *gorm.DB) {
+			startDbSpan(operation, db)
+		}); err != nil {
+			return err
+		}
+		if err := hook.after("tracing:after_"+operation, endDbSpan); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func startDbSpan(operation string, db *gorm.DB) {
+	_, span := Tracer().Start(
+		db.Statement.Context,
+		"mysql."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemMySQL),
+	)
+	db.InstanceSet(spanKey, span)
+}
+
+func endDbSpan(db *gorm.DB) {
+	value, ok := db.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span, ok := value.(trace.Span)
+	if !ok {
+		return
+	}
+
+	// parameters are left out of the statement so no amounts end up in the traces
+	span.SetAttributes(
+		semconv.DBSQLTable(db.Statement.Table),
+		semconv.DBStatement(db.Statement.SQL.String()),
+	)
+
+	err := db.Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+	}
+	End(span, err)
+}
@@ -0,0 +1,109 @@
+package tracing_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/tracing"
+	jsonapi "github.com/ageeknamedslickback/wallet-API/wallet/presentation/json_api"
+	"github.com/ageeknamedslickback/wallet-API/wallet/presentation/middleware"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository/mocks"
+	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type fakeCache struct{}
+
+func (fakeCache) CacheBalance(ctx context.Context, wallet *domain.Wallet) (*domain.Wallet, error) {
+	return wallet, nil
+}
+
+func (fakeCache) FillBalance(ctx context.Context, wallet *domain.Wallet) error {
+	return nil
+}
+
+func (fakeCache) GetCachedBalance(ctx context.Context, walletID int) (*domain.Wallet, error) {
+	return &domain.Wallet{ID: walletID, Balance: decimal.NewFromInt(10)}, nil
+}
+
+func (fakeCache) GetCachedBalances(ctx context.Context, walletIDs []int) (map[int]*domain.Wallet, error) {
+	return map[int]*domain.Wallet{}, nil
+}
+
+func (fakeCache) EvictBalance(ctx context.Context, walletID int) error {
+	return nil
+}
+
+func TestTracing_Propagation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	if _, err := tracing.Setup(context.Background(), tracing.ExporterNone, "wallet-api"); err != nil {
+		t.Fatal(err)
+	}
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+
+	tracedCache := tracing.NewTracedCache(fakeCache{})
+	getMockRepo := mocks.NewMockRepo()
+	getMockRepo.MockGetBalance = func(ctx context.Context, walletID int) (*domain.Wallet, error) {
+		return tracedCache.GetCachedBalance(ctx, walletID)
+	}
+	uc := tracing.NewTracedUsecases(
+		usecases.NewWalletUsecases(getMockRepo, mocks.NewMockRepo(), mocks.NewMockRepo()),
+	)
+	h := jsonapi.NewWalletJsonAPIs(uc, dto.Rules{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	router := gin.New()
+	router.Use(middleware.Tracing())
+	router.GET("/api/v1/:wallet_id/balance", h.WalletBalance)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/v1/1/balance", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %v, but got %v", http.StatusOK, w.Code)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID().String() != traceID {
+			t.Fatalf("expected span %s to join the caller's trace", span.Name())
+		}
+		spans[span.Name()] = span
+	}
+
+	parents := []struct {
+		child  string
+		parent string
+	}{
+		{"WalletUsecases.WalletBalance", "GET /api/v1/:wallet_id/balance"},
+		{"redis.GetCachedBalance", "WalletUsecases.WalletBalance"},
+	}
+	for _, tt := range parents {
+		child, ok := spans[tt.child]
+		if !ok {
+			t.Fatalf("expected a %s span but got %v", tt.child, spans)
+		}
+		parent, ok := spans[tt.parent]
+		if !ok {
+			t.Fatalf("expected a %s span but got %v", tt.parent, spans)
+		}
+		if child.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Fatalf("expected %s to be a child of %s", tt.child, tt.parent)
+		}
+	}
+}
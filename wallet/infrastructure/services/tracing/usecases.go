@@ -0,0 +1,137 @@
+package tracing
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// TracedUsecases decorates the usecases, starting a span for every one of them
+type TracedUsecases struct {
+	Next usecases.WalletBusinessLogic
+}
+
+// NewTracedUsecases initializes usecases that trace the given ones
+func NewTracedUsecases(next usecases.WalletBusinessLogic) *TracedUsecases {
+	u := &TracedUsecases{
+		Next: next,
+	}
+	u.checkPreconditions()
+	return u
+}
+
+func (u *TracedUsecases) checkPreconditions() {
+	if u.Next == nil {
+		log.Panicf("traced usecases have not been initialized with the usecases")
+	}
+}
+
+// WalletBalance retrieves a wallet's balance
+func (u *TracedUsecases) WalletBalance(
+	ctx context.Context,
+	walletID int,
+) (*domain.Wallet, error) {
+	ctx, span := Start(ctx, "WalletUsecases.WalletBalance", attribute.Int("wallet.id", walletID))
+
+	wallet, err := u.Next.WalletBalance(ctx, walletID)
+	End(span, err)
+	return wallet, err
+}
+
+// WalletBalanceAsOf retrieves the balance a wallet had at the given moment
+func (u *TracedUsecases) WalletBalanceAsOf(
+	ctx context.Context,
+	walletID int,
+	asOf time.Time,
+) (*domain.Wallet, error) {
+	ctx, span := Start(
+		ctx,
+		"WalletUsecases.WalletBalanceAsOf",
+		attribute.Int("wallet.id", walletID),
+		attribute.String("wallet.as_of", asOf.Format(time.RFC3339Nano)),
+	)
+
+	wallet, err := u.Next.WalletBalanceAsOf(ctx, walletID, asOf)
+	End(span, err)
+	return wallet, err
+}
+
+// WalletBalances retrieves the balances of many wallets
+func (u *TracedUsecases) WalletBalances(
+	ctx context.Context,
+	walletIDs []int,
+) ([]dto.WalletBalanceResult, error) {
+	ctx, span := Start(ctx, "WalletUsecases.WalletBalances", attribute.Int("wallet.count", len(walletIDs)))
+
+	results, err := u.Next.WalletBalances(ctx, walletIDs)
+	End(span, err)
+	return results, err
+}
+
+// CreditWallet credits a wallet
+func (u *TracedUsecases) CreditWallet(
+	ctx context.Context,
+	walletID int,
+	creditAmount decimal.Decimal,
+) (*domain.Wallet, error) {
+	ctx, span := Start(ctx, "WalletUsecases.CreditWallet", attribute.Int("wallet.id", walletID))
+
+	wallet, err := u.Next.CreditWallet(ctx, walletID, creditAmount)
+	End(span, err)
+	return wallet, err
+}
+
+// DebitWallet debits a wallet
+func (u *TracedUsecases) DebitWallet(
+	ctx context.Context,
+	walletID int,
+	debitAmount decimal.Decimal,
+) (*domain.Wallet, error) {
+	ctx, span := Start(ctx, "WalletUsecases.DebitWallet", attribute.Int("wallet.id", walletID))
+
+	wallet, err := u.Next.DebitWallet(ctx, walletID, debitAmount)
+	End(span, err)
+	return wallet, err
+}
+
+// ApplyBatch applies many credits/debits at once
+func (u *TracedUsecases) ApplyBatch(
+	ctx context.Context,
+	input dto.BatchInput,
+) (*dto.BatchResult, error) {
+	ctx, span := Start(
+		ctx,
+		"WalletUsecases.ApplyBatch",
+		attribute.String("batch.mode", string(input.Mode)),
+		attribute.Int("batch.operations", len(input.Operations)),
+	)
+
+	result, err := u.Next.ApplyBatch(ctx, input)
+	if result != nil {
+		span.SetAttributes(
+			attribute.Bool("batch.applied", result.Applied),
+			attribute.Bool("batch.replayed", result.Replayed),
+		)
+	}
+	End(span, err)
+	return result, err
+}
+
+// WatchBalance subscribes to a wallet's balance updates. Only the subscription
+// is traced, not the lifetime of the stream
+func (u *TracedUsecases) WatchBalance(
+	ctx context.Context,
+	walletID int,
+) (<-chan *domain.Wallet, error) {
+	spanCtx, span := Start(ctx, "WalletUsecases.WatchBalance", attribute.Int("wallet.id", walletID))
+
+	updates, err := u.Next.WatchBalance(spanCtx, walletID)
+	End(span, err)
+	return updates, err
+}
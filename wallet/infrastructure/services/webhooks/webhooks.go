@@ -0,0 +1,379 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+)
+
+// Headers every delivery is sent with
+const (
+	SignatureHeader    = "X-Webhook-Signature"
+	SubscriptionHeader = "X-Webhook-Subscription"
+	EventIDHeader      = "X-Event-ID"
+	EventTypeHeader    = "X-Event-Type"
+)
+
+// Store represents a contract for scheduling and claiming webhook deliveries
+type Store interface {
+	EnqueueDeliveries(
+		ctx context.Context,
+		event domain.OutboxEvent,
+	) error
+	// ClaimDeliveries leases the pending deliveries that are due, along with their
+	// subscriptions, so that no other dispatcher attempts them until the lease is over
+	ClaimDeliveries(
+		ctx context.Context,
+		limit int,
+		lease time.Duration,
+	) ([]domain.WebhookDelivery, []domain.WebhookSubscription, error)
+	// SaveDelivery records the outcome of a delivery attempt
+	SaveDelivery(
+		ctx context.Context,
+		delivery *domain.WebhookDelivery,
+	) error
+}
+
+// DefaultTimeout bounds each delivery attempt unless told otherwise
+const DefaultTimeout = 10 * time.Second
+
+// Sign signs a delivery's payload sent at the given time. The signature header is
+// "t=<unix timestamp>,v1=<hex HMAC-SHA256 of "<timestamp>.<payload>">", the
+// timestamp lets receivers reject replayed deliveries
+func Sign(secret string, timestamp time.Time, payload []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + t + ",v1=" + signature(secret, t, payload)
+}
+
+// Verify checks a signature header against the payload, as a receiver would
+func Verify(secret string, header string, payload []byte) bool {
+	var t, v1 string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			v1 = value
+		}
+	}
+	if t == "" || v1 == "" {
+		return false
+	}
+	return hmac.Equal([]byte(v1), []byte(signature(secret, t, payload)))
+}
+
+func signature(secret string, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Fanout is the outbox sink that schedules an event's delivery to every
+// webhook subscribed to its type
+type Fanout struct {
+	Store Store
+}
+
+// NewFanout initializes the sink scheduling webhook deliveries
+func NewFanout(store Store) *Fanout {
+	f := &Fanout{
+		Store: store,
+	}
+	f.checkPreconditions()
+	return f
+}
+
+func (f *Fanout) checkPreconditions() {
+	if f.Store == nil {
+		log.Panicf("webhook fanout has not been initialized with a store")
+	}
+}
+
+// Publish schedules the event's deliveries
+func (f *Fanout) Publish(ctx context.Context, event domain.OutboxEvent) error {
+	if err := f.Store.EnqueueDeliveries(ctx, event); err != nil {
+		return dto.Wrap(err, "Fanout.Publish")
+	}
+	return nil
+}
+
+// RetryPolicy is how failed deliveries are retried
+type RetryPolicy struct {
+	// MaxAttempts is how many times a delivery is attempted before it is dead lettered
+	MaxAttempts int
+	// Backoff is how long to wait before the first retry, it doubles with every attempt
+	Backoff time.Duration
+	// MaxBackoff caps how long to wait between attempts
+	MaxBackoff time.Duration
+}
+
+// Delay is how long to wait before retrying a delivery that failed the given
+// number of times. The delay is jittered so that retries do not bunch up
+func (p RetryPolicy) Delay(attempts int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < attempts && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// errNonPublicAddress is returned when a webhook resolves to an address of this network
+var errNonPublicAddress = errors.New("webhook must not point at a loopback, private or link local address")
+
+// NewClient initializes the HTTP client webhooks are delivered with. It only dials
+// public addresses, checked once the webhook's host has been resolved so that a host
+// name can not be pointed at this network after subscribing, and does not follow
+// redirects, which are answered as failed deliveries
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, conn syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !dto.PublicIP(ip) {
+				return errNonPublicAddress
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Dispatcher delivers the scheduled webhook deliveries, retrying the failed ones
+// with exponential backoff until they are dead lettered
+type Dispatcher struct {
+	Store  Store
+	Client *http.Client
+	Retry  RetryPolicy
+	// Timeout bounds each delivery attempt, the client's timeout by default
+	Timeout   time.Duration
+	Interval  time.Duration
+	BatchSize int
+	Logger    *slog.Logger
+}
+
+// NewDispatcher initializes a dispatcher that polls for due deliveries every interval
+func NewDispatcher(
+	store Store,
+	client *http.Client,
+	retry RetryPolicy,
+	interval time.Duration,
+	batchSize int,
+	logger *slog.Logger,
+) *Dispatcher {
+	d := &Dispatcher{
+		Store:     store,
+		Client:    client,
+		Retry:     retry,
+		Timeout:   DefaultTimeout,
+		Interval:  interval,
+		BatchSize: batchSize,
+		Logger:    logger,
+	}
+	if client != nil && client.Timeout > 0 {
+		d.Timeout = client.Timeout
+	}
+	d.checkPreconditions()
+	return d
+}
+
+func (d *Dispatcher) checkPreconditions() {
+	if d.Store == nil {
+		log.Panicf("webhook dispatcher has not been initialized with a store")
+	}
+	if d.Client == nil {
+		log.Panicf("webhook dispatcher has not been initialized with an HTTP client")
+	}
+	if d.Retry.MaxAttempts <= 0 || d.Retry.Backoff <= 0 || d.Retry.MaxBackoff < d.Retry.Backoff {
+		log.Panicf("webhook dispatcher has not been configured with a valid retry policy")
+	}
+	if d.Timeout <= 0 {
+		log.Panicf("webhook dispatcher has not been configured with a timeout")
+	}
+	if d.Interval <= 0 {
+		log.Panicf("webhook dispatcher has not been configured with a polling interval")
+	}
+	if d.BatchSize <= 0 {
+		log.Panicf("webhook dispatcher has not been configured with a batch size")
+	}
+	if d.Logger == nil {
+		log.Panicf("webhook dispatcher has not been initialized with a logger")
+	}
+}
+
+// Run dispatches the due deliveries until the context is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		attempted, err := d.DispatchOnce(ctx)
+		if err != nil {
+			d.Logger.ErrorContext(ctx, "failed to dispatch webhook deliveries", slog.String("error", err.Error()))
+		}
+
+		// a full batch means more deliveries are due
+		if err == nil && attempted == d.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchOnce attempts a batch of due deliveries and returns how many were attempted.
+// The batch is leased for long enough to attempt every delivery in it, one at a time,
+// and each outcome is saved as soon as it is known
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	due, subs, err := d.Store.ClaimDeliveries(ctx, d.BatchSize, d.Timeout*time.Duration(d.BatchSize))
+	if err != nil {
+		return 0, dto.Wrap(err, "DispatchOnce")
+	}
+	byID := make(map[uint64]domain.WebhookSubscription, len(subs))
+	for _, sub := range subs {
+		byID[sub.ID] = sub
+	}
+
+	attempted := 0
+	for i := range due {
+		sub, ok := byID[due[i].SubscriptionID]
+		if !ok {
+			continue
+		}
+
+		d.attempt(ctx, &due[i], sub)
+		attempted++
+		if err := d.Store.SaveDelivery(ctx, &due[i]); err != nil {
+			// the delivery is attempted again once its lease is over
+			d.Logger.ErrorContext(
+				ctx,
+				"failed to save webhook delivery",
+				slog.Uint64("delivery_id", due[i].ID),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+	return attempted, nil
+}
+
+// attempt delivers an event once and records the outcome on the delivery
+func (d *Dispatcher) attempt(ctx context.Context, delivery *domain.WebhookDelivery, sub domain.WebhookSubscription) {
+	now := time.Now()
+	delivery.Attempts++
+
+	attemptCtx, cancel := context.WithTimeout(ctx, d.Timeout)
+	statusCode, err := d.post(attemptCtx, delivery, sub, now)
+	cancel()
+	delivery.LastStatusCode = statusCode
+	if err == nil {
+		delivery.Status = domain.DeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+		return
+	}
+
+	delivery.LastError = truncate(err.Error(), 1024)
+	if delivery.Attempts >= d.Retry.MaxAttempts {
+		delivery.Status = domain.DeliveryDeadLettered
+		d.Logger.WarnContext(
+			ctx,
+			"webhook delivery dead lettered",
+			slog.Uint64("delivery_id", delivery.ID),
+			slog.Uint64("subscription_id", sub.ID),
+			slog.Int("attempts", delivery.Attempts),
+			slog.String("error", delivery.LastError),
+		)
+		return
+	}
+	delivery.NextAttemptAt = now.Add(d.Retry.Delay(delivery.Attempts))
+}
+
+func (d *Dispatcher) post(
+	ctx context.Context,
+	delivery *domain.WebhookDelivery,
+	sub domain.WebhookSubscription,
+	now time.Time,
+) (int, error) {
+	// subscriptions made before webhooks had to be https are not delivered to
+	u, err := url.Parse(sub.URL)
+	if err != nil {
+		return 0, err
+	}
+	if u.Scheme != "https" {
+		return 0, fmt.Errorf("webhook URL must be https")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, now, delivery.Payload))
+	req.Header.Set(SubscriptionHeader, strconv.FormatUint(sub.ID, 10))
+	req.Header.Set(EventIDHeader, delivery.EventID)
+	req.Header.Set(EventTypeHeader, delivery.EventType)
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// drain the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return resp.StatusCode, fmt.Errorf("webhook answered with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max]
+}
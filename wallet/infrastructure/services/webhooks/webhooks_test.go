@@ -0,0 +1,386 @@
+package webhooks_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/webhooks"
+)
+
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// memoryStore holds a single subscription's deliveries in memory
+type memoryStore struct {
+	mu         sync.Mutex
+	sub        domain.WebhookSubscription
+	deliveries []domain.WebhookDelivery
+}
+
+func (s *memoryStore) EnqueueDeliveries(ctx context.Context, event domain.OutboxEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.sub.Subscribes(event.Type) {
+		return nil
+	}
+	for _, delivery := range s.deliveries {
+		if delivery.EventID == event.EventID {
+			return nil
+		}
+	}
+	s.deliveries = append(s.deliveries, domain.WebhookDelivery{
+		ID:             uint64(len(s.deliveries) + 1),
+		SubscriptionID: s.sub.ID,
+		EventID:        event.EventID,
+		EventType:      event.Type,
+		Payload:        event.Payload,
+		Status:         domain.DeliveryPending,
+		NextAttemptAt:  time.Now(),
+	})
+	return nil
+}
+
+func (s *memoryStore) ClaimDeliveries(
+	ctx context.Context,
+	limit int,
+	lease time.Duration,
+) ([]domain.WebhookDelivery, []domain.WebhookSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var claimed []domain.WebhookDelivery
+	for i := range s.deliveries {
+		delivery := &s.deliveries[i]
+		if len(claimed) == limit || delivery.Status != domain.DeliveryPending || delivery.NextAttemptAt.After(now) {
+			continue
+		}
+		delivery.NextAttemptAt = now.Add(lease)
+		claimed = append(claimed, *delivery)
+	}
+	return claimed, []domain.WebhookSubscription{s.sub}, nil
+}
+
+func (s *memoryStore) SaveDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deliveries[delivery.ID-1] = *delivery
+	return nil
+}
+
+// due makes every pending delivery due now, as if its backoff had passed
+func (s *memoryStore) due() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.deliveries {
+		s.deliveries[i].NextAttemptAt = time.Now()
+	}
+}
+
+func TestSign(t *testing.T) {
+	payload := []byte(`{"id":"abc"}`)
+	header := webhooks.Sign("a-very-secret-secret", time.Unix(1700000000, 0), payload)
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		payload []byte
+		want    bool
+	}{
+		{
+			name:    "happy case - valid signature",
+			secret:  "a-very-secret-secret",
+			header:  header,
+			payload: payload,
+			want:    true,
+		},
+		{
+			name:    "sad case - wrong secret",
+			secret:  "another-secret-secret",
+			header:  header,
+			payload: payload,
+		},
+		{
+			name:    "sad case - tampered payload",
+			secret:  "a-very-secret-secret",
+			header:  header,
+			payload: []byte(`{"id":"abd"}`),
+		},
+		{
+			name:    "sad case - tampered timestamp",
+			secret:  "a-very-secret-secret",
+			header:  "t=1700000001" + header[len("t=1700000000"):],
+			payload: payload,
+		},
+		{
+			name:    "sad case - malformed header",
+			secret:  "a-very-secret-secret",
+			header:  "v1=",
+			payload: payload,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := webhooks.Verify(tt.secret, tt.header, tt.payload); got != tt.want {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	policy := webhooks.RetryPolicy{MaxAttempts: 8, Backoff: time.Second, MaxBackoff: 10 * time.Second}
+
+	tests := []struct {
+		name     string
+		attempts int
+		max      time.Duration
+	}{
+		{
+			name:     "first retry",
+			attempts: 1,
+			max:      time.Second,
+		},
+		{
+			name:     "backs off exponentially",
+			attempts: 3,
+			max:      4 * time.Second,
+		},
+		{
+			name:     "capped",
+			attempts: 20,
+			max:      10 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				delay := policy.Delay(tt.attempts)
+				if delay < tt.max/2 || delay > tt.max {
+					t.Fatalf("expected a delay between %v and %v but got %v", tt.max/2, tt.max, delay)
+				}
+			}
+		})
+	}
+}
+
+func TestDispatcher_DispatchOnce(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantStatus   string
+		wantAttempts int
+	}{
+		{
+			name:         "happy case - delivered",
+			statuses:     []int{http.StatusOK},
+			wantStatus:   domain.DeliveryDelivered,
+			wantAttempts: 1,
+		},
+		{
+			name:         "happy case - delivered after a retry",
+			statuses:     []int{http.StatusInternalServerError, http.StatusNoContent},
+			wantStatus:   domain.DeliveryDelivered,
+			wantAttempts: 2,
+		},
+		{
+			name:         "sad case - dead lettered",
+			statuses:     []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusGone},
+			wantStatus:   domain.DeliveryDeadLettered,
+			wantAttempts: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu       sync.Mutex
+				received int
+			)
+			receiver := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if !webhooks.Verify("a-very-secret-secret", r.Header.Get(webhooks.SignatureHeader), body) {
+					t.Errorf("expected a valid signature")
+				}
+				if r.Header.Get(webhooks.EventIDHeader) != "event-1" {
+					t.Errorf("expected the event ID header to be set")
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				w.WriteHeader(tt.statuses[received])
+				received++
+			}))
+			defer receiver.Close()
+
+			store := &memoryStore{sub: domain.WebhookSubscription{
+				ID:         1,
+				URL:        receiver.URL,
+				EventTypes: domain.EventWalletCredited,
+				Secret:     "a-very-secret-secret",
+			}}
+			for _, event := range []domain.OutboxEvent{
+				{EventID: "event-1", Type: domain.EventWalletCredited, Payload: []byte(`{"id":"event-1"}`)},
+				{EventID: "event-1", Type: domain.EventWalletCredited, Payload: []byte(`{"id":"event-1"}`)},
+				{EventID: "event-2", Type: domain.EventWalletDebited, Payload: []byte(`{"id":"event-2"}`)},
+			} {
+				if err := webhooks.NewFanout(store).Publish(context.Background(), event); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if len(store.deliveries) != 1 {
+				t.Fatalf("expected a single delivery to be scheduled but got %d", len(store.deliveries))
+			}
+
+			d := webhooks.NewDispatcher(
+				store,
+				receiver.Client(),
+				webhooks.RetryPolicy{MaxAttempts: 3, Backoff: time.Hour, MaxBackoff: time.Hour},
+				time.Second,
+				10,
+				logger,
+			)
+			for range tt.statuses {
+				if _, err := d.DispatchOnce(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+				if attempted, _ := d.DispatchOnce(context.Background()); attempted != 0 {
+					t.Fatalf("expected a failed delivery to back off")
+				}
+				store.due()
+			}
+
+			delivery := store.deliveries[0]
+			if delivery.Status != tt.wantStatus || delivery.Attempts != tt.wantAttempts {
+				t.Fatalf(
+					"expected the delivery to be %s after %d attempts but got %s after %d",
+					tt.wantStatus, tt.wantAttempts, delivery.Status, delivery.Attempts,
+				)
+			}
+			if delivery.LastStatusCode != tt.statuses[len(tt.statuses)-1] {
+				t.Fatalf("expected the last status code to be recorded but got %d", delivery.LastStatusCode)
+			}
+			if attempted, _ := d.DispatchOnce(context.Background()); attempted != 0 {
+				t.Fatalf("expected no more attempts once the delivery is %s", delivery.Status)
+			}
+		})
+	}
+}
+
+func TestDispatcher_DispatchOnce_Unsafe(t *testing.T) {
+	receiver := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://169.254.169.254/latest/meta-data", http.StatusFound)
+	}))
+	defer receiver.Close()
+
+	// the receiver's client trusts its certificate but does not guard the dial
+	redirecting := receiver.Client()
+	redirecting.CheckRedirect = webhooks.NewClient(time.Second).CheckRedirect
+
+	tests := []struct {
+		name    string
+		url     string
+		client  *http.Client
+		want    int
+		wantErr string
+	}{
+		{
+			name:    "sad case - plain http",
+			url:     "http" + strings.TrimPrefix(receiver.URL, "https"),
+			client:  receiver.Client(),
+			wantErr: "https",
+		},
+		{
+			name:    "sad case - loopback address",
+			url:     receiver.URL,
+			client:  webhooks.NewClient(time.Second),
+			wantErr: "loopback",
+		},
+		{
+			name:    "sad case - redirect",
+			url:     receiver.URL,
+			client:  redirecting,
+			want:    http.StatusFound,
+			wantErr: "status 302",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memoryStore{sub: domain.WebhookSubscription{
+				ID:         1,
+				URL:        tt.url,
+				EventTypes: domain.EventWalletCredited,
+				Secret:     "a-very-secret-secret",
+			}}
+			event := domain.OutboxEvent{EventID: "event-1", Type: domain.EventWalletCredited, Payload: []byte(`{"id":"event-1"}`)}
+			if err := webhooks.NewFanout(store).Publish(context.Background(), event); err != nil {
+				t.Fatal(err)
+			}
+
+			d := webhooks.NewDispatcher(
+				store,
+				tt.client,
+				webhooks.RetryPolicy{MaxAttempts: 3, Backoff: time.Hour, MaxBackoff: time.Hour},
+				time.Second,
+				10,
+				logger,
+			)
+			if _, err := d.DispatchOnce(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			delivery := store.deliveries[0]
+			if delivery.Status != domain.DeliveryPending || !strings.Contains(delivery.LastError, tt.wantErr) || delivery.LastStatusCode != tt.want {
+				t.Fatalf("expected the delivery to fail with status %d but got %+v", tt.want, delivery)
+			}
+		})
+	}
+}
+
+func TestDispatcher_DispatchOnce_Lease(t *testing.T) {
+	store := &memoryStore{}
+	receiver := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the delivery is being attempted outside of its claim, and leased meanwhile
+		claimed, _, err := store.ClaimDeliveries(r.Context(), 10, time.Minute)
+		if err != nil || len(claimed) != 0 {
+			t.Errorf("expected the delivery to be leased while it is attempted but got %+v, %v", claimed, err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	store.sub = domain.WebhookSubscription{
+		ID:         1,
+		URL:        receiver.URL,
+		EventTypes: domain.EventWalletCredited,
+		Secret:     "a-very-secret-secret",
+	}
+	event := domain.OutboxEvent{EventID: "event-1", Type: domain.EventWalletCredited, Payload: []byte(`{"id":"event-1"}`)}
+	if err := webhooks.NewFanout(store).Publish(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	d := webhooks.NewDispatcher(
+		store,
+		receiver.Client(),
+		webhooks.RetryPolicy{MaxAttempts: 3, Backoff: time.Hour, MaxBackoff: time.Hour},
+		time.Second,
+		10,
+		logger,
+	)
+	if attempted, err := d.DispatchOnce(context.Background()); err != nil || attempted != 1 {
+		t.Fatalf("expected a single attempt but got %d, %v", attempted, err)
+	}
+	if delivery := store.deliveries[0]; delivery.Status != domain.DeliveryDelivered {
+		t.Fatalf("expected the delivery to be saved as delivered but got %+v", delivery)
+	}
+}
@@ -1,74 +1,704 @@
 package presentation
 
 import (
-	"fmt"
+	"context"
 	"io"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
 	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/database"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/audit"
 	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/cache"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/events"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/eventstore"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/health"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/logging"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/metrics"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/reconcile"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/settlement"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/tracing"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/webhooks"
+	grpcapi "github.com/ageeknamedslickback/wallet-API/wallet/presentation/grpc_api"
 	jsonapi "github.com/ageeknamedslickback/wallet-API/wallet/presentation/json_api"
 	"github.com/ageeknamedslickback/wallet-API/wallet/presentation/middleware"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository"
 	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis"
 	adapter "github.com/gwatts/gin-adapter"
+	"github.com/shopspring/decimal"
+	"google.golang.org/grpc"
+	"gorm.io/gorm"
 )
 
-// Router sets up the presentation layer config router
-func Router() *gin.Engine {
-	db, err := strconv.Atoi(os.Getenv("REDIS_DB"))
+// Dependencies are the connections shared by the usecases and the readiness probe
+type Dependencies struct {
+	Db    *gorm.DB
+	Redis cache.RedisClient
+	// AuditKey seals the records appended to the audit log
+	AuditKey audit.Key
+}
+
+// Connect opens the connections to MySQL and Redis and reads the audit log's key,
+// without which nothing can be appended to the audit log
+func Connect() Dependencies {
+	auditKey, err := audit.KeyFromEnv()
 	if err != nil {
-		log.Panic(err)
+		log.Panicf("error reading the audit log key: %v", err)
+	}
+	if len(auditKey.Secret) == 0 {
+		log.Panicf("AUDIT_HMAC_KEY has not been set")
+	}
+	rdb, err := cache.ConnectToRedis(context.Background())
+	if err != nil {
+		log.Panicf("error connecting to redis: %v", err)
 	}
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     os.Getenv("REDIS_ADDR"),
-		Password: os.Getenv("REDIS_PASSWORD"),
-		DB:       db,
-	})
-
-	router := gin.Default()
 
 	gormDb, err := database.ConnectToDatabase()
 	if err != nil {
 		log.Panicf("error connecting to the database: %v", err)
 	}
-	cache := cache.NewCacheService(rdb)
-	getRepo := database.NewWalletDb(gormDb, cache)
-	updateRepo := database.NewWalletDb(gormDb, cache)
-	uc := usecases.NewWalletUsecases(getRepo, updateRepo)
-	h := jsonapi.NewWalletJsonAPIs(uc)
-
-	gin.DisableConsoleColor()
-
-	f, _ := os.Create("wallet.log")
-	gin.DefaultWriter = io.MultiWriter(f, os.Stdout)
-	router.Use(gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
-		return fmt.Sprintf("%s - [%s] \"%s %s %s %d %s \"%s\" %s\"\n",
-			param.ClientIP,
-			param.TimeStamp.Format(time.RFC1123),
-			param.Method,
-			param.Path,
-			param.Request.Proto,
-			param.StatusCode,
-			param.Latency,
-			param.Request.UserAgent(),
-			param.ErrorMessage,
-		)
+
+	return Dependencies{Db: gormDb, Redis: rdb, AuditKey: auditKey}
+}
+
+// Usecases sets up the usecases shared by the JSON and gRPC APIs. Balances are
+// kept in the wallets table unless WALLET_STORE is events, in which case they are
+// derived from each wallet's event stream
+func Usecases(deps Dependencies, logger *slog.Logger) usecases.WalletBusinessLogic {
+	gormDb := deps.Db
+	redisCache := newRedisCache(deps)
+	localCache := cache.NewLocalCache(tracing.NewTracedCache(redisCache), redisCache, localCacheOptions(), logger)
+	go listen(context.Background(), "cache_invalidations", localCache.ListenForInvalidations, logger)
+
+	var uc *usecases.WalletUsecases
+	switch store := os.Getenv("WALLET_STORE"); store {
+	case "", "table":
+		getRepo := database.NewWalletDb(gormDb, localCache, deps.AuditKey, logger)
+		updateRepo := database.NewWalletDb(gormDb, localCache, deps.AuditKey, logger)
+		batchRepo := database.NewWalletDb(gormDb, localCache, deps.AuditKey, logger)
+		uc = usecases.NewWalletUsecases(getRepo, updateRepo, batchRepo)
+		uc.History = getRepo
+	case "events":
+		eventStore := database.NewEventStore(gormDb, localCache, deps.AuditKey, snapshotEvery(), logger)
+		uc = usecases.NewWalletUsecases(eventStore, eventStore, eventStore)
+		uc.History = eventStore
+	default:
+		log.Panicf("unsupported WALLET_STORE %q", store)
+	}
+	uc.Counterparties = counterparties()
+	uc.Rules = validationRules()
+	uc.Broadcast = redisCache
+	go listen(context.Background(), "balance_updates", uc.ListenForUpdates, logger)
+	return metrics.NewInstrumentedUsecases(tracing.NewTracedUsecases(uc), currency())
+}
+
+// maxListenBackoff caps the wait before resubscribing to a failed subscription
+const maxListenBackoff = 30 * time.Second
+
+// listen keeps a pub/sub subscription running until the context is cancelled. A
+// subscription that fails or ends is resubscribed after a backoff that starts at a
+// second and doubles up to maxListenBackoff, or at a second again when it had been
+// running for longer than that. Resubscriptions are counted by subscription
+func listen(
+	ctx context.Context,
+	name string,
+	subscribe func(ctx context.Context) error,
+	logger *slog.Logger,
+) {
+	backoff := time.Second
+	for {
+		start := time.Now()
+		err := subscribe(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if time.Since(start) > maxListenBackoff {
+			backoff = time.Second
+		}
+		attrs := []interface{}{slog.String("subscription", name), slog.Duration("retry_in", backoff)}
+		if err != nil {
+			attrs = append(attrs, slog.String("error", err.Error()))
+		}
+		logger.Error("stopped listening, resubscribing", attrs...)
+		metrics.ObserveResubscription(name)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxListenBackoff {
+			backoff = maxListenBackoff
+		}
+	}
+}
+
+// WebhookUsecases sets up the webhook subscriptions' usecases
+func WebhookUsecases(deps Dependencies) usecases.WebhookBusinessLogic {
+	return usecases.NewWebhookUsecases(database.NewWebhookStore(deps.Db))
+}
+
+// SettlementUsecases sets up the reports of the closed business days
+func SettlementUsecases(deps Dependencies) usecases.SettlementBusinessLogic {
+	return usecases.NewSettlementUsecases(database.NewSettlementStore(deps.Db), currency())
+}
+
+// StatementUsecases sets up the wallets' account statements. Opening balances are
+// read from the store picked by WALLET_STORE
+func StatementUsecases(deps Dependencies, logger *slog.Logger) usecases.StatementBusinessLogic {
+	redisCache := newRedisCache(deps)
+
+	var history repository.History
+	switch store := os.Getenv("WALLET_STORE"); store {
+	case "", "table":
+		history = database.NewWalletDb(deps.Db, redisCache, deps.AuditKey, logger)
+	case "events":
+		history = database.NewEventStore(deps.Db, redisCache, deps.AuditKey, snapshotEvery(), logger)
+	default:
+		log.Panicf("unsupported WALLET_STORE %q", store)
+	}
+
+	return usecases.NewStatementUsecases(history, database.NewLedger(deps.Db), currency())
+}
+
+// AdminUsecases sets up the operators' actions on wallets, on the store picked by
+// WALLET_STORE. Every wallet they change is dropped from the servers' in-memory caches
+// and broadcast to the servers' balance watchers
+func AdminUsecases(deps Dependencies, logger *slog.Logger) usecases.AdminBusinessLogic {
+	redisCache := newRedisCache(deps)
+	walletCache := cache.NewLocalCache(redisCache, redisCache, localCacheOptions(), logger)
+
+	var uc *usecases.AdminUsecases
+	switch store := os.Getenv("WALLET_STORE"); store {
+	case "", "table":
+		walletDb := database.NewWalletDb(deps.Db, walletCache, deps.AuditKey, logger)
+		uc = usecases.NewAdminUsecases(walletDb, walletDb, walletDb)
+	case "events":
+		eventStore := database.NewEventStore(deps.Db, walletCache, deps.AuditKey, snapshotEvery(), logger)
+		uc = usecases.NewAdminUsecases(eventStore, eventStore, eventStore)
+	default:
+		log.Panicf("unsupported WALLET_STORE %q", store)
+	}
+	uc.Broadcast = redisCache
+	return uc
+}
+
+// WebhookDispatcher sets up the worker delivering events to the webhook subscriptions.
+// A failed delivery is retried after WEBHOOK_BACKOFF (30s by default), doubling with
+// every attempt up to WEBHOOK_MAX_BACKOFF (1h by default), and is dead lettered
+// after WEBHOOK_MAX_ATTEMPTS (8 by default). Each attempt times out after WEBHOOK_TIMEOUT (10s by default)
+func WebhookDispatcher(deps Dependencies, logger *slog.Logger) *webhooks.Dispatcher {
+	return webhooks.NewDispatcher(
+		database.NewWebhookStore(deps.Db),
+		webhooks.NewClient(durationEnv("WEBHOOK_TIMEOUT", 10*time.Second)),
+		webhooks.RetryPolicy{
+			MaxAttempts: intEnv("WEBHOOK_MAX_ATTEMPTS", 8),
+			Backoff:     durationEnv("WEBHOOK_BACKOFF", 30*time.Second),
+			MaxBackoff:  durationEnv("WEBHOOK_MAX_BACKOFF", time.Hour),
+		},
+		time.Second,
+		intEnv("WEBHOOK_BATCH_SIZE", 10),
+		logger,
+	)
+}
+
+// Readiness sets up the MySQL, Redis and JWKS checks behind /readyz, each of
+// which is bounded by READINESS_TIMEOUT (2s by default)
+func Readiness(deps Dependencies) *health.Checker {
+	timeout := 2 * time.Second
+	if t := os.Getenv("READINESS_TIMEOUT"); t != "" {
+		d, err := time.ParseDuration(t)
+		if err != nil {
+			log.Panic(err)
+		}
+		timeout = d
+	}
+
+	return health.NewChecker(
+		map[string]health.Check{
+			"mysql": health.Database(deps.Db),
+			"redis": health.Redis(deps.Redis),
+			"jwks":  health.JWKS(http.DefaultClient, middleware.IssuerURL(), middleware.JWKSCacheTTL),
+		},
+		timeout,
+	)
+}
+
+// OutboxRelay sets up the relay publishing the outbox's events to the sink picked
+// by OUTBOX_SINK: subscriptions (the default, fanning events out to the webhook
+// subscriptions), file (OUTBOX_FILE) or webhook (OUTBOX_WEBHOOK_URL). No relay is
+// set up for none, in which case the events wait in the outbox. The outbox is
+// polled every OUTBOX_POLL_INTERVAL (1s by default) OUTBOX_BATCH_SIZE (100 by default) events at a time,
+// each batch being published within OUTBOX_LEASE (1m by default)
+func OutboxRelay(deps Dependencies, logger *slog.Logger) *events.Relay {
+	var sink events.Sink
+	switch os.Getenv("OUTBOX_SINK") {
+	case "none":
+		return nil
+	case "", "subscriptions":
+		sink = webhooks.NewFanout(database.NewWebhookStore(deps.Db))
+	case "file":
+		fileSink, err := events.NewFileSink(os.Getenv("OUTBOX_FILE"))
+		if err != nil {
+			log.Panicf("error opening the outbox file: %v", err)
+		}
+		sink = fileSink
+	case "webhook":
+		sink = events.NewWebhookSink(os.Getenv("OUTBOX_WEBHOOK_URL"), &http.Client{Timeout: 10 * time.Second})
+	default:
+		log.Panicf("unsupported OUTBOX_SINK %q", os.Getenv("OUTBOX_SINK"))
+	}
+
+	relay := events.NewRelay(
+		database.NewOutbox(deps.Db),
+		sink,
+		durationEnv("OUTBOX_POLL_INTERVAL", time.Second),
+		intEnv("OUTBOX_BATCH_SIZE", 100),
+		logger,
+	)
+	relay.Lease = durationEnv("OUTBOX_LEASE", events.DefaultLease)
+	return relay
+}
+
+// reconcileLock is the database lock held by the server reconciling the wallets
+const reconcileLock = "wallet_reconcile"
+
+// Reconciler sets up the reconciliation of wallets' balances with their ledger and the
+// cache, RECONCILE_CHUNK_SIZE (500 by default) wallets at a time. Balances are read from
+// the store picked by WALLET_STORE. With RECONCILE_REPAIR_CACHE set to true the wallets
+// whose cached balance is wrong are evicted from the cache. When the servers reconcile
+// on their own, only one of them reconciles at a time
+func Reconciler(deps Dependencies, logger *slog.Logger) *reconcile.Reconciler {
+	redisCache := newRedisCache(deps)
+
+	var balances reconcile.Balances
+	switch store := os.Getenv("WALLET_STORE"); store {
+	case "", "table":
+		balances = database.NewWalletDb(deps.Db, redisCache, deps.AuditKey, logger)
+	case "events":
+		balances = database.NewEventStore(deps.Db, redisCache, deps.AuditKey, snapshotEvery(), logger)
+	default:
+		log.Panicf("unsupported WALLET_STORE %q", store)
+	}
+
+	r := reconcile.NewReconciler(
+		balances,
+		database.NewLedger(deps.Db),
+		redisCache,
+		intEnv("RECONCILE_CHUNK_SIZE", reconcile.DefaultChunkSize),
+		logger,
+	)
+	if repair := os.Getenv("RECONCILE_REPAIR_CACHE"); repair != "" {
+		var err error
+		if r.RepairCache, err = strconv.ParseBool(repair); err != nil {
+			log.Panicf("invalid RECONCILE_REPAIR_CACHE: %v", err)
+		}
+	}
+	r.Lock = database.NewJobLock(deps.Db, reconcileLock)
+	return r
+}
+
+// ReconcileInterval is how often the server reconciles the wallets, RECONCILE_INTERVAL.
+// Wallets are only reconciled on demand, with cmd/reconcile, unless it is set
+func ReconcileInterval() time.Duration {
+	return durationEnv("RECONCILE_INTERVAL", 0)
+}
+
+// closeDayLock is the database lock held by the server closing a business day
+const closeDayLock = "wallet_close_day"
+
+// Closer sets up the closing of the books of business days, which end at midnight
+// in EOD_TIMEZONE (UTC by default). Closing balances are read from the store picked
+// by WALLET_STORE EOD_CHUNK_SIZE (500 by default) wallets at a time. When the servers
+// close the days on their own, only one of them closes a day at a time
+func Closer(deps Dependencies, logger *slog.Logger) *settlement.Closer {
+	redisCache := newRedisCache(deps)
+
+	var balances settlement.Balances
+	switch store := os.Getenv("WALLET_STORE"); store {
+	case "", "table":
+		balances = database.NewWalletDb(deps.Db, redisCache, deps.AuditKey, logger)
+	case "events":
+		balances = database.NewEventStore(deps.Db, redisCache, deps.AuditKey, snapshotEvery(), logger)
+	default:
+		log.Panicf("unsupported WALLET_STORE %q", store)
+	}
+
+	location, err := time.LoadLocation(envOr("EOD_TIMEZONE", "UTC"))
+	if err != nil {
+		log.Panicf("invalid EOD_TIMEZONE: %v", err)
+	}
+
+	c := settlement.NewCloser(
+		balances,
+		database.NewLedger(deps.Db),
+		database.NewSettlementStore(deps.Db),
+		currency(),
+		location,
+		intEnv("EOD_CHUNK_SIZE", settlement.DefaultChunkSize),
+		logger,
+	)
+	c.Lock = database.NewJobLock(deps.Db, closeDayLock)
+	return c
+}
+
+// CloseInterval is how often the server checks whether the previous business day
+// has been closed, EOD_CLOSE_INTERVAL. A day is only closed once it has been over
+// for EOD_CLOSE_GRACE (5m by default). Days are only closed on demand, with
+// cmd/closeday, unless the interval is set
+func CloseInterval() (time.Duration, time.Duration) {
+	return durationEnv("EOD_CLOSE_INTERVAL", 0), durationEnv("EOD_CLOSE_GRACE", 5*time.Minute)
+}
+
+// DrainPeriod is how long readiness fails before the servers are shut down,
+// SHUTDOWN_DRAIN_PERIOD (5s by default)
+func DrainPeriod() time.Duration {
+	return durationEnv("SHUTDOWN_DRAIN_PERIOD", 5*time.Second)
+}
+
+// Tracing sets up the span exporter picked by OTEL_TRACES_EXPORTER (none by default)
+// and returns the function that flushes the remaining spans on shutdown
+func Tracing() func(context.Context) error {
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "wallet-api"
+	}
+
+	shutdown, err := tracing.Setup(context.Background(), os.Getenv("OTEL_TRACES_EXPORTER"), serviceName)
+	if err != nil {
+		log.Panicf("error setting up tracing: %v", err)
+	}
+	return shutdown
+}
+
+// Logger sets up the JSON logger shared by every layer. It logs to stdout unless
+// LOG_FILE is set, in which case the file is rotated once it reaches
+// LOG_FILE_MAX_SIZE_MB (100 by default) keeping LOG_FILE_MAX_BACKUPS (5 by default)
+func Logger() *slog.Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(envOr("LOG_LEVEL", "info"))); err != nil {
+		log.Panicf("invalid LOG_LEVEL: %v", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if path := os.Getenv("LOG_FILE"); path != "" {
+		w = logging.FileWriter(path, logging.RotationOptions{
+			MaxSizeMB:  intEnv("LOG_FILE_MAX_SIZE_MB", 100),
+			MaxBackups: intEnv("LOG_FILE_MAX_BACKUPS", 5),
+		})
+	}
+
+	return logging.New(w, level)
+}
+
+// Router sets up the presentation layer config router
+func Router() *gin.Engine {
+	logger := Logger()
+	deps := Connect()
+	return NewRouter(
+		Usecases(deps, logger),
+		WebhookUsecases(deps),
+		SettlementUsecases(deps),
+		StatementUsecases(deps, logger),
+		Readiness(deps),
+		logger,
+	)
+}
+
+// NewRouter sets up the presentation layer config router on top of the given usecases
+func NewRouter(
+	uc usecases.WalletBusinessLogic,
+	webhookUc usecases.WebhookBusinessLogic,
+	settlementUc usecases.SettlementBusinessLogic,
+	statementUc usecases.StatementBusinessLogic,
+	checker *health.Checker,
+	logger *slog.Logger,
+) *gin.Engine {
+	router := gin.New()
+	if err := router.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Panic(err)
+	}
+	h := jsonapi.NewWalletJsonAPIs(uc, validationRules(), logger)
+	wh := jsonapi.NewWebhookJsonAPIs(webhookUc, logger)
+	rh := jsonapi.NewSettlementJsonAPIs(settlementUc, logger)
+	th := jsonapi.NewStatementJsonAPIs(statementUc, logger)
+	sh := jsonapi.NewBalanceStreamJsonAPI(uc, streamLimits(), checker.Drained(), logger)
+
+	router.Use(middleware.RequestID())
+	router.Use(middleware.Logger(logger))
+	router.Use(gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered interface{}) {
+		logger.ErrorContext(c.Request.Context(), "recovered from a panic", slog.Any("panic", recovered))
+		c.AbortWithStatus(http.StatusInternalServerError)
 	}))
+	router.Use(middleware.Metrics())
+	router.Use(middleware.Tracing())
+
+	defaultTimeout, timeouts := routeTimeouts()
+	router.Use(middleware.Timeouts(defaultTimeout, timeouts))
 
+	router.GET("/healthz", jsonapi.Liveness)
+	router.GET("/readyz", jsonapi.Readiness(checker, logger))
+	router.GET("/openapi.json", jsonapi.OpenAPI)
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
 	router.POST("/access_token", h.Authenticate)
 
 	v1 := router.Group("api/v1")
-	v1.Use(adapter.Wrap(middleware.EnsureValidToken()))
+	v1.Use(adapter.Wrap(middleware.EnsureValidToken(logger)))
+	v1.Use(middleware.Actor())
 	{
 		v1.GET("/:wallet_id/balance", h.WalletBalance)
+		v1.GET(streamRoute, sh.Stream)
+		v1.GET(statementRoute, th.Statement)
+		v1.POST("/balances", h.WalletBalances)
 		v1.POST("/:wallet_id/credit", h.CreditWallet)
 		v1.POST("/:wallet_id/debit", h.DebitWallet)
+		v1.POST("/batch", h.ApplyBatch)
+
+		v1.POST("/webhooks", wh.CreateSubscription)
+		v1.GET("/webhooks", wh.Subscriptions)
+		v1.DELETE("/webhooks/:webhook_id", wh.DeleteSubscription)
+		v1.GET("/webhooks/:webhook_id/deliveries", wh.Deliveries)
+
+		v1.GET("/reports/eod/:day", rh.SettlementReport)
+		v1.GET(closingBalancesRoute, rh.ClosingBalances)
 	}
 
 	return router
 }
+
+// GrpcServer sets up the gRPC API on top of the given usecases
+func GrpcServer(uc usecases.WalletBusinessLogic, logger *slog.Logger) *grpc.Server {
+	return grpcapi.NewServer(uc, middleware.NewTokenValidator(), validationRules(), logger)
+}
+
+// trustedProxies reads the proxies allowed to set the caller's IP through the
+// X-Forwarded-For and X-Real-IP headers from TRUSTED_PROXIES, a comma separated
+// list of IPs and CIDRs. No proxy is trusted by default so the audited IP is the
+// address the request came from and can not be made up by the caller
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// routeTimeouts reads the request timeouts. ROUTE_TIMEOUT applies to every route
+// unless it is overridden in ROUTE_TIMEOUTS, a comma separated list of
+// "<METHOD> <route>=<duration>" e.g. "POST /api/v1/batch=1m"
+func routeTimeouts() (time.Duration, map[string]time.Duration) {
+	defaultTimeout := 10 * time.Second
+	if timeout := os.Getenv("ROUTE_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			log.Panic(err)
+		}
+		defaultTimeout = d
+	}
+
+	// balance streams are bounded by STREAM_MAX_DURATION instead, and statements and
+	// closing balances are exported for as long as there is something left to stream
+	overrides := map[string]time.Duration{
+		http.MethodGet + " /api/v1" + streamRoute:          0,
+		http.MethodGet + " /api/v1" + statementRoute:       0,
+		http.MethodGet + " /api/v1" + closingBalancesRoute: 0,
+	}
+	for _, override := range strings.Split(os.Getenv("ROUTE_TIMEOUTS"), ",") {
+		if strings.TrimSpace(override) == "" {
+			continue
+		}
+
+		route, timeout, ok := strings.Cut(override, "=")
+		if !ok {
+			log.Panicf("invalid route timeout %q", override)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(timeout))
+		if err != nil {
+			log.Panic(err)
+		}
+		overrides[strings.Join(strings.Fields(route), " ")] = d
+	}
+
+	return defaultTimeout, overrides
+}
+
+// streamRoute is the route of the balance streams
+const streamRoute = "/:wallet_id/balance/stream"
+
+// statementRoute is the route of the wallets' account statements
+const statementRoute = "/:wallet_id/statement"
+
+// closingBalancesRoute is the route of the closing balances exports
+const closingBalancesRoute = "/reports/eod/:day/balances"
+
+// streamLimits reads the balance stream limits. An instance holds at most
+// STREAM_MAX_CONNECTIONS (1000 by default) streams open, of which at most
+// STREAM_MAX_PER_SUBJECT (5 by default) per access token subject. Streams are
+// sent a heartbeat every STREAM_HEARTBEAT (15s by default) and are ended after
+// STREAM_MAX_DURATION (1h by default), clients reconnect after STREAM_RETRY (3s by default)
+func streamLimits() jsonapi.StreamLimits {
+	return jsonapi.StreamLimits{
+		MaxStreams:    intEnv("STREAM_MAX_CONNECTIONS", 1000),
+		MaxPerSubject: intEnv("STREAM_MAX_PER_SUBJECT", 5),
+		MaxDuration:   durationEnv("STREAM_MAX_DURATION", time.Hour),
+		Heartbeat:     durationEnv("STREAM_HEARTBEAT", 15*time.Second),
+		Retry:         durationEnv("STREAM_RETRY", 3*time.Second),
+	}
+}
+
+// validationRules reads the credit/debit validation rules. Amounts have at most
+// 2 decimal places unless AMOUNT_DECIMAL_PLACES says otherwise and are only
+// bounded when the <CREDIT|DEBIT>_<MIN|MAX>_AMOUNT limits are set
+func validationRules() dto.Rules {
+	rules := dto.Rules{
+		Credit: dto.AmountLimits{
+			Min: decimalEnv("CREDIT_MIN_AMOUNT"),
+			Max: decimalEnv("CREDIT_MAX_AMOUNT"),
+		},
+		Debit: dto.AmountLimits{
+			Min: decimalEnv("DEBIT_MIN_AMOUNT"),
+			Max: decimalEnv("DEBIT_MAX_AMOUNT"),
+		},
+		DecimalPlaces: 2,
+	}
+
+	if places := os.Getenv("AMOUNT_DECIMAL_PLACES"); places != "" {
+		p, err := strconv.ParseInt(places, 10, 32)
+		if err != nil {
+			log.Panic(err)
+		}
+		rules.DecimalPlaces = int32(p)
+	}
+
+	return rules
+}
+
+func decimalEnv(key string) decimal.Decimal {
+	value := os.Getenv(key)
+	if value == "" {
+		return decimal.Zero
+	}
+
+	d, err := decimal.NewFromString(value)
+	if err != nil {
+		log.Panicf("invalid %s: %v", key, err)
+	}
+	return d
+}
+
+func envOr(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func durationEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Panicf("invalid %s: %v", key, err)
+	}
+	return d
+}
+
+func intEnv(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		log.Panicf("invalid %s: %v", key, err)
+	}
+	return i
+}
+
+// snapshotEvery reads how many events are appended to a wallet's stream between
+// two snapshots, EVENT_SNAPSHOT_EVERY (100 by default)
+func snapshotEvery() uint64 {
+	every := intEnv("EVENT_SNAPSHOT_EVERY", eventstore.DefaultSnapshotEvery)
+	if every <= 0 {
+		log.Panicf("invalid EVENT_SNAPSHOT_EVERY: must be positive")
+	}
+	return uint64(every)
+}
+
+// counterparties reads the ledger accounts credits are posted to, LEDGER_CREDIT_ACCOUNT,
+// and debits are posted from, LEDGER_DEBIT_ACCOUNT. Both are the house by default
+func counterparties() usecases.Counterparties {
+	c := usecases.DefaultCounterparties
+	if account := os.Getenv("LEDGER_CREDIT_ACCOUNT"); account != "" {
+		c.Credit = account
+	}
+	if account := os.Getenv("LEDGER_DEBIT_ACCOUNT"); account != "" {
+		c.Debit = account
+	}
+	if err := c.Valid(); err != nil {
+		log.Panicf("invalid ledger accounts: %v", err)
+	}
+	return c
+}
+
+// currency reads the ISO 4217 code of the wallets' balances, XXX (no currency) by default
+func currency() string {
+	if code := os.Getenv("CURRENCY"); code != "" {
+		return code
+	}
+	return "XXX"
+}
+
+// newRedisCache sets up the shared cache tier, balances are cached in redis for
+// REDIS_CACHE_TTL (1h by default)
+func newRedisCache(deps Dependencies) *cache.ServiceCache {
+	c := cache.NewCacheService(deps.Redis)
+	c.TTL = durationEnv("REDIS_CACHE_TTL", cache.DefaultTTL)
+	return c
+}
+
+func localCacheOptions() cache.LocalCacheOptions {
+	opts := cache.LocalCacheOptions{
+		MaxEntries: 10000,
+		TTL:        5 * time.Second,
+	}
+
+	if size := os.Getenv("LOCAL_CACHE_SIZE"); size != "" {
+		maxEntries, err := strconv.Atoi(size)
+		if err != nil {
+			log.Panic(err)
+		}
+		opts.MaxEntries = maxEntries
+	}
+
+	if ttl := os.Getenv("LOCAL_CACHE_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			log.Panic(err)
+		}
+		opts.TTL = d
+	}
+
+	if beta := os.Getenv("LOCAL_CACHE_EARLY_REFRESH_BETA"); beta != "" {
+		b, err := strconv.ParseFloat(beta, 64)
+		if err != nil {
+			log.Panic(err)
+		}
+		opts.EarlyRefreshBeta = b
+	}
+
+	return opts
+}
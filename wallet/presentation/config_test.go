@@ -0,0 +1,284 @@
+package presentation_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/health"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/logging"
+	"github.com/ageeknamedslickback/wallet-API/wallet/presentation"
+	"github.com/ageeknamedslickback/wallet-API/wallet/presentation/middleware"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository/mocks"
+	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
+	"github.com/gin-gonic/gin"
+)
+
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+var checker = health.NewChecker(nil, time.Second)
+
+var webhookUc = usecases.NewWebhookUsecases(mocks.NewMockWebhooks())
+
+var settlementUc = usecases.NewSettlementUsecases(mocks.NewMockSettlement(), "EUR")
+
+var statementUc = usecases.NewStatementUsecases(mocks.NewMockRepo(), mocks.NewMockPostings(), "EUR")
+
+var pathParam = regexp.MustCompile(`:([^/]+)`)
+
+type openAPIDocument struct {
+	OpenAPI string                                `json:"openapi"`
+	Paths   map[string]map[string]json.RawMessage `json:"paths"`
+}
+
+func TestNewRouter_OpenAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	uc := usecases.NewWalletUsecases(mocks.NewMockRepo(), mocks.NewMockRepo(), mocks.NewMockRepo())
+	router := presentation.NewRouter(uc, webhookUc, settlementUc, statementUc, checker, logger)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/openapi.json", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %v, but got %v", http.StatusOK, w.Code)
+	}
+
+	var doc openAPIDocument
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("expected the spec to be valid JSON: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Fatalf("expected an OpenAPI 3 document but got %q", doc.OpenAPI)
+	}
+
+	registered := map[string]bool{}
+	for _, route := range router.Routes() {
+		path := pathParam.ReplaceAllString(route.Path, "{$1}")
+		method := strings.ToLower(route.Method)
+		registered[method+" "+path] = true
+
+		if _, ok := doc.Paths[path][method]; !ok {
+			t.Errorf("route %s %s is missing from the OpenAPI document", route.Method, route.Path)
+		}
+	}
+	for path, operations := range doc.Paths {
+		for method := range operations {
+			if !registered[method+" "+path] {
+				t.Errorf("the OpenAPI document describes %s %s which is not registered", method, path)
+			}
+		}
+	}
+}
+
+func TestNewRouter_Metrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	uc := usecases.NewWalletUsecases(mocks.NewMockRepo(), mocks.NewMockRepo(), mocks.NewMockRepo())
+	router := presentation.NewRouter(uc, webhookUc, settlementUc, statementUc, checker, logger)
+
+	for _, url := range []string{"/openapi.json", "/metrics"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code %v, but got %v", http.StatusOK, w.Code)
+		}
+
+		if url == "/metrics" {
+			want := `wallet_http_requests_total{method="GET",route="/openapi.json",status="200"}`
+			if !strings.Contains(w.Body.String(), want) {
+				t.Fatalf("expected %s to be exposed", want)
+			}
+		}
+	}
+}
+
+func TestNewRouter_RequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name      string
+		requestID string
+		wantEcho  bool
+	}{
+		{
+			name:      "happy case - caller's request ID",
+			requestID: "abc-123",
+			wantEcho:  true,
+		},
+		{
+			name: "happy case - generated request ID",
+		},
+		{
+			name:      "sad case - unsafe request ID is replaced",
+			requestID: "abc\"} injected",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			uc := usecases.NewWalletUsecases(mocks.NewMockRepo(), mocks.NewMockRepo(), mocks.NewMockRepo())
+			router := presentation.NewRouter(uc, webhookUc, settlementUc, statementUc, checker, logging.New(&buf, slog.LevelDebug))
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/api/v1/1/balance", nil)
+			req.Header.Set("Authorization", "Bearer s3cr3t")
+			if tt.requestID != "" {
+				req.Header.Set(middleware.RequestIDHeader, tt.requestID)
+			}
+			router.ServeHTTP(w, req)
+
+			requestID := w.Header().Get(middleware.RequestIDHeader)
+			if requestID == "" || (tt.wantEcho && requestID != tt.requestID) || (!tt.wantEcho && requestID == tt.requestID) {
+				t.Fatalf("unexpected request ID %q", requestID)
+			}
+
+			logs := buf.String()
+			served := false
+			dec := json.NewDecoder(&buf)
+			for dec.More() {
+				var record struct {
+					Msg       string `json:"msg"`
+					RequestID string `json:"request_id"`
+				}
+				if err := dec.Decode(&record); err != nil {
+					t.Fatalf("expected JSON logs: %v", err)
+				}
+				if record.RequestID != requestID {
+					t.Fatalf("expected %q to carry request ID %s but got %s", record.Msg, requestID, record.RequestID)
+				}
+				served = served || record.Msg == "request served"
+			}
+			if !served {
+				t.Fatalf("expected the request to be logged")
+			}
+			if strings.Contains(logs, "s3cr3t") {
+				t.Fatalf("expected the token to be redacted but got %s", logs)
+			}
+		})
+	}
+}
+
+func TestNewRouter_TrustedProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		trustedProxies string
+		wantIP         string
+	}{
+		{
+			name:   "happy case - forwarded IP is ignored by default",
+			wantIP: "203.0.113.7",
+		},
+		{
+			name:           "happy case - forwarded IP from a trusted proxy",
+			trustedProxies: "10.0.0.1, 203.0.113.0/24",
+			wantIP:         "198.51.100.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TRUSTED_PROXIES", tt.trustedProxies)
+
+			var buf bytes.Buffer
+			uc := usecases.NewWalletUsecases(mocks.NewMockRepo(), mocks.NewMockRepo(), mocks.NewMockRepo())
+			router := presentation.NewRouter(uc, webhookUc, settlementUc, statementUc, checker, logging.New(&buf, slog.LevelDebug))
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/openapi.json", nil)
+			req.RemoteAddr = "203.0.113.7:4321"
+			req.Header.Set("X-Forwarded-For", "198.51.100.1")
+			router.ServeHTTP(w, req)
+
+			want := fmt.Sprintf(`"client_ip":%q`, tt.wantIP)
+			if !strings.Contains(buf.String(), want) {
+				t.Fatalf("expected the request to be logged with %s but got %s", want, buf.String())
+			}
+		})
+	}
+}
+
+func TestNewRouter_Health(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	up := func(ctx context.Context) error { return nil }
+	down := func(ctx context.Context) error { return fmt.Errorf("dial tcp 10.0.0.1:6379") }
+
+	tests := []struct {
+		name       string
+		url        string
+		checks     map[string]health.Check
+		drain      bool
+		wantStatus int
+	}{
+		{
+			name:       "happy case - alive",
+			url:        "/healthz",
+			checks:     map[string]health.Check{"redis": down},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "happy case - ready",
+			url:        "/readyz",
+			checks:     map[string]health.Check{"mysql": up, "redis": up, "jwks": up},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "sad case - a dependency is down",
+			url:        "/readyz",
+			checks:     map[string]health.Check{"mysql": up, "redis": down, "jwks": up},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "sad case - shutting down",
+			url:        "/readyz",
+			checks:     map[string]health.Check{"mysql": up, "redis": up, "jwks": up},
+			drain:      true,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := health.NewChecker(tt.checks, time.Second)
+			if tt.drain {
+				checker.Drain()
+			}
+			uc := usecases.NewWalletUsecases(mocks.NewMockRepo(), mocks.NewMockRepo(), mocks.NewMockRepo())
+			router := presentation.NewRouter(uc, webhookUc, settlementUc, statementUc, checker, logger)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status code %v, but got %v: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if strings.Contains(w.Body.String(), "dial tcp") {
+				t.Fatalf("expected dependency errors not to leak but got %s", w.Body.String())
+			}
+
+			if tt.url == "/readyz" {
+				var report health.Report
+				if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+					t.Fatal(err)
+				}
+				for name := range tt.checks {
+					if _, ok := report.Dependencies[name]; !ok {
+						t.Fatalf("expected the status of %s to be reported", name)
+					}
+				}
+			}
+		})
+	}
+}
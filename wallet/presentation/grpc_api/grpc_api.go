@@ -0,0 +1,204 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/presentation/grpc_api/walletpb"
+	"github.com/ageeknamedslickback/wallet-API/wallet/presentation/middleware"
+	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
+	"github.com/shopspring/decimal"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// WalletGrpcAPI sets up wallet's API server gRPC presentation layer
+// with all the necessary dependencies
+type WalletGrpcAPI struct {
+	walletpb.UnimplementedWalletServiceServer
+
+	Uc     usecases.WalletBusinessLogic
+	Rules  dto.Rules
+	Logger *slog.Logger
+}
+
+// NewWalletGrpcAPI initializes a new instance of wallet's gRPC API
+// that validates credits/debits against the given rules
+func NewWalletGrpcAPI(
+	uc usecases.WalletBusinessLogic,
+	rules dto.Rules,
+	logger *slog.Logger,
+) *WalletGrpcAPI {
+	w := &WalletGrpcAPI{
+		Uc:     uc,
+		Rules:  rules,
+		Logger: logger,
+	}
+	w.checkPreconditions()
+	return w
+}
+
+func (p *WalletGrpcAPI) checkPreconditions() {
+	if p.Uc == nil {
+		log.Panicf("gRPC presentation layer has not initialized the usecases")
+	}
+	if p.Logger == nil {
+		log.Panicf("gRPC presentation layer has not initialized the logger")
+	}
+}
+
+// NewServer sets up a gRPC server serving wallet's gRPC API behind JWT authentication
+func NewServer(
+	uc usecases.WalletBusinessLogic,
+	validateToken middleware.TokenValidator,
+	rules dto.Rules,
+	logger *slog.Logger,
+) *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(middleware.UnaryAuthInterceptor(validateToken, logger)),
+		grpc.StreamInterceptor(middleware.StreamAuthInterceptor(validateToken, logger)),
+	)
+	walletpb.RegisterWalletServiceServer(srv, NewWalletGrpcAPI(uc, rules, logger))
+	return srv
+}
+
+func toWalletResponse(wallet *domain.Wallet) *walletpb.WalletResponse {
+	return &walletpb.WalletResponse{
+		Wallet: &walletpb.Wallet{
+			Id:      int64(wallet.ID),
+			Balance: wallet.Balance.String(),
+		},
+	}
+}
+
+// grpcError maps an error's kind to a gRPC status. Only the client safe
+// detail is sent, the full error chain is logged instead
+func (p *WalletGrpcAPI) grpcError(ctx context.Context, err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, domain.ErrInsufficientFunds),
+		errors.Is(err, domain.ErrFrozen):
+		code = codes.FailedPrecondition
+	case errors.Is(err, domain.ErrConflict):
+		code = codes.Aborted
+	case errors.Is(err, domain.ErrValidation):
+		code = codes.InvalidArgument
+	case errors.Is(err, domain.ErrUnavailable):
+		code = codes.Unavailable
+	}
+	if code == codes.Internal || code == codes.Unavailable {
+		p.Logger.ErrorContext(ctx, "gRPC call failed", slog.String("error", err.Error()))
+	}
+
+	return status.Error(code, domain.ErrorDetail(err))
+}
+
+// parseAmount validates the wallet and amount of a credit/debit request
+func (p *WalletGrpcAPI) parseAmount(
+	ctx context.Context,
+	req *walletpb.AmountRequest,
+	op dto.OperationType,
+) (decimal.Decimal, error) {
+	if err := dto.ValidWalletID(int(req.GetWalletId())); err != nil {
+		return decimal.Zero, p.grpcError(ctx, err)
+	}
+
+	var input dto.AmountInput
+	if req.GetAmount() != "" {
+		value, err := decimal.NewFromString(req.GetAmount())
+		if err != nil {
+			return decimal.Zero, status.Errorf(codes.InvalidArgument, "invalid amount: %v", err)
+		}
+		input.Amount = decimal.NewNullDecimal(value)
+	}
+
+	if err := input.Valid(p.Rules, op); err != nil {
+		return decimal.Zero, p.grpcError(ctx, err)
+	}
+
+	return input.Amount.Decimal, nil
+}
+
+// WalletBalance is a gRPC API that retrieves a wallet's balance
+func (p *WalletGrpcAPI) WalletBalance(
+	ctx context.Context,
+	req *walletpb.WalletBalanceRequest,
+) (*walletpb.WalletResponse, error) {
+	if err := dto.ValidWalletID(int(req.GetWalletId())); err != nil {
+		return nil, p.grpcError(ctx, err)
+	}
+
+	wallet, err := p.Uc.WalletBalance(ctx, int(req.GetWalletId()))
+	if err != nil {
+		return nil, p.grpcError(ctx, err)
+	}
+
+	return toWalletResponse(wallet), nil
+}
+
+// CreditWallet is a gRPC API that credits a wallet's balance
+func (p *WalletGrpcAPI) CreditWallet(
+	ctx context.Context,
+	req *walletpb.AmountRequest,
+) (*walletpb.WalletResponse, error) {
+	amount, err := p.parseAmount(ctx, req, dto.CreditOperation)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet, err := p.Uc.CreditWallet(ctx, int(req.GetWalletId()), amount)
+	if err != nil {
+		return nil, p.grpcError(ctx, err)
+	}
+
+	return toWalletResponse(wallet), nil
+}
+
+// DebitWallet is a gRPC API that debits a wallet's balance
+func (p *WalletGrpcAPI) DebitWallet(
+	ctx context.Context,
+	req *walletpb.AmountRequest,
+) (*walletpb.WalletResponse, error) {
+	amount, err := p.parseAmount(ctx, req, dto.DebitOperation)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet, err := p.Uc.DebitWallet(ctx, int(req.GetWalletId()), amount)
+	if err != nil {
+		return nil, p.grpcError(ctx, err)
+	}
+
+	return toWalletResponse(wallet), nil
+}
+
+// WatchBalance is a gRPC API that streams a wallet's balance updates
+func (p *WalletGrpcAPI) WatchBalance(
+	req *walletpb.WalletBalanceRequest,
+	stream walletpb.WalletService_WatchBalanceServer,
+) error {
+	ctx := stream.Context()
+	if err := dto.ValidWalletID(int(req.GetWalletId())); err != nil {
+		return p.grpcError(ctx, err)
+	}
+
+	updates, err := p.Uc.WatchBalance(ctx, int(req.GetWalletId()))
+	if err != nil {
+		return p.grpcError(ctx, err)
+	}
+
+	for wallet := range updates {
+		if err := stream.Send(toWalletResponse(wallet)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,269 @@
+package grpcapi_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	grpcapi "github.com/ageeknamedslickback/wallet-API/wallet/presentation/grpc_api"
+	"github.com/ageeknamedslickback/wallet-API/wallet/presentation/grpc_api/walletpb"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository/mocks"
+	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
+	"github.com/shopspring/decimal"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const validToken = "valid-token"
+
+func validateToken(ctx context.Context, token string) (interface{}, error) {
+	if token != validToken {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return struct{}{}, nil
+}
+
+// initTestClient serves the gRPC API in-process over a bufconn listener
+func initTestClient(t *testing.T) walletpb.WalletServiceClient {
+	getMockRepo := mocks.NewMockRepo()
+	updateMockRepo := mocks.NewMockRepo()
+	batchMockRepo := mocks.NewMockRepo()
+
+	wallets := map[int]*domain.Wallet{
+		1: {ID: 1, Balance: decimal.NewFromFloat(200)},
+	}
+	getMockRepo.MockGetBalance = func(ctx context.Context, walletID int) (*domain.Wallet, error) {
+		wallet, ok := wallets[walletID]
+		if !ok {
+			return nil, domain.NewError(domain.ErrNotFound, "wallet not found", nil)
+		}
+		copied := *wallet
+		return &copied, nil
+	}
+	updateMockRepo.MockUpdateBalance = func(ctx context.Context, wallet *domain.Wallet, txn *domain.LedgerTransaction) (*domain.Wallet, error) {
+		updated, err := mocks.ChangeBalance(wallet, txn)
+		if err != nil {
+			return nil, err
+		}
+		wallets[wallet.ID] = updated
+		return updated, nil
+	}
+	uc := usecases.NewWalletUsecases(getMockRepo, updateMockRepo, batchMockRepo)
+
+	lis := bufconn.Listen(1024 * 1024)
+	rules := dto.Rules{
+		Debit:         dto.AmountLimits{Max: decimal.NewFromInt(500)},
+		DecimalPlaces: 2,
+	}
+	srv := grpcapi.NewServer(uc, validateToken, rules, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	go func() {
+		if err := srv.Serve(lis); err != nil {
+			t.Logf("gRPC server stopped: %v", err)
+		}
+	}()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return walletpb.NewWalletServiceClient(conn)
+}
+
+func authorized(token string) context.Context {
+	return metadata.AppendToOutgoingContext(
+		context.Background(),
+		"authorization",
+		fmt.Sprintf("Bearer %s", token),
+	)
+}
+
+func TestWalletGrpcAPI_WalletBalance(t *testing.T) {
+	client := initTestClient(t)
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		walletID int64
+		wantCode codes.Code
+	}{
+		{
+			name:     "happy case",
+			ctx:      authorized(validToken),
+			walletID: 1,
+			wantCode: codes.OK,
+		},
+		{
+			name:     "sad case - unauthenticated",
+			ctx:      context.Background(),
+			walletID: 1,
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "sad case - invalid token",
+			ctx:      authorized("invalid"),
+			walletID: 1,
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "sad case - not found",
+			ctx:      authorized(validToken),
+			walletID: 2,
+			wantCode: codes.NotFound,
+		},
+		{
+			name:     "sad case - invalid wallet ID",
+			ctx:      authorized(validToken),
+			walletID: -1,
+			wantCode: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.WalletBalance(
+				tt.ctx,
+				&walletpb.WalletBalanceRequest{WalletId: tt.walletID},
+			)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("expected code %v but got %v", tt.wantCode, err)
+			}
+
+			if tt.wantCode == codes.OK && resp.GetWallet().GetBalance() != "200" {
+				t.Fatalf("expected a balance of 200 but got %s", resp.GetWallet().GetBalance())
+			}
+		})
+	}
+}
+
+func TestWalletGrpcAPI_CreditAndDebitWallet(t *testing.T) {
+	client := initTestClient(t)
+	ctx := authorized(validToken)
+
+	tests := []struct {
+		name        string
+		call        func(context.Context, *walletpb.AmountRequest, ...grpc.CallOption) (*walletpb.WalletResponse, error)
+		amount      string
+		wantBalance string
+		wantCode    codes.Code
+	}{
+		{
+			name:        "happy case - credit",
+			call:        client.CreditWallet,
+			amount:      "50.5",
+			wantBalance: "149.5",
+			wantCode:    codes.OK,
+		},
+		{
+			name:        "happy case - debit",
+			call:        client.DebitWallet,
+			amount:      "0.5",
+			wantBalance: "150",
+			wantCode:    codes.OK,
+		},
+		{
+			name:     "sad case - balance below 0",
+			call:     client.CreditWallet,
+			amount:   "1000",
+			wantCode: codes.FailedPrecondition,
+		},
+		{
+			name:     "sad case - negative amount",
+			call:     client.DebitWallet,
+			amount:   "-1",
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "sad case - not a number",
+			call:     client.DebitWallet,
+			amount:   "ten",
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "sad case - missing amount",
+			call:     client.DebitWallet,
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "sad case - too precise",
+			call:     client.DebitWallet,
+			amount:   "0.001",
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "sad case - above the debit limit",
+			call:     client.DebitWallet,
+			amount:   "500.01",
+			wantCode: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.call(ctx, &walletpb.AmountRequest{WalletId: 1, Amount: tt.amount})
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("expected code %v but got %v", tt.wantCode, err)
+			}
+
+			if tt.wantCode == codes.OK && resp.GetWallet().GetBalance() != tt.wantBalance {
+				t.Fatalf("expected a balance of %s but got %s", tt.wantBalance, resp.GetWallet().GetBalance())
+			}
+		})
+	}
+}
+
+func TestWalletGrpcAPI_WatchBalance(t *testing.T) {
+	client := initTestClient(t)
+
+	ctx, cancel := context.WithTimeout(authorized(validToken), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.WatchBalance(ctx, &walletpb.WalletBalanceRequest{WalletId: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.GetWallet().GetBalance() != "200" {
+		t.Fatalf("expected the current balance first but got %s", current.GetWallet().GetBalance())
+	}
+
+	if _, err := client.DebitWallet(ctx, &walletpb.AmountRequest{WalletId: 1, Amount: "25"}); err != nil {
+		t.Fatal(err)
+	}
+
+	update, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update.GetWallet().GetBalance() != "225" {
+		t.Fatalf("expected the updated balance but got %s", update.GetWallet().GetBalance())
+	}
+
+	unauthorized, err := client.WatchBalance(context.Background(), &walletpb.WalletBalanceRequest{WalletId: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unauthorized.Recv(); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected an unauthenticated stream but got %v", err)
+	}
+}
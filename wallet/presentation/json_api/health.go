@@ -0,0 +1,41 @@
+package jsonapi
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/health"
+	"github.com/gin-gonic/gin"
+)
+
+// Liveness is a JSON API that reports the process is alive. It never checks
+// the dependencies so that an outage of theirs does not get the process restarted
+func Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+}
+
+// Readiness is a JSON API that reports whether the service and each of its
+// dependencies can take traffic. It fails while the server is shutting down
+func Readiness(checker *health.Checker, logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		report := checker.Check(ctx)
+
+		for name, dependency := range report.Dependencies {
+			if dependency.Err != nil {
+				logger.WarnContext(
+					ctx,
+					"dependency is unavailable",
+					slog.String("dependency", name),
+					slog.String("error", dependency.Err.Error()),
+				)
+			}
+		}
+
+		status := http.StatusOK
+		if !report.Ready() {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, report)
+	}
+}
@@ -1,17 +1,21 @@
 package jsonapi
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
 	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
 	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
 	"github.com/gin-gonic/gin"
@@ -22,20 +26,31 @@ type WalletJsonPresentation interface {
 	Authenticate(c *gin.Context)
 
 	WalletBalance(c *gin.Context)
+	WalletBalances(c *gin.Context)
 	CreditWallet(c *gin.Context)
 	DebitWallet(c *gin.Context)
+	ApplyBatch(c *gin.Context)
 }
 
 // WalletJsonAPI sets up wallet's API server presentation layer
 // with all the necessary dependencies
 type WalletJsonAPI struct {
-	Uc usecases.WalletBusinessLogic
+	Uc     usecases.WalletBusinessLogic
+	Rules  dto.Rules
+	Logger *slog.Logger
 }
 
 // NewWalletJsonAPIs initializes a new instance of wallet's JSON APIs
-func NewWalletJsonAPIs(uc usecases.WalletBusinessLogic) *WalletJsonAPI {
+// that validates credits/debits against the given rules
+func NewWalletJsonAPIs(
+	uc usecases.WalletBusinessLogic,
+	rules dto.Rules,
+	logger *slog.Logger,
+) *WalletJsonAPI {
 	w := &WalletJsonAPI{
-		Uc: uc,
+		Uc:     uc,
+		Rules:  rules,
+		Logger: logger,
 	}
 	w.checkPreconditions()
 	return w
@@ -45,73 +60,174 @@ func (p *WalletJsonAPI) checkPreconditions() {
 	if p.Uc == nil {
 		log.Panicf("presentation layer has not initialized the usecases")
 	}
-}
-
-func jsonErrorResponse(c *gin.Context, statusCode int, err string) {
-	c.JSON(statusCode, gin.H{"error": err})
+	if p.Logger == nil {
+		log.Panicf("presentation layer has not initialized the logger")
+	}
 }
 
 func getWalletID(c *gin.Context) (*int, error) {
 	strWalletID := c.Param("wallet_id")
 	if strWalletID == "" {
-		return nil, dto.Wrap(fmt.Errorf("wallet ID has not been provided"), "getWalletID")
+		return nil, dto.Wrap(
+			domain.NewError(domain.ErrValidation, "wallet ID has not been provided", nil),
+			"getWalletID",
+		)
 	}
 
 	walletID, err := strconv.Atoi(strWalletID)
 	if err != nil {
+		return nil, dto.Wrap(
+			domain.NewError(domain.ErrValidation, "wallet ID must be a whole number", err),
+			"getWalletID",
+		)
+	}
+	if err := dto.ValidWalletID(walletID); err != nil {
 		return nil, dto.Wrap(err, "getWalletID")
 	}
 
 	return &walletID, nil
 }
 
-// WalletBalance is a JSON API that retrieves a wallet's balance
+// bindJSON strictly decodes a request body, rejecting unknown fields and
+// reporting which field could not be decoded
+func bindJSON(c *gin.Context, input interface{}) error {
+	if c.Request.Body == nil {
+		return dto.FieldErrors{{Field: "body", Message: "is required"}}
+	}
+
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(input)
+	if err == nil {
+		if decoder.More() {
+			return dto.FieldErrors{{Field: "body", Message: "must be a single JSON object"}}
+		}
+		return nil
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, io.EOF):
+		return dto.FieldErrors{{Field: "body", Message: "is required"}}
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return dto.FieldErrors{{Field: typeErr.Field, Message: "must be of type " + typeErr.Type.String()}}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		return dto.FieldErrors{{Field: field, Message: "is not supported"}}
+	default:
+		return err
+	}
+}
+
+// getAsOf reads the optional as_of query parameter, the RFC 3339 moment a balance
+// is wanted at. No time is returned when the current balance is wanted
+func getAsOf(c *gin.Context) (*time.Time, error) {
+	strAsOf := c.Query("as_of")
+	if strAsOf == "" {
+		return nil, nil
+	}
+
+	asOf, err := time.Parse(time.RFC3339Nano, strAsOf)
+	if err != nil {
+		errs := dto.FieldErrors{{Field: "as_of", Message: "must be an RFC 3339 timestamp"}}
+		return nil, dto.Wrap(domain.NewError(domain.ErrValidation, errs.Error(), errs), "getAsOf")
+	}
+	if asOf.After(time.Now()) {
+		errs := dto.FieldErrors{{Field: "as_of", Message: "can not be in the future"}}
+		return nil, dto.Wrap(domain.NewError(domain.ErrValidation, errs.Error(), errs), "getAsOf")
+	}
+
+	return &asOf, nil
+}
+
+// WalletBalance is a JSON API that retrieves a wallet's balance, or the
+// balance it had at the moment passed as as_of
 func (p *WalletJsonAPI) WalletBalance(c *gin.Context) {
-	ctx := context.Background()
+	ctx := c.Request.Context()
 
 	walletID, err := getWalletID(c)
 	if err != nil {
-		jsonErrorResponse(c, http.StatusBadRequest, err.Error())
+		p.problemResponse(c, err)
+		return
+	}
+	asOf, err := getAsOf(c)
+	if err != nil {
+		p.problemResponse(c, err)
+		return
+	}
+
+	if asOf != nil {
+		wallet, err := p.Uc.WalletBalanceAsOf(ctx, *walletID, *asOf)
+		if err != nil {
+			p.problemResponse(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"wallet": wallet, "as_of": asOf})
 		return
 	}
 
 	wallet, err := p.Uc.WalletBalance(ctx, *walletID)
 	if err != nil {
-		jsonErrorResponse(c, http.StatusBadRequest, err.Error())
+		p.problemResponse(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"wallet": wallet})
 }
 
+// WalletBalances is a JSON API that retrieves the balances of many wallets at once
+func (p *WalletJsonAPI) WalletBalances(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var input dto.BulkBalanceInput
+	if err := bindJSON(c, &input); err != nil {
+		invalidRequestResponse(c, p.Logger, err)
+		return
+	}
+
+	if err := input.Valid(); err != nil {
+		p.problemResponse(c, err)
+		return
+	}
+
+	results, err := p.Uc.WalletBalances(ctx, input.WalletIDs)
+	if err != nil {
+		p.problemResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"wallets": results})
+}
+
 // CreditWallet is a JSON API that credits a wallet's balance
 func (p *WalletJsonAPI) CreditWallet(c *gin.Context) {
-	ctx := context.Background()
+	ctx := c.Request.Context()
 
 	walletID, err := getWalletID(c)
 	if err != nil {
-		jsonErrorResponse(c, http.StatusBadRequest, err.Error())
+		p.problemResponse(c, err)
 		return
 	}
 
 	var crAmountInput dto.AmountInput
-	if err := c.ShouldBindJSON(&crAmountInput); err != nil {
-		jsonErrorResponse(c, http.StatusBadRequest, err.Error())
+	if err := bindJSON(c, &crAmountInput); err != nil {
+		invalidRequestResponse(c, p.Logger, err)
 		return
 	}
 
-	if err := crAmountInput.Valid(); err != nil {
-		jsonErrorResponse(c, http.StatusBadRequest, err.Error())
+	if err := crAmountInput.Valid(p.Rules, dto.CreditOperation); err != nil {
+		p.problemResponse(c, err)
 		return
 	}
 
 	wallet, err := p.Uc.CreditWallet(
 		ctx,
 		*walletID,
-		crAmountInput.Amount,
+		crAmountInput.Amount.Decimal,
 	)
 	if err != nil {
-		jsonErrorResponse(c, http.StatusBadRequest, err.Error())
+		p.problemResponse(c, err)
 		return
 	}
 
@@ -120,38 +236,80 @@ func (p *WalletJsonAPI) CreditWallet(c *gin.Context) {
 
 // DebitWallet is a JSON API that credits a wallet's balance
 func (p *WalletJsonAPI) DebitWallet(c *gin.Context) {
-	ctx := context.Background()
+	ctx := c.Request.Context()
 
 	walletID, err := getWalletID(c)
 	if err != nil {
-		jsonErrorResponse(c, http.StatusBadRequest, err.Error())
+		p.problemResponse(c, err)
 		return
 	}
 
 	var drAmountInput dto.AmountInput
-	if err := c.ShouldBindJSON(&drAmountInput); err != nil {
-		jsonErrorResponse(c, http.StatusBadRequest, err.Error())
+	if err := bindJSON(c, &drAmountInput); err != nil {
+		invalidRequestResponse(c, p.Logger, err)
 		return
 	}
 
-	if err := drAmountInput.Valid(); err != nil {
-		jsonErrorResponse(c, http.StatusBadRequest, err.Error())
+	if err := drAmountInput.Valid(p.Rules, dto.DebitOperation); err != nil {
+		p.problemResponse(c, err)
 		return
 	}
 
 	wallet, err := p.Uc.DebitWallet(
 		ctx,
 		*walletID,
-		drAmountInput.Amount,
+		drAmountInput.Amount.Decimal,
 	)
 	if err != nil {
-		jsonErrorResponse(c, http.StatusBadRequest, err.Error())
+		p.problemResponse(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"wallet": wallet})
 }
 
+// ApplyBatch is a JSON API that credits/debits many wallets at once.
+// The idempotency key can be passed either in the body or in an Idempotency-Key header
+func (p *WalletJsonAPI) ApplyBatch(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var input dto.BatchInput
+	if err := bindJSON(c, &input); err != nil {
+		invalidRequestResponse(c, p.Logger, err)
+		return
+	}
+	if key := c.GetHeader("Idempotency-Key"); key != "" {
+		input.IdempotencyKey = key
+	}
+
+	if err := input.Valid(p.Rules); err != nil {
+		p.problemResponse(c, err)
+		return
+	}
+
+	result, err := p.Uc.ApplyBatch(ctx, input)
+	if err != nil {
+		p.problemResponse(c, err)
+		return
+	}
+
+	if !result.Applied {
+		writeProblem(
+			c,
+			newProblem(
+				c,
+				http.StatusConflict,
+				domain.CodeConflict,
+				"batch has been rejected, no operation has been applied",
+			),
+			gin.H{"batch": result},
+		)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"batch": result})
+}
+
 // Authenticate provides an authentication endpoint that returns an access token
 // to interact with the other APIs
 func (p *WalletJsonAPI) Authenticate(c *gin.Context) {
@@ -163,29 +321,32 @@ func (p *WalletJsonAPI) Authenticate(c *gin.Context) {
 	payload := strings.NewReader(params.Encode())
 
 	URL := fmt.Sprintf("https://%s/oauth/token", os.Getenv("AUTH0_DOMAIN"))
-	req, err := http.NewRequest(http.MethodPost, URL, payload)
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodPost, URL, payload)
 	if err != nil {
-		jsonErrorResponse(c, http.StatusInternalServerError, err.Error())
+		p.problemResponse(c, dto.Wrap(err, "Authenticate"))
 		return
 	}
 
 	req.Header.Set("content-type", "application/x-www-form-urlencoded")
 	res, err := http.DefaultClient.Do(req)
 	if err != nil {
-		jsonErrorResponse(c, http.StatusInternalServerError, err.Error())
+		p.problemResponse(c, dto.Wrap(
+			domain.NewError(domain.ErrUnavailable, "the identity provider is unavailable", err),
+			"Authenticate",
+		))
 		return
 	}
 
 	defer res.Body.Close()
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		jsonErrorResponse(c, http.StatusInternalServerError, err.Error())
+		p.problemResponse(c, dto.Wrap(err, "Authenticate"))
 		return
 	}
 
 	var accessToken dto.AccessToken
 	if err := json.Unmarshal(body, &accessToken); err != nil {
-		jsonErrorResponse(c, http.StatusInternalServerError, err.Error())
+		p.problemResponse(c, dto.Wrap(err, "Authenticate"))
 		return
 	}
 
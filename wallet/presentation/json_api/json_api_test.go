@@ -2,6 +2,7 @@ package jsonapi_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,9 +10,15 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
 	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
 	"github.com/ageeknamedslickback/wallet-API/wallet/presentation"
+	jsonapi "github.com/ageeknamedslickback/wallet-API/wallet/presentation/json_api"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository/mocks"
+	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
+	"github.com/gin-gonic/gin"
 	"github.com/shopspring/decimal"
 )
 
@@ -67,12 +74,20 @@ func TestWalletJsonAPI_WalletBalance(t *testing.T) {
 			wantStatusCode: http.StatusNotFound,
 		},
 		{
-			name: "sad case - bad request",
+			name: "sad case - wallet not found",
 			args: args{
-				url:    "/api/v1/0/balance",
+				url:    "/api/v1/999999/balance",
 				method: http.MethodGet,
 			},
-			wantStatusCode: http.StatusBadRequest,
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name: "sad case - invalid wallet ID",
+			args: args{
+				url:    "/api/v1/one/balance",
+				method: http.MethodGet,
+			},
+			wantStatusCode: http.StatusUnprocessableEntity,
 		},
 	}
 	for _, tt := range tests {
@@ -98,9 +113,193 @@ func TestWalletJsonAPI_WalletBalance(t *testing.T) {
 				}
 			}
 
-			if tt.wantStatusCode == http.StatusBadRequest {
-				if !strings.Contains(w.Body.String(), "error") {
-					t.Fatalf("expected error to be found in response")
+			if tt.wantStatusCode >= http.StatusBadRequest && strings.HasPrefix(tt.args.url, "/api") {
+				if w.Header().Get("Content-Type") != jsonapi.ProblemContentType {
+					t.Fatalf("expected a problem details response")
+				}
+				if !strings.Contains(w.Body.String(), `"code"`) {
+					t.Fatalf("expected error code to be found in response")
+				}
+			}
+		})
+	}
+}
+
+func TestWalletJsonAPI_WalletBalanceAsOf(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	asOf := time.Date(2022, 3, 1, 21, 3, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		url         string
+		noHistory   bool
+		wantStatus  int
+		wantCode    string
+		wantBalance string
+	}{
+		{
+			name:        "happy case - as of a past moment",
+			url:         "/api/v1/1/balance?as_of=2022-03-01T21:03:00Z",
+			wantStatus:  http.StatusOK,
+			wantBalance: "150",
+		},
+		{
+			name:        "happy case - as of now",
+			url:         "/api/v1/1/balance",
+			wantStatus:  http.StatusOK,
+			wantBalance: "200",
+		},
+		{
+			name:       "sad case - not a timestamp",
+			url:        "/api/v1/1/balance?as_of=last-tuesday",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   domain.CodeValidation,
+		},
+		{
+			name:       "sad case - in the future",
+			url:        "/api/v1/1/balance?as_of=" + time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   domain.CodeValidation,
+		},
+		{
+			name:       "sad case - no balance history",
+			url:        "/api/v1/1/balance?as_of=2022-03-01T21:03:00Z",
+			noHistory:  true,
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   domain.CodeUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			historyMockRepo := mocks.NewMockRepo()
+			historyMockRepo.MockGetBalanceAsOf = func(ctx context.Context, walletID int, at time.Time) (*domain.Wallet, error) {
+				if !at.Equal(asOf) {
+					return nil, fmt.Errorf("expected the balance as of %s but got %s", asOf, at)
+				}
+				return &domain.Wallet{ID: walletID, Balance: decimal.NewFromInt(150)}, nil
+			}
+			uc := usecases.NewWalletUsecases(mocks.NewMockRepo(), mocks.NewMockRepo(), mocks.NewMockRepo())
+			if !tt.noHistory {
+				uc.History = historyMockRepo
+			}
+			h := jsonapi.NewWalletJsonAPIs(uc, dto.Rules{}, logger)
+
+			router := gin.New()
+			router.GET("/api/v1/:wallet_id/balance", h.WalletBalance)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status code %v, but got %v: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				var problem dto.Problem
+				if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+					t.Fatal(err)
+				}
+				if problem.Code != tt.wantCode {
+					t.Fatalf("expected code %s but got %+v", tt.wantCode, problem)
+				}
+				return
+			}
+
+			var resp struct {
+				Wallet domain.Wallet `json:"wallet"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Wallet.Balance.String() != tt.wantBalance {
+				t.Fatalf("expected a balance of %s but got %s", tt.wantBalance, resp.Wallet.Balance)
+			}
+		})
+	}
+}
+
+func TestWalletJsonAPI_WalletBalances(t *testing.T) {
+	router := presentation.Router()
+
+	tooMany := make([]int, dto.MaxBulkWallets+1)
+	tooManyBs, err := json.Marshal(dto.BulkBalanceInput{WalletIDs: tooMany})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type args struct {
+		url    string
+		method string
+		body   io.Reader
+	}
+	tests := []struct {
+		name           string
+		args           args
+		wantStatusCode int
+	}{
+		{
+			name: "happy case",
+			args: args{
+				url:    "/api/v1/balances",
+				method: http.MethodPost,
+				body:   strings.NewReader(`{"wallet_ids": [1, 2, 0]}`),
+			},
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name: "sad case - no wallet IDs",
+			args: args{
+				url:    "/api/v1/balances",
+				method: http.MethodPost,
+				body:   strings.NewReader(`{"wallet_ids": []}`),
+			},
+			wantStatusCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "sad case - too many wallet IDs",
+			args: args{
+				url:    "/api/v1/balances",
+				method: http.MethodPost,
+				body:   bytes.NewBuffer(tooManyBs),
+			},
+			wantStatusCode: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			req, _ := http.NewRequest(tt.args.method, tt.args.url, tt.args.body)
+			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken(t)))
+
+			router.ServeHTTP(w, req)
+
+			if tt.wantStatusCode != w.Code {
+				t.Fatalf(
+					"expected status code %v, but got %v",
+					tt.wantStatusCode,
+					w.Code,
+				)
+			}
+
+			if tt.wantStatusCode == http.StatusOK {
+				var resp struct {
+					Wallets []dto.WalletBalanceResult `json:"wallets"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+				if len(resp.Wallets) != 3 || resp.Wallets[2].Found {
+					t.Fatalf("expected wallet 0 to be marked as not found")
+				}
+			}
+
+			if tt.wantStatusCode >= http.StatusBadRequest && strings.HasPrefix(tt.args.url, "/api") {
+				if w.Header().Get("Content-Type") != jsonapi.ProblemContentType {
+					t.Fatalf("expected a problem details response")
+				}
+				if !strings.Contains(w.Body.String(), `"code"`) {
+					t.Fatalf("expected error code to be found in response")
 				}
 			}
 		})
@@ -111,7 +310,7 @@ func TestWalletJsonAPI_CreditWallet(t *testing.T) {
 	router := presentation.Router()
 
 	crAmount := dto.AmountInput{
-		Amount: decimal.NewFromFloat(2.98),
+		Amount: decimal.NewNullDecimal(decimal.NewFromFloat(2.98)),
 	}
 	crAmountBs, err := json.Marshal(crAmount)
 	if err != nil {
@@ -149,7 +348,7 @@ func TestWalletJsonAPI_CreditWallet(t *testing.T) {
 		{
 			name: "sad case - bad request",
 			args: args{
-				url:    "/api/v1/0/credit",
+				url:    "/api/v1/3/credit",
 				method: http.MethodPost,
 				body:   nil,
 			},
@@ -179,9 +378,12 @@ func TestWalletJsonAPI_CreditWallet(t *testing.T) {
 				}
 			}
 
-			if tt.wantStatusCode == http.StatusBadRequest {
-				if !strings.Contains(w.Body.String(), "error") {
-					t.Fatalf("expected error to be found in response")
+			if tt.wantStatusCode >= http.StatusBadRequest && strings.HasPrefix(tt.args.url, "/api") {
+				if w.Header().Get("Content-Type") != jsonapi.ProblemContentType {
+					t.Fatalf("expected a problem details response")
+				}
+				if !strings.Contains(w.Body.String(), `"code"`) {
+					t.Fatalf("expected error code to be found in response")
 				}
 			}
 		})
@@ -192,7 +394,7 @@ func TestWalletJsonAPI_DebitWallet(t *testing.T) {
 	router := presentation.Router()
 
 	drAmount := dto.AmountInput{
-		Amount: decimal.NewFromFloat(2.98),
+		Amount: decimal.NewNullDecimal(decimal.NewFromFloat(2.98)),
 	}
 	drAmountBs, err := json.Marshal(drAmount)
 	if err != nil {
@@ -230,7 +432,7 @@ func TestWalletJsonAPI_DebitWallet(t *testing.T) {
 		{
 			name: "sad case - bad request",
 			args: args{
-				url:    "/api/v1/0/debit",
+				url:    "/api/v1/3/debit",
 				method: http.MethodPost,
 				body:   nil,
 			},
@@ -260,9 +462,12 @@ func TestWalletJsonAPI_DebitWallet(t *testing.T) {
 				}
 			}
 
-			if tt.wantStatusCode == http.StatusBadRequest {
-				if !strings.Contains(w.Body.String(), "error") {
-					t.Fatalf("expected error to be found in response")
+			if tt.wantStatusCode >= http.StatusBadRequest && strings.HasPrefix(tt.args.url, "/api") {
+				if w.Header().Get("Content-Type") != jsonapi.ProblemContentType {
+					t.Fatalf("expected a problem details response")
+				}
+				if !strings.Contains(w.Body.String(), `"code"`) {
+					t.Fatalf("expected error code to be found in response")
 				}
 			}
 		})
@@ -0,0 +1,18 @@
+package jsonapi
+
+import (
+	_ "embed" // embeds the OpenAPI document
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenAPIDocument is the OpenAPI 3 specification of the JSON APIs
+//
+//go:embed openapi.json
+var OpenAPIDocument []byte
+
+// OpenAPI is a JSON API that serves the OpenAPI 3 specification of the JSON APIs
+func OpenAPI(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", OpenAPIDocument)
+}
@@ -0,0 +1,128 @@
+package jsonapi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/gin-gonic/gin"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details responses
+const ProblemContentType = "application/problem+json"
+
+// Error codes that only the JSON API returns
+const (
+	// CodeInvalidRequest is the error code of requests that could not be decoded
+	CodeInvalidRequest = "invalid_request"
+	// CodeTimeout is the error code of requests that ran out of time
+	CodeTimeout = "timeout"
+	// CodeTooManyStreams is the error code of balance streams refused for
+	// exceeding the open stream limits
+	CodeTooManyStreams = "too_many_streams"
+)
+
+// statusClientClosedRequest is the (nginx) status of requests that the client gave up on
+const statusClientClosedRequest = 499
+
+// errorStatus maps an error's kind to its HTTP status
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, domain.ErrInsufficientFunds),
+		errors.Is(err, domain.ErrFrozen),
+		errors.Is(err, domain.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, domain.ErrValidation):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, domain.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func newProblem(c *gin.Context, status int, code string, detail string) dto.Problem {
+	return dto.Problem{
+		Type:     "/problems/" + code,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Code:     code,
+		Instance: c.Request.URL.Path,
+	}
+}
+
+// problemResponse responds with the problem details of an error
+func (p *WalletJsonAPI) problemResponse(c *gin.Context, err error) {
+	respondProblem(c, p.Logger, err)
+}
+
+// respondProblem responds with the problem details of an error. Only the
+// client safe detail is sent, the full error chain is logged instead
+func respondProblem(c *gin.Context, logger *slog.Logger, err error) {
+	ctx := c.Request.Context()
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		logger.WarnContext(ctx, "request timed out", slog.String("error", err.Error()))
+		writeProblem(c, newProblem(c, http.StatusGatewayTimeout, CodeTimeout, "the request timed out"), nil)
+		return
+
+	case context.Canceled:
+		// nobody is listening for a response anymore
+		c.AbortWithStatus(statusClientClosedRequest)
+		return
+	}
+
+	status := errorStatus(err)
+	if status >= http.StatusInternalServerError {
+		logger.ErrorContext(ctx, "request failed", slog.String("error", err.Error()))
+	}
+
+	writeProblem(c, newProblem(c, status, domain.ErrorCode(err), domain.ErrorDetail(err)), fieldErrors(err))
+}
+
+// invalidRequestResponse responds to a request whose body could not be decoded. The
+// decoding error can quote the body and name the input's Go types, so it is logged
+// and only the invalid fields, when known, are sent along with a fixed detail
+func invalidRequestResponse(c *gin.Context, logger *slog.Logger, err error) {
+	logger.WarnContext(c.Request.Context(), "invalid request", slog.String("error", err.Error()))
+	writeProblem(
+		c,
+		newProblem(c, http.StatusBadRequest, CodeInvalidRequest, "the request body could not be decoded"),
+		fieldErrors(err),
+	)
+}
+
+// fieldErrors lists which request fields are invalid, if the error says so
+func fieldErrors(err error) gin.H {
+	var errs dto.FieldErrors
+	if !errors.As(err, &errs) {
+		return nil
+	}
+	return gin.H{"errors": errs}
+}
+
+// writeProblem writes a problem, merging in any extension members
+func writeProblem(c *gin.Context, problem dto.Problem, extensions gin.H) {
+	body := gin.H{
+		"type":   problem.Type,
+		"title":  problem.Title,
+		"status": problem.Status,
+		"detail": problem.Detail,
+		"code":   problem.Code,
+	}
+	if problem.Instance != "" {
+		body["instance"] = problem.Instance
+	}
+	for k, v := range extensions {
+		body[k] = v
+	}
+
+	c.Header("Content-Type", ProblemContentType)
+	c.JSON(problem.Status, body)
+}
@@ -0,0 +1,296 @@
+package jsonapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	jsonapi "github.com/ageeknamedslickback/wallet-API/wallet/presentation/json_api"
+	"github.com/ageeknamedslickback/wallet-API/wallet/presentation/middleware"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository/mocks"
+	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestWalletJsonAPI_Problems(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		getErr     error
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name:       "wallet not found",
+			method:     http.MethodGet,
+			url:        "/api/v1/1/balance",
+			getErr:     domain.NewError(domain.ErrNotFound, "wallet not found", fmt.Errorf("record not found")),
+			wantStatus: http.StatusNotFound,
+			wantCode:   domain.CodeNotFound,
+		},
+		{
+			name:       "database outage",
+			method:     http.MethodGet,
+			url:        "/api/v1/1/balance",
+			getErr:     domain.NewError(domain.ErrUnavailable, "the database is unavailable", fmt.Errorf("dial tcp 10.0.0.1:3306")),
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   domain.CodeUnavailable,
+		},
+		{
+			name:       "unclassified failure",
+			method:     http.MethodGet,
+			url:        "/api/v1/1/balance",
+			getErr:     fmt.Errorf("dial tcp 10.0.0.1:3306"),
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   domain.CodeInternal,
+		},
+		{
+			name:       "insufficient funds",
+			method:     http.MethodPost,
+			url:        "/api/v1/1/credit",
+			body:       `{"amount": 1000}`,
+			wantStatus: http.StatusConflict,
+			wantCode:   domain.CodeInsufficientFunds,
+		},
+		{
+			name:       "negative amount",
+			method:     http.MethodPost,
+			url:        "/api/v1/1/debit",
+			body:       `{"amount": -1}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   domain.CodeValidation,
+		},
+		{
+			name:       "malformed body",
+			method:     http.MethodPost,
+			url:        "/api/v1/1/debit",
+			body:       `{"amount": {"value": "<script>"}}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   jsonapi.CodeInvalidRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getMockRepo := mocks.NewMockRepo()
+			if tt.getErr != nil {
+				getMockRepo.MockGetBalance = func(ctx context.Context, walletID int) (*domain.Wallet, error) {
+					return nil, tt.getErr
+				}
+			}
+			uc := usecases.NewWalletUsecases(getMockRepo, mocks.NewMockRepo(), mocks.NewMockRepo())
+			h := jsonapi.NewWalletJsonAPIs(uc, dto.Rules{}, logger)
+
+			router := gin.New()
+			router.GET("/api/v1/:wallet_id/balance", h.WalletBalance)
+			router.POST("/api/v1/:wallet_id/credit", h.CreditWallet)
+			router.POST("/api/v1/:wallet_id/debit", h.DebitWallet)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status code %v, but got %v", tt.wantStatus, w.Code)
+			}
+			if w.Header().Get("Content-Type") != jsonapi.ProblemContentType {
+				t.Fatalf("expected a problem details response")
+			}
+
+			var problem dto.Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatal(err)
+			}
+			if problem.Code != tt.wantCode || problem.Status != tt.wantStatus {
+				t.Fatalf("expected code %s but got %+v", tt.wantCode, problem)
+			}
+			if problem.Instance != tt.url {
+				t.Fatalf("expected the problem instance to be %s but got %s", tt.url, problem.Instance)
+			}
+			if strings.Contains(w.Body.String(), "dial tcp") || strings.Contains(w.Body.String(), "WalletBalance:") ||
+				strings.Contains(w.Body.String(), "script") || strings.Contains(w.Body.String(), "decimal") {
+				t.Fatalf("expected internal details not to leak but got %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestWalletJsonAPI_Timeouts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		timeouts   map[string]time.Duration
+		wantStatus int
+	}{
+		{
+			name:       "sad case - default timeout",
+			wantStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name:       "happy case - route override",
+			timeouts:   map[string]time.Duration{"GET /api/v1/:wallet_id/balance": time.Second},
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getMockRepo := mocks.NewMockRepo()
+			getMockRepo.MockGetBalance = func(ctx context.Context, walletID int) (*domain.Wallet, error) {
+				select {
+				case <-time.After(50 * time.Millisecond):
+					return &domain.Wallet{ID: walletID}, nil
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+			uc := usecases.NewWalletUsecases(getMockRepo, mocks.NewMockRepo(), mocks.NewMockRepo())
+			h := jsonapi.NewWalletJsonAPIs(uc, dto.Rules{}, logger)
+
+			router := gin.New()
+			router.Use(middleware.Timeouts(10*time.Millisecond, tt.timeouts))
+			router.GET("/api/v1/:wallet_id/balance", h.WalletBalance)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/api/v1/1/balance", nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status code %v, but got %v", tt.wantStatus, w.Code)
+			}
+			if tt.wantStatus == http.StatusGatewayTimeout && !strings.Contains(w.Body.String(), jsonapi.CodeTimeout) {
+				t.Fatalf("expected a timeout problem but got %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestWalletJsonAPI_FieldErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	rules := dto.Rules{
+		Debit:         dto.AmountLimits{Max: decimal.NewFromInt(100)},
+		DecimalPlaces: 2,
+	}
+
+	tests := []struct {
+		name       string
+		url        string
+		body       string
+		wantStatus int
+		wantCode   string
+		wantField  string
+	}{
+		{
+			name:       "missing amount",
+			url:        "/api/v1/1/debit",
+			body:       `{}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   domain.CodeValidation,
+			wantField:  "amount",
+		},
+		{
+			name:       "zero amount",
+			url:        "/api/v1/1/debit",
+			body:       `{"amount": 0}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   domain.CodeValidation,
+			wantField:  "amount",
+		},
+		{
+			name:       "too precise",
+			url:        "/api/v1/1/debit",
+			body:       `{"amount": "1.005"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   domain.CodeValidation,
+			wantField:  "amount",
+		},
+		{
+			name:       "above the debit limit",
+			url:        "/api/v1/1/debit",
+			body:       `{"amount": 100.5}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   domain.CodeValidation,
+			wantField:  "amount",
+		},
+		{
+			name:       "negative wallet ID",
+			url:        "/api/v1/-1/debit",
+			body:       `{"amount": 1}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   domain.CodeValidation,
+			wantField:  "wallet_id",
+		},
+		{
+			name:       "unknown field",
+			url:        "/api/v1/1/debit",
+			body:       `{"amount": 1, "currency": "KES"}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   jsonapi.CodeInvalidRequest,
+			wantField:  "currency",
+		},
+		{
+			name:       "wrong type",
+			url:        "/api/v1/balances",
+			body:       `{"wallet_ids": ["one"]}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   jsonapi.CodeInvalidRequest,
+			wantField:  "wallet_ids",
+		},
+		{
+			name:       "invalid bulk wallet ID",
+			url:        "/api/v1/balances",
+			body:       `{"wallet_ids": [1, 0]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   domain.CodeValidation,
+			wantField:  "wallet_ids[1]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := usecases.NewWalletUsecases(mocks.NewMockRepo(), mocks.NewMockRepo(), mocks.NewMockRepo())
+			h := jsonapi.NewWalletJsonAPIs(uc, rules, logger)
+
+			router := gin.New()
+			router.POST("/api/v1/balances", h.WalletBalances)
+			router.POST("/api/v1/:wallet_id/debit", h.DebitWallet)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, tt.url, strings.NewReader(tt.body))
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status code %v, but got %v: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+
+			var problem struct {
+				dto.Problem
+				Errors dto.FieldErrors `json:"errors"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatal(err)
+			}
+			if problem.Code != tt.wantCode {
+				t.Fatalf("expected code %s but got %+v", tt.wantCode, problem)
+			}
+			if len(problem.Errors) != 1 || !strings.HasPrefix(problem.Errors[0].Field, tt.wantField) {
+				t.Fatalf("expected %s to be invalid but got %+v", tt.wantField, problem.Errors)
+			}
+		})
+	}
+}
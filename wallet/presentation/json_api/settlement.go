@@ -0,0 +1,140 @@
+package jsonapi
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
+	"github.com/gin-gonic/gin"
+)
+
+// CSVContentType is the media type of the CSV exports
+const CSVContentType = "text/csv; charset=utf-8"
+
+// SettlementJsonAPI sets up the closed business days' presentation layer
+type SettlementJsonAPI struct {
+	Uc     usecases.SettlementBusinessLogic
+	Logger *slog.Logger
+}
+
+// NewSettlementJsonAPIs initializes a new instance of the closed business days' JSON APIs
+func NewSettlementJsonAPIs(uc usecases.SettlementBusinessLogic, logger *slog.Logger) *SettlementJsonAPI {
+	s := &SettlementJsonAPI{
+		Uc:     uc,
+		Logger: logger,
+	}
+	s.checkPreconditions()
+	return s
+}
+
+func (p *SettlementJsonAPI) checkPreconditions() {
+	if p.Uc == nil {
+		log.Panicf("presentation layer has not initialized the settlement usecases")
+	}
+	if p.Logger == nil {
+		log.Panicf("presentation layer has not initialized the logger")
+	}
+}
+
+func (p *SettlementJsonAPI) problemResponse(c *gin.Context, err error) {
+	respondProblem(c, p.Logger, err)
+}
+
+// attachCSV marks the response as a CSV file to be downloaded
+func attachCSV(c *gin.Context, filename string) {
+	c.Header("Content-Type", CSVContentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+}
+
+// SettlementReport is a JSON API that reports a closed day's closing balance and the
+// debits and credits posted to each type of ledger account over the day. With format=csv
+// the totals are exported as CSV instead
+func (p *SettlementJsonAPI) SettlementReport(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		errs := dto.FieldErrors{{Field: "format", Message: "must be json or csv"}}
+		p.problemResponse(c, domain.NewError(domain.ErrValidation, errs.Error(), errs))
+		return
+	}
+
+	report, err := p.Uc.SettlementReport(c.Request.Context(), c.Param("day"))
+	if err != nil {
+		p.problemResponse(c, err)
+		return
+	}
+
+	if format == "json" {
+		c.JSON(http.StatusOK, gin.H{"report": report})
+		return
+	}
+
+	attachCSV(c, fmt.Sprintf("settlement-%s.csv", report.Day))
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write([]string{"day", "currency", "account_type", "debits", "credits", "postings"})
+	for _, total := range report.Totals {
+		_ = w.Write([]string{
+			total.Day,
+			total.Currency,
+			total.AccountType,
+			total.Debits.String(),
+			total.Credits.String(),
+			strconv.FormatInt(total.Postings, 10),
+		})
+	}
+	w.Flush()
+}
+
+// ClosingBalances is a JSON API that exports every wallet's closing balance of a closed
+// day as CSV. The balances are streamed as they are read, so once the export has started
+// a failure can only cut it short
+func (p *SettlementJsonAPI) ClosingBalances(c *gin.Context) {
+	day := c.Param("day")
+	w := csv.NewWriter(c.Writer)
+	started := false
+	start := func() {
+		if !started {
+			attachCSV(c, fmt.Sprintf("closing-balances-%s.csv", day))
+			_ = w.Write([]string{"day", "currency", "wallet_id", "balance"})
+			started = true
+		}
+	}
+
+	err := p.Uc.ClosingBalances(c.Request.Context(), day, func(balances []domain.ClosingBalance) error {
+		start()
+		for _, balance := range balances {
+			if err := w.Write([]string{
+				balance.Day,
+				balance.Currency,
+				strconv.Itoa(balance.WalletID),
+				balance.Balance.String(),
+			}); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		return w.Error()
+	})
+	if err != nil && !started {
+		p.problemResponse(c, err)
+		return
+	}
+	if err != nil {
+		p.Logger.ErrorContext(
+			c.Request.Context(),
+			"closing balances export cut short",
+			slog.String("day", day),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	start()
+	w.Flush()
+}
@@ -0,0 +1,135 @@
+package jsonapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	jsonapi "github.com/ageeknamedslickback/wallet-API/wallet/presentation/json_api"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository/mocks"
+	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
+	"github.com/gin-gonic/gin"
+)
+
+func TestSettlementJsonAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name            string
+		url             string
+		notClosed       bool
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+		wantCode        string
+	}{
+		{
+			name:            "happy case - report",
+			url:             "/api/v1/reports/eod/2022-03-01",
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json",
+		},
+		{
+			name:            "happy case - report as csv",
+			url:             "/api/v1/reports/eod/2022-03-01?format=csv",
+			wantStatus:      http.StatusOK,
+			wantContentType: jsonapi.CSVContentType,
+			wantBody: "day,currency,account_type,debits,credits,postings\n" +
+				"2022-03-01,EUR,house,10,60,2\n" +
+				"2022-03-01,EUR,wallet,60,10,2\n",
+		},
+		{
+			name:            "happy case - closing balances",
+			url:             "/api/v1/reports/eod/2022-03-01/balances",
+			wantStatus:      http.StatusOK,
+			wantContentType: jsonapi.CSVContentType,
+			wantBody: "day,currency,wallet_id,balance\n" +
+				"2022-03-01,EUR,1,10\n" +
+				"2022-03-01,EUR,2,20\n" +
+				"2022-03-01,EUR,3,30\n",
+		},
+		{
+			name:       "sad case - unsupported format",
+			url:        "/api/v1/reports/eod/2022-03-01?format=xml",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   domain.CodeValidation,
+		},
+		{
+			name:       "sad case - invalid day",
+			url:        "/api/v1/reports/eod/yesterday/balances",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   domain.CodeValidation,
+		},
+		{
+			name:       "sad case - report of a day not closed",
+			url:        "/api/v1/reports/eod/2022-03-01",
+			notClosed:  true,
+			wantStatus: http.StatusNotFound,
+			wantCode:   domain.CodeNotFound,
+		},
+		{
+			name:       "sad case - closing balances of a day not closed",
+			url:        "/api/v1/reports/eod/2022-03-01/balances",
+			notClosed:  true,
+			wantStatus: http.StatusNotFound,
+			wantCode:   domain.CodeNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := mocks.NewMockSettlement()
+			if tt.notClosed {
+				repo.MockGetDayClose = func(ctx context.Context, day string, currency string) (*domain.DayClose, error) {
+					return nil, domain.NewError(domain.ErrNotFound, "the day has not been closed", nil)
+				}
+			}
+			h := jsonapi.NewSettlementJsonAPIs(usecases.NewSettlementUsecases(repo, "EUR"), logger)
+
+			router := gin.New()
+			router.GET("/api/v1/reports/eod/:day", h.SettlementReport)
+			router.GET("/api/v1/reports/eod/:day/balances", h.ClosingBalances)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status code %v, but got %v: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+
+			if tt.wantCode != "" {
+				var problem dto.Problem
+				if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+					t.Fatal(err)
+				}
+				if problem.Code != tt.wantCode {
+					t.Fatalf("expected error code %s but got %s", tt.wantCode, problem.Code)
+				}
+				return
+			}
+
+			if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, tt.wantContentType) {
+				t.Fatalf("expected content type %s but got %s", tt.wantContentType, contentType)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Fatalf("expected\n%s\nbut got\n%s", tt.wantBody, w.Body.String())
+			}
+			if tt.wantContentType == "application/json" {
+				var body struct {
+					Report dto.SettlementReport `json:"report"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if body.Report.Day != "2022-03-01" || body.Report.Wallets != 3 || len(body.Report.Totals) != 2 {
+					t.Fatalf("unexpected report %+v", body.Report)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package jsonapi
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/statement"
+	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
+	"github.com/gin-gonic/gin"
+)
+
+// StatementJsonAPI sets up the wallets' account statements' presentation layer
+type StatementJsonAPI struct {
+	Uc     usecases.StatementBusinessLogic
+	Logger *slog.Logger
+}
+
+// NewStatementJsonAPIs initializes a new instance of the wallets' account statements' JSON APIs
+func NewStatementJsonAPIs(uc usecases.StatementBusinessLogic, logger *slog.Logger) *StatementJsonAPI {
+	s := &StatementJsonAPI{
+		Uc:     uc,
+		Logger: logger,
+	}
+	s.checkPreconditions()
+	return s
+}
+
+func (p *StatementJsonAPI) checkPreconditions() {
+	if p.Uc == nil {
+		log.Panicf("presentation layer has not initialized the statement usecases")
+	}
+	if p.Logger == nil {
+		log.Panicf("presentation layer has not initialized the logger")
+	}
+}
+
+func (p *StatementJsonAPI) problemResponse(c *gin.Context, err error) {
+	respondProblem(c, p.Logger, err)
+}
+
+// getPeriod reads the RFC 3339 moments a statement is from, which is required,
+// and to, which is now unless it is given
+func getPeriod(c *gin.Context) (time.Time, time.Time, error) {
+	var errs dto.FieldErrors
+	parse := func(field string) time.Time {
+		moment, err := time.Parse(time.RFC3339Nano, c.Query(field))
+		if err != nil {
+			errs = append(errs, dto.FieldError{Field: field, Message: "must be an RFC 3339 timestamp"})
+		}
+		return moment
+	}
+
+	from := parse("from")
+	to := time.Now()
+	if c.Query("to") != "" {
+		to = parse("to")
+	}
+	if len(errs) > 0 {
+		return time.Time{}, time.Time{}, dto.Wrap(domain.NewError(domain.ErrValidation, errs.Error(), errs), "getPeriod")
+	}
+	return from, to, nil
+}
+
+// httpStatement only starts the response once the statement is opened, so that a
+// statement that can not be opened is still answered with a problem
+type httpStatement struct {
+	usecases.StatementWriter
+	c      *gin.Context
+	format string
+	opened bool
+}
+
+func (s *httpStatement) Open(st dto.Statement) error {
+	s.c.Header("Content-Type", statement.ContentType(s.format))
+	if s.format != statement.FormatJSON {
+		s.c.Header(
+			"Content-Disposition",
+			fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("statement-%d.%s", st.WalletID, s.format)),
+		)
+	}
+	s.c.Status(http.StatusOK)
+	s.opened = true
+	return s.StatementWriter.Open(st)
+}
+
+// Statement is a JSON API that streams a wallet's account statement from, inclusive, to,
+// exclusive: its opening balance, every ledger posting to it with the balance it left and
+// its closing balance, as JSON, CSV or OFX. Postings are streamed as they are read, so
+// once the statement has started a failure can only cut it short
+func (p *StatementJsonAPI) Statement(c *gin.Context) {
+	walletID, err := getWalletID(c)
+	if err != nil {
+		p.problemResponse(c, err)
+		return
+	}
+	from, to, err := getPeriod(c)
+	if err != nil {
+		p.problemResponse(c, err)
+		return
+	}
+
+	format := c.DefaultQuery("format", statement.FormatJSON)
+	w, err := statement.NewWriter(format, c.Writer)
+	if err != nil {
+		errs := dto.FieldErrors{{Field: "format", Message: "must be one of " + strings.Join(statement.Formats, ", ")}}
+		p.problemResponse(c, domain.NewError(domain.ErrValidation, errs.Error(), errs))
+		return
+	}
+
+	sw := &httpStatement{StatementWriter: w, c: c, format: format}
+	if err := p.Uc.Statement(c.Request.Context(), *walletID, from, to, sw); err != nil {
+		if !sw.opened {
+			p.problemResponse(c, err)
+			return
+		}
+		p.Logger.ErrorContext(
+			c.Request.Context(),
+			"statement cut short",
+			slog.Int("wallet_id", *walletID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
@@ -0,0 +1,146 @@
+package jsonapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	jsonapi "github.com/ageeknamedslickback/wallet-API/wallet/presentation/json_api"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository/mocks"
+	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
+	"github.com/gin-gonic/gin"
+)
+
+func TestStatementJsonAPI_Statement(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name            string
+		url             string
+		notFound        bool
+		wantStatus      int
+		wantContentType string
+		wantAttachment  string
+		wantBody        string
+		wantCode        string
+	}{
+		{
+			name:            "happy case - json statement",
+			url:             "/api/v1/1/statement?from=2022-03-01T00:00:00Z&to=2022-03-02T00:00:00Z",
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json",
+		},
+		{
+			name:            "happy case - csv statement",
+			url:             "/api/v1/1/statement?from=2022-03-01T00:00:00Z&to=2022-03-02T00:00:00Z&format=csv",
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/csv",
+			wantAttachment:  "statement-1.csv",
+			wantBody: "created_at,id,transaction_id,type,amount,balance\n" +
+				"2022-03-01T00:00:00Z,,,opening_balance,,200\n" +
+				"2022-03-01T00:00:00Z,1,txn1,debit,50,250\n" +
+				"2022-03-01T00:01:00Z,2,txn2,credit,-30,220\n" +
+				"2022-03-02T00:00:00Z,,,closing_balance,,220\n",
+		},
+		{
+			name:            "happy case - ofx statement",
+			url:             "/api/v1/1/statement?from=2022-03-01T00:00:00Z&to=2022-03-02T00:00:00Z&format=ofx",
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/x-ofx",
+			wantAttachment:  "statement-1.ofx",
+		},
+		{
+			name:            "happy case - statement up to now",
+			url:             "/api/v1/1/statement?from=2022-03-01T00:00:00Z",
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json",
+		},
+		{
+			name:       "sad case - missing from",
+			url:        "/api/v1/1/statement",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   domain.CodeValidation,
+		},
+		{
+			name:       "sad case - invalid to",
+			url:        "/api/v1/1/statement?from=2022-03-01T00:00:00Z&to=tomorrow",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   domain.CodeValidation,
+		},
+		{
+			name:       "sad case - unsupported format",
+			url:        "/api/v1/1/statement?from=2022-03-01T00:00:00Z&format=qif",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   domain.CodeValidation,
+		},
+		{
+			name:       "sad case - wallet not found",
+			url:        "/api/v1/1/statement?from=2022-03-01T00:00:00Z&format=csv",
+			notFound:   true,
+			wantStatus: http.StatusNotFound,
+			wantCode:   domain.CodeNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := mocks.NewMockRepo()
+			if tt.notFound {
+				repo.MockGetBalanceAsOf = func(ctx context.Context, walletID int, asOf time.Time) (*domain.Wallet, error) {
+					return nil, domain.NewError(domain.ErrNotFound, "wallet not found", nil)
+				}
+			}
+			h := jsonapi.NewStatementJsonAPIs(usecases.NewStatementUsecases(repo, mocks.NewMockPostings(), "EUR"), logger)
+
+			router := gin.New()
+			router.GET("/api/v1/:wallet_id/statement", h.Statement)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status code %v, but got %v: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+
+			if tt.wantCode != "" {
+				var problem dto.Problem
+				if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+					t.Fatal(err)
+				}
+				if problem.Code != tt.wantCode {
+					t.Fatalf("expected error code %s but got %s", tt.wantCode, problem.Code)
+				}
+				return
+			}
+
+			if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, tt.wantContentType) {
+				t.Fatalf("expected content type %s but got %s", tt.wantContentType, contentType)
+			}
+			if disposition := w.Header().Get("Content-Disposition"); !strings.Contains(disposition, tt.wantAttachment) {
+				t.Fatalf("expected the attachment %s but got %s", tt.wantAttachment, disposition)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Fatalf("expected\n%s\nbut got\n%s", tt.wantBody, w.Body.String())
+			}
+			if tt.wantContentType == "application/json" {
+				var body struct {
+					Statement dto.Statement        `json:"statement"`
+					Entries   []dto.StatementEntry `json:"entries"`
+					Closing   string               `json:"closing_balance"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if body.Statement.WalletID != 1 || len(body.Entries) != 2 || body.Closing != "220" {
+					t.Fatalf("unexpected statement %+v", body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package jsonapi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/audit"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/metrics"
+	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
+	"github.com/gin-gonic/gin"
+)
+
+// BalanceEvent is the name of the server-sent events carrying a wallet's balance
+const BalanceEvent = "balance"
+
+// StreamLimits bounds the balance streams an instance serves
+type StreamLimits struct {
+	// MaxStreams is how many streams the instance holds open at once
+	MaxStreams int
+	// MaxPerSubject is how many streams an access token subject may hold open at once
+	MaxPerSubject int
+	// MaxDuration is how long a stream is held open before it is ended for the client to reconnect
+	MaxDuration time.Duration
+	// Heartbeat is how often an idle stream is written to so that proxies keep it open
+	Heartbeat time.Duration
+	// Retry is how long clients wait before reconnecting to an ended stream
+	Retry time.Duration
+}
+
+// BalanceStreamJsonAPI streams wallet balances as server-sent events
+type BalanceStreamJsonAPI struct {
+	Uc      usecases.WalletBusinessLogic
+	Limits  StreamLimits
+	Drained <-chan struct{}
+	Logger  *slog.Logger
+
+	mu        sync.Mutex
+	open      int
+	bySubject map[string]int
+}
+
+// NewBalanceStreamJsonAPI initializes the balance streams. Open streams are
+// ended once drained is closed so that they do not hold up the shutdown
+func NewBalanceStreamJsonAPI(
+	uc usecases.WalletBusinessLogic,
+	limits StreamLimits,
+	drained <-chan struct{},
+	logger *slog.Logger,
+) *BalanceStreamJsonAPI {
+	s := &BalanceStreamJsonAPI{
+		Uc:      uc,
+		Limits:  limits,
+		Drained: drained,
+		Logger:  logger,
+
+		bySubject: map[string]int{},
+	}
+	s.checkPreconditions()
+	return s
+}
+
+func (s *BalanceStreamJsonAPI) checkPreconditions() {
+	if s.Uc == nil {
+		log.Panicf("presentation layer has not initialized usecases")
+	}
+	if s.Limits.MaxStreams <= 0 || s.Limits.MaxPerSubject <= 0 {
+		log.Panicf("balance streams have not been configured with connection limits")
+	}
+	if s.Limits.MaxDuration <= 0 || s.Limits.Heartbeat <= 0 || s.Limits.Retry <= 0 {
+		log.Panicf("balance streams have not been configured with their timings")
+	}
+	if s.Logger == nil {
+		log.Panicf("presentation layer has not initialized the logger")
+	}
+}
+
+// acquire reserves a stream for the subject, unless a limit has been reached
+func (s *BalanceStreamJsonAPI) acquire(subject string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.open >= s.Limits.MaxStreams || s.bySubject[subject] >= s.Limits.MaxPerSubject {
+		return false
+	}
+	s.open++
+	s.bySubject[subject]++
+	metrics.ObserveBalanceStreams(s.open)
+	return true
+}
+
+func (s *BalanceStreamJsonAPI) release(subject string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.open--
+	s.bySubject[subject]--
+	if s.bySubject[subject] == 0 {
+		delete(s.bySubject, subject)
+	}
+	metrics.ObserveBalanceStreams(s.open)
+}
+
+// Stream is a JSON API that sends a wallet's current balance as a server-sent
+// event followed by an event for every update to it. Streams are ended after
+// the maximum duration and when the server shuts down, clients reconnect
+func (s *BalanceStreamJsonAPI) Stream(c *gin.Context) {
+	walletID, err := getWalletID(c)
+	if err != nil {
+		respondProblem(c, s.Logger, err)
+		return
+	}
+
+	subject := audit.ActorFrom(c.Request.Context()).Subject
+	if !s.acquire(subject) {
+		writeProblem(c, newProblem(c, http.StatusTooManyRequests, CodeTooManyStreams, "too many balance streams are open"), nil)
+		return
+	}
+	defer s.release(subject)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), s.Limits.MaxDuration)
+	defer cancel()
+
+	updates, err := s.Uc.WatchBalance(ctx, *walletID)
+	if err != nil {
+		respondProblem(c, s.Logger, err)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// stops nginx from buffering the events
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", s.Limits.Retry.Milliseconds())
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(s.Limits.Heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-s.Drained:
+			return
+
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": heartbeat\n\n")
+			c.Writer.Flush()
+
+		case wallet, ok := <-updates:
+			if !ok {
+				return
+			}
+			c.SSEvent(BalanceEvent, gin.H{"wallet": wallet})
+			c.Writer.Flush()
+			heartbeat.Reset(s.Limits.Heartbeat)
+		}
+	}
+}
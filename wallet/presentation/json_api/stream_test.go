@@ -0,0 +1,174 @@
+package jsonapi_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	jsonapi "github.com/ageeknamedslickback/wallet-API/wallet/presentation/json_api"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository/mocks"
+	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+// initTestStreams serves the balance streams of wallet 1 whose balance is 200
+func initTestStreams(t *testing.T, limits jsonapi.StreamLimits, drained <-chan struct{}) (*httptest.Server, *usecases.WalletUsecases) {
+	gin.SetMode(gin.TestMode)
+
+	getMockRepo := mocks.NewMockRepo()
+	updateMockRepo := mocks.NewMockRepo()
+	getMockRepo.MockGetBalance = func(ctx context.Context, walletID int) (*domain.Wallet, error) {
+		if walletID != 1 {
+			return nil, domain.NewError(domain.ErrNotFound, "wallet not found", nil)
+		}
+		return &domain.Wallet{ID: 1, Balance: decimal.NewFromInt(200)}, nil
+	}
+	uc := usecases.NewWalletUsecases(getMockRepo, updateMockRepo, mocks.NewMockRepo())
+
+	router := gin.New()
+	router.GET("/api/v1/:wallet_id/balance/stream", jsonapi.NewBalanceStreamJsonAPI(uc, limits, drained, logger).Stream)
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	return srv, uc
+}
+
+var testLimits = jsonapi.StreamLimits{
+	MaxStreams:    10,
+	MaxPerSubject: 1,
+	MaxDuration:   5 * time.Second,
+	Heartbeat:     50 * time.Millisecond,
+	Retry:         time.Second,
+}
+
+// nextBalance reads the stream up to its next balance event
+func nextBalance(t *testing.T, r *bufio.Reader) (string, bool) {
+	heartbeat := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("expected a balance event: %v", err)
+		}
+		heartbeat = heartbeat || strings.HasPrefix(line, ": heartbeat")
+
+		if data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:"); ok {
+			var event struct {
+				Wallet domain.Wallet `json:"wallet"`
+			}
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				t.Fatal(err)
+			}
+			return event.Wallet.Balance.String(), heartbeat
+		}
+	}
+}
+
+func TestBalanceStreamJsonAPI_Stream(t *testing.T) {
+	srv, uc := initTestStreams(t, testLimits, nil)
+
+	resp, err := http.Get(srv.URL + "/api/v1/1/balance/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream but got %v %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	body := bufio.NewReader(resp.Body)
+	if balance, _ := nextBalance(t, body); balance != "200" {
+		t.Fatalf("expected the current balance first but got %s", balance)
+	}
+
+	// another stream by the same subject is over the limit
+	refused, err := http.Get(srv.URL + "/api/v1/1/balance/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused.Body.Close()
+	if refused.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected status code %v, but got %v", http.StatusTooManyRequests, refused.StatusCode)
+	}
+
+	time.Sleep(2 * testLimits.Heartbeat)
+	if _, err := uc.DebitWallet(context.Background(), 1, decimal.NewFromInt(25)); err != nil {
+		t.Fatal(err)
+	}
+	balance, heartbeat := nextBalance(t, body)
+	if balance != "225" {
+		t.Fatalf("expected the updated balance but got %s", balance)
+	}
+	if !heartbeat {
+		t.Fatalf("expected a heartbeat on the idle stream")
+	}
+}
+
+func TestBalanceStreamJsonAPI_Stream_Ends(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		drain      bool
+		wantStatus int
+	}{
+		{
+			name:       "happy case - ends on shutdown",
+			url:        "/api/v1/1/balance/stream",
+			drain:      true,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "sad case - wallet not found",
+			url:        "/api/v1/2/balance/stream",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "sad case - invalid wallet ID",
+			url:        "/api/v1/abc/balance/stream",
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			drained := make(chan struct{})
+			srv, _ := initTestStreams(t, testLimits, drained)
+
+			resp, err := http.Get(srv.URL + tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("expected status code %v, but got %v", tt.wantStatus, resp.StatusCode)
+			}
+			if !tt.drain {
+				return
+			}
+
+			body := bufio.NewReader(resp.Body)
+			nextBalance(t, body)
+			close(drained)
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for {
+					if _, err := body.ReadString('\n'); err != nil {
+						return
+					}
+				}
+			}()
+			select {
+			case <-done:
+			case <-time.After(2 * time.Second):
+				t.Fatalf("expected the stream to end on shutdown")
+			}
+		})
+	}
+}
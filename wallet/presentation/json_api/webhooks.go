@@ -0,0 +1,140 @@
+package jsonapi
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/audit"
+	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
+	"github.com/gin-gonic/gin"
+)
+
+// WebhookJsonAPI sets up the webhook subscriptions' presentation layer.
+// Subscriptions belong to the subject of the access token that created them
+type WebhookJsonAPI struct {
+	Uc     usecases.WebhookBusinessLogic
+	Logger *slog.Logger
+}
+
+// NewWebhookJsonAPIs initializes a new instance of the webhook subscriptions' JSON APIs
+func NewWebhookJsonAPIs(uc usecases.WebhookBusinessLogic, logger *slog.Logger) *WebhookJsonAPI {
+	w := &WebhookJsonAPI{
+		Uc:     uc,
+		Logger: logger,
+	}
+	w.checkPreconditions()
+	return w
+}
+
+func (p *WebhookJsonAPI) checkPreconditions() {
+	if p.Uc == nil {
+		log.Panicf("presentation layer has not initialized the webhook usecases")
+	}
+	if p.Logger == nil {
+		log.Panicf("presentation layer has not initialized the logger")
+	}
+}
+
+func (p *WebhookJsonAPI) problemResponse(c *gin.Context, err error) {
+	respondProblem(c, p.Logger, err)
+}
+
+func getWebhookID(c *gin.Context) (uint64, error) {
+	id, err := strconv.ParseUint(c.Param("webhook_id"), 10, 64)
+	if err != nil || id == 0 {
+		return 0, dto.Wrap(
+			domain.NewError(
+				domain.ErrValidation,
+				"webhook_id must be a positive whole number",
+				dto.FieldErrors{{Field: "webhook_id", Message: "must be a positive whole number"}},
+			),
+			"getWebhookID",
+		)
+	}
+	return id, nil
+}
+
+func owner(c *gin.Context) string {
+	return audit.ActorFrom(c.Request.Context()).Subject
+}
+
+// CreateSubscription is a JSON API that subscribes a webhook to event types.
+// The signing secret is only returned in this response
+func (p *WebhookJsonAPI) CreateSubscription(c *gin.Context) {
+	var input dto.WebhookSubscriptionInput
+	if err := bindJSON(c, &input); err != nil {
+		invalidRequestResponse(c, p.Logger, err)
+		return
+	}
+
+	sub, err := p.Uc.Subscribe(c.Request.Context(), owner(c), input)
+	if err != nil {
+		p.problemResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"subscription": sub})
+}
+
+// Subscriptions is a JSON API that lists the caller's webhook subscriptions
+func (p *WebhookJsonAPI) Subscriptions(c *gin.Context) {
+	subs, err := p.Uc.Subscriptions(c.Request.Context(), owner(c))
+	if err != nil {
+		p.problemResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"subscriptions": subs})
+}
+
+// DeleteSubscription is a JSON API that unsubscribes one of the caller's webhooks
+func (p *WebhookJsonAPI) DeleteSubscription(c *gin.Context) {
+	id, err := getWebhookID(c)
+	if err != nil {
+		p.problemResponse(c, err)
+		return
+	}
+
+	if err := p.Uc.Unsubscribe(c.Request.Context(), owner(c), id); err != nil {
+		p.problemResponse(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Deliveries is a JSON API that lists the latest deliveries to one of the
+// caller's webhooks, newest first, including the dead lettered ones
+func (p *WebhookJsonAPI) Deliveries(c *gin.Context) {
+	id, err := getWebhookID(c)
+	if err != nil {
+		p.problemResponse(c, err)
+		return
+	}
+
+	limit := usecases.MaxDeliveries
+	if l := c.Query("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 || limit > usecases.MaxDeliveries {
+			errs := dto.FieldErrors{{
+				Field:   "limit",
+				Message: fmt.Sprintf("must be a whole number between 1 and %d", usecases.MaxDeliveries),
+			}}
+			p.problemResponse(c, domain.NewError(domain.ErrValidation, errs.Error(), errs))
+			return
+		}
+	}
+
+	deliveries, err := p.Uc.Deliveries(c.Request.Context(), owner(c), id, limit)
+	if err != nil {
+		p.problemResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"net"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/audit"
+	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
+	"github.com/auth0/go-jwt-middleware/v2/validator"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/peer"
+)
+
+// Actor is a middleware that tags the request with who is calling, the subject
+// of its validated access token, and from which IP so that audited actions can
+// be attributed. It has to run after the JWT has been validated
+func Actor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		c.Request = c.Request.WithContext(audit.WithActor(ctx, audit.Actor{
+			Subject: subject(ctx),
+			IP:      c.ClientIP(),
+		}))
+		c.Next()
+	}
+}
+
+// grpcActor tags a gRPC call with who is calling and from which IP
+func grpcActor(ctx context.Context) context.Context {
+	ip := ""
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		ip = p.Addr.String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+	}
+
+	return audit.WithActor(ctx, audit.Actor{
+		Subject: subject(ctx),
+		IP:      ip,
+	})
+}
+
+// subject is the subject of the validated access token, if any
+func subject(ctx context.Context) string {
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok {
+		return ""
+	}
+	return claims.RegisteredClaims.Subject
+}
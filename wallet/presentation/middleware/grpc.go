@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/logging"
+
+	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryAuthInterceptor is a gRPC interceptor that will check the validity of our JWT
+// for every unary call. The token is passed in the authorization metadata
+func UnaryAuthInterceptor(validateToken TokenValidator, logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		ctx, err := authorize(ctx, validateToken, logger)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamAuthInterceptor is a gRPC interceptor that will check the validity of our JWT
+// for every streaming call. The token is passed in the authorization metadata
+func StreamAuthInterceptor(validateToken TokenValidator, logger *slog.Logger) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx, err := authorize(ss.Context(), validateToken, logger)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authorizedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authorize validates the bearer token and stores its claims, and the actor
+// they identify, in the context the same way the JSON API's middlewares do. The call is tagged with the
+// caller's x-request-id, or a generated one, so that its logs can be correlated
+func authorize(ctx context.Context, validateToken TokenValidator, logger *slog.Logger) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	requestID := ""
+	if ids := md.Get(RequestIDHeader); len(ids) > 0 {
+		requestID = ids[0]
+	}
+	if !validRequestID.MatchString(requestID) {
+		requestID = newRequestID()
+	}
+	ctx = logging.WithRequestID(ctx, requestID)
+
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "Unauthorized.")
+	}
+
+	token := strings.TrimSpace(strings.TrimPrefix(values[0], "Bearer"))
+	claims, err := validateToken(ctx, token)
+	if err != nil {
+		logger.WarnContext(ctx, "invalid JWT", slog.String("error", err.Error()))
+		return nil, status.Error(codes.Unauthenticated, "Unauthorized.")
+	}
+
+	return grpcActor(context.WithValue(ctx, jwtmiddleware.ContextKey{}, claims)), nil
+}
+
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context carrying the validated claims
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
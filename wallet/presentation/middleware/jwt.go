@@ -2,12 +2,16 @@ package middleware
 
 import (
 	"context"
+	"encoding/json"
 	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"time"
 
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/tracing"
 	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
 	"github.com/auth0/go-jwt-middleware/v2/jwks"
 	"github.com/auth0/go-jwt-middleware/v2/validator"
@@ -24,14 +28,25 @@ func (c CustomClaims) Validate(ctx context.Context) error {
 	return nil
 }
 
-// EnsureValidToken is a middleware that will check the validity of our JWT.
-func EnsureValidToken() func(next http.Handler) http.Handler {
-	issuerURL, err := url.Parse("https://" + os.Getenv("AUTH0_DOMAIN") + "/")
+// TokenValidator validates a JWT and returns its claims
+type TokenValidator func(ctx context.Context, token string) (interface{}, error)
+
+// JWKSCacheTTL is how long the JSON Web Key Set fetched from the issuer is cached for
+const JWKSCacheTTL = 5 * time.Minute
+
+// IssuerURL is the Auth0 tenant that issues the access tokens
+func IssuerURL() string {
+	return "https://" + os.Getenv("AUTH0_DOMAIN") + "/"
+}
+
+// NewTokenValidator sets up the Auth0 JWT validator shared by the JSON and gRPC APIs
+func NewTokenValidator() TokenValidator {
+	issuerURL, err := url.Parse(IssuerURL())
 	if err != nil {
 		log.Fatalf("Failed to parse the issuer url: %v", err)
 	}
 
-	provider := jwks.NewCachingProvider(issuerURL, 5*time.Minute)
+	provider := jwks.NewCachingProvider(issuerURL, JWKSCacheTTL)
 
 	jwtValidator, err := validator.New(
 		provider.KeyFunc,
@@ -49,16 +64,38 @@ func EnsureValidToken() func(next http.Handler) http.Handler {
 		log.Fatalf("Failed to set up the jwt validator")
 	}
 
+	return func(ctx context.Context, token string) (interface{}, error) {
+		// the JWKS are fetched from Auth0 the first time and whenever they expire
+		ctx, span := tracing.Start(ctx, "auth0.ValidateToken")
+		claims, err := jwtValidator.ValidateToken(ctx, token)
+		tracing.End(span, err)
+		return claims, err
+	}
+}
+
+// EnsureValidToken is a middleware that will check the validity of our JWT.
+func EnsureValidToken(logger *slog.Logger) func(next http.Handler) http.Handler {
+	validateToken := NewTokenValidator()
+
 	errorHandler := func(w http.ResponseWriter, r *http.Request, err error) {
-		log.Printf("Encountered error while validating JWT: %v", err)
+		logger.WarnContext(r.Context(), "invalid JWT", slog.String("error", err.Error()))
+
+		bs, _ := json.Marshal(dto.Problem{
+			Type:     "/problems/unauthorized",
+			Title:    http.StatusText(http.StatusUnauthorized),
+			Status:   http.StatusUnauthorized,
+			Detail:   "Unauthorized.",
+			Code:     "unauthorized",
+			Instance: r.URL.Path,
+		})
 
-		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Type", "application/problem+json")
 		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte(`{"error":"Unauthorized."}`))
+		w.Write(bs)
 	}
 
 	middleware := jwtmiddleware.New(
-		jwtValidator.ValidateToken,
+		jwtmiddleware.ValidateToken(validateToken),
 		jwtmiddleware.WithErrorHandler(errorHandler),
 	)
 
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader is the header a request ID is accepted from and returned in
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID keeps request IDs passed by clients short and safe to log
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID is a middleware that tags every request with the caller's X-Request-ID,
+// or a generated one, so that its logs can be correlated
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+
+		c.Header(RequestIDHeader, requestID)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), requestID))
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	bs := make([]byte, 16)
+	if _, err := rand.Read(bs); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(bs)
+}
+
+// Logger is a middleware that logs every request once it has been served.
+// The request headers are only logged at debug level, with credentials redacted
+func Logger(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("user_agent", c.Request.UserAgent()),
+		}
+		if errs := c.Errors.String(); errs != "" {
+			attrs = append(attrs, slog.String("errors", errs))
+		}
+		if logger.Enabled(c.Request.Context(), slog.LevelDebug) {
+			attrs = append(attrs, headers(c.Request.Header))
+		}
+
+		logger.LogAttrs(c.Request.Context(), level, "request served", attrs...)
+	}
+}
+
+func headers(header http.Header) slog.Attr {
+	attrs := make([]any, 0, len(header))
+	for name, values := range header {
+		if len(values) == 1 {
+			attrs = append(attrs, slog.String(name, values[0]))
+			continue
+		}
+		attrs = append(attrs, slog.Any(name, values))
+	}
+	return slog.Group("headers", attrs...)
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// unmatchedRoute labels requests that did not match any route so that
+// arbitrary paths can not blow up the number of time series
+const unmatchedRoute = "unmatched"
+
+// Metrics is a middleware that records the count and latency of every request
+// by route, method and status
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		metrics.ObserveRequest(route, c.Request.Method, c.Writer.Status(), time.Since(start))
+	}
+}
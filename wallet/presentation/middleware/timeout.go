@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Timeouts is a middleware that bounds how long a request may take. Every route
+// gets the default timeout unless it is overridden for its "<METHOD> <route>" key,
+// e.g. "POST /api/v1/batch". Handlers must pass on the request's context for the
+// deadline to cancel their database and cache calls
+func Timeouts(defaultTimeout time.Duration, overrides map[string]time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout := defaultTimeout
+		if override, ok := overrides[c.Request.Method+" "+c.FullPath()]; ok {
+			timeout = override
+		}
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
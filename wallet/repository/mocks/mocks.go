@@ -2,22 +2,52 @@ package mocks
 
 import (
 	"context"
+	"time"
 
 	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository"
 	"github.com/shopspring/decimal"
 )
 
+// ChangeBalance changes a wallet's balance by the ledger transaction's postings on it the
+// way the database layer does, refusing to take money out of it below zero
+func ChangeBalance(wallet *domain.Wallet, txn *domain.LedgerTransaction) (*domain.Wallet, error) {
+	change := txn.Change(domain.WalletAccount(wallet.ID))
+	balance := wallet.Balance.Add(change)
+	if change.IsNegative() && balance.IsNegative() {
+		return nil, domain.NewError(domain.ErrInsufficientFunds, "a wallet balance cannot go below 0", nil)
+	}
+	return &domain.Wallet{ID: wallet.ID, Balance: balance, Frozen: wallet.Frozen}, nil
+}
+
 // MockRepo creates a mock the repository layer
 type MockRepo struct {
 	MockGetBalance func(
 		ctx context.Context,
 		walletID int,
 	) (*domain.Wallet, error)
+	MockGetBalances func(
+		ctx context.Context,
+		walletIDs []int,
+	) (map[int]*domain.Wallet, error)
+	MockGetBalanceAsOf func(
+		ctx context.Context,
+		walletID int,
+		asOf time.Time,
+	) (*domain.Wallet, error)
 	MockUpdateBalance func(
 		ctx context.Context,
 		wallet *domain.Wallet,
-		balance decimal.Decimal,
+		txn *domain.LedgerTransaction,
 	) (*domain.Wallet, error)
+	MockGetBatch func(
+		ctx context.Context,
+		idempotencyKey string,
+	) (*domain.Batch, error)
+	MockTransact func(
+		ctx context.Context,
+		fn func(tx repository.Tx) error,
+	) error
 }
 
 // NewMockRepo inits a new instance of repository mocks with happy cases pre-defined
@@ -28,9 +58,19 @@ func NewMockRepo() *MockRepo {
 	}
 	return &MockRepo{
 		MockGetBalance: func(ctx context.Context, walletID int) (*domain.Wallet, error) { return wallet, nil },
-		MockUpdateBalance: func(ctx context.Context, wallet *domain.Wallet, balance decimal.Decimal) (*domain.Wallet, error) {
+		MockGetBalances: func(ctx context.Context, walletIDs []int) (map[int]*domain.Wallet, error) {
+			return map[int]*domain.Wallet{wallet.ID: wallet}, nil
+		},
+		MockGetBalanceAsOf: func(ctx context.Context, walletID int, asOf time.Time) (*domain.Wallet, error) {
 			return wallet, nil
 		},
+		MockUpdateBalance: func(ctx context.Context, wallet *domain.Wallet, txn *domain.LedgerTransaction) (*domain.Wallet, error) {
+			return ChangeBalance(wallet, txn)
+		},
+		MockGetBatch: func(ctx context.Context, idempotencyKey string) (*domain.Batch, error) { return nil, nil },
+		MockTransact: func(ctx context.Context, fn func(tx repository.Tx) error) error {
+			return fn(NewMockTx())
+		},
 	}
 }
 
@@ -42,11 +82,411 @@ func (m *MockRepo) GetBalance(
 	return m.MockGetBalance(ctx, walletID)
 }
 
+// GetBalances mocks GetBalances
+func (m *MockRepo) GetBalances(
+	ctx context.Context,
+	walletIDs []int,
+) (map[int]*domain.Wallet, error) {
+	return m.MockGetBalances(ctx, walletIDs)
+}
+
+// GetBalanceAsOf mocks GetBalanceAsOf
+func (m *MockRepo) GetBalanceAsOf(
+	ctx context.Context,
+	walletID int,
+	asOf time.Time,
+) (*domain.Wallet, error) {
+	return m.MockGetBalanceAsOf(ctx, walletID, asOf)
+}
+
 // UpdateBalance mocks UpdateBalance
 func (m *MockRepo) UpdateBalance(
 	ctx context.Context,
 	wallet *domain.Wallet,
-	balance decimal.Decimal,
+	txn *domain.LedgerTransaction,
 ) (*domain.Wallet, error) {
-	return m.MockUpdateBalance(ctx, wallet, balance)
+	return m.MockUpdateBalance(ctx, wallet, txn)
+}
+
+// GetBatch mocks GetBatch
+func (m *MockRepo) GetBatch(
+	ctx context.Context,
+	idempotencyKey string,
+) (*domain.Batch, error) {
+	return m.MockGetBatch(ctx, idempotencyKey)
+}
+
+// Transact mocks Transact
+func (m *MockRepo) Transact(
+	ctx context.Context,
+	fn func(tx repository.Tx) error,
+) error {
+	return m.MockTransact(ctx, fn)
+}
+
+// MockTx creates a mock of a repository transaction
+type MockTx struct {
+	MockUpdateBalance func(
+		ctx context.Context,
+		wallet *domain.Wallet,
+		txn *domain.LedgerTransaction,
+	) (*domain.Wallet, error)
+	MockClaimBatch func(
+		ctx context.Context,
+		batch *domain.Batch,
+	) (bool, error)
+	MockSaveBatch func(
+		ctx context.Context,
+		batch *domain.Batch,
+	) error
+	MockLockWallets func(
+		ctx context.Context,
+		walletIDs []int,
+	) (map[int]*domain.Wallet, error)
+	MockAdjustBalance func(
+		ctx context.Context,
+		wallet *domain.Wallet,
+		txn *domain.LedgerTransaction,
+		reason string,
+	) (*domain.Wallet, error)
+	MockCreateWallet func(
+		ctx context.Context,
+		reason string,
+	) (*domain.Wallet, error)
+}
+
+// NewMockTx inits a new instance of transaction mocks with happy cases pre-defined
+func NewMockTx() *MockTx {
+	return &MockTx{
+		MockUpdateBalance: func(ctx context.Context, wallet *domain.Wallet, txn *domain.LedgerTransaction) (*domain.Wallet, error) {
+			return ChangeBalance(wallet, txn)
+		},
+		MockClaimBatch: func(ctx context.Context, batch *domain.Batch) (bool, error) { return true, nil },
+		MockSaveBatch:  func(ctx context.Context, batch *domain.Batch) error { return nil },
+		MockLockWallets: func(ctx context.Context, walletIDs []int) (map[int]*domain.Wallet, error) {
+			return map[int]*domain.Wallet{
+				1: {ID: 1, Balance: decimal.NewFromFloat(200)},
+			}, nil
+		},
+		MockAdjustBalance: func(ctx context.Context, wallet *domain.Wallet, txn *domain.LedgerTransaction, reason string) (*domain.Wallet, error) {
+			return ChangeBalance(wallet, txn)
+		},
+		MockCreateWallet: func(ctx context.Context, reason string) (*domain.Wallet, error) {
+			return &domain.Wallet{ID: 1, Balance: decimal.Zero}, nil
+		},
+	}
+}
+
+// UpdateBalance mocks UpdateBalance
+func (m *MockTx) UpdateBalance(
+	ctx context.Context,
+	wallet *domain.Wallet,
+	txn *domain.LedgerTransaction,
+) (*domain.Wallet, error) {
+	return m.MockUpdateBalance(ctx, wallet, txn)
+}
+
+// ClaimBatch mocks ClaimBatch
+func (m *MockTx) ClaimBatch(
+	ctx context.Context,
+	batch *domain.Batch,
+) (bool, error) {
+	return m.MockClaimBatch(ctx, batch)
+}
+
+// SaveBatch mocks SaveBatch
+func (m *MockTx) SaveBatch(
+	ctx context.Context,
+	batch *domain.Batch,
+) error {
+	return m.MockSaveBatch(ctx, batch)
+}
+
+// LockWallets mocks LockWallets
+func (m *MockTx) LockWallets(
+	ctx context.Context,
+	walletIDs []int,
+) (map[int]*domain.Wallet, error) {
+	return m.MockLockWallets(ctx, walletIDs)
+}
+
+// AdjustBalance mocks AdjustBalance
+func (m *MockTx) AdjustBalance(
+	ctx context.Context,
+	wallet *domain.Wallet,
+	txn *domain.LedgerTransaction,
+	reason string,
+) (*domain.Wallet, error) {
+	return m.MockAdjustBalance(ctx, wallet, txn, reason)
+}
+
+// CreateWallet mocks CreateWallet
+func (m *MockTx) CreateWallet(
+	ctx context.Context,
+	reason string,
+) (*domain.Wallet, error) {
+	return m.MockCreateWallet(ctx, reason)
+}
+
+// MockAdmin creates a mock of the operators' actions on wallets
+type MockAdmin struct {
+	MockSetFrozen func(
+		ctx context.Context,
+		walletID int,
+		frozen bool,
+		reason string,
+	) (*domain.Wallet, error)
+}
+
+// NewMockAdmin inits a new instance of admin mocks with happy cases pre-defined.
+// Wallet 1 holds 200
+func NewMockAdmin() *MockAdmin {
+	return &MockAdmin{
+		MockSetFrozen: func(ctx context.Context, walletID int, frozen bool, reason string) (*domain.Wallet, error) {
+			return &domain.Wallet{ID: walletID, Balance: decimal.NewFromFloat(200), Frozen: frozen}, nil
+		},
+	}
+}
+
+// SetFrozen mocks SetFrozen
+func (m *MockAdmin) SetFrozen(
+	ctx context.Context,
+	walletID int,
+	frozen bool,
+	reason string,
+) (*domain.Wallet, error) {
+	return m.MockSetFrozen(ctx, walletID, frozen, reason)
+}
+
+// MockWebhooks creates a mock of the webhook subscriptions repository
+type MockWebhooks struct {
+	MockCreateSubscription func(
+		ctx context.Context,
+		sub *domain.WebhookSubscription,
+	) error
+	MockGetSubscription func(
+		ctx context.Context,
+		id uint64,
+	) (*domain.WebhookSubscription, error)
+	MockListSubscriptions func(
+		ctx context.Context,
+		owner string,
+	) ([]domain.WebhookSubscription, error)
+	MockDeleteSubscription func(
+		ctx context.Context,
+		id uint64,
+	) error
+	MockListDeliveries func(
+		ctx context.Context,
+		subscriptionID uint64,
+		limit int,
+	) ([]domain.WebhookDelivery, error)
+}
+
+// NewMockWebhooks inits a new instance of webhook subscription mocks with happy cases
+// pre-defined. Subscription 1 belongs to "owner"
+func NewMockWebhooks() *MockWebhooks {
+	sub := &domain.WebhookSubscription{
+		ID:         1,
+		URL:        "https://partner.example.com/webhooks",
+		EventTypes: domain.EventWalletCredited,
+		Secret:     "a-very-secret-secret",
+		CreatedBy:  "owner",
+	}
+	return &MockWebhooks{
+		MockCreateSubscription: func(ctx context.Context, s *domain.WebhookSubscription) error {
+			s.ID = 2
+			return nil
+		},
+		MockGetSubscription: func(ctx context.Context, id uint64) (*domain.WebhookSubscription, error) {
+			if id != sub.ID {
+				return nil, domain.NewError(domain.ErrNotFound, "webhook subscription not found", nil)
+			}
+			return sub, nil
+		},
+		MockListSubscriptions: func(ctx context.Context, owner string) ([]domain.WebhookSubscription, error) {
+			return []domain.WebhookSubscription{*sub}, nil
+		},
+		MockDeleteSubscription: func(ctx context.Context, id uint64) error { return nil },
+		MockListDeliveries: func(ctx context.Context, subscriptionID uint64, limit int) ([]domain.WebhookDelivery, error) {
+			return []domain.WebhookDelivery{{ID: 1, SubscriptionID: subscriptionID, Status: domain.DeliveryDelivered}}, nil
+		},
+	}
+}
+
+// CreateSubscription mocks CreateSubscription
+func (m *MockWebhooks) CreateSubscription(
+	ctx context.Context,
+	sub *domain.WebhookSubscription,
+) error {
+	return m.MockCreateSubscription(ctx, sub)
+}
+
+// GetSubscription mocks GetSubscription
+func (m *MockWebhooks) GetSubscription(
+	ctx context.Context,
+	id uint64,
+) (*domain.WebhookSubscription, error) {
+	return m.MockGetSubscription(ctx, id)
+}
+
+// ListSubscriptions mocks ListSubscriptions
+func (m *MockWebhooks) ListSubscriptions(
+	ctx context.Context,
+	owner string,
+) ([]domain.WebhookSubscription, error) {
+	return m.MockListSubscriptions(ctx, owner)
+}
+
+// DeleteSubscription mocks DeleteSubscription
+func (m *MockWebhooks) DeleteSubscription(
+	ctx context.Context,
+	id uint64,
+) error {
+	return m.MockDeleteSubscription(ctx, id)
+}
+
+// ListDeliveries mocks ListDeliveries
+func (m *MockWebhooks) ListDeliveries(
+	ctx context.Context,
+	subscriptionID uint64,
+	limit int,
+) ([]domain.WebhookDelivery, error) {
+	return m.MockListDeliveries(ctx, subscriptionID, limit)
+}
+
+// MockSettlement creates a mock of the closed business days repository
+type MockSettlement struct {
+	MockGetDayClose func(
+		ctx context.Context,
+		day string,
+		currency string,
+	) (*domain.DayClose, error)
+	MockListSettlementTotals func(
+		ctx context.Context,
+		day string,
+		currency string,
+	) ([]domain.SettlementTotal, error)
+	MockListClosingBalances func(
+		ctx context.Context,
+		day string,
+		currency string,
+		afterWalletID int,
+		limit int,
+	) ([]domain.ClosingBalance, error)
+}
+
+// NewMockSettlement inits a new instance of closed business day mocks with happy cases
+// pre-defined. Every day has been closed with wallets 1 to 3
+func NewMockSettlement() *MockSettlement {
+	return &MockSettlement{
+		MockGetDayClose: func(ctx context.Context, day string, currency string) (*domain.DayClose, error) {
+			return &domain.DayClose{
+				Day:            day,
+				Currency:       currency,
+				Wallets:        3,
+				ClosingBalance: decimal.NewFromInt(60),
+			}, nil
+		},
+		MockListSettlementTotals: func(ctx context.Context, day string, currency string) ([]domain.SettlementTotal, error) {
+			return []domain.SettlementTotal{
+				{Day: day, Currency: currency, AccountType: domain.AccountHouse, Debits: decimal.NewFromInt(10), Credits: decimal.NewFromInt(60), Postings: 2},
+				{Day: day, Currency: currency, AccountType: domain.AccountTypeWallet, Debits: decimal.NewFromInt(60), Credits: decimal.NewFromInt(10), Postings: 2},
+			}, nil
+		},
+		MockListClosingBalances: func(
+			ctx context.Context,
+			day string,
+			currency string,
+			afterWalletID int,
+			limit int,
+		) ([]domain.ClosingBalance, error) {
+			var balances []domain.ClosingBalance
+			for walletID := afterWalletID + 1; walletID <= 3 && len(balances) < limit; walletID++ {
+				balances = append(balances, domain.ClosingBalance{
+					Day:      day,
+					Currency: currency,
+					WalletID: walletID,
+					Balance:  decimal.NewFromInt(int64(walletID * 10)),
+				})
+			}
+			return balances, nil
+		},
+	}
+}
+
+// GetDayClose mocks GetDayClose
+func (m *MockSettlement) GetDayClose(
+	ctx context.Context,
+	day string,
+	currency string,
+) (*domain.DayClose, error) {
+	return m.MockGetDayClose(ctx, day, currency)
+}
+
+// ListSettlementTotals mocks ListSettlementTotals
+func (m *MockSettlement) ListSettlementTotals(
+	ctx context.Context,
+	day string,
+	currency string,
+) ([]domain.SettlementTotal, error) {
+	return m.MockListSettlementTotals(ctx, day, currency)
+}
+
+// ListClosingBalances mocks ListClosingBalances
+func (m *MockSettlement) ListClosingBalances(
+	ctx context.Context,
+	day string,
+	currency string,
+	afterWalletID int,
+	limit int,
+) ([]domain.ClosingBalance, error) {
+	return m.MockListClosingBalances(ctx, day, currency, afterWalletID, limit)
+}
+
+// MockPostings creates a mock of the ledger postings repository
+type MockPostings struct {
+	MockListPostings func(
+		ctx context.Context,
+		account string,
+		from time.Time,
+		to time.Time,
+		after *domain.Posting,
+		limit int,
+	) ([]domain.Posting, error)
+}
+
+// NewMockPostings inits a new instance of ledger postings mocks with happy cases
+// pre-defined. Every account has been debited 50 and credited 30
+func NewMockPostings() *MockPostings {
+	return &MockPostings{
+		MockListPostings: func(
+			ctx context.Context,
+			account string,
+			from time.Time,
+			to time.Time,
+			after *domain.Posting,
+			limit int,
+		) ([]domain.Posting, error) {
+			if after != nil {
+				return nil, nil
+			}
+			return []domain.Posting{
+				{ID: 1, TransactionID: "txn1", Account: account, Amount: decimal.NewFromInt(50), CreatedAt: from},
+				{ID: 2, TransactionID: "txn2", Account: account, Amount: decimal.NewFromInt(-30), CreatedAt: from.Add(time.Minute)},
+			}, nil
+		},
+	}
+}
+
+// ListPostings mocks ListPostings
+func (m *MockPostings) ListPostings(
+	ctx context.Context,
+	account string,
+	from time.Time,
+	to time.Time,
+	after *domain.Posting,
+	limit int,
+) ([]domain.Posting, error) {
+	return m.MockListPostings(ctx, account, from, to, after, limit)
 }
@@ -2,9 +2,9 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
-	"github.com/shopspring/decimal"
 )
 
 // Get represents a contract for all GET operations in the infra database layer
@@ -13,13 +13,152 @@ type Get interface {
 		ctx context.Context,
 		walletID int,
 	) (*domain.Wallet, error)
+	GetBalances(
+		ctx context.Context,
+		walletIDs []int,
+	) (map[int]*domain.Wallet, error)
+}
+
+// History represents a contract for reading balances as they were in the past
+type History interface {
+	GetBalanceAsOf(
+		ctx context.Context,
+		walletID int,
+		asOf time.Time,
+	) (*domain.Wallet, error)
 }
 
-// Update represents a contract for all UPDATE operations in the infra database layer
+// Postings represents a contract for reading a ledger account's postings over a period.
+// Postings are read in the order they were made, a page at a time after the given posting
+type Postings interface {
+	ListPostings(
+		ctx context.Context,
+		account string,
+		from time.Time,
+		to time.Time,
+		after *domain.Posting,
+		limit int,
+	) ([]domain.Posting, error)
+}
+
+// Update represents a contract for all UPDATE operations in the infra database layer.
+// A wallet's balance is changed by the ledger transaction's postings on it, applied to
+// the balance the wallet has once it is locked, and posted to the ledger with them
 type Update interface {
 	UpdateBalance(
 		ctx context.Context,
 		wallet *domain.Wallet,
-		balance decimal.Decimal,
+		txn *domain.LedgerTransaction,
+	) (*domain.Wallet, error)
+}
+
+// Batch represents a contract for applying many balance changes at once
+type Batch interface {
+	GetBatch(
+		ctx context.Context,
+		idempotencyKey string,
+	) (*domain.Batch, error)
+	Transact(
+		ctx context.Context,
+		fn func(tx Tx) error,
+	) error
+}
+
+// Tx represents a contract for the operations that run inside a database transaction.
+// Balances updated in a transaction are only cached once it has been committed
+type Tx interface {
+	Update
+
+	ClaimBatch(
+		ctx context.Context,
+		batch *domain.Batch,
+	) (bool, error)
+	SaveBatch(
+		ctx context.Context,
+		batch *domain.Batch,
+	) error
+	LockWallets(
+		ctx context.Context,
+		walletIDs []int,
+	) (map[int]*domain.Wallet, error)
+	AdjustBalance(
+		ctx context.Context,
+		wallet *domain.Wallet,
+		txn *domain.LedgerTransaction,
+		reason string,
+	) (*domain.Wallet, error)
+	CreateWallet(
+		ctx context.Context,
+		reason string,
+	) (*domain.Wallet, error)
+}
+
+// Admin represents a contract for the operators' actions on wallets. Every action is
+// recorded in the audit log in the same transaction as the change it makes
+type Admin interface {
+	SetFrozen(
+		ctx context.Context,
+		walletID int,
+		frozen bool,
+		reason string,
 	) (*domain.Wallet, error)
 }
+
+// Webhooks represents a contract for storing webhook subscriptions and reading their deliveries
+type Webhooks interface {
+	CreateSubscription(
+		ctx context.Context,
+		sub *domain.WebhookSubscription,
+	) error
+	GetSubscription(
+		ctx context.Context,
+		id uint64,
+	) (*domain.WebhookSubscription, error)
+	ListSubscriptions(
+		ctx context.Context,
+		owner string,
+	) ([]domain.WebhookSubscription, error)
+	DeleteSubscription(
+		ctx context.Context,
+		id uint64,
+	) error
+	ListDeliveries(
+		ctx context.Context,
+		subscriptionID uint64,
+		limit int,
+	) ([]domain.WebhookDelivery, error)
+}
+
+// Updates represents a contract for broadcasting balance updates to the
+// balance watchers of every API server instance
+type Updates interface {
+	PublishBalance(
+		ctx context.Context,
+		wallet *domain.Wallet,
+	) error
+	SubscribeBalances(
+		ctx context.Context,
+		handler func(wallet *domain.Wallet),
+	) error
+}
+
+// Settlement represents a contract for reading closed business days
+type Settlement interface {
+	GetDayClose(
+		ctx context.Context,
+		day string,
+		currency string,
+	) (*domain.DayClose, error)
+	ListSettlementTotals(
+		ctx context.Context,
+		day string,
+		currency string,
+	) ([]domain.SettlementTotal, error)
+	ListClosingBalances(
+		ctx context.Context,
+		day string,
+		currency string,
+		afterWalletID int,
+		limit int,
+	) ([]domain.ClosingBalance, error)
+}
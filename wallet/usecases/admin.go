@@ -0,0 +1,304 @@
+package usecases
+
+import (
+	"context"
+	"log"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository"
+	"github.com/shopspring/decimal"
+)
+
+// SeedReason is the reason recorded for the wallets seeded as test data
+const SeedReason = "seeded test data"
+
+// adjustments settle every manual adjustment against the adjustments account
+var adjustments = Counterparties{
+	Credit: domain.AccountAdjustments,
+	Debit:  domain.AccountAdjustments,
+}
+
+// AdminBusinessLogic designs the operators' actions on wallets
+type AdminBusinessLogic interface {
+	CreateWallet(
+		ctx context.Context,
+		balance decimal.Decimal,
+		reason string,
+	) (*domain.Wallet, error)
+	Wallet(
+		ctx context.Context,
+		walletID int,
+	) (*domain.Wallet, error)
+	FreezeWallet(
+		ctx context.Context,
+		walletID int,
+		reason string,
+	) (*domain.Wallet, error)
+	UnfreezeWallet(
+		ctx context.Context,
+		walletID int,
+		reason string,
+	) (*domain.Wallet, error)
+	AdjustWallet(
+		ctx context.Context,
+		walletID int,
+		amount decimal.Decimal,
+		reason string,
+	) (*dto.Adjustment, error)
+	SeedWallets(
+		ctx context.Context,
+		count int,
+		balance decimal.Decimal,
+	) ([]domain.Wallet, error)
+}
+
+// AdminUsecases sets up the operators' actions on wallets
+type AdminUsecases struct {
+	Get   repository.Get
+	Batch repository.Batch
+	Admin repository.Admin
+	// Broadcast is optional, without it the balance watchers do not see the
+	// wallets changed by the operators until their next update
+	Broadcast repository.Updates
+}
+
+// NewAdminUsecases initializes the operators' actions on wallets
+func NewAdminUsecases(
+	get repository.Get,
+	batch repository.Batch,
+	admin repository.Admin,
+) *AdminUsecases {
+	a := &AdminUsecases{
+		Get:   get,
+		Batch: batch,
+		Admin: admin,
+	}
+	a.checkPreconditions()
+	return a
+}
+
+func (a *AdminUsecases) checkPreconditions() {
+	if a.Get == nil {
+		log.Panicf("admin usecases have not initalized GET repository")
+	}
+	if a.Batch == nil {
+		log.Panicf("admin usecases have not initalized BATCH repository")
+	}
+	if a.Admin == nil {
+		log.Panicf("admin usecases have not initalized ADMIN repository")
+	}
+}
+
+// CreateWallet opens a wallet, putting the balance in it with an adjustment so that its
+// opening balance is posted to the ledger. The wallet is opened and funded in the same
+// transaction, so it is never left opened but not funded
+func (a *AdminUsecases) CreateWallet(
+	ctx context.Context,
+	balance decimal.Decimal,
+	reason string,
+) (*domain.Wallet, error) {
+	if err := dto.ValidOpening(balance, reason); err != nil {
+		return nil, dto.Wrap(err, "CreateWallet")
+	}
+
+	wallet, err := a.openWallet(ctx, balance, reason)
+	if err != nil {
+		return nil, dto.Wrap(err, "CreateWallet")
+	}
+
+	return wallet, nil
+}
+
+// openWallet opens a wallet and puts the balance in it within one transaction
+func (a *AdminUsecases) openWallet(
+	ctx context.Context,
+	balance decimal.Decimal,
+	reason string,
+) (*domain.Wallet, error) {
+	var wallet *domain.Wallet
+	err := a.Batch.Transact(ctx, func(tx repository.Tx) error {
+		var err error
+		if wallet, err = tx.CreateWallet(ctx, reason); err != nil {
+			return err
+		}
+		if balance.IsZero() {
+			return nil
+		}
+
+		adjustment, err := adjust(ctx, tx, wallet.ID, balance, reason)
+		if err != nil {
+			return err
+		}
+		wallet = adjustment.Wallet
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return wallet, nil
+}
+
+// Wallet gets a wallet's current balance and whether it is frozen
+func (a *AdminUsecases) Wallet(
+	ctx context.Context,
+	walletID int,
+) (*domain.Wallet, error) {
+	if err := dto.ValidWalletID(walletID); err != nil {
+		return nil, dto.Wrap(err, "Wallet")
+	}
+
+	wallet, err := a.Get.GetBalance(ctx, walletID)
+	if err != nil {
+		return nil, dto.Wrap(err, "Wallet")
+	}
+
+	return wallet, nil
+}
+
+// FreezeWallet stops the players from crediting or debiting a wallet until it is unfrozen
+func (a *AdminUsecases) FreezeWallet(
+	ctx context.Context,
+	walletID int,
+	reason string,
+) (*domain.Wallet, error) {
+	wallet, err := a.setFrozen(ctx, walletID, true, reason)
+	if err != nil {
+		return nil, dto.Wrap(err, "FreezeWallet")
+	}
+
+	a.publish(ctx, wallet)
+	return wallet, nil
+}
+
+// UnfreezeWallet lets the players credit and debit a frozen wallet again
+func (a *AdminUsecases) UnfreezeWallet(
+	ctx context.Context,
+	walletID int,
+	reason string,
+) (*domain.Wallet, error) {
+	wallet, err := a.setFrozen(ctx, walletID, false, reason)
+	if err != nil {
+		return nil, dto.Wrap(err, "UnfreezeWallet")
+	}
+
+	a.publish(ctx, wallet)
+	return wallet, nil
+}
+
+func (a *AdminUsecases) setFrozen(
+	ctx context.Context,
+	walletID int,
+	frozen bool,
+	reason string,
+) (*domain.Wallet, error) {
+	if err := dto.ValidWalletID(walletID); err != nil {
+		return nil, err
+	}
+	if err := dto.ValidReason(reason, false); err != nil {
+		return nil, err
+	}
+
+	return a.Admin.SetFrozen(ctx, walletID, frozen, reason)
+}
+
+// AdjustWallet puts money in, or takes it out of, a wallet by hand, frozen or not. The
+// adjustment is posted against the adjustments ledger account and its reason recorded in
+// the audit log in the same transaction. A balance can not be adjusted below zero
+func (a *AdminUsecases) AdjustWallet(
+	ctx context.Context,
+	walletID int,
+	amount decimal.Decimal,
+	reason string,
+) (*dto.Adjustment, error) {
+	if err := dto.ValidAdjustment(walletID, amount, reason); err != nil {
+		return nil, dto.Wrap(err, "AdjustWallet")
+	}
+
+	var adjustment *dto.Adjustment
+	err := a.Batch.Transact(ctx, func(tx repository.Tx) error {
+		var err error
+		adjustment, err = adjust(ctx, tx, walletID, amount, reason)
+		return err
+	})
+	if err != nil {
+		return nil, dto.Wrap(err, "AdjustWallet")
+	}
+
+	a.publish(ctx, adjustment.Wallet)
+	return adjustment, nil
+}
+
+// publish broadcasts a wallet changed by an operator to the balance watchers of every
+// instance. The change has been committed by then, so failing to broadcast it is not
+// an error and the watchers see the wallet with its next update
+func (a *AdminUsecases) publish(ctx context.Context, wallet *domain.Wallet) {
+	if a.Broadcast == nil || wallet == nil {
+		return
+	}
+	_ = a.Broadcast.PublishBalance(ctx, wallet)
+}
+
+// adjust posts an adjustment of a wallet's balance within the transaction, the
+// repository records it with its reason in the audit log
+func adjust(
+	ctx context.Context,
+	tx repository.Tx,
+	walletID int,
+	amount decimal.Decimal,
+	reason string,
+) (*dto.Adjustment, error) {
+	txn, err := newLedgerTransaction()
+	if err != nil {
+		return nil, err
+	}
+	adjustments.post(txn, walletID, amount)
+	if err := CheckBalanced(txn); err != nil {
+		return nil, err
+	}
+
+	adjustment := &dto.Adjustment{
+		TransactionID: txn.ID,
+		WalletID:      walletID,
+		Amount:        amount,
+		Reason:        reason,
+	}
+	wallets, err := tx.LockWallets(ctx, []int{walletID})
+	if err != nil {
+		return nil, err
+	}
+	wallet, ok := wallets[walletID]
+	if !ok {
+		return nil, errWalletNotFound
+	}
+
+	if adjustment.Wallet, err = tx.AdjustBalance(ctx, wallet, txn, reason); err != nil {
+		return nil, err
+	}
+
+	return adjustment, nil
+}
+
+// SeedWallets opens wallets as test data, putting the balance in each one with an adjustment.
+// Each wallet is opened and funded in its own transaction
+func (a *AdminUsecases) SeedWallets(
+	ctx context.Context,
+	count int,
+	balance decimal.Decimal,
+) ([]domain.Wallet, error) {
+	if err := dto.ValidSeed(count, balance); err != nil {
+		return nil, dto.Wrap(err, "SeedWallets")
+	}
+
+	wallets := make([]domain.Wallet, 0, count)
+	for i := 0; i < count; i++ {
+		wallet, err := a.openWallet(ctx, balance, SeedReason)
+		if err != nil {
+			return wallets, dto.Wrap(err, "SeedWallets")
+		}
+		wallets = append(wallets, *wallet)
+	}
+
+	return wallets, nil
+}
@@ -0,0 +1,345 @@
+package usecases_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository/mocks"
+	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
+	"github.com/shopspring/decimal"
+)
+
+func TestAdminUsecases_AdjustWallet(t *testing.T) {
+	tests := []struct {
+		name        string
+		walletID    int
+		amount      decimal.Decimal
+		reason      string
+		frozen      bool
+		wantBalance decimal.Decimal
+		wantErr     error
+	}{
+		{
+			name:        "happy case - money put in",
+			walletID:    1,
+			amount:      decimal.NewFromInt(50),
+			reason:      "goodwill for ticket 42",
+			wantBalance: decimal.NewFromInt(250),
+		},
+		{
+			name:        "happy case - money taken out of a frozen wallet",
+			walletID:    1,
+			amount:      decimal.NewFromInt(-200),
+			reason:      "chargeback",
+			frozen:      true,
+			wantBalance: decimal.Zero,
+		},
+		{
+			name:     "sad case - no reason",
+			walletID: 1,
+			amount:   decimal.NewFromInt(50),
+			reason:   "  ",
+			wantErr:  domain.ErrValidation,
+		},
+		{
+			name:     "sad case - zero amount",
+			walletID: 1,
+			amount:   decimal.Zero,
+			reason:   "nothing",
+			wantErr:  domain.ErrValidation,
+		},
+		{
+			name:     "sad case - balance below zero",
+			walletID: 1,
+			amount:   decimal.NewFromInt(-201),
+			reason:   "chargeback",
+			wantErr:  domain.ErrInsufficientFunds,
+		},
+		{
+			name:     "sad case - wallet not found",
+			walletID: 2,
+			amount:   decimal.NewFromInt(50),
+			reason:   "goodwill",
+			wantErr:  domain.ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := mocks.NewMockTx()
+			tx.MockLockWallets = func(ctx context.Context, walletIDs []int) (map[int]*domain.Wallet, error) {
+				return map[int]*domain.Wallet{
+					1: {ID: 1, Balance: decimal.NewFromInt(200), Frozen: tt.frozen},
+				}, nil
+			}
+			var posted *domain.LedgerTransaction
+			var audited string
+			tx.MockAdjustBalance = func(ctx context.Context, wallet *domain.Wallet, txn *domain.LedgerTransaction, reason string) (*domain.Wallet, error) {
+				updated, err := mocks.ChangeBalance(wallet, txn)
+				if err == nil {
+					posted, audited = txn, reason
+				}
+				return updated, err
+			}
+			repo := mocks.NewMockRepo()
+			repo.MockTransact = func(ctx context.Context, fn func(tx repository.Tx) error) error {
+				return fn(tx)
+			}
+			a := usecases.NewAdminUsecases(repo, repo, mocks.NewMockAdmin())
+
+			adjustment, err := a.AdjustWallet(ctx, tt.walletID, tt.amount, tt.reason)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("AdjustWallet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if posted != nil {
+					t.Fatalf("did not expect the adjustment to be posted")
+				}
+				return
+			}
+
+			if !adjustment.Wallet.Balance.Equal(tt.wantBalance) {
+				t.Fatalf("expected a balance of %s but got %s", tt.wantBalance, adjustment.Wallet.Balance)
+			}
+			if err := usecases.CheckBalanced(posted); err != nil {
+				t.Fatal(err)
+			}
+			for _, posting := range posted.Postings {
+				if posting.Account != domain.WalletAccount(tt.walletID) && posting.Account != domain.AccountAdjustments {
+					t.Fatalf("expected the adjustment to be posted against %s but got %s", domain.AccountAdjustments, posting.Account)
+				}
+			}
+			if audited != tt.reason || posted.ID != adjustment.TransactionID {
+				t.Fatalf("expected the adjustment to be audited with its reason but got %q", audited)
+			}
+		})
+	}
+}
+
+func TestAdminUsecases_FreezeWallet(t *testing.T) {
+	tests := []struct {
+		name     string
+		walletID int
+		freeze   bool
+		reason   string
+		notFound bool
+		wantErr  error
+	}{
+		{
+			name:     "happy case - freeze",
+			walletID: 1,
+			freeze:   true,
+			reason:   "suspected fraud",
+		},
+		{
+			name:     "happy case - unfreeze without a reason",
+			walletID: 1,
+		},
+		{
+			name:     "sad case - invalid wallet ID",
+			walletID: 0,
+			freeze:   true,
+			wantErr:  domain.ErrValidation,
+		},
+		{
+			name:     "sad case - reason too long",
+			walletID: 1,
+			freeze:   true,
+			reason:   strings.Repeat("x", 256),
+			wantErr:  domain.ErrValidation,
+		},
+		{
+			name:     "sad case - wallet not found",
+			walletID: 1,
+			freeze:   true,
+			notFound: true,
+			wantErr:  domain.ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admin := mocks.NewMockAdmin()
+			if tt.notFound {
+				admin.MockSetFrozen = func(ctx context.Context, walletID int, frozen bool, reason string) (*domain.Wallet, error) {
+					return nil, domain.NewError(domain.ErrNotFound, "wallet not found", nil)
+				}
+			}
+			repo := mocks.NewMockRepo()
+			a := usecases.NewAdminUsecases(repo, repo, admin)
+			var published []*domain.Wallet
+			a.Broadcast = &memoryBroadcast{handlers: []func(wallet *domain.Wallet){
+				func(wallet *domain.Wallet) { published = append(published, wallet) },
+			}}
+
+			setFrozen := a.UnfreezeWallet
+			if tt.freeze {
+				setFrozen = a.FreezeWallet
+			}
+			wallet, err := setFrozen(ctx, tt.walletID, tt.reason)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("setting frozen error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && wallet.Frozen != tt.freeze {
+				t.Fatalf("expected the wallet's frozen to be %v", tt.freeze)
+			}
+
+			// the balance watchers see the wallet frozen or unfrozen
+			wantPublished := 1
+			if tt.wantErr != nil {
+				wantPublished = 0
+			}
+			if len(published) != wantPublished {
+				t.Fatalf("expected %d broadcast wallets but got %d", wantPublished, len(published))
+			}
+		})
+	}
+}
+
+func TestAdminUsecases_CreateWallet(t *testing.T) {
+	tests := []struct {
+		name        string
+		balance     decimal.Decimal
+		reason      string
+		fundErr     error
+		wantBalance decimal.Decimal
+		wantErr     error
+	}{
+		{
+			name:        "happy case - funded wallet",
+			balance:     decimal.NewFromInt(100),
+			reason:      "VIP onboarding",
+			wantBalance: decimal.NewFromInt(100),
+		},
+		{
+			name:        "happy case - empty wallet",
+			wantBalance: decimal.Zero,
+		},
+		{
+			name:    "sad case - funded without a reason",
+			balance: decimal.NewFromInt(100),
+			wantErr: domain.ErrValidation,
+		},
+		{
+			name:    "sad case - negative balance",
+			balance: decimal.NewFromInt(-1),
+			reason:  "VIP onboarding",
+			wantErr: domain.ErrValidation,
+		},
+		{
+			name:    "sad case - funding fails",
+			balance: decimal.NewFromInt(100),
+			reason:  "VIP onboarding",
+			fundErr: domain.ErrUnavailable,
+			wantErr: domain.ErrUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := mocks.NewMockTx()
+			tx.MockLockWallets = func(ctx context.Context, walletIDs []int) (map[int]*domain.Wallet, error) {
+				return map[int]*domain.Wallet{1: {ID: 1, Balance: decimal.Zero}}, nil
+			}
+			tx.MockAdjustBalance = func(ctx context.Context, wallet *domain.Wallet, txn *domain.LedgerTransaction, reason string) (*domain.Wallet, error) {
+				if tt.fundErr != nil {
+					return nil, domain.NewError(tt.fundErr, "the database is unavailable", nil)
+				}
+				return mocks.ChangeBalance(wallet, txn)
+			}
+			transactions := 0
+			repo := mocks.NewMockRepo()
+			repo.MockTransact = func(ctx context.Context, fn func(tx repository.Tx) error) error {
+				transactions++
+				return fn(tx)
+			}
+			a := usecases.NewAdminUsecases(repo, repo, mocks.NewMockAdmin())
+
+			wallet, err := a.CreateWallet(ctx, tt.balance, tt.reason)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("CreateWallet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr == domain.ErrValidation {
+				return
+			}
+
+			// opening and funding the wallet are rolled back together
+			if transactions != 1 {
+				t.Fatalf("expected the wallet to be opened and funded in one transaction but got %d", transactions)
+			}
+			if tt.wantErr == nil && !wallet.Balance.Equal(tt.wantBalance) {
+				t.Fatalf("expected the wallet to hold %s but got %s", tt.wantBalance, wallet.Balance)
+			}
+		})
+	}
+}
+
+func TestAdminUsecases_SeedWallets(t *testing.T) {
+	tests := []struct {
+		name        string
+		count       int
+		balance     decimal.Decimal
+		wantAdjusts int
+		wantErr     error
+	}{
+		{
+			name:        "happy case - funded wallets",
+			count:       3,
+			balance:     decimal.NewFromInt(100),
+			wantAdjusts: 3,
+		},
+		{
+			name:  "happy case - empty wallets",
+			count: 2,
+		},
+		{
+			name:    "sad case - no wallets",
+			count:   0,
+			wantErr: domain.ErrValidation,
+		},
+		{
+			name:    "sad case - negative balance",
+			count:   1,
+			balance: decimal.NewFromInt(-1),
+			wantErr: domain.ErrValidation,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created := 0
+			tx := mocks.NewMockTx()
+			tx.MockCreateWallet = func(ctx context.Context, reason string) (*domain.Wallet, error) {
+				created++
+				return &domain.Wallet{ID: created, Balance: decimal.Zero}, nil
+			}
+			adjusts := 0
+			tx.MockLockWallets = func(ctx context.Context, walletIDs []int) (map[int]*domain.Wallet, error) {
+				adjusts++
+				return map[int]*domain.Wallet{walletIDs[0]: {ID: walletIDs[0], Balance: decimal.Zero}}, nil
+			}
+			repo := mocks.NewMockRepo()
+			repo.MockTransact = func(ctx context.Context, fn func(tx repository.Tx) error) error {
+				return fn(tx)
+			}
+			a := usecases.NewAdminUsecases(repo, repo, mocks.NewMockAdmin())
+
+			wallets, err := a.SeedWallets(ctx, tt.count, tt.balance)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("SeedWallets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if len(wallets) != tt.count || adjusts != tt.wantAdjusts {
+				t.Fatalf("expected %d wallets and %d adjustments but got %d and %d", tt.count, tt.wantAdjusts, len(wallets), adjusts)
+			}
+			for i, wallet := range wallets {
+				if wallet.ID != i+1 || !wallet.Balance.Equal(tt.balance) {
+					t.Fatalf("expected wallet %d to hold %s but got %+v", i+1, tt.balance, wallet)
+				}
+			}
+		})
+	}
+}
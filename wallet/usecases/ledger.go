@@ -0,0 +1,112 @@
+package usecases
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/shopspring/decimal"
+)
+
+// Counterparties are the ledger accounts on the other side of wallets' balance
+// changes. A credit moves money from a wallet to the Credit account and a debit
+// moves money from the Debit account to a wallet
+type Counterparties struct {
+	Credit string
+	Debit  string
+}
+
+// DefaultCounterparties settle every credit and debit against the house
+var DefaultCounterparties = Counterparties{
+	Credit: domain.AccountHouse,
+	Debit:  domain.AccountHouse,
+}
+
+// Valid checks that both counterparties are ledger accounts other than a wallet's
+func (c Counterparties) Valid() error {
+	for _, account := range []string{c.Credit, c.Debit} {
+		if !isCounterparty(account) {
+			return fmt.Errorf("%q is not one of the ledger accounts %v", account, domain.Accounts)
+		}
+	}
+	return nil
+}
+
+func isCounterparty(account string) bool {
+	for _, a := range domain.Accounts {
+		if a == account {
+			return true
+		}
+	}
+	return false
+}
+
+// newLedgerTransaction starts a ledger transaction without any postings
+func newLedgerTransaction() (*domain.LedgerTransaction, error) {
+	bs := make([]byte, 16)
+	if _, err := rand.Read(bs); err != nil {
+		return nil, fmt.Errorf("failed to generate a ledger transaction ID with err %v", err)
+	}
+	return &domain.LedgerTransaction{ID: hex.EncodeToString(bs)}, nil
+}
+
+// transfer builds the ledger transaction of a wallet's balance change, balanced
+// against the change's counterparty, and checks it before anything is changed
+func (w *WalletUsecases) transfer(
+	walletID int,
+	change decimal.Decimal,
+) (*domain.LedgerTransaction, error) {
+	txn, err := newLedgerTransaction()
+	if err != nil {
+		return nil, err
+	}
+	w.Counterparties.post(txn, walletID, change)
+	if err := CheckBalanced(txn); err != nil {
+		return nil, err
+	}
+
+	return txn, nil
+}
+
+// post adds the postings of a wallet's balance change to the transaction: the
+// wallet's posting balanced by one against the counterparty of the change
+func (c Counterparties) post(
+	txn *domain.LedgerTransaction,
+	walletID int,
+	change decimal.Decimal,
+) {
+	counterparty := c.Debit
+	if change.IsNegative() {
+		counterparty = c.Credit
+	}
+	txn.Postings = append(
+		txn.Postings,
+		domain.Posting{TransactionID: txn.ID, Account: domain.WalletAccount(walletID), Amount: change},
+		domain.Posting{TransactionID: txn.ID, Account: counterparty, Amount: change.Neg()},
+	)
+}
+
+// CheckBalanced enforces double-entry: a transaction has at least two postings,
+// each one against a ledger account, and their amounts sum to zero
+func CheckBalanced(txn *domain.LedgerTransaction) error {
+	if txn == nil || len(txn.Postings) < 2 {
+		return fmt.Errorf("a ledger transaction needs at least two postings")
+	}
+
+	sum := decimal.Zero
+	for _, posting := range txn.Postings {
+		if !domain.IsAccount(posting.Account) {
+			return fmt.Errorf("ledger transaction %s posts to unknown account %q", txn.ID, posting.Account)
+		}
+		if posting.TransactionID != txn.ID {
+			return fmt.Errorf("ledger transaction %s has a posting of transaction %s", txn.ID, posting.TransactionID)
+		}
+		sum = sum.Add(posting.Amount)
+	}
+	if !sum.IsZero() {
+		return fmt.Errorf("ledger transaction %s is unbalanced by %s", txn.ID, sum)
+	}
+
+	return nil
+}
@@ -0,0 +1,220 @@
+package usecases_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository/mocks"
+	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
+	"github.com/shopspring/decimal"
+)
+
+func TestCheckBalanced(t *testing.T) {
+	posting := func(account string, amount int64) domain.Posting {
+		return domain.Posting{TransactionID: "txn", Account: account, Amount: decimal.NewFromInt(amount)}
+	}
+
+	tests := []struct {
+		name    string
+		txn     *domain.LedgerTransaction
+		wantErr bool
+	}{
+		{
+			name: "happy case - balanced",
+			txn: &domain.LedgerTransaction{ID: "txn", Postings: []domain.Posting{
+				posting(domain.WalletAccount(1), 50),
+				posting(domain.AccountBonusPool, -20),
+				posting(domain.AccountHouse, -30),
+			}},
+		},
+		{
+			name: "sad case - unbalanced",
+			txn: &domain.LedgerTransaction{ID: "txn", Postings: []domain.Posting{
+				posting(domain.WalletAccount(1), 50),
+				posting(domain.AccountHouse, -49),
+			}},
+			wantErr: true,
+		},
+		{
+			name: "sad case - single posting",
+			txn: &domain.LedgerTransaction{ID: "txn", Postings: []domain.Posting{
+				posting(domain.WalletAccount(1), 0),
+			}},
+			wantErr: true,
+		},
+		{
+			name: "sad case - unknown account",
+			txn: &domain.LedgerTransaction{ID: "txn", Postings: []domain.Posting{
+				posting(domain.WalletAccount(1), 50),
+				posting("marketing", -50),
+			}},
+			wantErr: true,
+		},
+		{
+			name: "sad case - posting of another transaction",
+			txn: &domain.LedgerTransaction{ID: "other", Postings: []domain.Posting{
+				posting(domain.WalletAccount(1), 50),
+				posting(domain.AccountHouse, -50),
+			}},
+			wantErr: true,
+		},
+		{
+			name:    "sad case - no transaction",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := usecases.CheckBalanced(tt.txn); (err != nil) != tt.wantErr {
+				t.Fatalf("CheckBalanced() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCounterparties_Valid(t *testing.T) {
+	tests := []struct {
+		name           string
+		counterparties usecases.Counterparties
+		wantErr        bool
+	}{
+		{
+			name:           "happy case - default",
+			counterparties: usecases.DefaultCounterparties,
+		},
+		{
+			name:           "happy case - provider settlement and bonus pool",
+			counterparties: usecases.Counterparties{Credit: domain.AccountProviderSettlement, Debit: domain.AccountBonusPool},
+		},
+		{
+			name:           "sad case - a wallet",
+			counterparties: usecases.Counterparties{Credit: domain.AccountHouse, Debit: domain.WalletAccount(1)},
+			wantErr:        true,
+		},
+		{
+			name:           "sad case - unknown account",
+			counterparties: usecases.Counterparties{Credit: "", Debit: domain.AccountHouse},
+			wantErr:        true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.counterparties.Valid(); (err != nil) != tt.wantErr {
+				t.Fatalf("Counterparties.Valid() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestWalletUsecases_Ledger checks that every balance change is posted as a balanced
+// transaction whose wallet postings add up to the change
+func TestWalletUsecases_Ledger(t *testing.T) {
+	amount := func(value float64) dto.AmountInput {
+		return dto.AmountInput{Amount: decimal.NewNullDecimal(decimal.NewFromFloat(value))}
+	}
+
+	tests := []struct {
+		name     string
+		apply    func(w *usecases.WalletUsecases) error
+		want     map[string]string
+		wantTxns int
+	}{
+		{
+			name: "credit",
+			apply: func(w *usecases.WalletUsecases) error {
+				_, err := w.CreditWallet(ctx, 1, decimal.NewFromInt(30))
+				return err
+			},
+			want:     map[string]string{domain.WalletAccount(1): "-30", domain.AccountProviderSettlement: "30"},
+			wantTxns: 1,
+		},
+		{
+			name: "debit",
+			apply: func(w *usecases.WalletUsecases) error {
+				_, err := w.DebitWallet(ctx, 1, decimal.NewFromInt(50))
+				return err
+			},
+			want:     map[string]string{domain.WalletAccount(1): "50", domain.AccountBonusPool: "-50"},
+			wantTxns: 1,
+		},
+		{
+			name: "batch",
+			apply: func(w *usecases.WalletUsecases) error {
+				_, err := w.ApplyBatch(ctx, dto.BatchInput{
+					IdempotencyKey: "key",
+					Mode:           dto.AtomicBatch,
+					Operations: []dto.BatchOperation{
+						{WalletID: 1, Type: dto.DebitOperation, AmountInput: amount(50)},
+						{WalletID: 1, Type: dto.CreditOperation, AmountInput: amount(20)},
+						{WalletID: 2, Type: dto.DebitOperation, AmountInput: amount(5)},
+					},
+				})
+				return err
+			},
+			want: map[string]string{
+				domain.WalletAccount(1):          "30",
+				domain.WalletAccount(2):          "5",
+				domain.AccountBonusPool:          "-55",
+				domain.AccountProviderSettlement: "20",
+			},
+			wantTxns: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var txns []*domain.LedgerTransaction
+			record := func(ctx context.Context, wallet *domain.Wallet, txn *domain.LedgerTransaction) (*domain.Wallet, error) {
+				if err := usecases.CheckBalanced(txn); err != nil {
+					t.Fatal(err)
+				}
+				txns = append(txns, txn)
+				return mocks.ChangeBalance(wallet, txn)
+			}
+
+			updateMockRepo := mocks.NewMockRepo()
+			updateMockRepo.MockUpdateBalance = record
+			batchMockRepo := mocks.NewMockRepo()
+			tx := mocks.NewMockTx()
+			tx.MockUpdateBalance = record
+			tx.MockLockWallets = func(ctx context.Context, walletIDs []int) (map[int]*domain.Wallet, error) {
+				return map[int]*domain.Wallet{
+					1: {ID: 1, Balance: decimal.NewFromInt(200)},
+					2: {ID: 2, Balance: decimal.NewFromInt(0)},
+				}, nil
+			}
+			batchMockRepo.MockTransact = func(ctx context.Context, fn func(tx repository.Tx) error) error {
+				return fn(tx)
+			}
+
+			w := usecases.NewWalletUsecases(mocks.NewMockRepo(), updateMockRepo, batchMockRepo)
+			w.Counterparties = usecases.Counterparties{
+				Credit: domain.AccountProviderSettlement,
+				Debit:  domain.AccountBonusPool,
+			}
+			if err := tt.apply(w); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(txns) != tt.wantTxns {
+				t.Fatalf("expected %d ledger transactions but got %d", tt.wantTxns, len(txns))
+			}
+			got := map[string]decimal.Decimal{}
+			for _, txn := range txns {
+				for _, posting := range txn.Postings {
+					got[posting.Account] = got[posting.Account].Add(posting.Amount)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected postings to %v but got %v", tt.want, got)
+			}
+			for account, want := range tt.want {
+				if got[account].String() != want {
+					t.Fatalf("expected %s to be posted %s but got %s", account, want, got[account])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package usecases
+
+import (
+	"context"
+	"log"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository"
+)
+
+// ClosingBalancesChunk is how many closing balances are read at a time when they are exported
+const ClosingBalancesChunk = 1000
+
+// SettlementBusinessLogic designs the reports of the closed business days
+type SettlementBusinessLogic interface {
+	SettlementReport(
+		ctx context.Context,
+		day string,
+	) (*dto.SettlementReport, error)
+	ClosingBalances(
+		ctx context.Context,
+		day string,
+		fn func(balances []domain.ClosingBalance) error,
+	) error
+}
+
+// SettlementUsecases sets up the closed business days' usecase layer. Days are
+// closed in the currency the wallets' balances are in
+type SettlementUsecases struct {
+	Settlement repository.Settlement
+	Currency   string
+}
+
+// NewSettlementUsecases initializes the closed business days' business logic
+func NewSettlementUsecases(settlement repository.Settlement, currency string) *SettlementUsecases {
+	s := &SettlementUsecases{
+		Settlement: settlement,
+		Currency:   currency,
+	}
+	s.checkPreconditions()
+	return s
+}
+
+func (s *SettlementUsecases) checkPreconditions() {
+	if s.Settlement == nil {
+		log.Panicf("settlement usecases have not initalized SETTLEMENT repository")
+	}
+	if s.Currency == "" {
+		log.Panicf("settlement usecases have not been configured with a currency")
+	}
+}
+
+// SettlementReport retrieves a closed day with its settlement totals
+func (s *SettlementUsecases) SettlementReport(
+	ctx context.Context,
+	day string,
+) (*dto.SettlementReport, error) {
+	if err := dto.ValidDay(day); err != nil {
+		return nil, dto.Wrap(err, "SettlementReport")
+	}
+
+	dayClose, err := s.Settlement.GetDayClose(ctx, day, s.Currency)
+	if err != nil {
+		return nil, dto.Wrap(err, "SettlementReport")
+	}
+	totals, err := s.Settlement.ListSettlementTotals(ctx, day, s.Currency)
+	if err != nil {
+		return nil, dto.Wrap(err, "SettlementReport")
+	}
+
+	return &dto.SettlementReport{DayClose: *dayClose, Totals: totals}, nil
+}
+
+// ClosingBalances passes a closed day's closing balances to fn, in wallet ID order,
+// a chunk at a time so that they are never all held in memory. Nothing is passed
+// to fn unless the day has been closed
+func (s *SettlementUsecases) ClosingBalances(
+	ctx context.Context,
+	day string,
+	fn func(balances []domain.ClosingBalance) error,
+) error {
+	if err := dto.ValidDay(day); err != nil {
+		return dto.Wrap(err, "ClosingBalances")
+	}
+	if _, err := s.Settlement.GetDayClose(ctx, day, s.Currency); err != nil {
+		return dto.Wrap(err, "ClosingBalances")
+	}
+
+	afterWalletID := 0
+	for {
+		balances, err := s.Settlement.ListClosingBalances(ctx, day, s.Currency, afterWalletID, ClosingBalancesChunk)
+		if err != nil {
+			return dto.Wrap(err, "ClosingBalances")
+		}
+		if len(balances) == 0 {
+			return nil
+		}
+		if err := fn(balances); err != nil {
+			return dto.Wrap(err, "ClosingBalances")
+		}
+		if len(balances) < ClosingBalancesChunk {
+			return nil
+		}
+		afterWalletID = balances[len(balances)-1].WalletID
+	}
+}
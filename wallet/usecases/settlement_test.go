@@ -0,0 +1,141 @@
+package usecases_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository/mocks"
+	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
+	"github.com/shopspring/decimal"
+)
+
+func TestSettlementUsecases_SettlementReport(t *testing.T) {
+	tests := []struct {
+		name       string
+		day        string
+		notClosed  bool
+		wantTotals int
+		wantErr    error
+	}{
+		{
+			name:       "happy case - closed day",
+			day:        "2022-03-01",
+			wantTotals: 2,
+		},
+		{
+			name:    "sad case - invalid day",
+			day:     "2022-3-1",
+			wantErr: domain.ErrValidation,
+		},
+		{
+			name:      "sad case - day not closed",
+			day:       "2022-03-01",
+			notClosed: true,
+			wantErr:   domain.ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := mocks.NewMockSettlement()
+			if tt.notClosed {
+				repo.MockGetDayClose = func(ctx context.Context, day string, currency string) (*domain.DayClose, error) {
+					return nil, domain.NewError(domain.ErrNotFound, "the day has not been closed", nil)
+				}
+			}
+			s := usecases.NewSettlementUsecases(repo, "EUR")
+
+			report, err := s.SettlementReport(ctx, tt.day)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("SettlementReport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if report.Day != tt.day || report.Currency != "EUR" || len(report.Totals) != tt.wantTotals {
+				t.Fatalf("expected the report of %s in EUR with %d totals but got %+v", tt.day, tt.wantTotals, report)
+			}
+		})
+	}
+}
+
+func TestSettlementUsecases_ClosingBalances(t *testing.T) {
+	tests := []struct {
+		name       string
+		wallets    int
+		notClosed  bool
+		wantChunks []int
+		wantErr    bool
+	}{
+		{
+			name:       "happy case - several chunks",
+			wallets:    2*usecases.ClosingBalancesChunk + 5,
+			wantChunks: []int{usecases.ClosingBalancesChunk, usecases.ClosingBalancesChunk, 5},
+		},
+		{
+			name:       "happy case - a full chunk",
+			wallets:    usecases.ClosingBalancesChunk,
+			wantChunks: []int{usecases.ClosingBalancesChunk},
+		},
+		{
+			name:    "happy case - no wallets",
+			wallets: 0,
+		},
+		{
+			name:      "sad case - day not closed",
+			wallets:   5,
+			notClosed: true,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := mocks.NewMockSettlement()
+			repo.MockListClosingBalances = func(
+				ctx context.Context,
+				day string,
+				currency string,
+				afterWalletID int,
+				limit int,
+			) ([]domain.ClosingBalance, error) {
+				var balances []domain.ClosingBalance
+				for walletID := afterWalletID + 1; walletID <= tt.wallets && len(balances) < limit; walletID++ {
+					balances = append(balances, domain.ClosingBalance{WalletID: walletID, Balance: decimal.NewFromInt(1)})
+				}
+				return balances, nil
+			}
+			if tt.notClosed {
+				repo.MockGetDayClose = func(ctx context.Context, day string, currency string) (*domain.DayClose, error) {
+					return nil, domain.NewError(domain.ErrNotFound, "the day has not been closed", nil)
+				}
+			}
+			s := usecases.NewSettlementUsecases(repo, "EUR")
+
+			var chunks []int
+			next := 1
+			err := s.ClosingBalances(ctx, "2022-03-01", func(balances []domain.ClosingBalance) error {
+				for _, balance := range balances {
+					if balance.WalletID != next {
+						t.Fatalf("expected wallet %d next but got %d", next, balance.WalletID)
+					}
+					next++
+				}
+				chunks = append(chunks, len(balances))
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ClosingBalances() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if len(chunks) != len(tt.wantChunks) {
+				t.Fatalf("expected chunks of %v but got %v", tt.wantChunks, chunks)
+			}
+			for i := range chunks {
+				if chunks[i] != tt.wantChunks[i] {
+					t.Fatalf("expected chunks of %v but got %v", tt.wantChunks, chunks)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package usecases
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository"
+	"github.com/shopspring/decimal"
+)
+
+// StatementChunk is how many ledger postings are read at a time when a statement is written
+const StatementChunk = 500
+
+// StatementWriter represents a contract for writing out a statement as it is read:
+// its opening balance first, then its entries a chunk at a time and its closing balance last
+type StatementWriter interface {
+	Open(statement dto.Statement) error
+	Write(entries []dto.StatementEntry) error
+	Close(statement dto.Statement) error
+}
+
+// StatementBusinessLogic designs the wallets' account statements
+type StatementBusinessLogic interface {
+	Statement(
+		ctx context.Context,
+		walletID int,
+		from time.Time,
+		to time.Time,
+		w StatementWriter,
+	) error
+}
+
+// StatementUsecases sets up the wallets' account statements' usecase layer
+type StatementUsecases struct {
+	History  repository.History
+	Postings repository.Postings
+	Currency string
+}
+
+// NewStatementUsecases initializes the wallets' account statements' business logic
+func NewStatementUsecases(
+	history repository.History,
+	postings repository.Postings,
+	currency string,
+) *StatementUsecases {
+	s := &StatementUsecases{
+		History:  history,
+		Postings: postings,
+		Currency: currency,
+	}
+	s.checkPreconditions()
+	return s
+}
+
+func (s *StatementUsecases) checkPreconditions() {
+	if s.History == nil {
+		log.Panicf("statement usecases have not initalized HISTORY repository")
+	}
+	if s.Postings == nil {
+		log.Panicf("statement usecases have not initalized POSTINGS repository")
+	}
+	if s.Currency == "" {
+		log.Panicf("statement usecases have not been configured with a currency")
+	}
+}
+
+// Statement writes a wallet's statement from, inclusive, to, exclusive. The opening
+// balance is read from the wallet's balance history and every ledger posting to the
+// wallet over the period is written with the balance it left, a chunk at a time so
+// that a statement over any period is never held in memory. Nothing is written when
+// the wallet does not exist or the period is not valid
+func (s *StatementUsecases) Statement(
+	ctx context.Context,
+	walletID int,
+	from time.Time,
+	to time.Time,
+	w StatementWriter,
+) error {
+	if err := dto.ValidWalletID(walletID); err != nil {
+		return dto.Wrap(err, "Statement")
+	}
+	if err := dto.ValidStatementPeriod(from, to); err != nil {
+		return dto.Wrap(err, "Statement")
+	}
+
+	opening, err := s.History.GetBalanceAsOf(ctx, walletID, from.Add(-time.Nanosecond))
+	if err != nil {
+		return dto.Wrap(err, "Statement")
+	}
+
+	statement := dto.Statement{
+		WalletID: walletID,
+		Currency: s.Currency,
+		From:     from,
+		To:       to,
+		Opening:  opening.Balance,
+	}
+	if err := w.Open(statement); err != nil {
+		return dto.Wrap(err, "Statement")
+	}
+
+	balance := opening.Balance
+	account := domain.WalletAccount(walletID)
+	var after *domain.Posting
+	for {
+		postings, err := s.Postings.ListPostings(ctx, account, from, to, after, StatementChunk)
+		if err != nil {
+			return dto.Wrap(err, "Statement")
+		}
+		if len(postings) == 0 {
+			break
+		}
+		after = &postings[len(postings)-1]
+
+		entries := make([]dto.StatementEntry, len(postings))
+		for i, posting := range postings {
+			balance = balance.Add(posting.Amount)
+			entries[i] = dto.StatementEntry{
+				ID:            posting.ID,
+				TransactionID: posting.TransactionID,
+				Type:          entryType(posting.Amount),
+				Amount:        posting.Amount,
+				Balance:       balance,
+				CreatedAt:     posting.CreatedAt,
+			}
+		}
+		if err := w.Write(entries); err != nil {
+			return dto.Wrap(err, "Statement")
+		}
+
+		if len(postings) < StatementChunk {
+			break
+		}
+	}
+
+	statement.Closing = &balance
+	if err := w.Close(statement); err != nil {
+		return dto.Wrap(err, "Statement")
+	}
+	return nil
+}
+
+// entryType is the kind of balance change a posting to a wallet made, credits taking money out of it
+func entryType(amount decimal.Decimal) dto.OperationType {
+	if amount.IsNegative() {
+		return dto.CreditOperation
+	}
+	return dto.DebitOperation
+}
@@ -0,0 +1,163 @@
+package usecases_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository/mocks"
+	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
+	"github.com/shopspring/decimal"
+)
+
+// recordedStatement keeps everything a statement writer was given
+type recordedStatement struct {
+	opened  *dto.Statement
+	entries []dto.StatementEntry
+	closed  *dto.Statement
+}
+
+func (r *recordedStatement) Open(statement dto.Statement) error {
+	r.opened = &statement
+	return nil
+}
+
+func (r *recordedStatement) Write(entries []dto.StatementEntry) error {
+	r.entries = append(r.entries, entries...)
+	return nil
+}
+
+func (r *recordedStatement) Close(statement dto.Statement) error {
+	r.closed = &statement
+	return nil
+}
+
+func TestStatementUsecases_Statement(t *testing.T) {
+	from := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+
+	// chunked returns a full chunk of 1 unit debits and then a last posting of -5
+	chunked := func(
+		ctx context.Context,
+		account string,
+		from time.Time,
+		to time.Time,
+		after *domain.Posting,
+		limit int,
+	) ([]domain.Posting, error) {
+		if after == nil {
+			postings := make([]domain.Posting, limit)
+			for i := range postings {
+				postings[i] = domain.Posting{ID: uint64(i + 1), Account: account, Amount: decimal.NewFromInt(1), CreatedAt: from}
+			}
+			return postings, nil
+		}
+		if after.ID == uint64(limit) {
+			return []domain.Posting{{ID: after.ID + 1, Account: account, Amount: decimal.NewFromInt(-5), CreatedAt: from}}, nil
+		}
+		return nil, nil
+	}
+
+	tests := []struct {
+		name         string
+		walletID     int
+		from         time.Time
+		to           time.Time
+		listPostings func(context.Context, string, time.Time, time.Time, *domain.Posting, int) ([]domain.Posting, error)
+		notFound     bool
+		wantEntries  int
+		wantClosing  decimal.Decimal
+		wantErr      error
+	}{
+		{
+			name:        "happy case - statement",
+			walletID:    1,
+			from:        from,
+			to:          to,
+			wantEntries: 2,
+			wantClosing: decimal.NewFromInt(220),
+		},
+		{
+			name:         "happy case - statement over many chunks",
+			walletID:     1,
+			from:         from,
+			to:           to,
+			listPostings: chunked,
+			wantEntries:  usecases.StatementChunk + 1,
+			wantClosing:  decimal.NewFromInt(200 + usecases.StatementChunk - 5),
+		},
+		{
+			name:     "sad case - invalid wallet ID",
+			walletID: -1,
+			from:     from,
+			to:       to,
+			wantErr:  domain.ErrValidation,
+		},
+		{
+			name:     "sad case - period ending before it starts",
+			walletID: 1,
+			from:     to,
+			to:       from,
+			wantErr:  domain.ErrValidation,
+		},
+		{
+			name:     "sad case - period ending in the future",
+			walletID: 1,
+			from:     from,
+			to:       time.Now().Add(time.Hour),
+			wantErr:  domain.ErrValidation,
+		},
+		{
+			name:     "sad case - wallet not found",
+			walletID: 1,
+			from:     from,
+			to:       to,
+			notFound: true,
+			wantErr:  domain.ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := mocks.NewMockRepo()
+			if tt.notFound {
+				repo.MockGetBalanceAsOf = func(ctx context.Context, walletID int, asOf time.Time) (*domain.Wallet, error) {
+					return nil, domain.NewError(domain.ErrNotFound, "wallet not found", nil)
+				}
+			}
+			postings := mocks.NewMockPostings()
+			if tt.listPostings != nil {
+				postings.MockListPostings = tt.listPostings
+			}
+			s := usecases.NewStatementUsecases(repo, postings, "EUR")
+
+			var w recordedStatement
+			err := s.Statement(ctx, tt.walletID, tt.from, tt.to, &w)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Statement() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if w.opened != nil {
+					t.Fatalf("expected nothing to be written but the statement was opened")
+				}
+				return
+			}
+
+			if w.opened == nil || !w.opened.Opening.Equal(decimal.NewFromInt(200)) || w.opened.Currency != "EUR" {
+				t.Fatalf("expected the statement to open with 200 EUR but got %+v", w.opened)
+			}
+			if len(w.entries) != tt.wantEntries {
+				t.Fatalf("expected %d entries but got %d", tt.wantEntries, len(w.entries))
+			}
+			last := w.entries[len(w.entries)-1]
+			if !last.Balance.Equal(tt.wantClosing) || last.Type != dto.CreditOperation {
+				t.Fatalf("expected the last entry to be a credit leaving %s but got %+v", tt.wantClosing, last)
+			}
+			if w.closed == nil || w.closed.Closing == nil || !w.closed.Closing.Equal(tt.wantClosing) {
+				t.Fatalf("expected the statement to close with %s but got %+v", tt.wantClosing, w.closed)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package usecases
+
+import (
+	"sync"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+)
+
+// balanceUpdates fans wallet balance updates out to everyone watching a wallet
+type balanceUpdates struct {
+	mu       sync.Mutex
+	watchers map[int]map[chan *domain.Wallet]struct{}
+}
+
+func newBalanceUpdates() *balanceUpdates {
+	return &balanceUpdates{
+		watchers: map[int]map[chan *domain.Wallet]struct{}{},
+	}
+}
+
+// subscribe registers a watcher of a wallet's balance. The watcher only ever holds
+// the latest balance so a slow watcher skips intermediate updates instead of
+// holding up the others. The returned func unregisters the watcher
+func (b *balanceUpdates) subscribe(walletID int) (chan *domain.Wallet, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan *domain.Wallet, 1)
+	if b.watchers[walletID] == nil {
+		b.watchers[walletID] = map[chan *domain.Wallet]struct{}{}
+	}
+	b.watchers[walletID][ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		delete(b.watchers[walletID], ch)
+		if len(b.watchers[walletID]) == 0 {
+			delete(b.watchers, walletID)
+		}
+	}
+}
+
+// publish notifies the wallet's watchers of its new balance
+func (b *balanceUpdates) publish(wallet *domain.Wallet) {
+	if wallet == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.watchers[wallet.ID] {
+		update := *wallet
+		replaceLatest(ch, &update)
+	}
+}
+
+func replaceLatest(ch chan *domain.Wallet, wallet *domain.Wallet) {
+	for {
+		select {
+		case ch <- wallet:
+			return
+		default:
+		}
+
+		select {
+		case <-ch:
+		default:
+		}
+	}
+}
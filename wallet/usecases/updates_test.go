@@ -0,0 +1,122 @@
+package usecases_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository/mocks"
+	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
+	"github.com/shopspring/decimal"
+)
+
+// memoryBroadcast passes balance updates to every subscribed instance, like
+// Redis pub/sub does
+type memoryBroadcast struct {
+	mu       sync.Mutex
+	handlers []func(wallet *domain.Wallet)
+	ready    sync.WaitGroup
+	down     bool
+}
+
+func (b *memoryBroadcast) PublishBalance(ctx context.Context, wallet *domain.Wallet) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.down {
+		return fmt.Errorf("dial tcp 10.0.0.1:6379")
+	}
+	for _, handler := range b.handlers {
+		handler(wallet)
+	}
+	return nil
+}
+
+func (b *memoryBroadcast) SubscribeBalances(ctx context.Context, handler func(wallet *domain.Wallet)) error {
+	b.mu.Lock()
+	b.handlers = append(b.handlers, handler)
+	b.mu.Unlock()
+	b.ready.Done()
+
+	<-ctx.Done()
+	return nil
+}
+
+func newInstance(t *testing.T, ctx context.Context, broadcast *memoryBroadcast) *usecases.WalletUsecases {
+	updateMockRepo := mocks.NewMockRepo()
+	uc := usecases.NewWalletUsecases(mocks.NewMockRepo(), updateMockRepo, mocks.NewMockRepo())
+	uc.Broadcast = broadcast
+
+	broadcast.ready.Add(1)
+	go func() {
+		if err := uc.ListenForUpdates(ctx); err != nil {
+			t.Errorf("ListenForUpdates() error = %v", err)
+		}
+	}()
+	return uc
+}
+
+func TestWalletUsecases_WatchBalance_Broadcast(t *testing.T) {
+	tests := []struct {
+		name        string
+		down        bool
+		debitOnSelf bool
+		wantBalance string
+	}{
+		{
+			name:        "happy case - update made through another instance",
+			wantBalance: "225",
+		},
+		{
+			name:        "happy case - update made through this instance",
+			debitOnSelf: true,
+			wantBalance: "225",
+		},
+		{
+			name:        "sad case - broadcast is down, this instance's watchers are notified",
+			down:        true,
+			debitOnSelf: true,
+			wantBalance: "225",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			broadcast := &memoryBroadcast{}
+			watched := newInstance(t, ctx, broadcast)
+			other := newInstance(t, ctx, broadcast)
+			broadcast.ready.Wait()
+			broadcast.down = tt.down
+
+			updates, err := watched.WatchBalance(ctx, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if current := <-updates; current.Balance.String() != "200" {
+				t.Fatalf("expected the current balance first but got %s", current.Balance)
+			}
+
+			debitedOn := other
+			if tt.debitOnSelf {
+				debitedOn = watched
+			}
+			if _, err := debitedOn.DebitWallet(ctx, 1, decimal.NewFromInt(25)); err != nil {
+				t.Fatal(err)
+			}
+
+			select {
+			case update := <-updates:
+				if update.Balance.String() != tt.wantBalance {
+					t.Fatalf("expected balance %s but got %s", tt.wantBalance, update.Balance)
+				}
+			case <-ctx.Done():
+				t.Fatalf("expected the update to be seen")
+			}
+		})
+	}
+}
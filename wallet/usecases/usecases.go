@@ -2,8 +2,13 @@ package usecases
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
 	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
@@ -17,6 +22,15 @@ type WalletBusinessLogic interface {
 		ctx context.Context,
 		walletID int,
 	) (*domain.Wallet, error)
+	WalletBalanceAsOf(
+		ctx context.Context,
+		walletID int,
+		asOf time.Time,
+	) (*domain.Wallet, error)
+	WalletBalances(
+		ctx context.Context,
+		walletIDs []int,
+	) ([]dto.WalletBalanceResult, error)
 	CreditWallet(
 		ctx context.Context,
 		walletID int,
@@ -27,23 +41,64 @@ type WalletBusinessLogic interface {
 		walletID int,
 		debitAmount decimal.Decimal,
 	) (*domain.Wallet, error)
+	ApplyBatch(
+		ctx context.Context,
+		input dto.BatchInput,
+	) (*dto.BatchResult, error)
+	WatchBalance(
+		ctx context.Context,
+		walletID int,
+	) (<-chan *domain.Wallet, error)
 }
 
+var (
+	errBatchClaimed      = errors.New("batch has already been claimed")
+	errBatchRejected     = errors.New("batch has been rejected")
+	errInsufficientFunds = domain.NewError(
+		domain.ErrInsufficientFunds,
+		"a wallet balance cannot go below 0",
+		nil,
+	)
+	errWalletNotFound       = domain.NewError(domain.ErrNotFound, "wallet not found", nil)
+	errWalletFrozen         = domain.NewError(domain.ErrFrozen, "the wallet is frozen", nil)
+	errHistoryNotConfigured = domain.NewError(domain.ErrUnavailable, "balance history has not been configured", nil)
+)
+
 // WalletUsecases sets up wallet's API server usecase layer
 // with all the necessary dependencies
 type WalletUsecases struct {
 	Get    repository.Get
 	Update repository.Update
+	Batch  repository.Batch
+	// Broadcast is optional, without it balance watchers only see the
+	// updates made through this instance
+	Broadcast repository.Updates
+	// History is optional, without it balances can only be read as they are now
+	History repository.History
+	// Counterparties are the ledger accounts wallets' credits and debits are
+	// balanced against, the house by default
+	Counterparties Counterparties
+	// Rules are the configured credit/debit validation rules batches are checked
+	// against, the zero value only enforces the rules every batch has to follow
+	Rules dto.Rules
+
+	updates *balanceUpdates
 }
 
 // NewWalletUsecases initializes wallet's business logic
 func NewWalletUsecases(
 	get repository.Get,
 	update repository.Update,
+	batch repository.Batch,
 ) *WalletUsecases {
 	w := &WalletUsecases{
 		Get:    get,
 		Update: update,
+		Batch:  batch,
+
+		Counterparties: DefaultCounterparties,
+
+		updates: newBalanceUpdates(),
 	}
 	w.checkPreconditions()
 	return w
@@ -56,6 +111,12 @@ func (w *WalletUsecases) checkPreconditions() {
 	if w.Update == nil {
 		log.Panicf("wallet usecases have not initalized UPDATE repository")
 	}
+	if w.Batch == nil {
+		log.Panicf("wallet usecases have not initalized BATCH repository")
+	}
+	if err := w.Counterparties.Valid(); err != nil {
+		log.Panicf("wallet usecases have invalid ledger counterparties: %v", err)
+	}
 }
 
 // WalletBalance gets the current balance of a wallet
@@ -71,7 +132,51 @@ func (w *WalletUsecases) WalletBalance(
 	return wallet, nil
 }
 
-// CreditWallet credits money on a given wallet
+// WalletBalanceAsOf gets the balance a wallet had at the given moment
+func (w *WalletUsecases) WalletBalanceAsOf(
+	ctx context.Context,
+	walletID int,
+	asOf time.Time,
+) (*domain.Wallet, error) {
+	if w.History == nil {
+		return nil, dto.Wrap(errHistoryNotConfigured, "WalletBalanceAsOf")
+	}
+
+	wallet, err := w.History.GetBalanceAsOf(ctx, walletID, asOf)
+	if err != nil {
+		return nil, dto.Wrap(err, "WalletBalanceAsOf")
+	}
+
+	return wallet, nil
+}
+
+// WalletBalances gets the current balances of many wallets. A result is returned
+// for every requested wallet, in the order requested, marking the ones not found
+func (w *WalletUsecases) WalletBalances(
+	ctx context.Context,
+	walletIDs []int,
+) ([]dto.WalletBalanceResult, error) {
+	wallets, err := w.Get.GetBalances(ctx, walletIDs)
+	if err != nil {
+		return nil, dto.Wrap(err, "WalletBalances")
+	}
+
+	results := make([]dto.WalletBalanceResult, len(walletIDs))
+	for i, walletID := range walletIDs {
+		wallet, ok := wallets[walletID]
+		results[i] = dto.WalletBalanceResult{
+			WalletID: walletID,
+			Found:    ok,
+			Wallet:   wallet,
+		}
+	}
+
+	return results, nil
+}
+
+// CreditWallet credits money on a given wallet unless it is frozen. The wallet's balance
+// is checked to cover the credit when it is updated, not against the balance read here
+// which may have been cached
 func (w *WalletUsecases) CreditWallet(
 	ctx context.Context,
 	walletID int,
@@ -81,21 +186,24 @@ func (w *WalletUsecases) CreditWallet(
 	if err != nil {
 		return nil, dto.Wrap(err, "CreditWallet")
 	}
-	balance := wallet.Balance.Sub(creditAmount)
-
-	if balance.IsNegative() {
-		return nil, dto.Wrap(fmt.Errorf("a wallet balance cannot go below 0"), "CreditWallet")
+	if wallet.Frozen {
+		return nil, dto.Wrap(errWalletFrozen, "CreditWallet")
+	}
+	txn, err := w.transfer(walletID, creditAmount.Neg())
+	if err != nil {
+		return nil, dto.Wrap(err, "CreditWallet")
 	}
 
-	updatedWallet, err := w.Update.UpdateBalance(ctx, wallet, balance)
+	updatedWallet, err := w.Update.UpdateBalance(ctx, wallet, txn)
 	if err != nil {
 		return nil, dto.Wrap(err, "CreditWallet")
 	}
+	w.publish(ctx, updatedWallet)
 
 	return updatedWallet, nil
 }
 
-// DebitWallet debits money on a given wallet
+// DebitWallet debits money on a given wallet unless it is frozen
 func (w *WalletUsecases) DebitWallet(
 	ctx context.Context,
 	walletID int,
@@ -105,12 +213,356 @@ func (w *WalletUsecases) DebitWallet(
 	if err != nil {
 		return nil, dto.Wrap(err, "DebitWallet")
 	}
-	balance := wallet.Balance.Add(debitAmount)
+	if wallet.Frozen {
+		return nil, dto.Wrap(errWalletFrozen, "DebitWallet")
+	}
+	txn, err := w.transfer(walletID, debitAmount)
+	if err != nil {
+		return nil, dto.Wrap(err, "DebitWallet")
+	}
 
-	updatedWallet, err := w.Update.UpdateBalance(ctx, wallet, balance)
+	updatedWallet, err := w.Update.UpdateBalance(ctx, wallet, txn)
 	if err != nil {
-		dto.Wrap(err, "DebitWallet")
+		return nil, dto.Wrap(err, "DebitWallet")
 	}
+	w.publish(ctx, updatedWallet)
 
 	return updatedWallet, nil
 }
+
+// ApplyBatch applies many credits/debits at once, either all or nothing (atomic)
+// or every one that can be applied (best effort). Wallets are row locked while
+// the batch is applied and a batch retried with the same idempotency key returns
+// the outcome of the first attempt instead of being applied again
+func (w *WalletUsecases) ApplyBatch(
+	ctx context.Context,
+	input dto.BatchInput,
+) (*dto.BatchResult, error) {
+	if err := input.Valid(w.Rules); err != nil {
+		return nil, dto.Wrap(err, "ApplyBatch")
+	}
+
+	requestHash, err := hashBatch(input)
+	if err != nil {
+		return nil, dto.Wrap(err, "ApplyBatch")
+	}
+
+	if replayed, err := w.replayBatch(ctx, input.IdempotencyKey, requestHash); replayed != nil || err != nil {
+		return replayed, err
+	}
+
+	var result *dto.BatchResult
+	err = w.Batch.Transact(ctx, func(tx repository.Tx) error {
+		batch := &domain.Batch{
+			IdempotencyKey: input.IdempotencyKey,
+			RequestHash:    requestHash,
+		}
+		claimed, err := tx.ClaimBatch(ctx, batch)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			return errBatchClaimed
+		}
+
+		result, err = applyBatch(ctx, tx, input, w.Counterparties)
+		if err != nil {
+			return err
+		}
+		if !result.Applied {
+			return errBatchRejected
+		}
+
+		batch.Result, err = json.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("failed to marshal batch result with err %v", err)
+		}
+		return tx.SaveBatch(ctx, batch)
+	})
+	switch {
+	case errors.Is(err, errBatchClaimed):
+		// a concurrent attempt with the same key has been applied in the meantime
+		return w.replayBatch(ctx, input.IdempotencyKey, requestHash)
+
+	case errors.Is(err, errBatchRejected):
+		return result, nil
+
+	case err != nil:
+		return nil, dto.Wrap(err, "ApplyBatch")
+	}
+
+	w.publishBatch(ctx, result)
+	return result, nil
+}
+
+// publishBatch notifies watchers of the final balance of every wallet a batch updated
+func (w *WalletUsecases) publishBatch(ctx context.Context, result *dto.BatchResult) {
+	final := map[int]*domain.Wallet{}
+	for _, opResult := range result.Results {
+		if opResult.Succeeded {
+			final[opResult.WalletID] = opResult.Wallet
+		}
+	}
+	for _, wallet := range final {
+		w.publish(ctx, wallet)
+	}
+}
+
+// publish notifies the watchers of a wallet of its new balance, on every instance
+// when the update can be broadcast and on this instance otherwise
+func (w *WalletUsecases) publish(ctx context.Context, wallet *domain.Wallet) {
+	if w.Broadcast != nil && wallet != nil {
+		if err := w.Broadcast.PublishBalance(ctx, wallet); err == nil {
+			// this instance's watchers are notified when the broadcast comes back
+			return
+		}
+	}
+	w.updates.publish(wallet)
+}
+
+// ListenForUpdates notifies this instance's watchers of the balance updates
+// broadcast by every instance. It blocks until the context is cancelled or the
+// subscription fails or ends, after which it is expected to be called again
+func (w *WalletUsecases) ListenForUpdates(ctx context.Context) error {
+	if w.Broadcast == nil {
+		return nil
+	}
+
+	if err := w.Broadcast.SubscribeBalances(ctx, w.updates.publish); err != nil {
+		return dto.Wrap(err, "ListenForUpdates")
+	}
+	return nil
+}
+
+// WatchBalance streams a wallet's current balance followed by every update to it
+// until the context is done. Updates made through other instances are only seen
+// when they are broadcast
+func (w *WalletUsecases) WatchBalance(
+	ctx context.Context,
+	walletID int,
+) (<-chan *domain.Wallet, error) {
+	updates, unsubscribe := w.updates.subscribe(walletID)
+
+	wallet, err := w.Get.GetBalance(ctx, walletID)
+	if err != nil {
+		unsubscribe()
+		return nil, dto.Wrap(err, "WatchBalance")
+	}
+	// an update published between subscribing and reading the balance is newer
+	select {
+	case updates <- wallet:
+	default:
+	}
+
+	out := make(chan *domain.Wallet)
+	go func() {
+		defer close(out)
+		defer unsubscribe()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case wallet := <-updates:
+				select {
+				case out <- wallet:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// replayBatch returns the stored outcome of an already processed batch
+func (w *WalletUsecases) replayBatch(
+	ctx context.Context,
+	idempotencyKey string,
+	requestHash string,
+) (*dto.BatchResult, error) {
+	batch, err := w.Batch.GetBatch(ctx, idempotencyKey)
+	if err != nil {
+		return nil, dto.Wrap(err, "replayBatch")
+	}
+	if batch == nil {
+		return nil, nil
+	}
+
+	if batch.RequestHash != requestHash {
+		return nil, dto.Wrap(
+			domain.NewError(
+				domain.ErrConflict,
+				"idempotency key has already been used for a different batch",
+				nil,
+			),
+			"replayBatch",
+		)
+	}
+
+	var result dto.BatchResult
+	if err := json.Unmarshal(batch.Result, &result); err != nil {
+		return nil, dto.Wrap(
+			fmt.Errorf("failed to unmarshal batch result with err %v", err),
+			"replayBatch",
+		)
+	}
+	result.Replayed = true
+
+	return &result, nil
+}
+
+// applyBatch locks the batch's wallets, works out every operation's outcome in
+// order, failing the operations on frozen wallets, and writes the resulting
+// balances, posting each wallet's operations to the ledger as one transaction.
+// Nothing is written when an atomic batch has a failing operation
+func applyBatch(
+	ctx context.Context,
+	tx repository.Tx,
+	input dto.BatchInput,
+	counterparties Counterparties,
+) (*dto.BatchResult, error) {
+	walletIDs := []int{}
+	seen := map[int]bool{}
+	for _, op := range input.Operations {
+		if !seen[op.WalletID] {
+			seen[op.WalletID] = true
+			walletIDs = append(walletIDs, op.WalletID)
+		}
+	}
+
+	wallets, err := tx.LockWallets(ctx, walletIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &dto.BatchResult{
+		IdempotencyKey: input.IdempotencyKey,
+		Mode:           input.Mode,
+		Applied:        true,
+		Results:        make([]dto.BatchOperationResult, len(input.Operations)),
+	}
+	balances := map[int]decimal.Decimal{}
+	txns := map[int]*domain.LedgerTransaction{}
+	failed := false
+	for i, op := range input.Operations {
+		opResult := dto.BatchOperationResult{
+			Index:    i,
+			WalletID: op.WalletID,
+			Type:     op.Type,
+		}
+
+		wallet, ok := wallets[op.WalletID]
+		if !ok {
+			opResult.Code = domain.ErrorCode(errWalletNotFound)
+			opResult.Error = errWalletNotFound.Detail
+			result.Results[i] = opResult
+			failed = true
+			continue
+		}
+		if wallet.Frozen {
+			opResult.Code = domain.ErrorCode(errWalletFrozen)
+			opResult.Error = errWalletFrozen.Detail
+			result.Results[i] = opResult
+			failed = true
+			continue
+		}
+
+		current, ok := balances[op.WalletID]
+		if !ok {
+			current = wallet.Balance
+		}
+		balance, err := applyOperation(current, op)
+		if err != nil {
+			opResult.Code = domain.ErrorCode(err)
+			opResult.Error = domain.ErrorDetail(err)
+			result.Results[i] = opResult
+			failed = true
+			continue
+		}
+
+		txn, ok := txns[op.WalletID]
+		if !ok {
+			if txn, err = newLedgerTransaction(); err != nil {
+				return nil, err
+			}
+			txns[op.WalletID] = txn
+		}
+		counterparties.post(txn, op.WalletID, balance.Sub(current))
+
+		balances[op.WalletID] = balance
+		opResult.Succeeded = true
+		opResult.Wallet = &domain.Wallet{ID: op.WalletID, Balance: balance}
+		result.Results[i] = opResult
+	}
+
+	if failed && input.Mode == dto.AtomicBatch {
+		result.Applied = false
+		for i := range result.Results {
+			result.Results[i].Succeeded = false
+			result.Results[i].Wallet = nil
+		}
+		return result, nil
+	}
+
+	for _, walletID := range walletIDs {
+		txn, ok := txns[walletID]
+		if !ok {
+			continue
+		}
+		if err := CheckBalanced(txn); err != nil {
+			return nil, err
+		}
+		if _, err := tx.UpdateBalance(ctx, wallets[walletID], txn); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// applyOperation works out a wallet's balance after a batch operation
+// following the same rules as CreditWallet and DebitWallet
+func applyOperation(
+	balance decimal.Decimal,
+	op dto.BatchOperation,
+) (decimal.Decimal, error) {
+	switch op.Type {
+	case dto.CreditOperation:
+		balance = balance.Sub(op.Amount.Decimal)
+		if balance.IsNegative() {
+			return balance, errInsufficientFunds
+		}
+		return balance, nil
+
+	case dto.DebitOperation:
+		return balance.Add(op.Amount.Decimal), nil
+
+	default:
+		return balance, domain.NewError(
+			domain.ErrValidation,
+			fmt.Sprintf("unsupported operation type %q", op.Type),
+			nil,
+		)
+	}
+}
+
+// hashBatch fingerprints a batch so that an idempotency key can not be reused
+// for a batch with different operations
+func hashBatch(input dto.BatchInput) (string, error) {
+	bs, err := json.Marshal(struct {
+		Mode       dto.BatchMode        `json:"mode"`
+		Operations []dto.BatchOperation `json:"operations"`
+	}{
+		Mode:       input.Mode,
+		Operations: input.Operations,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal batch with err %v", err)
+	}
+
+	sum := sha256.Sum256(bs)
+	return hex.EncodeToString(sum[:]), nil
+}
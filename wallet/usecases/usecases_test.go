@@ -2,18 +2,24 @@ package usecases_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"os"
 	"strconv"
 	"testing"
 
 	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
 	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/database"
+	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/audit"
 	"github.com/ageeknamedslickback/wallet-API/wallet/infrastructure/services/cache"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository"
 	"github.com/ageeknamedslickback/wallet-API/wallet/repository/mocks"
 	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
-	"github.com/go-redis/redis"
+	"github.com/go-redis/redis/v8"
 	"github.com/shopspring/decimal"
 )
 
@@ -35,9 +41,12 @@ func initTestUsecases() *usecases.WalletUsecases {
 		DB:       db,
 	})
 	c := cache.NewCacheService(rdb)
-	getRepo := database.NewWalletDb(gormDb, c)
-	updateRepo := database.NewWalletDb(gormDb, c)
-	w := usecases.NewWalletUsecases(getRepo, updateRepo)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	key := audit.Key{Secret: []byte("a test audit key of at least 32 characters"), From: 1}
+	getRepo := database.NewWalletDb(gormDb, c, key, logger)
+	updateRepo := database.NewWalletDb(gormDb, c, key, logger)
+	batchRepo := database.NewWalletDb(gormDb, c, key, logger)
+	w := usecases.NewWalletUsecases(getRepo, updateRepo, batchRepo)
 	return w
 }
 
@@ -72,7 +81,8 @@ func UnitTestWalletBalance(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			getMockRepo := mocks.NewMockRepo()
 			updateMockRepo := mocks.NewMockRepo()
-			w := usecases.NewWalletUsecases(getMockRepo, updateMockRepo)
+			batchMockRepo := mocks.NewMockRepo()
+			w := usecases.NewWalletUsecases(getMockRepo, updateMockRepo, batchMockRepo)
 
 			if tt.name == "sad case" {
 				getMockRepo.MockGetBalance = func(ctx context.Context, walletID int) (*domain.Wallet, error) {
@@ -220,10 +230,11 @@ func UnitTestCreditWallet(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			getMockRepo := mocks.NewMockRepo()
 			updateMockRepo := mocks.NewMockRepo()
-			w := usecases.NewWalletUsecases(getMockRepo, updateMockRepo)
+			batchMockRepo := mocks.NewMockRepo()
+			w := usecases.NewWalletUsecases(getMockRepo, updateMockRepo, batchMockRepo)
 
 			if tt.name == "happy case" {
-				updateMockRepo.MockUpdateBalance = func(ctx context.Context, wallet *domain.Wallet, balance decimal.Decimal) (*domain.Wallet, error) {
+				updateMockRepo.MockUpdateBalance = func(ctx context.Context, wallet *domain.Wallet, txn *domain.LedgerTransaction) (*domain.Wallet, error) {
 					return &domain.Wallet{ID: 1, Balance: decimal.NewFromFloat(250)}, nil
 				}
 			}
@@ -233,7 +244,7 @@ func UnitTestCreditWallet(t *testing.T) {
 			}
 
 			if tt.name == "sad case - failed to update balance" {
-				updateMockRepo.MockUpdateBalance = func(ctx context.Context, wallet *domain.Wallet, balance decimal.Decimal) (*domain.Wallet, error) {
+				updateMockRepo.MockUpdateBalance = func(ctx context.Context, wallet *domain.Wallet, txn *domain.LedgerTransaction) (*domain.Wallet, error) {
 					return nil, fmt.Errorf("error")
 				}
 			}
@@ -386,10 +397,11 @@ func UnitTestDebitWallet(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			getMockRepo := mocks.NewMockRepo()
 			updateMockRepo := mocks.NewMockRepo()
-			w := usecases.NewWalletUsecases(getMockRepo, updateMockRepo)
+			batchMockRepo := mocks.NewMockRepo()
+			w := usecases.NewWalletUsecases(getMockRepo, updateMockRepo, batchMockRepo)
 
 			if tt.name == "happy case" {
-				updateMockRepo.MockUpdateBalance = func(ctx context.Context, wallet *domain.Wallet, balance decimal.Decimal) (*domain.Wallet, error) {
+				updateMockRepo.MockUpdateBalance = func(ctx context.Context, wallet *domain.Wallet, txn *domain.LedgerTransaction) (*domain.Wallet, error) {
 					return &domain.Wallet{ID: 1, Balance: decimal.NewFromFloat(250)}, nil
 				}
 			}
@@ -399,7 +411,7 @@ func UnitTestDebitWallet(t *testing.T) {
 			}
 
 			if tt.name == "sad case - failed to update balance" {
-				updateMockRepo.MockUpdateBalance = func(ctx context.Context, wallet *domain.Wallet, balance decimal.Decimal) (*domain.Wallet, error) {
+				updateMockRepo.MockUpdateBalance = func(ctx context.Context, wallet *domain.Wallet, txn *domain.LedgerTransaction) (*domain.Wallet, error) {
 					return nil, fmt.Errorf("error")
 				}
 			}
@@ -498,3 +510,355 @@ func TestWalletUsecases_DebitWallet(t *testing.T) {
 		})
 	}
 }
+
+func TestWalletUsecases_WalletBalances(t *testing.T) {
+	type args struct {
+		ctx       context.Context
+		walletIDs []int
+	}
+	tests := []struct {
+		name      string
+		args      args
+		wantFound []bool
+		wantErr   bool
+	}{
+		{
+			name: "happy case",
+			args: args{
+				ctx:       ctx,
+				walletIDs: []int{1, 99, 1},
+			},
+			wantFound: []bool{true, false, true},
+			wantErr:   false,
+		},
+		{
+			name: "sad case",
+			args: args{
+				ctx:       ctx,
+				walletIDs: []int{1},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getMockRepo := mocks.NewMockRepo()
+			updateMockRepo := mocks.NewMockRepo()
+			batchMockRepo := mocks.NewMockRepo()
+			w := usecases.NewWalletUsecases(getMockRepo, updateMockRepo, batchMockRepo)
+
+			if tt.name == "sad case" {
+				getMockRepo.MockGetBalances = func(ctx context.Context, walletIDs []int) (map[int]*domain.Wallet, error) {
+					return nil, fmt.Errorf("failed to get wallets")
+				}
+			}
+
+			results, err := w.WalletBalances(tt.args.ctx, tt.args.walletIDs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WalletUsecases.WalletBalances() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr {
+				if len(results) != len(tt.args.walletIDs) {
+					t.Fatalf("expected a result for every wallet but got %d", len(results))
+				}
+				for i, result := range results {
+					if result.WalletID != tt.args.walletIDs[i] {
+						t.Fatalf("expected results in the requested order")
+					}
+					if result.Found != tt.wantFound[i] {
+						t.Fatalf("expected wallet %d found to be %v", result.WalletID, tt.wantFound[i])
+					}
+					if result.Found != (result.Wallet != nil) {
+						t.Fatalf("expected only found wallets to carry a balance")
+					}
+				}
+			}
+
+			if tt.wantErr && results != nil {
+				t.Fatalf("did not expect results")
+			}
+		})
+	}
+}
+
+func TestWalletUsecases_ApplyBatch(t *testing.T) {
+	operations := []dto.BatchOperation{
+		{WalletID: 1, Type: dto.CreditOperation, AmountInput: dto.AmountInput{Amount: decimal.NewNullDecimal(decimal.NewFromFloat(150))}},
+		{WalletID: 1, Type: dto.CreditOperation, AmountInput: dto.AmountInput{Amount: decimal.NewNullDecimal(decimal.NewFromFloat(100))}},
+		{WalletID: 2, Type: dto.DebitOperation, AmountInput: dto.AmountInput{Amount: decimal.NewNullDecimal(decimal.NewFromFloat(10))}},
+		{WalletID: 1, Type: dto.DebitOperation, AmountInput: dto.AmountInput{Amount: decimal.NewNullDecimal(decimal.NewFromFloat(5))}},
+	}
+
+	tests := []struct {
+		name          string
+		mode          dto.BatchMode
+		wantSucceeded []bool
+		frozen        bool
+		wantApplied   bool
+		wantUpdates   int
+		wantErr       bool
+	}{
+		{
+			name:          "happy case - best effort",
+			mode:          dto.BestEffortBatch,
+			wantSucceeded: []bool{true, false, false, true},
+			wantApplied:   true,
+			wantUpdates:   1,
+		},
+		{
+			name:          "happy case - atomic batch rejected",
+			mode:          dto.AtomicBatch,
+			wantSucceeded: []bool{false, false, false, false},
+			wantApplied:   false,
+			wantUpdates:   0,
+		},
+		{
+			name:          "happy case - frozen wallet",
+			mode:          dto.BestEffortBatch,
+			frozen:        true,
+			wantSucceeded: []bool{false, false, false, false},
+			wantApplied:   true,
+			wantUpdates:   0,
+		},
+		{
+			name:    "sad case - failed to update balance",
+			mode:    dto.BestEffortBatch,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getMockRepo := mocks.NewMockRepo()
+			updateMockRepo := mocks.NewMockRepo()
+			batchMockRepo := mocks.NewMockRepo()
+			w := usecases.NewWalletUsecases(getMockRepo, updateMockRepo, batchMockRepo)
+
+			tx := mocks.NewMockTx()
+			updates := 0
+			tx.MockUpdateBalance = func(ctx context.Context, wallet *domain.Wallet, txn *domain.LedgerTransaction) (*domain.Wallet, error) {
+				if tt.name == "sad case - failed to update balance" {
+					return nil, fmt.Errorf("error")
+				}
+				updates++
+				updated, err := mocks.ChangeBalance(wallet, txn)
+				if err != nil {
+					return nil, err
+				}
+				if !updated.Balance.Equal(decimal.NewFromFloat(55)) {
+					t.Fatalf("expected wallet 1 to end up with 55 but got %s", updated.Balance)
+				}
+				return updated, nil
+			}
+			if tt.frozen {
+				tx.MockLockWallets = func(ctx context.Context, walletIDs []int) (map[int]*domain.Wallet, error) {
+					return map[int]*domain.Wallet{
+						1: {ID: 1, Balance: decimal.NewFromFloat(200), Frozen: true},
+					}, nil
+				}
+			}
+			batchMockRepo.MockTransact = func(ctx context.Context, fn func(tx repository.Tx) error) error {
+				return fn(tx)
+			}
+
+			result, err := w.ApplyBatch(ctx, dto.BatchInput{
+				IdempotencyKey: "key",
+				Mode:           tt.mode,
+				Operations:     operations,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WalletUsecases.ApplyBatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if result != nil {
+					t.Fatalf("did not expect a batch result")
+				}
+				return
+			}
+
+			if result.Applied != tt.wantApplied {
+				t.Fatalf("expected applied to be %v", tt.wantApplied)
+			}
+			if updates != tt.wantUpdates {
+				t.Fatalf("expected %d balance updates but got %d", tt.wantUpdates, updates)
+			}
+			for i, want := range tt.wantSucceeded {
+				if result.Results[i].Succeeded != want {
+					t.Fatalf("expected operation %d succeeded to be %v", i, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWalletUsecases_ApplyBatch_AmountLimits(t *testing.T) {
+	rules := dto.Rules{
+		Credit: dto.AmountLimits{Max: decimal.NewFromInt(50000)},
+		Debit:  dto.AmountLimits{Max: decimal.NewFromInt(50000)},
+	}
+
+	tests := []struct {
+		name    string
+		amount  decimal.Decimal
+		wantErr bool
+	}{
+		{
+			name:   "happy case - above 10000 within the configured maximum",
+			amount: decimal.NewFromInt(20000),
+		},
+		{
+			name:    "sad case - above the configured maximum",
+			amount:  decimal.NewFromInt(50001),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batchMockRepo := mocks.NewMockRepo()
+			w := usecases.NewWalletUsecases(mocks.NewMockRepo(), mocks.NewMockRepo(), batchMockRepo)
+			w.Rules = rules
+
+			tx := mocks.NewMockTx()
+			batchMockRepo.MockTransact = func(ctx context.Context, fn func(tx repository.Tx) error) error {
+				return fn(tx)
+			}
+
+			result, err := w.ApplyBatch(ctx, dto.BatchInput{
+				IdempotencyKey: "key",
+				Mode:           dto.AtomicBatch,
+				Operations: []dto.BatchOperation{
+					{WalletID: 1, Type: dto.DebitOperation, AmountInput: dto.AmountInput{Amount: decimal.NewNullDecimal(tt.amount)}},
+				},
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WalletUsecases.ApplyBatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, domain.ErrValidation) {
+					t.Fatalf("expected an invalid batch but got %v", err)
+				}
+				return
+			}
+			if !result.Applied || !result.Results[0].Succeeded {
+				t.Fatalf("expected the batch to be applied")
+			}
+		})
+	}
+}
+
+func TestWalletUsecases_FrozenWallet(t *testing.T) {
+	getMockRepo := mocks.NewMockRepo()
+	updateMockRepo := mocks.NewMockRepo()
+	getMockRepo.MockGetBalance = func(ctx context.Context, walletID int) (*domain.Wallet, error) {
+		return &domain.Wallet{ID: walletID, Balance: decimal.NewFromFloat(200), Frozen: true}, nil
+	}
+	updateMockRepo.MockUpdateBalance = func(ctx context.Context, wallet *domain.Wallet, txn *domain.LedgerTransaction) (*domain.Wallet, error) {
+		t.Fatalf("did not expect a frozen wallet's balance to be updated")
+		return nil, nil
+	}
+	w := usecases.NewWalletUsecases(getMockRepo, updateMockRepo, mocks.NewMockRepo())
+
+	if _, err := w.CreditWallet(ctx, 1, decimal.NewFromFloat(10)); !errors.Is(err, domain.ErrFrozen) {
+		t.Fatalf("expected a frozen wallet not to be credited but got %v", err)
+	}
+	if _, err := w.DebitWallet(ctx, 1, decimal.NewFromFloat(10)); !errors.Is(err, domain.ErrFrozen) {
+		t.Fatalf("expected a frozen wallet not to be debited but got %v", err)
+	}
+}
+
+func TestWalletUsecases_ApplyBatch_Retries(t *testing.T) {
+	input := dto.BatchInput{
+		IdempotencyKey: "key",
+		Mode:           dto.AtomicBatch,
+		Operations: []dto.BatchOperation{
+			{WalletID: 1, Type: dto.DebitOperation, AmountInput: dto.AmountInput{Amount: decimal.NewNullDecimal(decimal.NewFromFloat(5))}},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		retry        dto.BatchInput
+		lostClaim    bool
+		wantReplayed bool
+		wantErr      bool
+	}{
+		{
+			name:         "happy case - retried batch",
+			retry:        input,
+			wantReplayed: true,
+		},
+		{
+			name:         "happy case - concurrent retry",
+			retry:        input,
+			lostClaim:    true,
+			wantReplayed: true,
+		},
+		{
+			name: "sad case - idempotency key reused",
+			retry: dto.BatchInput{
+				IdempotencyKey: input.IdempotencyKey,
+				Mode:           dto.BestEffortBatch,
+				Operations:     input.Operations,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getMockRepo := mocks.NewMockRepo()
+			updateMockRepo := mocks.NewMockRepo()
+			batchMockRepo := mocks.NewMockRepo()
+			w := usecases.NewWalletUsecases(getMockRepo, updateMockRepo, batchMockRepo)
+
+			batches := map[string]*domain.Batch{}
+			tx := mocks.NewMockTx()
+			tx.MockClaimBatch = func(ctx context.Context, batch *domain.Batch) (bool, error) {
+				if _, ok := batches[batch.IdempotencyKey]; ok {
+					return false, nil
+				}
+				batches[batch.IdempotencyKey] = batch
+				return true, nil
+			}
+			updates := 0
+			tx.MockUpdateBalance = func(ctx context.Context, wallet *domain.Wallet, txn *domain.LedgerTransaction) (*domain.Wallet, error) {
+				updates++
+				return mocks.ChangeBalance(wallet, txn)
+			}
+			batchMockRepo.MockTransact = func(ctx context.Context, fn func(tx repository.Tx) error) error {
+				return fn(tx)
+			}
+
+			lookups := 0
+			batchMockRepo.MockGetBatch = func(ctx context.Context, idempotencyKey string) (*domain.Batch, error) {
+				lookups++
+				// the concurrent retry does not see the first attempt until it loses the claim
+				if tt.lostClaim && lookups == 2 {
+					return nil, nil
+				}
+				return batches[idempotencyKey], nil
+			}
+
+			if _, err := w.ApplyBatch(ctx, input); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			result, err := w.ApplyBatch(ctx, tt.retry)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WalletUsecases.ApplyBatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if updates != 1 {
+				t.Fatalf("expected the batch to be applied once but got %d updates", updates)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if result.Replayed != tt.wantReplayed {
+				t.Fatalf("expected replayed to be %v", tt.wantReplayed)
+			}
+			if !result.Applied || !result.Results[0].Succeeded {
+				t.Fatalf("expected the outcome of the first attempt to be returned")
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package usecases
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository"
+)
+
+// MaxDeliveries is the maximum number of deliveries listed at once
+const MaxDeliveries = 100
+
+var errSubscriptionNotFound = domain.NewError(domain.ErrNotFound, "webhook subscription not found", nil)
+
+// WebhookBusinessLogic designs the webhook subscriptions' business logic. A
+// subscription is only visible to the owner (token subject) who created it
+type WebhookBusinessLogic interface {
+	Subscribe(
+		ctx context.Context,
+		owner string,
+		input dto.WebhookSubscriptionInput,
+	) (*dto.WebhookSubscription, error)
+	Subscriptions(
+		ctx context.Context,
+		owner string,
+	) ([]dto.WebhookSubscription, error)
+	Unsubscribe(
+		ctx context.Context,
+		owner string,
+		id uint64,
+	) error
+	Deliveries(
+		ctx context.Context,
+		owner string,
+		id uint64,
+		limit int,
+	) ([]domain.WebhookDelivery, error)
+}
+
+// WebhookUsecases sets up the webhook subscriptions' usecase layer
+type WebhookUsecases struct {
+	Webhooks repository.Webhooks
+}
+
+// NewWebhookUsecases initializes the webhook subscriptions' business logic
+func NewWebhookUsecases(webhooks repository.Webhooks) *WebhookUsecases {
+	w := &WebhookUsecases{
+		Webhooks: webhooks,
+	}
+	w.checkPreconditions()
+	return w
+}
+
+func (w *WebhookUsecases) checkPreconditions() {
+	if w.Webhooks == nil {
+		log.Panicf("webhook usecases have not initalized WEBHOOKS repository")
+	}
+}
+
+// Subscribe registers a webhook. The secret deliveries are signed with is
+// generated when none is given and is only returned here
+func (w *WebhookUsecases) Subscribe(
+	ctx context.Context,
+	owner string,
+	input dto.WebhookSubscriptionInput,
+) (*dto.WebhookSubscription, error) {
+	if err := input.Valid(); err != nil {
+		return nil, dto.Wrap(err, "Subscribe")
+	}
+
+	secret := input.Secret
+	if secret == "" {
+		var err error
+		secret, err = newSecret()
+		if err != nil {
+			return nil, dto.Wrap(err, "Subscribe")
+		}
+	}
+
+	sub := &domain.WebhookSubscription{
+		URL:        input.URL,
+		EventTypes: strings.Join(input.EventTypes, ","),
+		Secret:     secret,
+		CreatedBy:  owner,
+	}
+	if err := w.Webhooks.CreateSubscription(ctx, sub); err != nil {
+		return nil, dto.Wrap(err, "Subscribe")
+	}
+
+	created := dto.NewWebhookSubscription(*sub)
+	created.Secret = secret
+	return &created, nil
+}
+
+// Subscriptions lists the owner's webhook subscriptions
+func (w *WebhookUsecases) Subscriptions(
+	ctx context.Context,
+	owner string,
+) ([]dto.WebhookSubscription, error) {
+	subs, err := w.Webhooks.ListSubscriptions(ctx, owner)
+	if err != nil {
+		return nil, dto.Wrap(err, "Subscriptions")
+	}
+
+	results := make([]dto.WebhookSubscription, len(subs))
+	for i, sub := range subs {
+		results[i] = dto.NewWebhookSubscription(sub)
+	}
+	return results, nil
+}
+
+// Unsubscribe removes one of the owner's webhook subscriptions and its pending deliveries
+func (w *WebhookUsecases) Unsubscribe(
+	ctx context.Context,
+	owner string,
+	id uint64,
+) error {
+	if _, err := w.ownedSubscription(ctx, owner, id); err != nil {
+		return dto.Wrap(err, "Unsubscribe")
+	}
+
+	if err := w.Webhooks.DeleteSubscription(ctx, id); err != nil {
+		return dto.Wrap(err, "Unsubscribe")
+	}
+	return nil
+}
+
+// Deliveries lists the latest deliveries to one of the owner's webhook subscriptions
+func (w *WebhookUsecases) Deliveries(
+	ctx context.Context,
+	owner string,
+	id uint64,
+	limit int,
+) ([]domain.WebhookDelivery, error) {
+	if limit <= 0 || limit > MaxDeliveries {
+		limit = MaxDeliveries
+	}
+
+	if _, err := w.ownedSubscription(ctx, owner, id); err != nil {
+		return nil, dto.Wrap(err, "Deliveries")
+	}
+
+	deliveries, err := w.Webhooks.ListDeliveries(ctx, id, limit)
+	if err != nil {
+		return nil, dto.Wrap(err, "Deliveries")
+	}
+	return deliveries, nil
+}
+
+// ownedSubscription gets a subscription, which is not found unless the owner created it
+func (w *WebhookUsecases) ownedSubscription(
+	ctx context.Context,
+	owner string,
+	id uint64,
+) (*domain.WebhookSubscription, error) {
+	sub, err := w.Webhooks.GetSubscription(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if sub.CreatedBy != owner {
+		return nil, errSubscriptionNotFound
+	}
+	return sub, nil
+}
+
+func newSecret() (string, error) {
+	bs := make([]byte, 32)
+	if _, err := rand.Read(bs); err != nil {
+		return "", fmt.Errorf("failed to generate a webhook secret with err %v", err)
+	}
+	return "whsec_" + hex.EncodeToString(bs), nil
+}
@@ -0,0 +1,161 @@
+package usecases_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ageeknamedslickback/wallet-API/wallet/domain"
+	"github.com/ageeknamedslickback/wallet-API/wallet/dto"
+	"github.com/ageeknamedslickback/wallet-API/wallet/repository/mocks"
+	"github.com/ageeknamedslickback/wallet-API/wallet/usecases"
+)
+
+func TestWebhookUsecases_Subscribe(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      dto.WebhookSubscriptionInput
+		wantSecret string
+		wantErr    error
+	}{
+		{
+			name: "happy case - given secret",
+			input: dto.WebhookSubscriptionInput{
+				URL:        "https://partner.example.com/webhooks",
+				EventTypes: []string{domain.EventWalletCredited, domain.EventWalletDebited},
+				Secret:     "a-very-secret-secret",
+			},
+			wantSecret: "a-very-secret-secret",
+		},
+		{
+			name: "happy case - generated secret",
+			input: dto.WebhookSubscriptionInput{
+				URL:        "https://partner.example.com:8443/hooks",
+				EventTypes: []string{domain.EventWalletDebited},
+			},
+			wantSecret: "whsec_",
+		},
+		{
+			name: "sad case - plain http URL",
+			input: dto.WebhookSubscriptionInput{
+				URL:        "http://partner.example.com/webhooks",
+				EventTypes: []string{domain.EventWalletDebited},
+			},
+			wantErr: domain.ErrValidation,
+		},
+		{
+			name: "sad case - loopback URL",
+			input: dto.WebhookSubscriptionInput{
+				URL:        "https://localhost:9000/hooks",
+				EventTypes: []string{domain.EventWalletDebited},
+			},
+			wantErr: domain.ErrValidation,
+		},
+		{
+			name: "sad case - link local URL",
+			input: dto.WebhookSubscriptionInput{
+				URL:        "https://169.254.169.254/latest/meta-data",
+				EventTypes: []string{domain.EventWalletDebited},
+			},
+			wantErr: domain.ErrValidation,
+		},
+		{
+			name: "sad case - private URL",
+			input: dto.WebhookSubscriptionInput{
+				URL:        "https://[fd00::1]/hooks",
+				EventTypes: []string{domain.EventWalletDebited},
+			},
+			wantErr: domain.ErrValidation,
+		},
+		{
+			name: "sad case - relative URL",
+			input: dto.WebhookSubscriptionInput{
+				URL:        "/webhooks",
+				EventTypes: []string{domain.EventWalletDebited},
+			},
+			wantErr: domain.ErrValidation,
+		},
+		{
+			name: "sad case - unknown event type",
+			input: dto.WebhookSubscriptionInput{
+				URL:        "https://partner.example.com/webhooks",
+				EventTypes: []string{"wallet.opened"},
+			},
+			wantErr: domain.ErrValidation,
+		},
+		{
+			name: "sad case - short secret",
+			input: dto.WebhookSubscriptionInput{
+				URL:        "https://partner.example.com/webhooks",
+				EventTypes: []string{domain.EventWalletDebited},
+				Secret:     "short",
+			},
+			wantErr: domain.ErrValidation,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := usecases.NewWebhookUsecases(mocks.NewMockWebhooks())
+
+			sub, err := uc.Subscribe(ctx, "owner", tt.input)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Subscribe() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if sub.ID == 0 || !strings.HasPrefix(sub.Secret, tt.wantSecret) || len(sub.Secret) < dto.MinWebhookSecretLength {
+				t.Fatalf("unexpected subscription %+v", sub)
+			}
+			if strings.Join(sub.EventTypes, ",") != strings.Join(tt.input.EventTypes, ",") {
+				t.Fatalf("expected event types %v but got %v", tt.input.EventTypes, sub.EventTypes)
+			}
+		})
+	}
+}
+
+func TestWebhookUsecases_Deliveries(t *testing.T) {
+	tests := []struct {
+		name    string
+		owner   string
+		id      uint64
+		wantErr error
+	}{
+		{
+			name:  "happy case - owner",
+			owner: "owner",
+			id:    1,
+		},
+		{
+			name:    "sad case - another owner's subscription",
+			owner:   "intruder",
+			id:      1,
+			wantErr: domain.ErrNotFound,
+		},
+		{
+			name:    "sad case - no such subscription",
+			owner:   "owner",
+			id:      404,
+			wantErr: domain.ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := usecases.NewWebhookUsecases(mocks.NewMockWebhooks())
+
+			deliveries, err := uc.Deliveries(ctx, tt.owner, tt.id, 10)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Deliveries() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && len(deliveries) == 0 {
+				t.Fatalf("expected the subscription's deliveries")
+			}
+
+			err = uc.Unsubscribe(ctx, tt.owner, tt.id)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Unsubscribe() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}